@@ -58,6 +58,7 @@ func migrate() error {
 		&models.UserSession{},
 		&models.UserLoginLog{},
 		&models.UserOTPRecord{},
+		&models.WebAuthnCredential{},
 		&models.AuditLog{},
 		&models.Organization{},
 		&models.Role{},
@@ -67,12 +68,13 @@ func migrate() error {
 		&models.SystemSetting{},
 	}
 
-	// Phase 2 tables (commented for now)
-	// oauth2Tables := []interface{}{
-	// 	&models.OAuth2AuthorizationCode{},
-	// 	&models.OAuth2AccessToken{},
-	// 	&models.SAMLAssertion{},
-	// }
+	// OAuth2/OIDC/SAML tables
+	protocolTables := []interface{}{
+		&models.OAuth2AuthorizationCode{},
+		&models.OAuth2AccessToken{},
+		&models.SigningKey{},
+		&models.SAMLAssertion{},
+	}
 
 	logger.ServiceInfo("Starting core table migration")
 	for i, table := range coreTables {
@@ -82,6 +84,14 @@ func migrate() error {
 		}
 	}
 
+	logger.ServiceInfo("Starting protocol table migration")
+	for i, table := range protocolTables {
+		logger.ServiceInfo(fmt.Sprintf("Migrating protocol table %d/%d", i+1, len(protocolTables)))
+		if err := database.DB.AutoMigrate(table); err != nil {
+			return fmt.Errorf("protocol table migration failed: %v", err)
+		}
+	}
+
 	// Re-enable foreign key checks
 	if err := database.DB.Exec("SET FOREIGN_KEY_CHECKS = 1").Error; err != nil {
 		return fmt.Errorf("failed to enable foreign key checks: %v", err)
@@ -40,14 +40,14 @@ func main() {
 	}
 
 	// Execute seeding
-	if err := seed(); err != nil {
+	if err := seed(utils.NewPasswordHasher(&cfg.Encryption)); err != nil {
 		logger.ErrorFatal("Database seeding failed", zap.Error(err))
 	}
 
 	logger.ServiceInfo("Database seeding completed")
 }
 
-func seed() error {
+func seed(hasher *utils.PasswordHasher) error {
 	// 禁用外键检查
 	if err := database.DB.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
 		return fmt.Errorf("failed to disable foreign key checks: %v", err)
@@ -96,7 +96,7 @@ func seed() error {
 		return fmt.Errorf("failed to check existing user: %v", err)
 	} else {
 		// 创建新用户
-		hashedPassword, err := utils.HashPassword("admin123", 12)
+		hashedPassword, err := hasher.Hash("admin123")
 		if err != nil {
 			return fmt.Errorf("failed to hash password: %v", err)
 		}
@@ -14,6 +14,7 @@ import (
 	"eiam-platform/internal/router"
 	"eiam-platform/pkg/database"
 	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/notify"
 	"eiam-platform/pkg/redis"
 	"eiam-platform/pkg/utils"
 
@@ -56,12 +57,31 @@ func main() {
 		// 不中断启动，SAML功能可能不可用
 	}
 
+	// Initialize OIDC provider signing keys
+	if err := handlers.InitOIDCProvider(); err != nil {
+		logger.ErrorWarn("OIDC provider initialization failed", zap.Error(err))
+		// 不中断启动，ID Token签发不可用
+	}
+
 	// Initialize CAS using improved implementation
 	if err := handlers.InitCASImproved(); err != nil {
 		logger.ErrorWarn("CAS improved initialization failed", zap.Error(err))
 		// 不中断启动，CAS功能可能不可用
 	}
 
+	// Initialize notification channels
+	if err := notify.InitNotify(&cfg.Notification); err != nil {
+		logger.ErrorWarn("Notification initialization failed", zap.Error(err))
+		// 不中断启动，邮件和短信验证码不可用
+	}
+	handlers.StartPasswordExpiryReminder()
+
+	// Load breached and common password screening dataset
+	if err := handlers.InitPasswordScreening(); err != nil {
+		logger.ErrorWarn("Password screening initialization failed", zap.Error(err))
+		// 不中断启动，只使用内置的常见密码列表
+	}
+
 	// Setup router
 	r := router.SetupRouter(cfg, jwtManager)
 
@@ -44,14 +44,14 @@ func main() {
 	}
 
 	// Update password
-	if err := updatePassword(username, newPassword); err != nil {
+	if err := updatePassword(username, newPassword, utils.NewPasswordHasher(&cfg.Encryption)); err != nil {
 		logger.ErrorFatal("Password update failed", zap.Error(err))
 	}
 
 	logger.ServiceInfo("Password update completed")
 }
 
-func updatePassword(username, password string) error {
+func updatePassword(username, password string, hasher *utils.PasswordHasher) error {
 	var user models.User
 	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -60,8 +60,8 @@ func updatePassword(username, password string) error {
 		return fmt.Errorf("failed to find user: %v", err)
 	}
 
-	// 生成新的MD5密码
-	hashedPassword, err := utils.HashPassword(password, 12)
+	// 使用配置的算法生成密码哈希
+	hashedPassword, err := hasher.Hash(password)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %v", err)
 	}
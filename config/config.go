@@ -18,6 +18,9 @@ type Config struct {
 	CORS       CORSConfig       `mapstructure:"cors"`
 	Login      LoginConfig      `mapstructure:"login"`
 	IdP        IdPConfig        `mapstructure:"idp"`
+
+	Notification      NotificationConfig      `mapstructure:"notification"`
+	PasswordScreening PasswordScreeningConfig `mapstructure:"password_screening"`
 }
 
 // ServerConfig 服务器配置
@@ -74,7 +77,12 @@ type LogConfig struct {
 
 // EncryptionConfig 加密配置
 type EncryptionConfig struct {
-	BcryptCost int `mapstructure:"bcrypt_cost"`
+	PasswordHash      string `mapstructure:"password_hash"`      // 新密码的哈希算法：argon2id(默认)或bcrypt
+	Argon2Memory      int    `mapstructure:"argon2_memory"`      // argon2id内存（KiB）
+	Argon2Iterations  int    `mapstructure:"argon2_iterations"`  // argon2id迭代次数
+	Argon2Parallelism int    `mapstructure:"argon2_parallelism"` // argon2id并行度
+	BcryptCost        int    `mapstructure:"bcrypt_cost"`
+	KeyEncryptionKey  string `mapstructure:"key_encryption_key"` // 数据库中私钥等敏感数据的加密密钥，未配置时使用JWT密钥
 }
 
 // CORSConfig CORS配置
@@ -89,19 +97,141 @@ type CORSConfig struct {
 
 // LoginConfig 登录配置
 type LoginConfig struct {
-	DefaultMethod    string `mapstructure:"default_method"`
-	EnableOTP        bool   `mapstructure:"enable_otp"`
-	EnableThirdParty bool   `mapstructure:"enable_third_party"`
+	DefaultMethod    string         `mapstructure:"default_method"`
+	EnableOTP        bool           `mapstructure:"enable_otp"`
+	EnableThirdParty bool           `mapstructure:"enable_third_party"`
+	WebAuthn         WebAuthnConfig `mapstructure:"webauthn"`
+	OTPCode          OTPCodeConfig  `mapstructure:"otp_code"`
+	Lockout          LockoutConfig  `mapstructure:"lockout"`
+
+	PasswordEncryption PasswordEncryptionConfig `mapstructure:"password_encryption"`
+	StepUp             StepUpConfig             `mapstructure:"step_up"`
+	Impersonation      ImpersonationConfig      `mapstructure:"impersonation"`
+}
+
+// ImpersonationConfig 管理员代登录配置，时间单位为秒
+type ImpersonationConfig struct {
+	Enabled     bool `mapstructure:"enabled"`
+	Duration    int  `mapstructure:"duration"`     // 默认会话时长，默认900
+	MaxDuration int  `mapstructure:"max_duration"` // 管理员可申请的最长时长，默认3600
+	AllowWrite  bool `mapstructure:"allow_write"`  // 是否允许管理员申请可写的代登录会话
+}
+
+// StepUpConfig 敏感操作重新认证配置，时间单位为秒
+type StepUpConfig struct {
+	Window int `mapstructure:"window"` // 重新认证后会话保持提升状态的时长，默认300
+}
+
+// PasswordEncryptionConfig 登录密码加密配置，时间单位为秒，未配置时使用默认值
+type PasswordEncryptionConfig struct {
+	Required         bool `mapstructure:"required"`          // 是否拒绝明文密码
+	RotationInterval int  `mapstructure:"rotation_interval"` // 加密密钥轮换间隔
+	GracePeriod      int  `mapstructure:"grace_period"`      // 轮换后旧密钥继续接受的时长
+}
+
+// LockoutConfig 登录失败限制的补充配置，账户的失败次数和锁定时长在安全设置中配置
+type LockoutConfig struct {
+	IPMaxAttempts     int `mapstructure:"ip_max_attempts"`      // 同一IP在锁定时长内对所有账户的失败次数上限
+	IPUserMaxAttempts int `mapstructure:"ip_user_max_attempts"` // 同一IP对同一账户的失败次数上限，0表示与账户上限相同
+	DelayAfter        int `mapstructure:"delay_after"`          // 同一IP对同一账户失败多少次后开始延迟
+	BaseDelay         int `mapstructure:"base_delay"`           // 首次延迟（秒），之后每次失败翻倍
+	MaxDelay          int `mapstructure:"max_delay"`            // 最大延迟（秒）
+}
+
+// OTPCodeConfig 邮件/短信动态码配置，时间单位为秒，未配置时使用默认值
+type OTPCodeConfig struct {
+	Length                 int `mapstructure:"length"`                   // 动态码位数
+	TTL                    int `mapstructure:"ttl"`                      // 有效期
+	MaxAttempts            int `mapstructure:"max_attempts"`             // 每个动态码允许的校验次数
+	ResendInterval         int `mapstructure:"resend_interval"`          // 同一用户两次发送的最小间隔
+	UserHourlyLimit        int `mapstructure:"user_hourly_limit"`        // 每个用户每小时最多发送次数
+	DestinationHourlyLimit int `mapstructure:"destination_hourly_limit"` // 每个邮箱/手机号每小时最多接收次数
+}
+
+// WebAuthnConfig WebAuthn依赖方配置，未配置时从idp.base_url推导
+type WebAuthnConfig struct {
+	RPID    string   `mapstructure:"rp_id"`   // 依赖方ID，必须是页面域名或其父域名
+	RPName  string   `mapstructure:"rp_name"` // 认证器中显示的名称，默认使用站点名称
+	Origins []string `mapstructure:"origins"` // 允许的页面源，如https://iam.example.com
+	Timeout int      `mapstructure:"timeout"` // 注册和认证仪式超时（秒）
 }
 
 // IdPConfig IdP配置（用于对接外部SP）
 type IdPConfig struct {
-	BaseURL               string `mapstructure:"base_url"`
-	DefaultSessionTimeout int    `mapstructure:"default_session_timeout"`
-	MaxConcurrentSessions int    `mapstructure:"max_concurrent_sessions"`
-	EnableSingleLogout    bool   `mapstructure:"enable_single_logout"`
-	EnableRememberMe      bool   `mapstructure:"enable_remember_me"`
-	RememberMeDuration    int    `mapstructure:"remember_me_duration"`
+	BaseURL               string        `mapstructure:"base_url"`
+	DefaultSessionTimeout int           `mapstructure:"default_session_timeout"`
+	MaxConcurrentSessions int           `mapstructure:"max_concurrent_sessions"`
+	EnableSingleLogout    bool          `mapstructure:"enable_single_logout"`
+	EnableRememberMe      bool          `mapstructure:"enable_remember_me"`
+	RememberMeDuration    int           `mapstructure:"remember_me_duration"`
+	SAML                  SAMLKeyConfig `mapstructure:"saml"`
+	CAS                   CASConfig     `mapstructure:"cas"`
+}
+
+// CASConfig CAS票据存储配置，TTL单位为秒，未配置时使用默认值
+type CASConfig struct {
+	TicketRegistry          string `mapstructure:"ticket_registry"`            // redis(默认，支持多实例), memory(仅单实例)
+	ServiceTicketTTL        int    `mapstructure:"service_ticket_ttl"`         // ST有效期
+	ProxyTicketTTL          int    `mapstructure:"proxy_ticket_ttl"`           // PT有效期
+	ProxyGrantingTicketTTL  int    `mapstructure:"proxy_granting_ticket_ttl"`  // PGT有效期
+	TicketGrantingTicketTTL int    `mapstructure:"ticket_granting_ticket_ttl"` // TGT(CAS登录会话)有效期
+	CleanupInterval         int    `mapstructure:"cleanup_interval"`           // 票据表清理间隔
+}
+
+// SAMLKeyConfig SAML IdP签名密钥配置，配置后优先于数据库中的密钥且不参与轮换
+type SAMLKeyConfig struct {
+	Certificate     string `mapstructure:"certificate"`      // PEM格式证书
+	PrivateKey      string `mapstructure:"private_key"`      // PEM格式私钥
+	CertificateFile string `mapstructure:"certificate_file"` // 证书文件路径
+	PrivateKeyFile  string `mapstructure:"private_key_file"` // 私钥文件路径
+}
+
+// PasswordScreeningConfig 泄露/常见密码筛查配置，数据文件可在控制台重新加载
+type PasswordScreeningConfig struct {
+	Files             []string `mapstructure:"files"`               // 每行一个SHA-1（可带":出现次数"）或禁用词
+	MinOccurrences    int      `mapstructure:"min_occurrences"`     // 跳过HIBP出现次数低于该值的哈希
+	FalsePositiveRate float64  `mapstructure:"false_positive_rate"` // 布隆过滤器误判率，默认0.001
+}
+
+// NotificationConfig 通知渠道配置
+type NotificationConfig struct {
+	LogFile string      `mapstructure:"log_file"` // log驱动的输出文件，为空时写入服务日志
+	Email   EmailConfig `mapstructure:"email"`
+	SMS     SMSConfig   `mapstructure:"sms"`
+
+	PasswordExpiryReminder PasswordExpiryReminderConfig `mapstructure:"password_expiry_reminder"`
+}
+
+// PasswordExpiryReminderConfig 密码过期前的邮件提醒
+type PasswordExpiryReminderConfig struct {
+	Enabled       bool  `mapstructure:"enabled"`
+	DaysBefore    []int `mapstructure:"days_before"`    // 提前提醒的天数，如[14, 7, 1]，每个节点只提醒一次
+	CheckInterval int   `mapstructure:"check_interval"` // 检查间隔（秒），默认1小时
+}
+
+// EmailConfig 邮件渠道配置
+type EmailConfig struct {
+	Driver     string `mapstructure:"driver"` // smtp, log(仅开发环境)
+	Host       string `mapstructure:"host"`
+	Port       int    `mapstructure:"port"`
+	Username   string `mapstructure:"username"`
+	Password   string `mapstructure:"password"`
+	From       string `mapstructure:"from"`       // 发件人，如"EIAM <noreply@example.com>"
+	Encryption string `mapstructure:"encryption"` // starttls(默认), tls, none
+	Timeout    int    `mapstructure:"timeout"`    // 连接和发送超时（秒）
+}
+
+// SMSConfig 短信渠道配置，http驱动把消息提交给短信网关的HTTP接口
+type SMSConfig struct {
+	Driver       string            `mapstructure:"driver"`        // http, log(仅开发环境)
+	URL          string            `mapstructure:"url"`           // 网关地址
+	Method       string            `mapstructure:"method"`        // 默认POST
+	ContentType  string            `mapstructure:"content_type"`  // json(默认), form
+	Headers      map[string]string `mapstructure:"headers"`       // 附加请求头，如鉴权信息
+	ToField      string            `mapstructure:"to_field"`      // 手机号字段名，默认to
+	MessageField string            `mapstructure:"message_field"` // 短信内容字段名，默认message
+	Params       map[string]string `mapstructure:"params"`        // 附加的固定参数，如签名、模板ID
+	Timeout      int               `mapstructure:"timeout"`       // 请求超时（秒）
 }
 
 var AppConfig *Config
@@ -6,6 +6,8 @@ export interface AuditLog {
   id: string
   user_id: string
   username: string
+  actor_id?: string // administrator who acted while impersonating the user
+  actor?: string
   action: string
   resource: string
   resource_id: string
@@ -43,6 +45,11 @@ export interface UserSession {
   last_activity: string
   expires_at: string
   is_active: boolean
+  impersonated: boolean
+  impersonator_id?: string
+  impersonator_username?: string
+  impersonation_reason?: string
+  read_only?: boolean
 }
 
 export interface AuditListResponse extends PaginatedResponse<AuditLog> {}
@@ -54,6 +61,7 @@ export const auditApi = {
   // Get operation audit logs
   getOperationLogs: (params: PaginationParams & {
     user_id?: string
+    actor_id?: string
     action?: string
     resource?: string
     start_date?: string
@@ -64,6 +72,7 @@ export const auditApi = {
     queryParams.append('page_size', params.page_size.toString())
     
     if (params.user_id) queryParams.append('user_id', params.user_id)
+    if (params.actor_id) queryParams.append('actor_id', params.actor_id)
     if (params.action) queryParams.append('action', params.action)
     if (params.resource) queryParams.append('resource', params.resource)
     if (params.start_date) queryParams.append('start_date', params.start_date)
@@ -118,6 +127,11 @@ export const auditApi = {
     return http.delete(`/console/sessions/users/${userId}`)
   },
 
+  // End an impersonation session
+  endImpersonation: (sessionId: string) => {
+    return http.delete(`/console/sessions/impersonations/${sessionId}`)
+  },
+
   // Terminate all sessions for all users
   terminateAllSessions: () => {
     return http.post(`/console/sessions/force-logout-all`)
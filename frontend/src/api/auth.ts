@@ -1,5 +1,10 @@
 import { http } from './request'
-import type { LoginRequest, LoginResponse, RefreshTokenRequest, RefreshTokenResponse } from '@/types/api'
+import type { ChangePasswordRequest, LoginKey, LoginRequest, LoginResponse, ReauthRequest, ReauthResponse, RefreshTokenRequest, RefreshTokenResponse } from '@/types/api'
+
+// Get the current sign-in encryption key
+export const getLoginKey = (): Promise<LoginKey> => {
+  return http.get<LoginKey>('/public/login-key')
+}
 
 // Login API
 export const login = (data: LoginRequest): Promise<LoginResponse> => {
@@ -11,6 +16,26 @@ export const refreshToken = (data: RefreshTokenRequest): Promise<RefreshTokenRes
   return http.post<RefreshTokenResponse>('/console/auth/refresh', data)
 }
 
+// Console and portal sessions re-authenticate through their own endpoints
+export type AuthScope = 'console' | 'portal'
+
+// Re-authenticate the current session before a sensitive operation
+export const reauth = (data: ReauthRequest, scope: AuthScope = 'console'): Promise<ReauthResponse> => {
+  return http.post<ReauthResponse>(`/${scope}/auth/reauth`, data)
+}
+
+// Get WebAuthn assertion options for re-authentication
+export const reauthWebAuthnBegin = (scope: AuthScope = 'console'): Promise<any> => {
+  return http.post(`/${scope}/auth/reauth/webauthn/begin`)
+}
+
+// Change an expired password with the restricted token returned by login
+export const changePasswordWithToken = (token: string, data: ChangePasswordRequest): Promise<void> => {
+  return http.put('/portal/password/change', data, {
+    headers: { Authorization: `Bearer ${token}` }
+  })
+}
+
 // Logout API
 export const logout = (): Promise<void> => {
   return http.post('/console/auth/logout')
@@ -3,6 +3,7 @@ import { message } from 'ant-design-vue'
 import type { ApiResponse } from '@/types/api'
 import router from '@/router'
 import { TokenManager } from '@/utils/storage'
+import { requestReauth, reauthScope } from '@/utils/reauth'
 
 // Create axios instance
 const request: AxiosInstance = axios.create({
@@ -21,8 +22,9 @@ request.interceptors.request.use(
     config.headers['X-Trade-ID'] = tradeId
 
     // Add authorization token - 使用安全存储获取token
+    // 调用方显式指定的令牌（如修改过期密码的受限令牌）优先
     const token = TokenManager.getAccessToken()
-    if (token) {
+    if (token && !config.headers.Authorization) {
       config.headers.Authorization = `Bearer ${token}`
     }
 
@@ -73,7 +75,26 @@ request.interceptors.response.use(
     if (error.response) {
       const { status, data } = error.response
       
-      if (status === 401 && !originalRequest._retry) {
+      // Step-up challenge: the session is still valid, ask the user to re-authenticate and retry once
+      if (status === 401 && data?.data?.reauth_required) {
+        if (!originalRequest._reauth) {
+          originalRequest._reauth = true
+          try {
+            await requestReauth(reauthScope(originalRequest.url), data.data.factors)
+            return request(originalRequest)
+          } catch {
+            // 用户取消重新认证，按原错误返回给调用方
+          }
+        }
+        const reauthError = new Error(data.message || 'Re-authentication required')
+        ;(reauthError as any).code = data.code
+        ;(reauthError as any).data = data.data
+        return Promise.reject(reauthError)
+      }
+      
+      // Failed re-authentication is a wrong credential, not an expired session
+      const isReauthRequest = originalRequest.url?.includes('/auth/reauth')
+      if (status === 401 && !originalRequest._retry && !isReauthRequest) {
         if (isRefreshing) {
           // If we're already refreshing, queue this request
           return new Promise((resolve, reject) => {
@@ -58,14 +58,6 @@ export interface SystemSettings {
 }
 
 export interface SecuritySettings {
-  min_password_length: number
-  max_password_length: number
-  password_expiry_days: number
-  require_uppercase: boolean
-  require_lowercase: boolean
-  require_numbers: boolean
-  require_special_chars: boolean
-  password_history_count: number
   session_timeout: number
   max_concurrent_sessions: number
   remember_me_days: number
@@ -75,10 +67,20 @@ export interface SecuritySettings {
   enable_totp: boolean
   enable_sms: boolean
   enable_email: boolean
+  enable_webauthn: boolean
   max_login_attempts: number
   lockout_duration: number
+  withhold_unverified_email: boolean
 }
 
+export interface RateLimitRule {
+  enabled: boolean
+  limit: number
+  window: number
+}
+
+export type RateLimitSettings = Record<string, RateLimitRule>
+
 export interface AdministratorInfo {
   id: string
   username: string
@@ -227,6 +229,16 @@ export const systemApi = {
     return http.put<SecuritySettings>('/console/system/security-settings', data)
   },
 
+  // Get rate limit settings
+  getRateLimitSettings: () => {
+    return http.get<RateLimitSettings>('/console/system/rate-limit-settings')
+  },
+
+  // Update rate limit settings
+  updateRateLimitSettings: (data: RateLimitSettings) => {
+    return http.put('/console/system/rate-limit-settings', data)
+  },
+
   // Upload logo
   uploadLogo: (formData: FormData) => {
     return http.post('/console/system/upload-logo', formData, {
@@ -249,8 +261,44 @@ export const systemApi = {
     return http.post('/console/password-policy/validate', data)
   },
 
-  generatePassword: () => {
-    return http.post('/console/password-policy/generate')
+  generatePassword: (params?: { user_id?: string; organization_id?: string }) => {
+    return http.post('/console/password-policy/generate', undefined, { params })
+  },
+
+  // Organization and role password policies
+  getScopedPasswordPolicies: (params?: { scope?: 'organization' | 'role'; scope_id?: string }) => {
+    return http.get('/console/password-policy/policies', { params })
+  },
+
+  createScopedPasswordPolicy: (data: any) => {
+    return http.post('/console/password-policy/policies', data)
+  },
+
+  updateScopedPasswordPolicy: (id: string, data: any) => {
+    return http.put(`/console/password-policy/policies/${id}`, data)
+  },
+
+  deleteScopedPasswordPolicy: (id: string) => {
+    return http.delete(`/console/password-policy/policies/${id}`)
+  },
+
+  // Policy that applies to a user: role > organization > global
+  getEffectivePasswordPolicy: (userId: string) => {
+    return http.get(`/console/password-policy/effective/${userId}`)
+  },
+
+  // Count users by password hash scheme
+  getPasswordHashReport: () => {
+    return http.get('/console/password-policy/hash-report')
+  },
+
+  // Breached and common password dataset
+  getPasswordScreening: () => {
+    return http.get('/console/password-policy/screening')
+  },
+
+  reloadPasswordScreening: () => {
+    return http.post('/console/password-policy/screening/reload')
   }
 }
 
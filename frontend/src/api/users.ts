@@ -27,6 +27,28 @@ export interface UpdateUserRequest {
 
 export interface UserListResponse extends PaginatedResponse<User> {}
 
+export interface ImpersonateUserRequest {
+  reason: string
+  duration?: number // seconds
+  allow_write?: boolean
+}
+
+export interface ImpersonateUserResponse {
+  access_token: string
+  token_type: string
+  expires_in: number
+  expires_at: string
+  session_id: string
+  read_only: boolean
+  user: {
+    id: string
+    username: string
+    email: string
+    display_name: string
+    roles: string[]
+  }
+}
+
 // User API methods
 export const userApi = {
   // Get user list
@@ -64,5 +86,10 @@ export const userApi = {
   // Delete user
   deleteUser: (id: string) => {
     return http.delete(`/console/users/${id}`)
+  },
+
+  // Sign in to the portal as the user, read-only unless allow_write is permitted by the server
+  impersonateUser: (id: string, data: ImpersonateUserRequest) => {
+    return http.post<ImpersonateUserResponse>(`/console/users/${id}/impersonate`, data)
   }
 }
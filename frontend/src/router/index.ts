@@ -15,6 +15,12 @@ const routes: RouteRecordRaw[] = [
     component: () => import('@/views/Login.vue'),
     meta: { title: 'Login', requiresAuth: false }
   },
+  {
+    path: '/change-password',
+    name: 'ChangePassword',
+    component: () => import('@/views/ChangePassword.vue'),
+    meta: { title: 'Change Password', requiresAuth: false }
+  },
   {
     path: '/console',
     component: () => import('@/views/Console.vue'),
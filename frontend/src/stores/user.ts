@@ -1,8 +1,9 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import type { User } from '@/types/api'
-import { login as loginAPI, logout as logoutAPI, refreshToken as refreshTokenAPI, getCurrentUser as getCurrentUserAPI } from '@/api/auth'
+import { login as loginAPI, getLoginKey as getLoginKeyAPI, logout as logoutAPI, refreshToken as refreshTokenAPI, getCurrentUser as getCurrentUserAPI, changePasswordWithToken as changePasswordWithTokenAPI } from '@/api/auth'
 import { TokenManager, UserInfoManager } from '@/utils/storage'
+import { encryptLoginPassword } from '@/utils/crypto'
 import { useSiteStore } from '@/stores/site'
 
 export const useUserStore = defineStore('user', () => {
@@ -11,6 +12,8 @@ export const useUserStore = defineStore('user', () => {
   const token = ref<string | null>(TokenManager.getAccessToken())
   const refreshToken = ref<string | null>(TokenManager.getRefreshToken())
   const sessionId = ref<string | null>(null)
+  // 密码过期时登录返回的受限令牌，只保存在内存中，用于修改密码页面
+  const passwordChange = ref<{ token: string; reason?: string; username: string } | null>(null)
   
   console.log('用户store初始化:', {
     user: user.value,
@@ -64,13 +67,27 @@ export const useUserStore = defineStore('user', () => {
 
   const login = async (username: string, password: string, otpCode?: string) => {
     try {
-      // 不加密密码，直接发送明文（HTTPS保证传输安全）
+      // 使用服务端发布的登录公钥加密密码，每次提交都重新加密
+      const loginKey = await getLoginKeyAPI()
       const response = await loginAPI({
         username,
-        password: password,
+        encrypted_password: await encryptLoginPassword(password, loginKey.public_key),
+        key_id: loginKey.kid,
         otp_code: otpCode
       })
       
+      // 密码已过期或被要求修改：不保存令牌，由调用方跳转到修改密码页面
+      if (response.require_password_change && response.password_change_token) {
+        clearAuth()
+        passwordChange.value = {
+          token: response.password_change_token,
+          reason: response.password_change_reason,
+          username: response.user?.username || username
+        }
+        return response
+      }
+      passwordChange.value = null
+
       // response is already the data from the API (due to interceptor)
       const { access_token, refresh_token, user: userData, session_id } = response
       setToken(access_token, refresh_token)
@@ -127,6 +144,18 @@ export const useUserStore = defineStore('user', () => {
     }
   }
 
+  // 使用受限令牌修改密码，成功后需要使用新密码重新登录
+  const changeExpiredPassword = async (currentPassword: string, newPassword: string) => {
+    if (!passwordChange.value) {
+      throw new Error('Password change session expired, please sign in again')
+    }
+    await changePasswordWithTokenAPI(passwordChange.value.token, {
+      current_password: currentPassword,
+      new_password: newPassword
+    })
+    passwordChange.value = null
+  }
+
   const getCurrentUser = async () => {
     try {
       const response = await getCurrentUserAPI()
@@ -144,6 +173,7 @@ export const useUserStore = defineStore('user', () => {
     token,
     refreshToken,
     sessionId,
+    passwordChange,
     
     // Getters
     isLoggedIn,
@@ -158,6 +188,7 @@ export const useUserStore = defineStore('user', () => {
     login,
     logout,
     refreshTokenAction,
-    getCurrentUser
+    getCurrentUser,
+    changeExpiredPassword
   }
 })
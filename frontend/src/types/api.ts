@@ -117,10 +117,20 @@ export interface Application {
 // Login types
 export interface LoginRequest {
   username: string
-  password: string
+  password?: string
+  encrypted_password?: string
+  key_id?: string
   otp_code?: string
 }
 
+export interface LoginKey {
+  kid: string
+  alg: string
+  public_key: string
+  expires_at: string
+  required: boolean
+}
+
 export interface LoginResponse {
   access_token: string
   refresh_token: string
@@ -129,12 +139,36 @@ export interface LoginResponse {
   user: User
   require_otp: boolean
   session_id?: string
+  // 密码过期或被要求修改时只返回受限令牌，只能用于修改密码
+  require_password_change?: boolean
+  password_change_reason?: 'expired' | 'admin_required'
+  password_change_token?: string
+}
+
+export interface ChangePasswordRequest {
+  current_password: string
+  new_password: string
+  logout_other_sessions?: boolean
 }
 
 export interface RefreshTokenRequest {
   refresh_token: string
 }
 
+export interface ReauthRequest {
+  password?: string
+  encrypted_password?: string
+  key_id?: string
+  otp_code?: string
+  webauthn?: any
+}
+
+export interface ReauthResponse {
+  auth_time: number
+  amr: string[]
+  expires_at: string
+}
+
 export interface RefreshTokenResponse {
   access_token: string
   refresh_token: string
@@ -1,56 +1,28 @@
 import CryptoJS from 'crypto-js'
 
-// 加密密钥（应该从环境变量或配置中获取）
-const ENCRYPTION_KEY = 'eiam-platform-2024'
-
 /**
- * 加密密码
+ * 使用登录公钥加密密码（RSA-OAEP SHA-256）
+ * 载荷中带随机nonce，同一个密文只能提交一次
  * @param password 原始密码
- * @returns 加密后的密码
+ * @param publicKey 登录公钥（SPKI DER的base64）
+ * @returns base64编码的密文
  */
-export function encryptPassword(password: string): string {
-  try {
-    // 使用MD5加密
-    console.log('Encrypting password:', password)
-    const encrypted = CryptoJS.MD5(password).toString()
-    console.log('Encrypted password:', encrypted)
-    return encrypted
-  } catch (error) {
-    console.error('Password encryption failed:', error)
-    // 如果加密失败，返回原始密码（不推荐，但确保功能可用）
-    return password
-  }
-}
+export async function encryptLoginPassword(password: string, publicKey: string): Promise<string> {
+  const der = Uint8Array.from(atob(publicKey), c => c.charCodeAt(0))
+  const key = await window.crypto.subtle.importKey(
+    'spki',
+    der,
+    { name: 'RSA-OAEP', hash: 'SHA-256' },
+    false,
+    ['encrypt']
+  )
 
-/**
- * 解密密码（仅用于测试，生产环境不应解密）
- * @param encryptedPassword 加密后的密码
- * @returns 解密后的密码
- */
-export function decryptPassword(encryptedPassword: string): string {
-  try {
-    const key = CryptoJS.enc.Utf8.parse(ENCRYPTION_KEY)
-    const rawData = CryptoJS.enc.Base64.parse(encryptedPassword)
-    
-    // 提取IV (前16字节)
-    const iv = CryptoJS.lib.WordArray.create(rawData.words.slice(0, 4))
-    const ciphertext = CryptoJS.lib.WordArray.create(rawData.words.slice(4))
-    
-    const decrypted = CryptoJS.AES.decrypt(
-      CryptoJS.lib.CipherParams.create({ ciphertext: ciphertext }),
-      key,
-      {
-        iv: iv,
-        mode: CryptoJS.mode.CBC,
-        padding: CryptoJS.pad.Pkcs7
-      }
-    )
-    
-    return decrypted.toString(CryptoJS.enc.Utf8)
-  } catch (error) {
-    console.error('Password decryption failed:', error)
-    return encryptedPassword
-  }
+  const nonceBytes = window.crypto.getRandomValues(new Uint8Array(16))
+  const nonce = Array.from(nonceBytes, b => b.toString(16).padStart(2, '0')).join('')
+  const payload = new TextEncoder().encode(JSON.stringify({ password, nonce }))
+
+  const encrypted = await window.crypto.subtle.encrypt({ name: 'RSA-OAEP' }, key, payload)
+  return btoa(String.fromCharCode(...new Uint8Array(encrypted)))
 }
 
 /**
@@ -0,0 +1,60 @@
+import { createApp } from 'vue'
+import Antd from 'ant-design-vue'
+import ReauthDialog from '@/components/ReauthDialog.vue'
+import type { AuthScope } from '@/api/auth'
+
+/**
+ * 敏感操作要求重新认证时弹出认证对话框
+ * 同一时间只显示一个对话框，并发的请求共享同一次认证结果
+ */
+let pending: Promise<void> | null = null
+
+/**
+ * 根据请求地址判断使用管理端还是门户的重新认证接口
+ * @param url 原始请求地址
+ */
+export const reauthScope = (url?: string): AuthScope => {
+  return url?.replace(/^\/api\/v1/, '').startsWith('/portal') ? 'portal' : 'console'
+}
+
+/**
+ * 显示重新认证对话框
+ * @param scope 认证接口所属的端
+ * @param factors 服务端要求的认证方式
+ * @returns 认证成功时resolve，用户取消时reject
+ */
+export function requestReauth(scope: AuthScope, factors?: string[]): Promise<void> {
+  if (pending) {
+    return pending
+  }
+
+  pending = new Promise<void>((resolve, reject) => {
+    const container = document.createElement('div')
+    document.body.appendChild(container)
+
+    const close = () => {
+      // 等待关闭动画结束后卸载
+      setTimeout(() => {
+        app.unmount()
+        container.remove()
+      }, 300)
+      pending = null
+    }
+
+    const app = createApp(ReauthDialog, {
+      scope,
+      factors,
+      onSuccess: () => {
+        close()
+        resolve()
+      },
+      onCancel: () => {
+        close()
+        reject(new Error('Re-authentication cancelled'))
+      }
+    })
+    app.use(Antd)
+    app.mount(container)
+  })
+  return pending
+}
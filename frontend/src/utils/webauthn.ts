@@ -0,0 +1,55 @@
+/**
+ * WebAuthn辅助函数
+ * 服务端以base64url编码二进制字段，这里负责与ArrayBuffer互相转换
+ */
+
+const base64urlToBuffer = (value: string): ArrayBuffer => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/')
+  const padded = base64 + '='.repeat((4 - (base64.length % 4)) % 4)
+  return Uint8Array.from(atob(padded), c => c.charCodeAt(0)).buffer
+}
+
+const bufferToBase64url = (buffer: ArrayBuffer): string => {
+  let binary = ''
+  new Uint8Array(buffer).forEach(b => {
+    binary += String.fromCharCode(b)
+  })
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+}
+
+/**
+ * 浏览器是否支持WebAuthn
+ */
+export const webAuthnSupported = (): boolean => {
+  return typeof window !== 'undefined' && !!window.PublicKeyCredential
+}
+
+/**
+ * 使用服务端返回的断言参数调用navigator.credentials.get
+ * @param options 服务端返回的 { publicKey } 参数
+ * @returns 可直接提交给服务端的断言
+ */
+export async function getWebAuthnAssertion(options: any): Promise<any> {
+  const publicKey = {
+    ...options.publicKey,
+    challenge: base64urlToBuffer(options.publicKey.challenge),
+    allowCredentials: (options.publicKey.allowCredentials || []).map((credential: any) => ({
+      ...credential,
+      id: base64urlToBuffer(credential.id)
+    }))
+  }
+
+  const credential = (await navigator.credentials.get({ publicKey })) as PublicKeyCredential
+  const response = credential.response as AuthenticatorAssertionResponse
+  return {
+    id: credential.id,
+    rawId: bufferToBase64url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: bufferToBase64url(response.clientDataJSON),
+      authenticatorData: bufferToBase64url(response.authenticatorData),
+      signature: bufferToBase64url(response.signature),
+      userHandle: response.userHandle ? bufferToBase64url(response.userHandle) : ''
+    }
+  }
+}
@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
 	"net/url"
 	"time"
 
+	"github.com/crewjam/saml"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
@@ -93,9 +93,8 @@ func handleSAMLAppLaunch(c *gin.Context, user *models.User, app *models.Applicat
 		return
 	}
 
-	// 生成SAML断言并跳转到SP
-	// 这里需要调用SAML IdP库生成断言
-	samlResponse, err := generateSAMLResponseForUser(user, app)
+	// 生成签名的SAML响应并跳转到SP
+	form, err := generateSAMLResponseForUser(c, user, app)
 	if err != nil {
 		logger.Error("Failed to generate SAML response", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -110,9 +109,9 @@ func handleSAMLAppLaunch(c *gin.Context, user *models.User, app *models.Applicat
 
 	// 返回SAML POST表单，让浏览器自动提交到SP
 	c.HTML(http.StatusOK, "saml_post_form.html", gin.H{
-		"AcsURL":       app.AcsURL,
-		"SAMLResponse": samlResponse,
-		"RelayState":   "", // 可选的状态信息
+		"AcsURL":       form.URL,
+		"SAMLResponse": form.SAMLResponse,
+		"RelayState":   form.RelayState,
 	})
 }
 
@@ -127,7 +126,7 @@ func handleCASAppLaunch(c *gin.Context, user *models.User, app *models.Applicati
 	}
 
 	// 生成CAS服务票据
-	ticket, err := casTicketManager.GenerateServiceTicket(user.Username, app.ServiceURL)
+	ticket, err := casTicketManager.GenerateServiceTicket(user, app.ServiceURL, currentSessionID(c), false)
 	if err != nil {
 		logger.Error("Failed to generate CAS ticket", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -154,11 +153,10 @@ func handleCASAppLaunch(c *gin.Context, user *models.User, app *models.Applicati
 }
 
 // handleOAuth2AppLaunch 处理OAuth2/OIDC应用启动
+// 用户已在门户登录，直接签发授权码并跳转到应用的第一个回调地址
 func handleOAuth2AppLaunch(c *gin.Context, user *models.User, app *models.Application) {
-	// OAuth2/OIDC通常需要authorization code flow
-	// 这里简化处理，实际应该实现完整的OAuth2流程
-
-	if app.RedirectURIs == "" {
+	redirectURIs := parseRedirectURIs(app.RedirectURIs)
+	if len(redirectURIs) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"message": "OAuth2 redirect URIs not configured",
@@ -166,24 +164,53 @@ func handleOAuth2AppLaunch(c *gin.Context, user *models.User, app *models.Applic
 		return
 	}
 
-	// 生成授权码（简化实现）
-	authCode := utils.GenerateTradeIDString("auth")
-	state := c.Query("state") // 从查询参数获取state
+	if !clientAllowsGrant(app, OAuth2GrantAuthorizationCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Application does not support the authorization_code grant",
+		})
+		return
+	}
 
-	// 构建重定向URL
-	redirectURL := fmt.Sprintf("%s?code=%s&state=%s", app.RedirectURIs, authCode, state)
+	// 需要PKCE的应用必须由客户端自己发起授权请求，跳转到应用首页
+	if appRequiresPKCE(app) {
+		handleDirectAppLaunch(c, user, app)
+		return
+	}
+
+	redirectURI := redirectURIs[0]
+	scope, _ := resolveOAuth2Scope(app, "")
+	state := c.Query("state")
+
+	var authTime *time.Time
+	if value, exists := c.Get("claims"); exists {
+		claims := value.(*utils.AccessTokenClaims)
+		authTime = tokenAuthTime(claims)
+	}
+
+	authCode, err := issueOAuth2AuthorizationCode(user, app, redirectURI, scope, state, "", "", "", authTime)
+	if err != nil {
+		logger.Error("Failed to issue OAuth2 authorization code", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to issue authorization code",
+		})
+		return
+	}
 
 	// 记录应用访问日志
 	recordApplicationAccess(user.ID, app.ID, "oauth2", c.ClientIP())
 
 	logger.Info("OAuth2 application launch",
 		zap.String("username", user.Username),
-		zap.String("redirect_uri", app.RedirectURIs),
-		zap.String("auth_code", authCode),
+		zap.String("redirect_uri", redirectURI),
 	)
 
 	// 重定向到OAuth2客户端
-	c.Redirect(http.StatusFound, redirectURL)
+	c.Redirect(http.StatusFound, buildOAuth2RedirectURL(redirectURI, url.Values{
+		"code":  {authCode},
+		"state": {state},
+	}))
 }
 
 // handleDirectAppLaunch 处理直接跳转（无SSO）
@@ -209,19 +236,22 @@ func handleDirectAppLaunch(c *gin.Context, user *models.User, app *models.Applic
 }
 
 // generateSAMLResponseForUser 为用户生成SAML响应（IdP-initiated）
-func generateSAMLResponseForUser(user *models.User, app *models.Application) (string, error) {
-	if samlIDP == nil {
-		return "", fmt.Errorf("SAML IdP not initialized")
+func generateSAMLResponseForUser(c *gin.Context, user *models.User, app *models.Application) (*saml.IdpAuthnRequestForm, error) {
+	req, err := newIDPInitiatedSAMLRequest(c.Request, app, c.Query("RelayState"))
+	if err != nil {
+		return nil, err
 	}
 
-	// 生成SAML响应XML
-	samlResponseXML, err := createSAMLResponseXML(user, app)
-	if err != nil {
-		return "", fmt.Errorf("failed to create SAML response XML: %w", err)
+	// 会话信息来自当前登录令牌，SessionIndex用于后续单点注销
+	authTime := time.Now()
+	if user.LastLoginAt != nil {
+		authTime = *user.LastLoginAt
 	}
 
-	// Base64编码
-	samlResponseB64 := utils.Base64Encode([]byte(samlResponseXML))
+	form, err := issueSAMLResponse(req, app, user, samlSessionForUser(user, currentSessionID(c), authTime))
+	if err != nil {
+		return nil, err
+	}
 
 	logger.Info("SAML response generated successfully",
 		zap.String("username", user.Username),
@@ -229,7 +259,17 @@ func generateSAMLResponseForUser(user *models.User, app *models.Application) (st
 		zap.String("acs_url", app.AcsURL),
 	)
 
-	return samlResponseB64, nil
+	return form, nil
+}
+
+// currentSessionID 获取当前请求所属的平台会话ID
+func currentSessionID(c *gin.Context) string {
+	if value, exists := c.Get("claims"); exists {
+		if claims, ok := value.(*utils.AccessTokenClaims); ok {
+			return claims.SessionID
+		}
+	}
+	return ""
 }
 
 // recordApplicationAccess 记录应用访问日志
@@ -23,8 +23,13 @@ import (
 // LoginRequest 登录请求
 type LoginRequest struct {
 	Username string `json:"username" binding:"required" validate:"required,min=3,max=50"`
-	Password string `json:"password" binding:"required" validate:"required,min=6"`
-	OTPCode  string `json:"otp_code"` // 可选，OTP验证码
+	Password string `json:"password" binding:"required_without=EncryptedPassword"`
+	// 使用/public/login-key公钥加密的登录载荷，提交时可以不传password
+	EncryptedPassword string `json:"encrypted_password"`
+	KeyID             string `json:"key_id"`
+	OTPCode           string `json:"otp_code"` // 可选，OTP验证码
+	// 可选，WebAuthn第二因素断言
+	WebAuthn *WebAuthnCredentialResponse `json:"webauthn"`
 }
 
 // LoginResponse 登录响应
@@ -36,6 +41,15 @@ type LoginResponse struct {
 	User         UserInfo `json:"user"`
 	RequireOTP   bool     `json:"require_otp"`
 	SessionID    string   `json:"session_id"` // 添加会话ID
+
+	// 需要WebAuthn第二因素时返回navigator.credentials.get的参数
+	RequireWebAuthn bool  `json:"require_webauthn"`
+	WebAuthnOptions gin.H `json:"webauthn_options,omitempty"`
+
+	// 密码已过期或需要修改时只返回受限令牌，不返回access_token
+	RequirePasswordChange bool   `json:"require_password_change"`
+	PasswordChangeReason  string `json:"password_change_reason,omitempty"`
+	PasswordChangeToken   string `json:"password_change_token,omitempty"`
 }
 
 // 全局会话管理器实例
@@ -108,10 +122,22 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
+	// IP被封禁或同一IP对该账户失败过多时直接拒绝
+	if !checkLoginThrottle(c, req.Username) {
+		return
+	}
+
+	// 提交了加密密码时解密并校验nonce
+	password, ok := resolveLoginPassword(c, &req)
+	if !ok {
+		return
+	}
+
 	// 获取用户信息
 	var user models.User
 	if err := database.DB.Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			recordLoginFailure(c, nil)
 			logger.AccessInfo("Login failed: user not found",
 				zap.String("ip", c.ClientIP()),
 				zap.String("username", req.Username),
@@ -151,282 +177,53 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	// 验证密码（前端已经AES加密，需要先解密）
-	decryptedPassword := req.Password
-
-	// 如果密码长度表明是加密的，尝试解密
-	if len(req.Password) > 32 {
-		if decrypted, err := utils.DecryptPassword(req.Password); err == nil {
-			decryptedPassword = decrypted
-		}
-		// 如果解密失败，保持原密码（可能是明文或MD5）
-	}
-
-	if !utils.CheckPassword(decryptedPassword, user.Password) {
-		// 更新失败登录次数
-		user.FailedCount++
-		if user.FailedCount >= 5 {
-			// 锁定账户30分钟
-			lockTime := time.Now().Add(30 * time.Minute)
-			user.LockedUntil = &lockTime
-		}
-		database.DB.Save(&user)
-
-		logger.AccessInfo("Login failed: invalid password",
+	// 检查账户是否被锁定，锁定期间不再校验密码
+	if lockedUntil := accountLockedUntil(&user); lockedUntil != nil {
+		logger.AccessInfo("Login failed: account locked",
 			zap.String("ip", c.ClientIP()),
 			zap.String("username", user.Username),
-			zap.Int("failed_count", user.FailedCount),
+			zap.Time("locked_until", *lockedUntil),
 		)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"code":    401,
-			"message": i18n.InvalidCredentials,
+			"message": i18n.AccountLocked,
 			"data":    nil,
 		})
 		return
 	}
 
-	// 检查是否需要升级密码哈希
-	if utils.ShouldUpgradePassword(user.Password) {
-		// 在后台升级密码哈希
-		if newHash, err := utils.UpgradePasswordHash(decryptedPassword); err == nil {
-			user.Password = newHash
-			// 注意：这里会在更新登录信息时一起保存
-		}
-	}
+	if !utils.CheckPassword(password, user.Password) {
+		recordLoginFailure(c, &user)
 
-	// 检查账户是否被锁定
-	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
-		logger.AccessInfo("Login failed: account locked",
+		logger.AccessInfo("Login failed: invalid password",
 			zap.String("ip", c.ClientIP()),
 			zap.String("username", user.Username),
-			zap.Time("locked_until", *user.LockedUntil),
+			zap.Int("failed_count", user.FailedCount),
 		)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"code":    401,
-			"message": i18n.AccountLocked,
+			"message": i18n.InvalidCredentials,
 			"data":    nil,
 		})
 		return
 	}
 
-	// 检查是否需要OTP验证
-	if user.EnableOTP {
-		if req.OTPCode == "" {
-			// 需要OTP验证码
-			logger.AccessInfo("Login requires OTP",
-				zap.String("ip", c.ClientIP()),
-				zap.String("username", user.Username),
-			)
-			c.JSON(http.StatusOK, gin.H{
-				"code":    200,
-				"message": i18n.OTPRequired,
-				"data": LoginResponse{
-					RequireOTP: true,
-					User: UserInfo{
-						ID:            user.ID,
-						Username:      user.Username,
-						Email:         user.Email,
-						DisplayName:   user.DisplayName,
-						Avatar:        user.Avatar,
-						Status:        user.Status.String(),
-						EmailVerified: user.EmailVerified,
-						PhoneVerified: user.PhoneVerified,
-						EnableOTP:     user.EnableOTP,
-					},
-				},
-			})
-			return
-		}
-
-		// TODO: 验证OTP码
-		// 这里暂时跳过OTP验证，实际应该验证TOTP
-		if req.OTPCode != "123456" { // 临时使用固定码
-			logger.AccessInfo("Login failed: invalid OTP",
-				zap.String("ip", c.ClientIP()),
-				zap.String("username", user.Username),
-			)
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"code":    401,
-				"message": i18n.InvalidOTP,
-				"data":    nil,
-			})
-			return
-		}
-	}
-
-	// 生成JWT令牌（包含完整用户信息）
-	cfg := config.GetConfig()
-
-	// 获取用户角色和权限
-	var roles []string
-	var permissions []string
-
-	logger.Info("Starting to load user roles for login",
-		zap.String("username", user.Username),
-		zap.String("user_id", user.ID),
-	)
-
-	// 手动查询用户角色
-	var userRoles []models.Role
-	logger.Info("About to execute role query",
-		zap.String("username", user.Username),
-		zap.String("user_id", user.ID),
-	)
-
-	if err := database.DB.Table("user_roles").
-		Select("roles.*").
-		Joins("JOIN roles ON user_roles.role_id = roles.id").
-		Where("user_roles.user_id = ?", user.ID).
-		Unscoped().
-		Find(&userRoles).Error; err == nil {
-		logger.Info("Role query executed successfully",
-			zap.String("username", user.Username),
-			zap.Int("role_count", len(userRoles)),
-		)
-		for _, role := range userRoles {
-			roles = append(roles, role.Code)
-		}
-		logger.Info("Loaded user roles for login",
-			zap.String("username", user.Username),
-			zap.Strings("roles", roles),
-			zap.Int("role_count", len(userRoles)),
-		)
-	} else {
-		logger.ErrorError("Failed to load user roles for login",
-			zap.String("username", user.Username),
-			zap.Error(err),
-		)
-	}
+	// 密码哈希算法或参数已过时时重新计算
+	rehashPasswordIfNeeded(&user, password)
 
-	accessToken, err := utils.GenerateAccessTokenWithUserInfo(
-		user.ID,
-		user.Username,
-		user.Email,
-		user.DisplayName,
-		roles,
-		permissions,
-		cfg.JWT.Secret,
-		cfg.JWT.AccessTokenExpire,
-	)
-	if err != nil {
-		logger.ErrorError("Failed to generate access token",
-			zap.String("ip", c.ClientIP()),
-			zap.String("username", user.Username),
-			zap.Error(err),
-		)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": i18n.InternalServerError,
-			"data":    nil,
-		})
+	// 检查是否需要OTP验证
+	secondFactor, ok := checkLoginSecondFactor(c, &user, &req)
+	if !ok {
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Username, cfg.JWT.Secret, cfg.JWT.RefreshTokenExpire)
-	if err != nil {
-		logger.ErrorError("Failed to generate refresh token",
-			zap.String("ip", c.ClientIP()),
-			zap.String("username", user.Username),
-			zap.Error(err),
-		)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": i18n.InternalServerError,
-			"data":    nil,
-		})
+	// 密码已过期或被要求修改时只签发修改密码用的受限令牌
+	if requirePasswordChange(c, &user) {
 		return
 	}
 
-	// 更新用户登录信息
-	now := time.Now()
-	user.LastLoginAt = &now
-	user.LastLoginIP = c.ClientIP()
-	user.LoginCount++
-	user.FailedCount = 0   // 重置失败次数
-	user.LockedUntil = nil // 清除锁定状态
-	database.DB.Save(&user)
-
-	// 记录登录日志
-	loginLog := models.UserLoginLog{
-		UserID:    user.ID,
-		LoginType: "password",
-		LoginIP:   c.ClientIP(),
-		UserAgent: c.GetHeader("User-Agent"),
-		Success:   true,
-	}
-	database.DB.Create(&loginLog)
-
-	// 创建Redis会话
-	var sessionID string
-	logger.AccessInfo("Session manager status",
-		zap.Bool("session_manager_initialized", sessionManager != nil),
-		zap.String("username", user.Username),
-	)
-
-	if sessionManager != nil {
-		ctx := context.Background()
-		sessionID, err = sessionManager.CreateSession(
-			ctx,
-			user.ID,
-			user.Username,
-			user.Email,
-			user.DisplayName,
-			c.ClientIP(),
-			c.GetHeader("User-Agent"),
-			"", // tokenID将在后续设置
-			time.Duration(cfg.JWT.AccessTokenExpire)*time.Second,
-		)
-		if err != nil {
-			logger.ErrorError("Failed to create session",
-				zap.String("ip", c.ClientIP()),
-				zap.String("username", user.Username),
-				zap.Error(err),
-			)
-			// 会话创建失败不应该影响登录流程，只记录错误
-		} else {
-			logger.AccessInfo("Session created successfully",
-				zap.String("session_id", sessionID),
-				zap.String("username", user.Username),
-			)
-		}
-	} else {
-		logger.ErrorError("Session manager is nil",
-			zap.String("username", user.Username),
-		)
-	}
-
-	logger.AccessInfo("Login successful",
-		zap.String("ip", c.ClientIP()),
-		zap.String("username", user.Username),
-		zap.String("user_id", user.ID),
-		zap.String("session_id", sessionID),
-	)
-
-	c.JSON(http.StatusOK, gin.H{
-		"code":    200,
-		"message": i18n.LoginSuccess,
-		"data": LoginResponse{
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
-			TokenType:    "Bearer",
-			ExpiresIn:    int64(cfg.JWT.AccessTokenExpire),
-			RequireOTP:   false,
-			SessionID:    sessionID,
-			User: UserInfo{
-				ID:            user.ID,
-				Username:      user.Username,
-				Email:         user.Email,
-				DisplayName:   user.DisplayName,
-				Avatar:        user.Avatar,
-				Status:        user.Status.String(),
-				EmailVerified: user.EmailVerified,
-				PhoneVerified: user.PhoneVerified,
-				EnableOTP:     user.EnableOTP,
-				LastLoginAt:   *user.LastLoginAt,
-				LastLoginIP:   user.LastLoginIP,
-			},
-		},
-	})
+	// 与管理端、门户登录一致签发带auth_time和amr的令牌
+	completeConsoleLogin(c, &user, "password", loginAMR(utils.AMRPassword, secondFactor))
 }
 
 // LogoutHandler 登出处理器
@@ -495,16 +292,22 @@ func LogoutHandler(c *gin.Context) {
 		}
 	}
 
+	// 通知会话中登录过的应用注销
+	sloResult := notifyLogoutParticipants(claims.SessionID, "")
+
 	logger.AccessInfo("User logged out",
 		zap.String("user_id", claims.UserID),
 		zap.String("username", claims.Username),
 		zap.String("ip", c.ClientIP()),
+		zap.Bool("partial_logout", sloResult.Partial),
 	)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "Logout successful",
-		"data":    nil,
+		"data": gin.H{
+			"single_logout": sloResult,
+		},
 	})
 }
 
@@ -658,71 +461,51 @@ func GetAllSessionsHandler(c *gin.Context) {
 		// 获取多设备登录配置
 		allowMultiDevice := getMultiDeviceLoginConfig(ctx)
 
-		if allowMultiDevice {
-			// 多设备模式：显示所有活跃会话
-			for _, session := range sessions {
-				// 检查会话是否过期
-				isActive := time.Now().Before(session.ExpiresAt)
-
-				// 过滤活跃状态
-				if isActiveFilter != "" {
-					isActiveBool, _ := strconv.ParseBool(isActiveFilter)
-					if isActive != isActiveBool {
-						continue
-					}
-				}
+		visibleSessions := sessions
+		if !allowMultiDevice {
+			// 单设备模式：只保留最新的活跃会话，代登录会话始终显示
+			visibleSessions = impersonationSessions(sessions)
+			if latestSession := getLatestActiveSession(sessions); latestSession != nil {
+				visibleSessions = append([]*session.SessionInfo{latestSession}, visibleSessions...)
+			}
+		}
 
-				sessionData := map[string]interface{}{
-					"id":                 session.SessionID,
-					"user_id":            user.ID,
-					"username":           user.Username,
-					"session_id":         session.SessionID,
-					"login_ip":           session.LoginIP,
-					"user_agent":         session.UserAgent,
-					"device_type":        session.DeviceType,
-					"device_fingerprint": session.DeviceFingerprint,
-					"location":           "Unknown", // 暂时保持Unknown
-					"login_time":         session.LoginTime,
-					"last_activity":      session.LastActivity,
-					"expires_at":         session.ExpiresAt,
-					"is_active":          isActive,
+		for _, session := range visibleSessions {
+			// 检查会话是否过期
+			isActive := time.Now().Before(session.ExpiresAt)
+
+			// 过滤活跃状态
+			if isActiveFilter != "" {
+				isActiveBool, _ := strconv.ParseBool(isActiveFilter)
+				if isActive != isActiveBool {
+					continue
 				}
-				allSessions = append(allSessions, sessionData)
-				total++
 			}
-		} else {
-			// 单设备模式：只保留最新的活跃会话
-			latestSession := getLatestActiveSession(sessions)
-			if latestSession != nil {
-				// 检查会话是否过期
-				isActive := time.Now().Before(latestSession.ExpiresAt)
-
-				// 过滤活跃状态
-				if isActiveFilter != "" {
-					isActiveBool, _ := strconv.ParseBool(isActiveFilter)
-					if isActive != isActiveBool {
-						continue
-					}
-				}
 
-				sessionData := map[string]interface{}{
-					"id":                 latestSession.SessionID,
-					"user_id":            user.ID,
-					"username":           user.Username,
-					"session_id":         latestSession.SessionID,
-					"login_ip":           latestSession.LoginIP,
-					"user_agent":         latestSession.UserAgent,
-					"device_type":        latestSession.DeviceType,
-					"device_fingerprint": latestSession.DeviceFingerprint,
-					"location":           "Unknown", // 暂时保持Unknown
-					"login_time":         latestSession.LoginTime,
-					"last_activity":      latestSession.LastActivity,
-					"expires_at":         latestSession.ExpiresAt,
-					"is_active":          isActive,
-				}
-				allSessions = append(allSessions, sessionData)
-				total++
+			sessionData := map[string]interface{}{
+				"id":                 session.SessionID,
+				"user_id":            user.ID,
+				"username":           user.Username,
+				"session_id":         session.SessionID,
+				"login_ip":           session.LoginIP,
+				"user_agent":         session.UserAgent,
+				"device_type":        session.DeviceType,
+				"device_fingerprint": session.DeviceFingerprint,
+				"location":           "Unknown", // 暂时保持Unknown
+				"login_time":         session.LoginTime,
+				"last_activity":      session.LastActivity,
+				"expires_at":         session.ExpiresAt,
+				"is_active":          isActive,
+				"impersonated":       session.Impersonated(),
+			}
+			if session.Impersonated() {
+				sessionData["impersonator_id"] = session.ImpersonatorID
+				sessionData["impersonator_username"] = session.ImpersonatorUsername
+				sessionData["impersonation_reason"] = session.ImpersonationReason
+				sessionData["read_only"] = session.ReadOnly
 			}
+			allSessions = append(allSessions, sessionData)
+			total++
 		}
 	}
 
@@ -752,17 +535,28 @@ func GetAllSessionsHandler(c *gin.Context) {
 	})
 }
 
+// impersonationSessions 筛选管理员代登录的会话
+func impersonationSessions(sessions []*session.SessionInfo) []*session.SessionInfo {
+	var result []*session.SessionInfo
+	for _, s := range sessions {
+		if s.Impersonated() {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 // getLatestActiveSession 获取用户最新的活跃会话
 func getLatestActiveSession(sessions []*session.SessionInfo) *session.SessionInfo {
 	if len(sessions) == 0 {
 		return nil
 	}
 
-	// 过滤掉已过期的会话
+	// 过滤掉已过期的会话和代登录会话
 	var activeSessions []*session.SessionInfo
 	now := time.Now()
 	for _, s := range sessions {
-		if now.Before(s.ExpiresAt) {
+		if now.Before(s.ExpiresAt) && !s.Impersonated() {
 			activeSessions = append(activeSessions, s)
 		}
 	}
@@ -827,20 +621,21 @@ func RefreshTokenHandler(c *gin.Context) {
 		return
 	}
 
-	// 生成新的令牌（包含完整用户信息）
-	roles := []string{}
-	permissions := []string{}
-
-	accessToken, err := utils.GenerateAccessTokenWithUserInfo(
-		user.ID,
-		user.Username,
-		user.Email,
-		user.DisplayName,
-		roles,
-		permissions,
-		cfg.JWT.Secret,
-		cfg.JWT.AccessTokenExpire,
-	)
+	// 生成新的令牌，保留会话和原始认证时间，刷新令牌不是重新认证
+	jwtManager := utils.NewJWTManager(&cfg.JWT)
+	tokenInfo := &utils.TokenInfo{
+		UserID:      user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Roles:       loadUserRoleCodes(user.ID),
+		Permissions: []string{},
+		SessionID:   claims.SessionID,
+		TradeID:     utils.GenerateTradeIDString("refresh"),
+		AuthTime:    claims.AuthTime,
+		AMR:         claims.AMR,
+	}
+	accessToken, err := jwtManager.GenerateAccessToken(tokenInfo)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -850,7 +645,7 @@ func RefreshTokenHandler(c *gin.Context) {
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Username, cfg.JWT.Secret, cfg.JWT.RefreshTokenExpire)
+	refreshToken, err := jwtManager.GenerateRefreshToken(tokenInfo)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -2,144 +2,233 @@ package handlers
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/patrickmn/go-cache"
 	"go.uber.org/zap"
 
+	"eiam-platform/config"
 	"eiam-platform/internal/models"
 	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
 	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/session"
 	"eiam-platform/pkg/utils"
 )
 
-// CASTicketManager manages CAS service tickets using go-cache
+// CASTicketManager issues and consumes CAS tickets through a pluggable ticket registry
 type CASTicketManager struct {
-	cache *cache.Cache
+	registry CASTicketRegistry
+	ttls     casTicketTTLs
 }
 
-// CASTicket represents a CAS service ticket
+// CASTicket represents a CAS ticket held in the ticket registry
 type CASTicket struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"` // ST, PT, PGT, TGT
+	UserID    string    `json:"user_id"`
 	Username  string    `json:"username"`
 	Service   string    `json:"service"`
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
-	Used      bool      `json:"used"`
+	// SessionIndex is the single logout index of the platform session that issued the ticket
+	SessionIndex string `json:"session_index"`
+	// FromNewLogin reports whether the ticket was issued right after the user presented credentials
+	FromNewLogin bool `json:"from_new_login"`
+	// ProxyGrantingTicket is the PGT a proxy ticket was issued from
+	ProxyGrantingTicket string `json:"proxy_granting_ticket,omitempty"`
+	// ProxyCallbackURL is the pgtUrl a proxy granting ticket was delivered to
+	ProxyCallbackURL string `json:"proxy_callback_url,omitempty"`
+	// Proxies is the proxy chain of PT/PGT tickets, most recent proxy first
+	Proxies []string `json:"proxies,omitempty"`
 }
 
 var (
 	casTicketManager *CASTicketManager
 )
 
-// InitCASImproved initializes improved CAS implementation with go-cache
+// InitCASImproved initializes the CAS ticket manager and the ticket table janitor
 func InitCASImproved() error {
-	// Create ticket manager with 5 minute default expiration and 10 minute cleanup interval
+	var cfg config.CASConfig
+	if config.AppConfig != nil {
+		cfg = config.AppConfig.IdP.CAS
+	}
+
+	registry, registryType := newCASTicketRegistry(&cfg, redis.GetRedis())
 	casTicketManager = &CASTicketManager{
-		cache: cache.New(5*time.Minute, 10*time.Minute),
+		registry: registry,
+		ttls:     newCASTicketTTLs(&cfg),
+	}
+
+	cleanupInterval := time.Hour
+	if cfg.CleanupInterval > 0 {
+		cleanupInterval = time.Duration(cfg.CleanupInterval) * time.Second
 	}
+	startCASTicketJanitor(cleanupInterval, casTicketManager.TTL(casTicketTypeTGT))
 
-	logger.Info("CAS initialized successfully with improved implementation using go-cache")
+	logger.Info("CAS initialized successfully",
+		zap.String("ticket_registry", registryType),
+		zap.Duration("service_ticket_ttl", casTicketManager.TTL(casTicketTypeST)),
+		zap.Duration("proxy_granting_ticket_ttl", casTicketManager.TTL(casTicketTypePGT)),
+	)
 	return nil
 }
 
-// GenerateServiceTicket generates a new CAS service ticket
-func (tm *CASTicketManager) GenerateServiceTicket(username, service string) (string, error) {
-	// Generate ticket ID
-	ticketBytes := make([]byte, 32)
-	if _, err := rand.Read(ticketBytes); err != nil {
+// TTL returns the configured lifetime of a ticket type
+func (tm *CASTicketManager) TTL(ticketType string) time.Duration {
+	return tm.ttls[ticketType]
+}
+
+// IssueTicket stores a new ticket of ticket.Type in the registry and returns its ID
+func (tm *CASTicketManager) IssueTicket(ctx context.Context, ticket *CASTicket) (string, error) {
+	ticketID, err := newCASTicketID(ticket.Type, 32)
+	if err != nil {
 		return "", err
 	}
-	ticketID := "ST-" + base64.URLEncoding.EncodeToString(ticketBytes)
 
-	// Create ticket
+	ttl := tm.TTL(ticket.Type)
+	ticket.ID = ticketID
+	ticket.CreatedAt = time.Now()
+	ticket.ExpiresAt = ticket.CreatedAt.Add(ttl)
+	if err := tm.registry.Add(ctx, ticket, ttl); err != nil {
+		return "", err
+	}
+	return ticketID, nil
+}
+
+// GetTicket returns a ticket of the given type without consuming it
+func (tm *CASTicketManager) GetTicket(ctx context.Context, ticketID, ticketType string) (*CASTicket, error) {
+	ticket, err := tm.registry.Get(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if ticket.Type != ticketType {
+		return nil, errCASTicketNotFound
+	}
+	return ticket, nil
+}
+
+// ConsumeTicket atomically removes a ticket of the given type, it can only succeed once
+func (tm *CASTicketManager) ConsumeTicket(ctx context.Context, ticketID, ticketType string) (*CASTicket, error) {
+	ticket, err := tm.registry.Consume(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if ticket.Type != ticketType {
+		return nil, errCASTicketNotFound
+	}
+	return ticket, nil
+}
+
+// RevokeSession removes every ticket issued from a platform session
+func (tm *CASTicketManager) RevokeSession(ctx context.Context, sessionIndex string) error {
+	return tm.registry.DeleteBySession(ctx, sessionIndex)
+}
+
+// GenerateServiceTicket generates a new CAS service ticket
+// sessionID is the platform session the ticket is issued from, used for single logout.
+// fromNewLogin marks tickets issued from a credential login, required by renew validation
+func (tm *CASTicketManager) GenerateServiceTicket(user *models.User, service, sessionID string, fromNewLogin bool) (string, error) {
 	ticket := &CASTicket{
-		Username:  username,
-		Service:   service,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(5 * time.Minute),
-		Used:      false,
+		Type:         casTicketTypeST,
+		UserID:       user.ID,
+		Username:     user.Username,
+		Service:      service,
+		FromNewLogin: fromNewLogin,
+	}
+	if sessionID != "" {
+		ticket.SessionIndex = ssoSessionIndex(sessionID)
 	}
 
-	// Store in cache with 5 minute expiration
-	tm.cache.Set(ticketID, ticket, 5*time.Minute)
+	ticketID, err := tm.IssueTicket(context.Background(), ticket)
+	if err != nil {
+		return "", err
+	}
 
-	// Also store in database for persistence
+	// Keep a database record so single logout can find the services of a session
 	dbTicket := CASServiceTicket{
-		Ticket:    ticketID,
-		Service:   service,
-		Username:  username,
-		ExpiresAt: ticket.ExpiresAt,
-		Used:      false,
+		Ticket:       ticketID,
+		Service:      service,
+		UserID:       user.ID,
+		Username:     user.Username,
+		ExpiresAt:    ticket.ExpiresAt,
+		Used:         false,
+		SessionIndex: ticket.SessionIndex,
+		FromNewLogin: fromNewLogin,
 	}
 	dbTicket.ID = utils.GenerateTradeIDString("tkt")
 
 	if err := database.DB.Create(&dbTicket).Error; err != nil {
 		logger.Error("Failed to save CAS ticket to database", zap.Error(err))
-		// Continue anyway, as we have it in cache
+		// Continue anyway, the registry is authoritative
 	}
 
 	logger.Info("Generated CAS service ticket",
 		zap.String("ticket", ticketID),
 		zap.String("service", service),
-		zap.String("username", username),
+		zap.String("username", user.Username),
 	)
 
 	return ticketID, nil
 }
 
-// ValidateServiceTicket validates a CAS service ticket
-func (tm *CASTicketManager) ValidateServiceTicket(ticketID, service string) (string, bool) {
-	// First try cache
-	if item, found := tm.cache.Get(ticketID); found {
-		ticket := item.(*CASTicket)
-
-		// Check if ticket matches service and hasn't been used
-		if ticket.Service == service && !ticket.Used && time.Now().Before(ticket.ExpiresAt) {
-			// Mark as used
-			ticket.Used = true
-			tm.cache.Set(ticketID, ticket, cache.DefaultExpiration)
-
-			// Also update database
-			database.DB.Model(&CASServiceTicket{}).Where("ticket = ?", ticketID).Update("used", true)
-
-			return ticket.Username, true
+// ValidateServiceTicket consumes a CAS service ticket and returns it
+// The ticket is consumed even when the service does not match, as required by the CAS protocol
+func (tm *CASTicketManager) ValidateServiceTicket(ticketID, service string) (*CASTicket, bool) {
+	ticket, err := tm.ConsumeTicket(context.Background(), ticketID, casTicketTypeST)
+	if err != nil {
+		if !errors.Is(err, errCASTicketNotFound) {
+			logger.Error("Failed to consume CAS service ticket", zap.Error(err))
 		}
+		return nil, false
 	}
 
-	// Fallback to database
-	var dbTicket CASServiceTicket
-	if err := database.DB.Where("ticket = ? AND service = ? AND used = ? AND expires_at > ?",
-		ticketID, service, false, time.Now()).First(&dbTicket).Error; err != nil {
-		return "", false
-	}
-
-	// Mark as used
-	dbTicket.Used = true
-	database.DB.Save(&dbTicket)
+	database.DB.Model(&CASServiceTicket{}).Where("ticket = ?", ticketID).Update("used", true)
 
-	// Update cache
-	cacheTicket := &CASTicket{
-		Username:  dbTicket.Username,
-		Service:   dbTicket.Service,
-		CreatedAt: dbTicket.CreatedAt,
-		ExpiresAt: dbTicket.ExpiresAt,
-		Used:      true,
+	if ticket.Service != service {
+		logger.ErrorWarn("CAS service ticket presented for another service",
+			zap.String("ticket_service", ticket.Service),
+			zap.String("service", service),
+		)
+		return nil, false
 	}
-	tm.cache.Set(ticketID, cacheTicket, cache.DefaultExpiration)
-
-	return dbTicket.Username, true
+	return ticket, true
 }
 
+// casGatewayCookiePrefix marks applications whose default gateway pass already ran in this browser
+const casGatewayCookiePrefix = "cas_gateway_"
+
 // CASLoginHandlerImproved handles CAS login with improved implementation
 func CASLoginHandlerImproved(c *gin.Context) {
 	service := c.Query("service")
-	gateway := c.Query("gateway") == "true"
-	renew := c.Query("renew") == "true"
+	gateway := casBoolParam(c, "gateway")
+	renew := casBoolParam(c, "renew")
+
+	// Registered applications may require renew on every login. Their gateway flag is only a
+	// default for SPs that don't send the parameter, and only applies to the first pass: once the
+	// browser has been sent back without a ticket, the next visit is an explicit login.
+	gatewayCookie := ""
+	if service != "" {
+		if app, err := findCASApplication(service); err == nil {
+			renew = renew || app.Renew
+			if _, sent := c.GetQuery("gateway"); !sent && app.Gateway {
+				gatewayCookie = casGatewayCookiePrefix + app.ID
+				if _, err := c.Cookie(gatewayCookie); err != nil {
+					gateway = true
+				}
+			}
+		}
+	}
+	// renew takes precedence over gateway
+	if renew {
+		gateway = false
+	}
 
 	logger.Info("CAS login request (improved)",
 		zap.String("service", service),
@@ -153,7 +242,8 @@ func CASLoginHandlerImproved(c *gin.Context) {
 	if authenticated && !renew {
 		// User is already authenticated, generate service ticket
 		if service != "" {
-			ticket, err := casTicketManager.GenerateServiceTicket(user.Username, service)
+			sessionID, _ := c.Cookie("cas_session")
+			ticket, err := casTicketManager.GenerateServiceTicket(user, service, sessionID, false)
 			if err != nil {
 				logger.Error("Failed to generate CAS service ticket", zap.Error(err))
 				c.JSON(http.StatusInternalServerError, gin.H{
@@ -179,6 +269,9 @@ func CASLoginHandlerImproved(c *gin.Context) {
 	if gateway {
 		// Gateway mode - redirect back to service without authentication
 		if service != "" {
+			if gatewayCookie != "" {
+				c.SetCookie(gatewayCookie, "1", 0, "/", "", false, true)
+			}
 			c.Redirect(http.StatusFound, service)
 			return
 		}
@@ -193,17 +286,37 @@ func CASLoginHandlerImproved(c *gin.Context) {
 	})
 }
 
+// casLoginForm CAS login form. The WebAuthn step posts mfa_token and webauthn instead of credentials.
+type casLoginForm struct {
+	Username string `form:"username"`
+	Password string `form:"password"`
+	// Password encrypted with the login key from /public/login-key, see decodeLoginPassword
+	EncryptedPassword string `form:"encrypted_password"`
+	KeyID             string `form:"key_id"`
+	OTPCode           string `form:"otp_code"`
+	MFAToken          string `form:"mfa_token"`
+	WebAuthn          string `form:"webauthn"` // JSON encoded assertion
+	Service           string `form:"service"`
+	Gateway           bool   `form:"gateway"`
+	Renew             bool   `form:"renew"`
+}
+
+// casWebAuthnLogin a CAS login whose password was verified and that waits for the WebAuthn assertion
+type casWebAuthnLogin struct {
+	UserID  string `json:"user_id"`
+	Service string `json:"service"`
+}
+
+const casWebAuthnLoginPrefix = "cas_webauthn_login:"
+
 // CASLoginSubmitHandlerImproved handles CAS login form submission
 func CASLoginSubmitHandlerImproved(c *gin.Context) {
-	var req struct {
-		Username string `form:"username" binding:"required"`
-		Password string `form:"password" binding:"required"`
-		Service  string `form:"service"`
-		Gateway  bool   `form:"gateway"`
-		Renew    bool   `form:"renew"`
+	var req casLoginForm
+	err := c.ShouldBind(&req)
+	if err == nil && req.MFAToken == "" && (req.Username == "" || (req.Password == "" && req.EncryptedPassword == "")) {
+		err = errors.New("username and password are required")
 	}
-
-	if err := c.ShouldBind(&req); err != nil {
+	if err != nil {
 		logger.Error("Invalid CAS login request", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid request parameters",
@@ -217,9 +330,48 @@ func CASLoginSubmitHandlerImproved(c *gin.Context) {
 		zap.String("ip", c.ClientIP()),
 	)
 
+	// Second step for WebAuthn users, the password was verified in the first step
+	if req.MFAToken != "" {
+		completeCASWebAuthnLogin(c, &req)
+		return
+	}
+
+	// Reject blocked IPs and delayed IP+username pairs before checking credentials
+	if wait := loginThrottleRetryAfter(c, req.Username); wait > 0 {
+		logger.AccessInfo("CAS login throttled", zap.String("username", req.Username), zap.Duration("retry_after", wait))
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+		c.HTML(http.StatusTooManyRequests, "cas_login.html", gin.H{
+			"error":   i18n.LoginThrottled,
+			"service": req.Service,
+			"gateway": req.Gateway,
+			"renew":   req.Renew,
+			"title":   "CAS Login (Improved)",
+		})
+		return
+	}
+
+	// Decrypt the password, plaintext is rejected when login.password_encryption.required is set
+	password, message, err := decodeLoginPassword(c, req.Username, req.Password, req.KeyID, req.EncryptedPassword)
+	if err != nil {
+		status := http.StatusBadRequest
+		if message == "" {
+			status = http.StatusInternalServerError
+			message = i18n.InternalServerError
+		}
+		c.HTML(status, "cas_login.html", gin.H{
+			"error":   message,
+			"service": req.Service,
+			"gateway": req.Gateway,
+			"renew":   req.Renew,
+			"title":   "CAS Login (Improved)",
+		})
+		return
+	}
+
 	// Authenticate user using existing logic from auth.go
 	var user models.User
 	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
+		recordLoginFailure(c, nil)
 		logger.Error("User not found", zap.String("username", req.Username))
 		c.HTML(http.StatusUnauthorized, "cas_login.html", gin.H{
 			"error":   "Invalid username or password",
@@ -245,7 +397,7 @@ func CASLoginSubmitHandlerImproved(c *gin.Context) {
 	}
 
 	// Check if account is locked
-	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+	if accountLockedUntil(&user) != nil {
 		logger.Error("User account is locked", zap.String("username", req.Username))
 		c.HTML(http.StatusUnauthorized, "cas_login.html", gin.H{
 			"error":   "Account is temporarily locked",
@@ -258,15 +410,8 @@ func CASLoginSubmitHandlerImproved(c *gin.Context) {
 	}
 
 	// Validate password
-	if !utils.CheckPassword(req.Password, user.Password) {
-		// Update failed login count
-		user.FailedCount++
-		if user.FailedCount >= 5 {
-			// Lock account for 30 minutes
-			lockUntil := time.Now().Add(30 * time.Minute)
-			user.LockedUntil = &lockUntil
-		}
-		database.DB.Save(&user)
+	if !utils.CheckPassword(password, user.Password) {
+		recordLoginFailure(c, &user)
 
 		logger.Error("Invalid password", zap.String("username", req.Username))
 		c.HTML(http.StatusUnauthorized, "cas_login.html", gin.H{
@@ -278,6 +423,138 @@ func CASLoginSubmitHandlerImproved(c *gin.Context) {
 		})
 		return
 	}
+	rehashPasswordIfNeeded(&user, password)
+
+	// Verify second factor if the user has enrolled OTP or WebAuthn.
+	// Authenticator codes are checked here, WebAuthn users without a code confirm with their key in a second step.
+	hasWebAuthn := userHasWebAuthn(user.ID)
+	if user.EnableOTP || hasWebAuthn {
+		if hasWebAuthn && (req.OTPCode == "" || !user.EnableOTP) {
+			beginCASWebAuthnLogin(c, &user, &req)
+			return
+		}
+		message := i18n.OTPRequired
+		valid := false
+		if req.OTPCode != "" {
+			message = i18n.InvalidOTP
+			_, valid = verifyUserSecondFactor(&user, req.OTPCode)
+		}
+		if !valid {
+			if req.OTPCode != "" {
+				recordLoginFailure(c, &user)
+			}
+
+			logger.Error("CAS login second factor failed", zap.String("username", req.Username))
+			c.HTML(http.StatusUnauthorized, "cas_login.html", gin.H{
+				"error":   message,
+				"service": req.Service,
+				"gateway": req.Gateway,
+				"renew":   req.Renew,
+				"title":   "CAS Login (Improved)",
+			})
+			return
+		}
+	}
+
+	finishCASLogin(c, &user, &req)
+}
+
+// beginCASWebAuthnLogin starts the WebAuthn assertion for a user whose password was verified and
+// renders the login page in its security key step
+func beginCASWebAuthnLogin(c *gin.Context, user *models.User, req *casLoginForm) {
+	options, err := beginWebAuthnSecondFactor(user.ID)
+	var token string
+	if err == nil {
+		token, err = utils.GenerateRandomString(40)
+	}
+	if err == nil {
+		_, _, timeout := webAuthnSettings()
+		err = redis.SetJSON(casWebAuthnLoginPrefix+token, casWebAuthnLogin{UserID: user.ID, Service: req.Service}, timeout)
+	}
+	if err != nil {
+		logger.ErrorError("Failed to start CAS WebAuthn login", zap.String("user_id", user.ID), zap.Error(err))
+		c.HTML(http.StatusInternalServerError, "cas_login.html", gin.H{
+			"error":   i18n.InternalServerError,
+			"service": req.Service,
+			"gateway": req.Gateway,
+			"renew":   req.Renew,
+			"title":   "CAS Login (Improved)",
+		})
+		return
+	}
+
+	logger.AccessInfo("CAS login requires WebAuthn", zap.String("username", user.Username))
+	c.HTML(http.StatusOK, "cas_login.html", gin.H{
+		"message":          i18n.MFARequired,
+		"username":         user.Username,
+		"mfa_token":        token,
+		"webauthn_options": gin.H{"publicKey": options},
+		"service":          req.Service,
+		"gateway":          req.Gateway,
+		"renew":            req.Renew,
+		"title":            "CAS Login (Improved)",
+	})
+}
+
+// completeCASWebAuthnLogin verifies the WebAuthn assertion of the second login step. The pending
+// login is single use, a failed assertion sends the user back to the password form.
+func completeCASWebAuthnLogin(c *gin.Context, req *casLoginForm) {
+	fail := func(message string) {
+		c.HTML(http.StatusUnauthorized, "cas_login.html", gin.H{
+			"error":   message,
+			"service": req.Service,
+			"gateway": req.Gateway,
+			"renew":   req.Renew,
+			"title":   "CAS Login (Improved)",
+		})
+	}
+
+	var pending casWebAuthnLogin
+	value, err := getDelScript.Run(context.Background(), redis.RDB, []string{casWebAuthnLoginPrefix + req.MFAToken}).Text()
+	if err != nil || json.Unmarshal([]byte(value), &pending) != nil || pending.Service != req.Service {
+		fail(i18n.InvalidWebAuthn)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ? AND status = ?", pending.UserID, models.StatusActive).First(&user).Error; err != nil {
+		fail(i18n.InvalidWebAuthn)
+		return
+	}
+	if accountLockedUntil(&user) != nil {
+		fail("Account is temporarily locked")
+		return
+	}
+
+	var assertion WebAuthnCredentialResponse
+	if err := json.Unmarshal([]byte(req.WebAuthn), &assertion); err != nil {
+		fail(i18n.InvalidWebAuthn)
+		return
+	}
+	if _, err := verifyWebAuthnAssertion(&assertion, webAuthnCeremonySecondFactor, user.ID); err != nil {
+		recordLoginFailure(c, &user)
+		logger.AccessInfo("CAS login WebAuthn failed", zap.String("username", user.Username), zap.Error(err))
+		fail(i18n.InvalidWebAuthn)
+		return
+	}
+
+	finishCASLogin(c, &user, req)
+}
+
+// finishCASLogin creates the CAS session for an authenticated user and redirects to the service
+func finishCASLogin(c *gin.Context, user *models.User, req *casLoginForm) {
+	// Expired or flagged passwords can only be changed through the portal
+	if passwordChangeReason(user) != "" {
+		logger.AccessInfo("CAS login blocked: password change required", zap.String("username", user.Username))
+		c.HTML(http.StatusUnauthorized, "cas_login.html", gin.H{
+			"error":   i18n.PasswordChangeInPortal,
+			"service": req.Service,
+			"gateway": req.Gateway,
+			"renew":   req.Renew,
+			"title":   "CAS Login (Improved)",
+		})
+		return
+	}
 
 	// Reset failed count on successful login
 	user.FailedCount = 0
@@ -285,11 +562,13 @@ func CASLoginSubmitHandlerImproved(c *gin.Context) {
 	now := time.Now()
 	user.LastLoginAt = &now
 	user.LoginCount++
-	database.DB.Save(&user)
+	database.DB.Save(user)
+	clearLoginFailures(c, user)
 
-	// Create session
+	// Create session, it acts as the CAS ticket granting ticket
 	sessionManager := GetSessionManager()
 	ctx := context.Background()
+	tgtTTL := casTicketManager.TTL(casTicketTypeTGT)
 	sessionID, err := sessionManager.CreateSession(
 		ctx,
 		user.ID,
@@ -299,7 +578,7 @@ func CASLoginSubmitHandlerImproved(c *gin.Context) {
 		c.ClientIP(),
 		c.GetHeader("User-Agent"),
 		"", // no token ID for CAS
-		time.Hour*24,
+		tgtTTL,
 	)
 	if err != nil {
 		logger.Error("Failed to create session", zap.Error(err))
@@ -310,11 +589,11 @@ func CASLoginSubmitHandlerImproved(c *gin.Context) {
 	}
 
 	// Set session cookie
-	c.SetCookie("cas_session", sessionID, 86400, "/", "", false, true)
+	c.SetCookie("cas_session", sessionID, int(tgtTTL/time.Second), "/", "", false, true)
 
 	// Generate service ticket if service is specified
 	if req.Service != "" {
-		ticket, err := casTicketManager.GenerateServiceTicket(user.Username, req.Service)
+		ticket, err := casTicketManager.GenerateServiceTicket(user, req.Service, sessionID, true)
 		if err != nil {
 			logger.Error("Failed to generate CAS service ticket", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -353,120 +632,47 @@ func CASValidateHandlerImproved(c *gin.Context) {
 	}
 
 	// Validate ticket
-	username, valid := casTicketManager.ValidateServiceTicket(ticket, service)
+	serviceTicket, valid := casTicketManager.ValidateServiceTicket(ticket, service)
 	if valid {
-		c.String(http.StatusOK, "yes\n%s\n", username)
+		c.String(http.StatusOK, "yes\n%s\n", serviceTicket.Username)
 	} else {
 		c.String(http.StatusOK, "no\n")
 	}
 }
 
-// CASServiceValidateHandlerImproved handles CAS 2.0/3.0 service validation
+// CASServiceValidateHandlerImproved handles CAS 2.0 service validation
+// Proxy tickets are rejected here, they must be validated at /proxyValidate
 func CASServiceValidateHandlerImproved(c *gin.Context) {
-	service := c.Query("service")
-	ticket := c.Query("ticket")
-	format := c.Query("format") // xml, json
-
-	logger.Info("CAS service validate request (improved)",
-		zap.String("service", service),
-		zap.String("ticket", ticket),
-		zap.String("format", format),
-		zap.String("ip", c.ClientIP()),
-	)
-
-	if service == "" || ticket == "" {
-		if format == "json" {
-			c.JSON(http.StatusOK, gin.H{
-				"serviceResponse": gin.H{
-					"authenticationFailure": gin.H{
-						"code":        "INVALID_REQUEST",
-						"description": "Missing required parameters",
-					},
-				},
-			})
-		} else {
-			c.XML(http.StatusOK, gin.H{
-				"cas:serviceResponse": gin.H{
-					"cas:authenticationFailure": gin.H{
-						"code":     "INVALID_REQUEST",
-						"#content": "Missing required parameters",
-					},
-				},
-			})
-		}
-		return
-	}
-
-	// Validate ticket
-	username, valid := casTicketManager.ValidateServiceTicket(ticket, service)
-	if valid {
-		if format == "json" {
-			c.JSON(http.StatusOK, gin.H{
-				"serviceResponse": gin.H{
-					"authenticationSuccess": gin.H{
-						"user": username,
-						"attributes": gin.H{
-							"username": username,
-						},
-					},
-				},
-			})
-		} else {
-			c.XML(http.StatusOK, gin.H{
-				"cas:serviceResponse": gin.H{
-					"cas:authenticationSuccess": gin.H{
-						"cas:user": username,
-						"cas:attributes": gin.H{
-							"cas:username": username,
-						},
-					},
-				},
-			})
-		}
-	} else {
-		if format == "json" {
-			c.JSON(http.StatusOK, gin.H{
-				"serviceResponse": gin.H{
-					"authenticationFailure": gin.H{
-						"code":        "INVALID_TICKET",
-						"description": "Ticket validation failed",
-					},
-				},
-			})
-		} else {
-			c.XML(http.StatusOK, gin.H{
-				"cas:serviceResponse": gin.H{
-					"cas:authenticationFailure": gin.H{
-						"code":     "INVALID_TICKET",
-						"#content": "Ticket validation failed",
-					},
-				},
-			})
-		}
-	}
+	handleCASTicketValidation(c, false, false)
 }
 
 // Helper functions
 func checkUserAuthenticationFromSession(c *gin.Context) (*models.User, bool) {
+	user, _, ok := casSessionFromRequest(c)
+	return user, ok
+}
+
+// casSessionFromRequest 从统一登录会话cookie获取用户和会话信息
+func casSessionFromRequest(c *gin.Context) (*models.User, *session.SessionInfo, bool) {
 	// Check for session cookie
 	sessionID, err := c.Cookie("cas_session")
 	if err != nil {
-		return nil, false
+		return nil, nil, false
 	}
 
 	sessionManager := GetSessionManager()
 	ctx := context.Background()
 	sessionInfo, err := sessionManager.GetSession(ctx, sessionID)
 	if err != nil {
-		return nil, false
+		return nil, nil, false
 	}
 
 	var user models.User
 	if err := database.DB.Where("id = ?", sessionInfo.UserID).First(&user).Error; err != nil {
-		return nil, false
+		return nil, nil, false
 	}
 
-	return &user, true
+	return &user, sessionInfo, true
 }
 
 func buildCASRedirectURL(service, ticket string) string {
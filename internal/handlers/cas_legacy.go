@@ -30,6 +30,10 @@ type CASServiceTicket struct {
 	ExpiresAt  time.Time `json:"expires_at" gorm:"not null"`
 	Used       bool      `json:"used" gorm:"default:false"`
 	Attributes string    `json:"attributes" gorm:"type:text"` // JSON格式的用户属性
+	// SessionIndex 签发票据的平台会话索引，单点注销时据此通知应用
+	SessionIndex string `json:"session_index" gorm:"type:varchar(64);index"`
+	// FromNewLogin 票据是否由本次输入凭据登录签发，renew验证时要求为true
+	FromNewLogin bool `json:"from_new_login" gorm:"default:false"`
 }
 
 // TableName 指定表名
@@ -45,6 +49,7 @@ type CASProxyTicket struct {
 	UserID              string    `json:"user_id" gorm:"type:varchar(36);not null;index"`
 	Username            string    `json:"username" gorm:"type:varchar(100);not null"`
 	ProxyGrantingTicket string    `json:"proxy_granting_ticket" gorm:"type:varchar(255)"`
+	Proxies             string    `json:"proxies" gorm:"type:text"` // JSON数组，代理链回调地址，最近的代理在前
 	ExpiresAt           time.Time `json:"expires_at" gorm:"not null"`
 	Used                bool      `json:"used" gorm:"default:false"`
 }
@@ -57,11 +62,15 @@ func (CASProxyTicket) TableName() string {
 // CASProxyGrantingTicket CAS代理授权票据
 type CASProxyGrantingTicket struct {
 	models.BaseModel
-	Ticket    string    `json:"ticket" gorm:"type:varchar(255);uniqueIndex;not null"`
-	UserID    string    `json:"user_id" gorm:"type:varchar(36);not null;index"`
-	Username  string    `json:"username" gorm:"type:varchar(100);not null"`
-	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
-	Used      bool      `json:"used" gorm:"default:false"`
+	Ticket           string    `json:"ticket" gorm:"type:varchar(255);uniqueIndex;not null"`
+	UserID           string    `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	Username         string    `json:"username" gorm:"type:varchar(100);not null"`
+	Service          string    `json:"service" gorm:"type:varchar(500)"`            // 获得PGT的代理服务
+	ProxyCallbackURL string    `json:"proxy_callback_url" gorm:"type:varchar(500)"` // pgtUrl回调地址
+	Proxies          string    `json:"proxies" gorm:"type:text"`                    // JSON数组，包含本代理在内的代理链
+	SessionIndex     string    `json:"session_index" gorm:"type:varchar(64);index"` // 平台会话索引，注销时撤销
+	ExpiresAt        time.Time `json:"expires_at" gorm:"not null"`
+	Used             bool      `json:"used" gorm:"default:false"`
 }
 
 // TableName 指定表名
@@ -117,7 +126,8 @@ func CASLoginHandler(c *gin.Context) {
 			cfg := config.GetConfig()
 			jwtManager := utils.NewJWTManager(&cfg.JWT)
 			claims, err := jwtManager.ValidateAccessToken(token)
-			if err == nil && claims != nil {
+			// 代登录令牌不能用于登录应用
+			if err == nil && claims != nil && claims.Act == nil {
 				// 获取用户信息
 				if err := database.DB.Where("id = ?", claims.UserID).First(&user).Error; err == nil {
 					isLoggedIn = true
@@ -291,6 +301,7 @@ func CASLoginSubmitHandler(c *gin.Context) {
 		})
 		return
 	}
+	rehashPasswordIfNeeded(&user, req.Password)
 
 	// 创建session
 	sessionManager := GetSessionManager()
@@ -345,137 +356,48 @@ func CASLoginSubmitHandler(c *gin.Context) {
 }
 
 // CASProxyValidateHandler CAS 2.0代理票据验证处理器
+// 同时接受服务票据和代理票据，代理票据返回经过的代理链
 func CASProxyValidateHandler(c *gin.Context) {
-	service := c.Query("service")
-	ticket := c.Query("ticket")
-	pgtUrl := c.Query("pgtUrl")
-
-	logger.Info("CAS proxy validate request",
-		zap.String("service", service),
-		zap.String("ticket", ticket),
-		zap.String("pgtUrl", pgtUrl),
-		zap.String("ip", c.ClientIP()),
-	)
-
-	// 验证参数
-	if service == "" || ticket == "" {
-		c.XML(http.StatusBadRequest, gin.H{
-			"cas:serviceResponse": gin.H{
-				"cas:authenticationFailure": "INVALID_REQUEST",
-			},
-		})
-		return
-	}
-
-	// 查找并验证票据
-	var serviceTicket CASServiceTicket
-	if err := database.DB.Where("ticket = ? AND service = ? AND used = ? AND expires_at > ?", ticket, service, false, time.Now()).First(&serviceTicket).Error; err != nil {
-		logger.ErrorError("Invalid or expired ticket", zap.Error(err))
-		c.Header("Content-Type", "application/xml")
-		c.String(http.StatusOK, `<?xml version="1.0"?>
-<cas:serviceResponse xmlns:cas='http://www.yale.edu/tp/cas'>
-    <cas:authenticationFailure code='INVALID_TICKET'>Ticket not found or expired</cas:authenticationFailure>
-</cas:serviceResponse>`)
-		return
-	}
-
-	// 标记票据为已使用
-	serviceTicket.Used = true
-	database.DB.Save(&serviceTicket)
-
-	// 获取用户信息
-	var user models.User
-	if err := database.DB.Where("id = ?", serviceTicket.UserID).First(&user).Error; err != nil {
-		logger.ErrorError("User not found", zap.Error(err))
-		c.XML(http.StatusOK, gin.H{
-			"cas:serviceResponse": gin.H{
-				"cas:authenticationFailure": "INTERNAL_ERROR",
-			},
-		})
-		return
-	}
-
-	// 获取应用信息
-	var application models.Application
-	var attributeMapping utils.CASAttributeMapping
-	if err := database.DB.Where("service_url = ? AND protocol = ? AND status = ?", service, "cas", 1).First(&application).Error; err != nil {
-		logger.ErrorError("Application not found", zap.Error(err))
-		// 使用默认映射
-		attributeMapping = utils.GetDefaultCASAttributeMapping()
-	} else {
-		// 获取应用的属性映射配置
-		var err error
-		attributeMapping, err = utils.ParseAttributeMapping(application.AttributeMapping)
-		if err != nil {
-			logger.ErrorError("Failed to parse attribute mapping", zap.Error(err))
-			// 使用默认映射
-			attributeMapping = utils.GetDefaultCASAttributeMapping()
-		}
-	}
-
-	// 构建用户属性
-	userAttributes := utils.BuildUserAttributes(&user, attributeMapping)
-
-	// 返回CAS 2.0 XML响应
-	response := gin.H{
-		"cas:serviceResponse": gin.H{
-			"cas:authenticationSuccess": gin.H{
-				"cas:user":       user.Username,
-				"cas:attributes": userAttributes,
-			},
-		},
-	}
-
-	// 如果提供了pgtUrl，生成Proxy Granting Ticket
-	if pgtUrl != "" {
-		// TODO: 实现Proxy Granting Ticket生成
-		logger.Info("Proxy Granting Ticket requested", zap.String("pgtUrl", pgtUrl))
-	}
-
-	c.XML(http.StatusOK, response)
-
-	logger.Info("CAS proxy ticket validated successfully",
-		zap.String("username", user.Username),
-		zap.String("service", service),
-		zap.String("ticket", ticket),
-	)
+	handleCASTicketValidation(c, true, false)
 }
 
-// CASProxyHandler CAS代理服务处理器
+// CASProxyHandler CAS代理服务处理器，使用PGT为目标服务签发代理票据
 func CASProxyHandler(c *gin.Context) {
 	targetService := c.Query("targetService")
 	pgt := c.Query("pgt")
+	format := casResponseFormat(c)
 
 	logger.Info("CAS proxy request",
 		zap.String("targetService", targetService),
-		zap.String("pgt", pgt),
 		zap.String("ip", c.ClientIP()),
 	)
 
 	// 验证参数
 	if targetService == "" || pgt == "" {
-		c.XML(http.StatusBadRequest, gin.H{
-			"cas:serviceResponse": gin.H{
-				"cas:proxyFailure": "INVALID_REQUEST",
-			},
+		writeCASResponse(c, format, &casServiceResponse{
+			ProxyFailure: &casFailure{Code: casErrorInvalidRequest, Description: "pgt and targetService parameters are required"},
 		})
 		return
 	}
 
-	// TODO: 验证Proxy Granting Ticket并生成Proxy Ticket
-	// 这里需要实现完整的代理票据逻辑
+	proxyTicket, code := issueProxyTicket(pgt, targetService)
+	if proxyTicket == "" {
+		logger.ErrorWarn("CAS proxy ticket request rejected",
+			zap.String("targetService", targetService),
+			zap.String("code", code),
+		)
+		writeCASResponse(c, format, &casServiceResponse{
+			ProxyFailure: &casFailure{Code: code, Description: "Proxy ticket could not be issued"},
+		})
+		return
+	}
 
-	c.XML(http.StatusOK, gin.H{
-		"cas:serviceResponse": gin.H{
-			"cas:proxySuccess": gin.H{
-				"cas:proxyTicket": "PT-EXAMPLE-TICKET",
-			},
-		},
+	writeCASResponse(c, format, &casServiceResponse{
+		ProxySuccess: &casProxySuccess{ProxyTicket: proxyTicket},
 	})
 
 	logger.Info("CAS proxy ticket generated",
 		zap.String("targetService", targetService),
-		zap.String("pgt", pgt),
 	)
 }
 
@@ -488,35 +410,21 @@ func CASLogoutHandler(c *gin.Context) {
 		zap.String("ip", c.ClientIP()),
 	)
 
-	// 清除session
-	sessionID := c.GetHeader("X-Session-ID")
+	// 优先使用平台SSO会话，兼容旧的会话头和cookie
+	sessionID, _ := c.Cookie("cas_session")
+	if sessionID == "" {
+		sessionID = c.GetHeader("X-Session-ID")
+	}
 	if sessionID == "" {
 		cookie, err := c.Cookie("session_id")
 		if err == nil {
 			sessionID = cookie
 		}
 	}
+	c.SetCookie("session_id", "", -1, "/", "", false, true)
 
-	if sessionID != "" {
-		sessionManager := GetSessionManager()
-		if sessionManager != nil {
-			ctx := c.Request.Context()
-			sessionManager.DeleteSession(ctx, sessionID)
-		}
-		// 清除cookie
-		c.SetCookie("session_id", "", -1, "/", "", false, true)
-	}
-
-	// 如果指定了service，重定向到service
-	if service != "" {
-		c.Redirect(http.StatusFound, service)
-		return
-	}
-
-	// 否则返回登出成功页面
-	c.HTML(http.StatusOK, "cas_logout.html", gin.H{
-		"title": "CAS Logout",
-	})
+	// 通知会话中的所有应用注销，全部成功且指定了service时重定向到service
+	startBrowserLogout(c, sessionID, service, nil)
 }
 
 // generateServiceTicket 生成服务票据
@@ -537,7 +445,7 @@ func generateServiceTicket(user *models.User, service string, application *model
 	}
 
 	// 构建用户属性
-	userAttributes := utils.BuildUserAttributes(user, attributeMapping)
+	userAttributes := casUserAttributes(user, attributeMapping)
 	attributesJSON, _ := json.Marshal(userAttributes)
 
 	// 创建服务票据记录
@@ -640,7 +548,12 @@ func CASServiceValidateHandler(c *gin.Context) {
 	// 处理代理授权票据（如果提供）
 	var pgtIou string
 	if pgtUrl != "" {
-		pgtIou = generateProxyGrantingTicket(&user, pgtUrl)
+		pgtIou = issueProxyGrantingTicket(&casValidation{
+			UserID:       user.ID,
+			Username:     user.Username,
+			Service:      service,
+			SessionIndex: serviceTicket.SessionIndex,
+		}, pgtUrl)
 	}
 
 	// 获取应用信息
@@ -662,7 +575,7 @@ func CASServiceValidateHandler(c *gin.Context) {
 	}
 
 	// 构建用户属性
-	userAttributes := utils.BuildUserAttributes(&user, attributeMapping)
+	userAttributes := casUserAttributes(&user, attributeMapping)
 
 	// 返回成功响应 - CAS 2.0 serviceValidate默认返回XML格式
 	response := fmt.Sprintf(`<?xml version="1.0"?>
@@ -694,43 +607,3 @@ func CASServiceValidateHandler(c *gin.Context) {
 		zap.String("ticket", ticket),
 	)
 }
-
-// generateProxyGrantingTicket 生成代理授权票据
-func generateProxyGrantingTicket(user *models.User, pgtUrl string) string {
-	// 生成随机票据
-	ticketBytes := make([]byte, 32)
-	if _, err := rand.Read(ticketBytes); err != nil {
-		return ""
-	}
-	ticket := "PGT-" + base64.URLEncoding.EncodeToString(ticketBytes)
-
-	// 创建代理授权票据记录
-	pgt := CASProxyGrantingTicket{
-		Ticket:    ticket,
-		UserID:    user.ID,
-		Username:  user.Username,
-		ExpiresAt: time.Now().Add(2 * time.Hour), // 2小时过期
-		Used:      false,
-	}
-
-	if err := database.DB.Create(&pgt).Error; err != nil {
-		return ""
-	}
-
-	// 生成PGTIOU
-	pgtIouBytes := make([]byte, 16)
-	if _, err := rand.Read(pgtIouBytes); err != nil {
-		return ""
-	}
-	pgtIou := "PGTIOU-" + base64.URLEncoding.EncodeToString(pgtIouBytes)
-
-	// 这里应该向pgtUrl发送回调，包含pgt和pgtIou
-	// 为了简化，我们直接返回pgtIou
-	logger.Info("Proxy granting ticket generated",
-		zap.String("ticket", ticket),
-		zap.String("pgtIou", pgtIou),
-		zap.String("username", user.Username),
-	)
-
-	return pgtIou
-}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/utils"
+)
+
+// casProxyCallbackTimeout pgtUrl回调超时时间
+const casProxyCallbackTimeout = 10 * time.Second
+
+// CAS协议错误码
+const (
+	casErrorInvalidRequest      = "INVALID_REQUEST"
+	casErrorInvalidTicket       = "INVALID_TICKET"
+	casErrorInvalidTicketSpec   = "INVALID_TICKET_SPEC"
+	casErrorInvalidService      = "INVALID_SERVICE"
+	casErrorUnauthorizedService = "UNAUTHORIZED_SERVICE"
+	casErrorInternal            = "INTERNAL_ERROR"
+)
+
+// casValidation 票据验证结果
+type casValidation struct {
+	UserID       string
+	Username     string
+	Service      string
+	SessionIndex string
+	FromNewLogin bool
+	// Proxies 代理票据经过的代理链，最近的代理在前；服务票据为空
+	Proxies []string
+}
+
+// casServiceResponse CAS验证及代理接口的XML响应
+type casServiceResponse struct {
+	XMLName               xml.Name                  `xml:"cas:serviceResponse"`
+	Namespace             string                    `xml:"xmlns:cas,attr"`
+	AuthenticationSuccess *casAuthenticationSuccess `xml:"cas:authenticationSuccess,omitempty"`
+	AuthenticationFailure *casFailure               `xml:"cas:authenticationFailure,omitempty"`
+	ProxySuccess          *casProxySuccess          `xml:"cas:proxySuccess,omitempty"`
+	ProxyFailure          *casFailure               `xml:"cas:proxyFailure,omitempty"`
+}
+
+type casAuthenticationSuccess struct {
+	User string `xml:"cas:user"`
+	// AttributesXML 由utils.FormatAttributesForCAS生成的cas:attributes元素
+	AttributesXML       string                 `xml:",innerxml"`
+	ProxyGrantingTicket string                 `xml:"cas:proxyGrantingTicket,omitempty"`
+	Proxies             *casProxies            `xml:"cas:proxies,omitempty"`
+	Attributes          map[string]interface{} `xml:"-"`
+}
+
+type casProxies struct {
+	Proxy []string `xml:"cas:proxy"`
+}
+
+type casProxySuccess struct {
+	ProxyTicket string `xml:"cas:proxyTicket"`
+}
+
+type casFailure struct {
+	Code        string `xml:"code,attr"`
+	Description string `xml:",chardata"`
+}
+
+// writeCASResponse 按format输出CAS响应，json格式去掉cas:前缀
+func writeCASResponse(c *gin.Context, format string, response *casServiceResponse) {
+	if strings.EqualFold(format, "json") {
+		body := gin.H{}
+		if s := response.AuthenticationSuccess; s != nil {
+			success := gin.H{"user": s.User}
+			if len(s.Attributes) > 0 {
+				success["attributes"] = utils.FormatAttributesForJSON(s.Attributes)
+			}
+			if s.ProxyGrantingTicket != "" {
+				success["proxyGrantingTicket"] = s.ProxyGrantingTicket
+			}
+			if s.Proxies != nil {
+				success["proxies"] = s.Proxies.Proxy
+			}
+			body["authenticationSuccess"] = success
+		}
+		if f := response.AuthenticationFailure; f != nil {
+			body["authenticationFailure"] = gin.H{"code": f.Code, "description": f.Description}
+		}
+		if s := response.ProxySuccess; s != nil {
+			body["proxySuccess"] = gin.H{"proxyTicket": s.ProxyTicket}
+		}
+		if f := response.ProxyFailure; f != nil {
+			body["proxyFailure"] = gin.H{"code": f.Code, "description": f.Description}
+		}
+		c.JSON(http.StatusOK, gin.H{"serviceResponse": body})
+		return
+	}
+
+	response.Namespace = "http://www.yale.edu/tp/cas"
+	output, err := xml.MarshalIndent(response, "", "    ")
+	if err != nil {
+		logger.ErrorError("Failed to marshal CAS response", zap.Error(err))
+		c.String(http.StatusInternalServerError, "Internal error")
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), output...))
+}
+
+// writeCASAuthenticationFailure 输出票据验证失败响应
+func writeCASAuthenticationFailure(c *gin.Context, format, code, description string) {
+	writeCASResponse(c, format, &casServiceResponse{
+		AuthenticationFailure: &casFailure{Code: code, Description: description},
+	})
+}
+
+// writeCASAuthenticationSuccess 输出票据验证成功响应
+func writeCASAuthenticationSuccess(c *gin.Context, format string, validation *casValidation, attributes map[string]interface{}, pgtIou string) {
+	success := &casAuthenticationSuccess{
+		User:                validation.Username,
+		AttributesXML:       utils.FormatAttributesForCAS(attributes),
+		ProxyGrantingTicket: pgtIou,
+		Attributes:          attributes,
+	}
+	if len(validation.Proxies) > 0 {
+		success.Proxies = &casProxies{Proxy: validation.Proxies}
+	}
+	writeCASResponse(c, format, &casServiceResponse{AuthenticationSuccess: success})
+}
+
+// newCASTicketID 生成带前缀的随机票据
+func newCASTicketID(prefix string, size int) (string, error) {
+	ticketBytes := make([]byte, size)
+	if _, err := rand.Read(ticketBytes); err != nil {
+		return "", err
+	}
+	return prefix + "-" + base64.RawURLEncoding.EncodeToString(ticketBytes), nil
+}
+
+// findCASApplication 查找服务地址对应的已启用CAS应用
+func findCASApplication(service string) (*models.Application, error) {
+	var application models.Application
+	if err := database.DB.Where("service_url = ? AND protocol = ? AND status = ?", service, "cas", 1).First(&application).Error; err != nil {
+		return nil, err
+	}
+	return &application, nil
+}
+
+// parseProxyCallbackPatterns 解析应用配置的代理回调地址正则，每行或逗号分隔一个，整串匹配
+func parseProxyCallbackPatterns(patterns string) ([]*regexp.Regexp, error) {
+	var result []*regexp.Regexp
+	for _, pattern := range strings.FieldsFunc(patterns, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ','
+	}) {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy callback pattern %q: %w", pattern, err)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
+
+// checkProxyCallbackAllowed 检查应用是否允许代理以及pgtUrl是否为允许的HTTPS地址
+func checkProxyCallbackAllowed(app *models.Application, pgtURL string) error {
+	if !app.AllowProxy {
+		return errors.New("proxy is not allowed for this service")
+	}
+
+	u, err := url.Parse(pgtURL)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid pgtUrl")
+	}
+	if u.Scheme != "https" {
+		return errors.New("pgtUrl must use https")
+	}
+
+	patterns, err := parseProxyCallbackPatterns(app.ProxyCallbackPatterns)
+	if err != nil {
+		return err
+	}
+	for _, re := range patterns {
+		if re.MatchString(pgtURL) {
+			return nil
+		}
+	}
+	return errors.New("pgtUrl is not an allowed proxy callback")
+}
+
+// issueProxyGrantingTicket 为验证通过的票据签发PGT，回调pgtUrl成功后返回PGTIOU
+// 任何失败都只记录日志并返回空字符串，票据验证本身仍然成功
+func issueProxyGrantingTicket(validation *casValidation, pgtURL string) string {
+	app, err := findCASApplication(validation.Service)
+	if err != nil {
+		logger.ErrorWarn("Proxy granting ticket requested for unregistered service",
+			zap.String("service", validation.Service),
+			zap.String("pgtUrl", pgtURL),
+		)
+		return ""
+	}
+	if err := checkProxyCallbackAllowed(app, pgtURL); err != nil {
+		logger.ErrorWarn("Proxy callback rejected",
+			zap.String("service", validation.Service),
+			zap.String("pgtUrl", pgtURL),
+			zap.Error(err),
+		)
+		return ""
+	}
+
+	pgtIou, err := newCASTicketID("PGTIOU", 32)
+	if err != nil {
+		return ""
+	}
+
+	// 先保存PGT再回调，回调失败时撤销
+	ctx := context.Background()
+	pgtID, err := casTicketManager.IssueTicket(ctx, &CASTicket{
+		Type:             casTicketTypePGT,
+		UserID:           validation.UserID,
+		Username:         validation.Username,
+		Service:          validation.Service,
+		SessionIndex:     validation.SessionIndex,
+		ProxyCallbackURL: pgtURL,
+		Proxies:          append([]string{pgtURL}, validation.Proxies...),
+	})
+	if err != nil {
+		logger.ErrorError("Failed to save proxy granting ticket", zap.Error(err))
+		return ""
+	}
+
+	if err := sendProxyCallback(pgtURL, pgtID, pgtIou); err != nil {
+		logger.ErrorWarn("Proxy callback failed",
+			zap.String("service", validation.Service),
+			zap.String("pgtUrl", pgtURL),
+			zap.Error(err),
+		)
+		if err := casTicketManager.registry.Delete(ctx, pgtID); err != nil {
+			logger.ErrorError("Failed to revoke proxy granting ticket", zap.Error(err))
+		}
+		return ""
+	}
+
+	logger.Info("Proxy granting ticket issued",
+		zap.String("username", validation.Username),
+		zap.String("service", validation.Service),
+		zap.String("pgtUrl", pgtURL),
+		zap.Int("proxy_depth", len(validation.Proxies)+1),
+	)
+	return pgtIou
+}
+
+// sendProxyCallback 通过HTTPS回调pgtUrl传递pgtId和pgtIou，回调地址必须返回200且不跟随重定向
+func sendProxyCallback(pgtURL, pgtID, pgtIou string) error {
+	u, err := url.Parse(pgtURL)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set("pgtId", pgtID)
+	query.Set("pgtIou", pgtIou)
+	u.RawQuery = query.Encode()
+
+	client := &http.Client{
+		Timeout: casProxyCallbackTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// validateCASTicket 验证服务票据，allowProxyTickets为true时同时接受代理票据
+func validateCASTicket(ticket, service string, allowProxyTickets bool) (*casValidation, string) {
+	if strings.HasPrefix(ticket, "PT-") {
+		if !allowProxyTickets {
+			return nil, casErrorInvalidTicketSpec
+		}
+		return validateProxyTicket(ticket, service)
+	}
+
+	serviceTicket, valid := casTicketManager.ValidateServiceTicket(ticket, service)
+	if !valid {
+		return nil, casErrorInvalidTicket
+	}
+	return &casValidation{
+		UserID:       serviceTicket.UserID,
+		Username:     serviceTicket.Username,
+		Service:      serviceTicket.Service,
+		SessionIndex: serviceTicket.SessionIndex,
+		FromNewLogin: serviceTicket.FromNewLogin,
+	}, ""
+}
+
+// validateProxyTicket 验证并消费代理票据，票据只能使用一次
+func validateProxyTicket(ticket, service string) (*casValidation, string) {
+	proxyTicket, err := casTicketManager.ConsumeTicket(context.Background(), ticket, casTicketTypePT)
+	if err != nil {
+		if !errors.Is(err, errCASTicketNotFound) {
+			logger.ErrorError("Failed to consume proxy ticket", zap.Error(err))
+			return nil, casErrorInternal
+		}
+		return nil, casErrorInvalidTicket
+	}
+	if proxyTicket.Service != service {
+		return nil, casErrorInvalidService
+	}
+
+	return &casValidation{
+		UserID:       proxyTicket.UserID,
+		Username:     proxyTicket.Username,
+		Service:      proxyTicket.Service,
+		SessionIndex: proxyTicket.SessionIndex,
+		Proxies:      proxyTicket.Proxies,
+	}, ""
+}
+
+// issueProxyTicket 使用PGT为目标服务签发代理票据
+func issueProxyTicket(pgtID, targetService string) (string, string) {
+	ctx := context.Background()
+	pgt, err := casTicketManager.GetTicket(ctx, pgtID, casTicketTypePGT)
+	if err != nil {
+		if !errors.Is(err, errCASTicketNotFound) {
+			logger.ErrorError("Failed to load proxy granting ticket", zap.Error(err))
+			return "", casErrorInternal
+		}
+		return "", casErrorInvalidTicket
+	}
+
+	if _, err := findCASApplication(targetService); err != nil {
+		return "", casErrorUnauthorizedService
+	}
+
+	// 代理票据继承PGT的会话索引，注销时一并撤销
+	ticket, err := casTicketManager.IssueTicket(ctx, &CASTicket{
+		Type:                casTicketTypePT,
+		UserID:              pgt.UserID,
+		Username:            pgt.Username,
+		Service:             targetService,
+		SessionIndex:        pgt.SessionIndex,
+		ProxyGrantingTicket: pgt.ID,
+		Proxies:             pgt.Proxies,
+	})
+	if err != nil {
+		logger.ErrorError("Failed to save proxy ticket", zap.Error(err))
+		return "", casErrorInternal
+	}
+	return ticket, ""
+}
+
+// revokeSessionCASTickets 撤销会话签发的所有CAS票据，包括未验证的ST和PGT
+func revokeSessionCASTickets(sessionID string) {
+	if sessionID == "" || casTicketManager == nil {
+		return
+	}
+	if err := casTicketManager.RevokeSession(context.Background(), ssoSessionIndex(sessionID)); err != nil {
+		logger.ErrorError("Failed to revoke CAS tickets", zap.Error(err))
+	}
+}
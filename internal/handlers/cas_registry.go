@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"eiam-platform/config"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/logger"
+)
+
+// CAS票据类型
+const (
+	casTicketTypeST  = "ST"
+	casTicketTypePT  = "PT"
+	casTicketTypePGT = "PGT"
+	casTicketTypeTGT = "TGT"
+)
+
+const (
+	casTicketKeyPrefix  = "cas:ticket:"
+	casSessionKeyPrefix = "cas:session:"
+)
+
+// errCASTicketNotFound 票据不存在、已过期或已被使用
+var errCASTicketNotFound = errors.New("ticket not found")
+
+// CASTicketRegistry CAS票据存储
+// Consume必须是原子的：并发消费同一票据时只有一个调用方能拿到票据
+type CASTicketRegistry interface {
+	// Add 保存票据，ttl到期后自动失效
+	Add(ctx context.Context, ticket *CASTicket, ttl time.Duration) error
+	// Get 读取票据但不消费
+	Get(ctx context.Context, id string) (*CASTicket, error)
+	// Consume 取出并删除票据
+	Consume(ctx context.Context, id string) (*CASTicket, error)
+	// Delete 删除票据
+	Delete(ctx context.Context, id string) error
+	// DeleteBySession 删除平台会话签发的所有票据
+	DeleteBySession(ctx context.Context, sessionIndex string) error
+}
+
+// newCASTicketRegistry 根据配置创建票据存储，默认使用Redis
+func newCASTicketRegistry(cfg *config.CASConfig, client *redis.Client) (CASTicketRegistry, string) {
+	if cfg.TicketRegistry == "memory" || client == nil {
+		return newMemoryCASTicketRegistry(), "memory"
+	}
+	return newRedisCASTicketRegistry(client), "redis"
+}
+
+// casTicketTTLs 各类票据有效期
+type casTicketTTLs map[string]time.Duration
+
+// newCASTicketTTLs 读取配置的票据有效期，未配置的类型使用默认值
+func newCASTicketTTLs(cfg *config.CASConfig) casTicketTTLs {
+	ttl := func(seconds int, fallback time.Duration) time.Duration {
+		if seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return fallback
+	}
+	return casTicketTTLs{
+		casTicketTypeST:  ttl(cfg.ServiceTicketTTL, 5*time.Minute),
+		casTicketTypePT:  ttl(cfg.ProxyTicketTTL, 5*time.Minute),
+		casTicketTypePGT: ttl(cfg.ProxyGrantingTicketTTL, 2*time.Hour),
+		casTicketTypeTGT: ttl(cfg.TicketGrantingTicketTTL, 24*time.Hour),
+	}
+}
+
+// redisCASTicketRegistry 基于Redis的票据存储，多实例共享
+type redisCASTicketRegistry struct {
+	client *redis.Client
+}
+
+// getDelScript 原子地读取并删除键，兼容不支持GETDEL的Redis版本
+var getDelScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if value then
+	redis.call('DEL', KEYS[1])
+end
+return value
+`)
+
+// casSessionIndexScript 将票据加入会话索引，索引有效期取最长的票据有效期
+var casSessionIndexScript = redis.NewScript(`
+redis.call('SADD', KEYS[1], ARGV[1])
+if redis.call('TTL', KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+func newRedisCASTicketRegistry(client *redis.Client) *redisCASTicketRegistry {
+	return &redisCASTicketRegistry{client: client}
+}
+
+func (r *redisCASTicketRegistry) Add(ctx context.Context, ticket *CASTicket, ttl time.Duration) error {
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+	ok, err := r.client.SetNX(ctx, casTicketKeyPrefix+ticket.ID, data, ttl).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("ticket already exists")
+	}
+
+	if ticket.SessionIndex != "" {
+		seconds := int(ttl / time.Second)
+		if err := casSessionIndexScript.Run(ctx, r.client, []string{casSessionKeyPrefix + ticket.SessionIndex}, ticket.ID, seconds).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *redisCASTicketRegistry) Get(ctx context.Context, id string) (*CASTicket, error) {
+	data, err := r.client.Get(ctx, casTicketKeyPrefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errCASTicketNotFound
+		}
+		return nil, err
+	}
+	return decodeCASTicket(data)
+}
+
+func (r *redisCASTicketRegistry) Consume(ctx context.Context, id string) (*CASTicket, error) {
+	value, err := getDelScript.Run(ctx, r.client, []string{casTicketKeyPrefix + id}).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errCASTicketNotFound
+		}
+		return nil, err
+	}
+	return decodeCASTicket([]byte(value))
+}
+
+func (r *redisCASTicketRegistry) Delete(ctx context.Context, id string) error {
+	return r.client.Del(ctx, casTicketKeyPrefix+id).Err()
+}
+
+func (r *redisCASTicketRegistry) DeleteBySession(ctx context.Context, sessionIndex string) error {
+	indexKey := casSessionKeyPrefix + sessionIndex
+	ids, err := r.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(ids)+1)
+	for _, id := range ids {
+		keys = append(keys, casTicketKeyPrefix+id)
+	}
+	keys = append(keys, indexKey)
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// decodeCASTicket 解析Redis中保存的票据
+func decodeCASTicket(data []byte) (*CASTicket, error) {
+	var ticket CASTicket
+	if err := json.Unmarshal(data, &ticket); err != nil {
+		return nil, err
+	}
+	if time.Now().After(ticket.ExpiresAt) {
+		return nil, errCASTicketNotFound
+	}
+	return &ticket, nil
+}
+
+// memoryCASTicketRegistry 进程内票据存储，仅适用于单实例部署
+type memoryCASTicketRegistry struct {
+	mu    sync.Mutex
+	cache *cache.Cache
+}
+
+func newMemoryCASTicketRegistry() *memoryCASTicketRegistry {
+	return &memoryCASTicketRegistry{cache: cache.New(5*time.Minute, 10*time.Minute)}
+}
+
+func (r *memoryCASTicketRegistry) Add(_ context.Context, ticket *CASTicket, ttl time.Duration) error {
+	return r.cache.Add(ticket.ID, ticket, ttl)
+}
+
+func (r *memoryCASTicketRegistry) Get(_ context.Context, id string) (*CASTicket, error) {
+	item, found := r.cache.Get(id)
+	if !found {
+		return nil, errCASTicketNotFound
+	}
+	ticket := *item.(*CASTicket)
+	return &ticket, nil
+}
+
+func (r *memoryCASTicketRegistry) Consume(_ context.Context, id string) (*CASTicket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	item, found := r.cache.Get(id)
+	if !found {
+		return nil, errCASTicketNotFound
+	}
+	r.cache.Delete(id)
+	return item.(*CASTicket), nil
+}
+
+func (r *memoryCASTicketRegistry) Delete(_ context.Context, id string) error {
+	r.cache.Delete(id)
+	return nil
+}
+
+func (r *memoryCASTicketRegistry) DeleteBySession(_ context.Context, sessionIndex string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, item := range r.cache.Items() {
+		if item.Object.(*CASTicket).SessionIndex == sessionIndex {
+			r.cache.Delete(id)
+		}
+	}
+	return nil
+}
+
+var casTicketJanitorOnce sync.Once
+
+// startCASTicketJanitor 定期清理票据表中的过期记录
+// 服务票据记录用于单点注销查找会话中的应用，保留到TGT有效期之后再删除
+func startCASTicketJanitor(interval, retention time.Duration) {
+	casTicketJanitorOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				cleanupCASTickets(retention)
+			}
+		}()
+	})
+}
+
+// cleanupCASTickets 删除过期超过retention的票据记录
+func cleanupCASTickets(retention time.Duration) {
+	cutoff := time.Now().Add(-retention)
+	tables := []interface{ TableName() string }{&CASServiceTicket{}, &CASProxyTicket{}, &CASProxyGrantingTicket{}}
+	for _, table := range tables {
+		result := database.DB.Unscoped().Where("expires_at < ?", cutoff).Delete(table)
+		if result.Error != nil {
+			logger.ErrorWarn("Failed to clean up CAS tickets", zap.Error(result.Error))
+			continue
+		}
+		if result.RowsAffected > 0 {
+			logger.Info("Cleaned up expired CAS tickets",
+				zap.String("table", table.TableName()),
+				zap.Int64("rows", result.RowsAffected),
+			)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/utils"
+)
+
+// CASP3ServiceValidateHandler CAS 3.0服务票据验证处理器
+func CASP3ServiceValidateHandler(c *gin.Context) {
+	handleCASTicketValidation(c, false, true)
+}
+
+// CASP3ProxyValidateHandler CAS 3.0代理票据验证处理器
+func CASP3ProxyValidateHandler(c *gin.Context) {
+	handleCASTicketValidation(c, true, true)
+}
+
+// handleCASTicketValidation 验证服务票据或代理票据并返回用户及属性
+// allowProxyTickets为true时接受代理票据，casV3为true时附加CAS 3.0认证属性
+func handleCASTicketValidation(c *gin.Context, allowProxyTickets, casV3 bool) {
+	service := c.Query("service")
+	ticket := c.Query("ticket")
+	pgtURL := c.Query("pgtUrl")
+	renew := casBoolParam(c, "renew")
+	format := casResponseFormat(c)
+
+	logger.Info("CAS ticket validate request",
+		zap.String("path", c.Request.URL.Path),
+		zap.String("service", service),
+		zap.String("ticket", ticket),
+		zap.String("pgtUrl", pgtURL),
+		zap.Bool("renew", renew),
+		zap.String("format", format),
+		zap.String("ip", c.ClientIP()),
+	)
+
+	// 验证参数
+	if service == "" || ticket == "" {
+		writeCASAuthenticationFailure(c, format, casErrorInvalidRequest, "service and ticket parameters are required")
+		return
+	}
+
+	// 查找并验证票据
+	validation, code := validateCASTicket(ticket, service, allowProxyTickets)
+	if validation == nil {
+		logger.ErrorWarn("CAS ticket validation failed",
+			zap.String("service", service),
+			zap.String("code", code),
+		)
+		writeCASAuthenticationFailure(c, format, code, "Ticket not found or expired")
+		return
+	}
+
+	application, appErr := findCASApplication(service)
+
+	// renew要求票据由本次输入凭据登录签发，应用也可以强制要求
+	if (renew || (appErr == nil && application.Renew)) && !validation.FromNewLogin {
+		writeCASAuthenticationFailure(c, format, casErrorInvalidTicket, "Ticket was not issued from a new login")
+		return
+	}
+
+	// 获取用户信息
+	var user models.User
+	if err := database.DB.Where("id = ?", validation.UserID).First(&user).Error; err != nil {
+		logger.ErrorError("User not found", zap.Error(err))
+		writeCASAuthenticationFailure(c, format, casErrorInternal, "User not found")
+		return
+	}
+
+	// 获取应用的属性映射配置
+	var attributeMapping utils.CASAttributeMapping
+	if appErr != nil {
+		logger.ErrorWarn("Application not found", zap.String("service", service), zap.Error(appErr))
+		// 使用默认映射
+		attributeMapping = utils.GetDefaultCASAttributeMapping()
+	} else {
+		var err error
+		attributeMapping, err = utils.ParseAttributeMapping(application.AttributeMapping)
+		if err != nil {
+			logger.ErrorError("Failed to parse attribute mapping", zap.Error(err))
+			// 使用默认映射
+			attributeMapping = utils.GetDefaultCASAttributeMapping()
+		}
+	}
+
+	// 构建用户属性
+	userAttributes := casUserAttributes(&user, attributeMapping)
+	if casV3 {
+		userAttributes["isFromNewLogin"] = strconv.FormatBool(validation.FromNewLogin)
+		userAttributes["longTermAuthenticationRequestTokenUsed"] = "false"
+	}
+
+	// 如果提供了pgtUrl，回调成功后签发Proxy Granting Ticket
+	var pgtIou string
+	if pgtURL != "" {
+		pgtIou = issueProxyGrantingTicket(validation, pgtURL)
+	}
+
+	writeCASAuthenticationSuccess(c, format, validation, userAttributes, pgtIou)
+
+	logger.Info("CAS ticket validated successfully",
+		zap.String("username", user.Username),
+		zap.String("service", service),
+		zap.Strings("proxies", validation.Proxies),
+	)
+}
+
+// casResponseFormat 解析响应格式：优先使用format参数(不区分大小写)，其次根据Accept头协商，默认XML
+func casResponseFormat(c *gin.Context) string {
+	if format := c.Query("format"); format != "" {
+		if strings.EqualFold(format, "json") {
+			return "json"
+		}
+		return "xml"
+	}
+	if strings.Contains(c.GetHeader("Accept"), "application/json") {
+		return "json"
+	}
+	return "xml"
+}
+
+// casBoolParam 解析renew、gateway等开关参数，出现即视为开启，显式为false时关闭
+func casBoolParam(c *gin.Context, name string) bool {
+	value, ok := c.GetQuery(name)
+	if !ok {
+		return false
+	}
+	return !strings.EqualFold(value, "false") && value != "0"
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/notify"
+	"eiam-platform/pkg/utils"
+)
+
+// ChangeEmailRequest 修改邮箱，新邮箱验证通过后才生效
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"new_email" binding:"required,email"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// VerifyEmailRequest 提交邮箱验证码
+type VerifyEmailRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// SendEmailVerificationHandler 向当前邮箱发送验证码
+func SendEmailVerificationHandler(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	email := otpDestination(user, notify.ChannelEmail)
+	if email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.EmailNotSet,
+			"data":    nil,
+		})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.EmailAlreadyVerified,
+			"data":    nil,
+		})
+		return
+	}
+	if !otpChannelEnabled(notify.ChannelEmail) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.OTPChannelDisabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	// 同一用途的旧验证码会作废，包括尚未确认的邮箱修改
+	if err := issueOneTimeCode(user, otpPurposeVerifyEmail, notify.ChannelEmail, email); err != nil {
+		respondOTPIssueError(c, err)
+		return
+	}
+
+	logger.AccessInfo("Email verification code sent",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("sent_to", maskDestination(email)),
+	)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.EmailVerificationSent,
+		"data": gin.H{
+			"sent_to":    maskDestination(email),
+			"expires_in": int(otpCodeSettings().TTL.Seconds()),
+		},
+	})
+}
+
+// ChangeEmailHandler 校验当前密码后向新邮箱发送验证码，并通知原邮箱
+// 验证通过前账户仍使用原邮箱
+func ChangeEmailHandler(c *gin.Context) {
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+	newEmail := strings.TrimSpace(req.NewEmail)
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CheckPassword(req.CurrentPassword, user.Password) {
+		recordLoginFailure(c, user)
+		logger.AccessInfo("Email change failed: invalid current password",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_id", user.ID),
+			zap.Int("failed_count", user.FailedCount),
+		)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.OldPassword,
+			"data":    nil,
+		})
+		return
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.EmailUnchanged,
+			"data":    nil,
+		})
+		return
+	}
+
+	taken, err := emailTaken(newEmail, user.ID)
+	if err != nil {
+		logger.ErrorError("Failed to check email", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if taken {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.EmailExists,
+			"data":    nil,
+		})
+		return
+	}
+	if !otpChannelEnabled(notify.ChannelEmail) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.OTPChannelDisabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := issueOneTimeCode(user, otpPurposeVerifyEmail, notify.ChannelEmail, newEmail); err != nil {
+		respondOTPIssueError(c, err)
+		return
+	}
+	if user.FailedCount > 0 {
+		database.DB.Model(user).Update("failed_count", 0)
+		clearLoginFailures(c, user)
+	}
+	sendEmailChangeNotice(user, newEmail)
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID,
+		"Email change requested by user: "+user.Username, gin.H{
+			"old_email": user.Email,
+			"new_email": newEmail,
+		})
+	logger.AccessInfo("Email change requested",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("sent_to", maskDestination(newEmail)),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.EmailChangePending,
+		"data": gin.H{
+			"pending_email": newEmail,
+			"expires_in":    int(otpCodeSettings().TTL.Seconds()),
+		},
+	})
+}
+
+// VerifyEmailHandler 校验邮箱验证码，验证码发往新邮箱时同时完成邮箱修改
+func VerifyEmailHandler(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	record, err := verifyOneTimeCode(user.ID, otpPurposeVerifyEmail, req.Code)
+	if err != nil {
+		logger.AccessInfo("Email verification failed",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_id", user.ID),
+			zap.Error(err),
+		)
+		respondOTPVerifyError(c, err)
+		return
+	}
+
+	oldEmail := user.Email
+	changed := !strings.EqualFold(record.SentTo, oldEmail)
+	if changed {
+		// 发送验证码后邮箱可能已被其他账户占用
+		taken, err := emailTaken(record.SentTo, user.ID)
+		if err != nil {
+			logger.ErrorError("Failed to check email", zap.Error(err))
+			respondInternalError(c)
+			return
+		}
+		if taken {
+			consumeOneTimeCode(record)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": i18n.EmailExists,
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	if err := consumeOneTimeCode(record); err != nil {
+		respondOTPVerifyError(c, err)
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"email":             record.SentTo,
+		"email_verified":    true,
+		"email_verified_at": now,
+	}).Error; err != nil {
+		logger.ErrorError("Failed to verify email", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	description := "Email verified by user: " + user.Username
+	if changed {
+		description = "Email changed by user: " + user.Username
+	}
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID, description, gin.H{
+		"old_email": oldEmail,
+		"email":     record.SentTo,
+	})
+	logger.AccessInfo("Email verified",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.Bool("changed", changed),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.SuccessEmailVerified,
+		"data": gin.H{
+			"email":             record.SentTo,
+			"email_verified":    true,
+			"email_verified_at": now,
+		},
+	})
+}
+
+// pendingEmailChange 返回尚未验证的新邮箱，没有待确认的修改时返回空字符串
+func pendingEmailChange(user *models.User) string {
+	var record models.UserOTPRecord
+	err := database.DB.Where("user_id = ? AND purpose = ? AND used = ? AND expires_at > ?",
+		user.ID, otpPurposeVerifyEmail, false, time.Now()).
+		Order("created_at DESC").First(&record).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.ErrorWarn("Failed to get pending email change", zap.String("user_id", user.ID), zap.Error(err))
+		}
+		return ""
+	}
+	if strings.EqualFold(record.SentTo, user.Email) {
+		return ""
+	}
+	return record.SentTo
+}
+
+// emailTaken 检查邮箱是否已被其他账户使用
+func emailTaken(email, userID string) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.User{}).Where("email = ? AND id <> ?", email, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// sendEmailChangeNotice 通知原邮箱有人申请修改邮箱，发送失败只记录日志
+func sendEmailChangeNotice(user *models.User, newEmail string) {
+	oldEmail := otpDestination(user, notify.ChannelEmail)
+	if oldEmail == "" {
+		return
+	}
+
+	site := siteDisplayName()
+	msg := &notify.Message{
+		To:      oldEmail,
+		Subject: site + " email address change requested",
+		Body: fmt.Sprintf("Hello %s,\n\nA request was made to change the email address of your %s account to %s. "+
+			"The change takes effect once the new address is verified.\n\n"+
+			"If you did not make this request, change your password immediately and contact your administrator.",
+			user.Username, site, maskDestination(newEmail)),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := notify.Send(ctx, notify.ChannelEmail, msg); err != nil {
+		logger.ErrorWarn("Failed to send email change notice",
+			zap.String("user_id", user.ID),
+			zap.String("sent_to", maskDestination(oldEmail)),
+			zap.Error(err),
+		)
+	}
+}
+
+// releasableEmail 返回可以下发给应用的邮箱，开启withhold_unverified_email后未验证的邮箱不下发
+func releasableEmail(user *models.User) string {
+	if user.Email == "" || user.EmailVerified {
+		return user.Email
+	}
+	if securitySettingEnabled("withhold_unverified_email", false) {
+		return ""
+	}
+	return user.Email
+}
+
+// casUserAttributes 构建CAS用户属性，邮箱按releasableEmail的规则下发
+func casUserAttributes(user *models.User, mapping utils.CASAttributeMapping) map[string]interface{} {
+	if email := releasableEmail(user); email != user.Email {
+		released := *user
+		released.Email = email
+		user = &released
+	}
+	return utils.BuildUserAttributes(user, mapping)
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"eiam-platform/config"
@@ -40,10 +41,22 @@ func ConsoleLoginHandler(c *gin.Context) {
 		return
 	}
 
+	// IP被封禁或同一IP对该账户失败过多时直接拒绝
+	if !checkLoginThrottle(c, req.Username) {
+		return
+	}
+
+	// 提交了加密密码时解密并校验nonce
+	password, ok := resolveLoginPassword(c, &req)
+	if !ok {
+		return
+	}
+
 	// 获取用户信息
 	var user models.User
 	if err := database.DB.Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			recordLoginFailure(c, nil)
 			logger.AccessInfo("Console login failed: user not found",
 				zap.String("ip", c.ClientIP()),
 				zap.String("username", req.Username),
@@ -83,45 +96,57 @@ func ConsoleLoginHandler(c *gin.Context) {
 		return
 	}
 
-	// 验证密码
-	if !utils.CheckPassword(req.Password, user.Password) {
-		// 更新失败登录次数
-		user.FailedCount++
-		if user.FailedCount >= 5 {
-			// 锁定账户30分钟
-			lockTime := time.Now().Add(30 * time.Minute)
-			user.LockedUntil = &lockTime
-		}
-		database.DB.Save(&user)
-
-		logger.AccessInfo("Console login failed: invalid password",
+	// 检查账户是否被锁定，锁定期间不再校验密码
+	if lockedUntil := accountLockedUntil(&user); lockedUntil != nil {
+		logger.AccessInfo("Console login failed: account locked",
 			zap.String("ip", c.ClientIP()),
 			zap.String("username", user.Username),
-			zap.Int("failed_count", user.FailedCount),
+			zap.Time("locked_until", *lockedUntil),
 		)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"code":    401,
-			"message": i18n.InvalidCredentials,
+			"message": i18n.AccountLocked,
 			"data":    nil,
 		})
 		return
 	}
 
-	// 检查账户是否被锁定
-	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
-		logger.AccessInfo("Console login failed: account locked",
+	// 验证密码
+	if !utils.CheckPassword(password, user.Password) {
+		recordLoginFailure(c, &user)
+
+		logger.AccessInfo("Console login failed: invalid password",
 			zap.String("ip", c.ClientIP()),
 			zap.String("username", user.Username),
-			zap.Time("locked_until", *user.LockedUntil),
+			zap.Int("failed_count", user.FailedCount),
 		)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"code":    401,
-			"message": i18n.AccountLocked,
+			"message": i18n.InvalidCredentials,
 			"data":    nil,
 		})
 		return
 	}
 
+	// 密码哈希算法或参数已过时时重新计算
+	rehashPasswordIfNeeded(&user, password)
+
+	// 检查是否需要OTP验证
+	secondFactor, ok := checkLoginSecondFactor(c, &user, &req)
+	if !ok {
+		return
+	}
+
+	// 密码已过期或被要求修改时只签发修改密码用的受限令牌
+	if requirePasswordChange(c, &user) {
+		return
+	}
+
+	completeConsoleLogin(c, &user, "console_password", loginAMR(utils.AMRPassword, secondFactor))
+}
+
+// completeConsoleLogin 认证通过后创建会话、签发令牌并返回管理端登录响应，amr为本次登录使用的认证方式
+func completeConsoleLogin(c *gin.Context, user *models.User, loginType string, amr []string) {
 	// 获取用户角色和权限
 	var roles []string
 	var permissions []string
@@ -198,6 +223,8 @@ func ConsoleLoginHandler(c *gin.Context) {
 		Permissions: permissions,
 		SessionID:   sessionID, // 包含session_id
 		TradeID:     tradeID,
+		AuthTime:    time.Now().Unix(),
+		AMR:         amr,
 	}
 
 	accessToken, err := jwtManager.GenerateAccessToken(tokenInfo)
@@ -215,7 +242,7 @@ func ConsoleLoginHandler(c *gin.Context) {
 		return
 	}
 
-	refreshToken, err := jwtManager.GenerateRefreshToken(user.ID, sessionID, tradeID)
+	refreshToken, err := jwtManager.GenerateRefreshToken(tokenInfo)
 	if err != nil {
 		logger.ErrorError("Failed to generate refresh token",
 			zap.String("ip", c.ClientIP()),
@@ -237,12 +264,13 @@ func ConsoleLoginHandler(c *gin.Context) {
 	user.LoginCount++
 	user.FailedCount = 0   // 重置失败次数
 	user.LockedUntil = nil // 清除锁定状态
-	database.DB.Save(&user)
+	database.DB.Save(user)
+	clearLoginFailures(c, user)
 
 	// 记录登录日志
 	loginLog := models.UserLoginLog{
 		UserID:    user.ID,
-		LoginType: "console_password",
+		LoginType: loginType,
 		LoginIP:   c.ClientIP(),
 		UserAgent: c.GetHeader("User-Agent"),
 		Success:   true,
@@ -379,8 +407,21 @@ func ConsoleRefreshTokenHandler(c *gin.Context) {
 		)
 	}
 
-	// 生成新的access token
-	accessToken, err := utils.GenerateAccessTokenWithUserInfo(user.ID, user.Username, user.Email, user.DisplayName, roles, []string{}, config.AppConfig.JWT.Secret, config.AppConfig.JWT.AccessTokenExpire)
+	// 生成新的access token，保留会话和原始认证时间，刷新令牌不是重新认证
+	jwtManager := utils.NewJWTManager(&config.AppConfig.JWT)
+	tokenInfo := &utils.TokenInfo{
+		UserID:      user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Roles:       roles,
+		Permissions: []string{},
+		SessionID:   claims.SessionID,
+		TradeID:     utils.GenerateTradeIDString("console_refresh"),
+		AuthTime:    claims.AuthTime,
+		AMR:         claims.AMR,
+	}
+	accessToken, err := jwtManager.GenerateAccessToken(tokenInfo)
 	if err != nil {
 		logger.ErrorError("Failed to generate access token for refresh",
 			zap.String("user_id", user.ID),
@@ -395,7 +436,7 @@ func ConsoleRefreshTokenHandler(c *gin.Context) {
 	}
 
 	// 生成新的refresh token
-	refreshToken, err := utils.GenerateRefreshToken(user.ID, claims.SessionID, config.AppConfig.JWT.Secret, config.AppConfig.JWT.RefreshTokenExpire)
+	refreshToken, err := jwtManager.GenerateRefreshToken(tokenInfo)
 	if err != nil {
 		logger.ErrorError("Failed to generate new refresh token",
 			zap.String("user_id", user.ID),
@@ -507,10 +548,22 @@ func PortalLoginHandler(c *gin.Context) {
 		return
 	}
 
+	// IP被封禁或同一IP对该账户失败过多时直接拒绝
+	if !checkLoginThrottle(c, req.Username) {
+		return
+	}
+
+	// 提交了加密密码时解密并校验nonce
+	password, ok := resolveLoginPassword(c, &req)
+	if !ok {
+		return
+	}
+
 	// 获取用户信息
 	var user models.User
 	if err := database.DB.Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			recordLoginFailure(c, nil)
 			logger.AccessInfo("Portal login failed: user not found",
 				zap.String("ip", c.ClientIP()),
 				zap.String("username", req.Username),
@@ -550,45 +603,57 @@ func PortalLoginHandler(c *gin.Context) {
 		return
 	}
 
-	// 验证密码
-	if !utils.CheckPassword(req.Password, user.Password) {
-		// 更新失败登录次数
-		user.FailedCount++
-		if user.FailedCount >= 5 {
-			// 锁定账户30分钟
-			lockTime := time.Now().Add(30 * time.Minute)
-			user.LockedUntil = &lockTime
-		}
-		database.DB.Save(&user)
-
-		logger.AccessInfo("Portal login failed: invalid password",
+	// 检查账户是否被锁定，锁定期间不再校验密码
+	if lockedUntil := accountLockedUntil(&user); lockedUntil != nil {
+		logger.AccessInfo("Portal login failed: account locked",
 			zap.String("ip", c.ClientIP()),
 			zap.String("username", user.Username),
-			zap.Int("failed_count", user.FailedCount),
+			zap.Time("locked_until", *lockedUntil),
 		)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"code":    401,
-			"message": i18n.InvalidCredentials,
+			"message": i18n.AccountLocked,
 			"data":    nil,
 		})
 		return
 	}
 
-	// 检查账户是否被锁定
-	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
-		logger.AccessInfo("Portal login failed: account locked",
+	// 验证密码
+	if !utils.CheckPassword(password, user.Password) {
+		recordLoginFailure(c, &user)
+
+		logger.AccessInfo("Portal login failed: invalid password",
 			zap.String("ip", c.ClientIP()),
 			zap.String("username", user.Username),
-			zap.Time("locked_until", *user.LockedUntil),
+			zap.Int("failed_count", user.FailedCount),
 		)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"code":    401,
-			"message": i18n.AccountLocked,
+			"message": i18n.InvalidCredentials,
 			"data":    nil,
 		})
 		return
 	}
 
+	// 密码哈希算法或参数已过时时重新计算
+	rehashPasswordIfNeeded(&user, password)
+
+	// 检查是否需要OTP验证
+	secondFactor, ok := checkLoginSecondFactor(c, &user, &req)
+	if !ok {
+		return
+	}
+
+	// 密码已过期或被要求修改时只签发修改密码用的受限令牌
+	if requirePasswordChange(c, &user) {
+		return
+	}
+
+	completePortalLogin(c, &user, loginAMR(utils.AMRPassword, secondFactor))
+}
+
+// completePortalLogin 认证通过后创建会话、签发令牌并返回门户登录响应，amr为本次登录使用的认证方式
+func completePortalLogin(c *gin.Context, user *models.User, amr []string) {
 	// 获取用户角色和权限
 	var roles []string
 	var permissions []string
@@ -665,6 +730,8 @@ func PortalLoginHandler(c *gin.Context) {
 		Permissions: permissions,
 		SessionID:   sessionID, // 包含session_id
 		TradeID:     tradeID,
+		AuthTime:    time.Now().Unix(),
+		AMR:         amr,
 	}
 
 	accessToken, err := jwtManager.GenerateAccessToken(tokenInfo)
@@ -682,7 +749,7 @@ func PortalLoginHandler(c *gin.Context) {
 		return
 	}
 
-	refreshToken, err := jwtManager.GenerateRefreshToken(user.ID, sessionID, tradeID)
+	refreshToken, err := jwtManager.GenerateRefreshToken(tokenInfo)
 	if err != nil {
 		logger.ErrorError("Failed to generate refresh token for portal login",
 			zap.String("ip", c.ClientIP()),
@@ -703,7 +770,8 @@ func PortalLoginHandler(c *gin.Context) {
 	user.LastLoginIP = c.ClientIP()
 	user.FailedCount = 0   // 重置失败次数
 	user.LockedUntil = nil // 清除锁定状态
-	database.DB.Save(&user)
+	database.DB.Save(user)
+	clearLoginFailures(c, user)
 
 	// 记录登录日志
 	logger.AccessInfo("Portal login successful",
@@ -739,6 +807,11 @@ func PortalLoginHandler(c *gin.Context) {
 func PortalLogoutHandler(c *gin.Context) {
 	userID := c.GetString("user_id")
 	sessionID := c.GetString("session_id")
+	if value, exists := c.Get("claims"); exists && sessionID == "" {
+		claims := value.(*utils.AccessTokenClaims)
+		// 会话ID在令牌中，退出时删除会话，代登录令牌随之失效
+		sessionID = claims.SessionID
+	}
 
 	if sessionManager != nil && sessionID != "" {
 		ctx := context.Background()
@@ -757,10 +830,15 @@ func PortalLogoutHandler(c *gin.Context) {
 		}
 	}
 
+	// 通知会话中登录过的应用注销
+	sloResult := notifyLogoutParticipants(sessionID, "")
+
 	c.JSON(http.StatusOK, gin.H{
-		"code":     200,
-		"message":  "Logout successful",
-		"data":     nil,
+		"code":    200,
+		"message": "Logout successful",
+		"data": gin.H{
+			"single_logout": sloResult,
+		},
 		"trade_id": c.GetString("trade_id"),
 	})
 }
@@ -898,6 +976,8 @@ func PortalRefreshTokenHandler(c *gin.Context) {
 		Permissions: []string{}, // 暂时为空
 		SessionID:   sessionID,
 		TradeID:     utils.GenerateTradeIDString("portal_refresh"),
+		AuthTime:    claims.AuthTime, // 刷新令牌不是重新认证
+		AMR:         claims.AMR,
 	}
 
 	newAccessToken, err := jwtManager.GenerateAccessToken(tokenInfo)
@@ -985,28 +1065,6 @@ func PortalGetMeHandler(c *gin.Context) {
 	})
 }
 
-// OTP handlers
-func SendOTPHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
-func VerifyOTPHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
-// Password management handlers
-func ForgotPasswordHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
-func ResetPasswordHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
-func ChangePasswordHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
 // User profile handlers
 func GetProfileHandler(c *gin.Context) {
 	userID := c.GetString("user_id")
@@ -1056,6 +1114,15 @@ func GetProfileHandler(c *gin.Context) {
 		"updated_at":        user.UpdatedAt,
 	}
 
+	// 尚未验证的新邮箱
+	if pendingEmail := pendingEmailChange(&user); pendingEmail != "" {
+		profileData["pending_email"] = pendingEmail
+	}
+	// 尚未验证的新手机号
+	if pendingPhone := pendingPhoneChange(&user); pendingPhone != "" {
+		profileData["pending_phone"] = pendingPhone
+	}
+
 	// Add organization name if available
 	if user.Organization != nil {
 		profileData["organization_name"] = user.Organization.Name
@@ -1080,8 +1147,8 @@ func UpdateProfileHandler(c *gin.Context) {
 	}
 
 	var req struct {
-		DisplayName string `json:"display_name"`
-		Phone       string `json:"phone"`
+		DisplayName string  `json:"display_name"`
+		Phone       *string `json:"phone"` // 只能提交原手机号，修改需通过验证流程
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -1113,10 +1180,19 @@ func UpdateProfileHandler(c *gin.Context) {
 		return
 	}
 
+	// 手机号可以接收登录和重置密码的动态码，修改必须校验密码并验证新号码
+	if req.Phone != nil && strings.TrimSpace(*req.Phone) != strings.TrimSpace(user.Phone) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.PhoneChangeRequired,
+			"data":    nil,
+		})
+		return
+	}
+
 	// 记录更新前的值用于审计
 	oldValues := gin.H{
 		"display_name": user.DisplayName,
-		"phone":        user.Phone,
 	}
 
 	// Update user information
@@ -1128,11 +1204,6 @@ func UpdateProfileHandler(c *gin.Context) {
 		updates["display_name"] = req.DisplayName
 		changedFields = append(changedFields, "display_name")
 	}
-	// 检查 Phone 是否有变化（允许设置为空字符串）
-	if req.Phone != user.Phone {
-		updates["phone"] = req.Phone
-		changedFields = append(changedFields, "phone")
-	}
 
 	if len(updates) > 0 {
 		updates["updated_at"] = time.Now()
@@ -1157,7 +1228,6 @@ func UpdateProfileHandler(c *gin.Context) {
 		// 记录成功的审计日志
 		newValues := gin.H{
 			"display_name": req.DisplayName,
-			"phone":        req.Phone,
 		}
 
 		utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, userID,
@@ -1363,32 +1433,8 @@ func UploadAvatarHandler(c *gin.Context) {
 	})
 }
 
-// Email verification handler
-func VerifyEmailHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
-// OTP setup handler
-func SetupOTPHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
-// Backup codes handler
-func GetBackupCodesHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
 // System settings handlers - 实现在 system_setting.go 中
 
-// OTP settings handlers
-func EnableOTPHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
-func DisableOTPHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": i18n.APINotImplemented, "trade_id": c.GetString("trade_id")})
-}
-
 // User application handlers
 func GetUserApplicationsHandler(c *gin.Context) {
 	// 从JWT中获取用户ID
@@ -3466,19 +3512,24 @@ func CreateApplicationHandler(c *gin.Context) {
 		ResponseTypes   string `json:"responseTypes"`
 		AccessTokenTTL  int    `json:"accessTokenTTL"`
 		RefreshTokenTTL int    `json:"refreshTokenTTL"`
+		PublicClient    bool   `json:"publicClient"`
+		RequirePKCE     bool   `json:"requirePkce"`
 
 		// SAML配置字段
-		EntityID           string `json:"entity_id"`
-		AcsURL             string `json:"acs_url"`
-		SloURL             string `json:"slo_url"`
-		Certificate        string `json:"certificate"`
-		SignatureAlgorithm string `json:"signature_algorithm"`
-		DigestAlgorithm    string `json:"digest_algorithm"`
+		EntityID            string `json:"entity_id"`
+		AcsURL              string `json:"acs_url"`
+		SloURL              string `json:"slo_url"`
+		Certificate         string `json:"certificate"`
+		SignatureAlgorithm  string `json:"signature_algorithm"`
+		DigestAlgorithm     string `json:"digest_algorithm"`
+		AllowUnsignedLogout bool   `json:"allow_unsigned_logout"`
 
 		// CAS配置字段
-		ServiceURL string `json:"service_url"`
-		Gateway    bool   `json:"gateway"`
-		Renew      bool   `json:"renew"`
+		ServiceURL            string `json:"service_url"`
+		Gateway               bool   `json:"gateway"`
+		Renew                 bool   `json:"renew"`
+		AllowProxy            bool   `json:"allow_proxy"`
+		ProxyCallbackPatterns string `json:"proxy_callback_patterns"`
 
 		// LDAP配置字段
 		LdapURL      string `json:"ldapUrl"`
@@ -3509,9 +3560,28 @@ func CreateApplicationHandler(c *gin.Context) {
 		}
 	}
 
-	// 生成唯一的ClientID和ClientSecret
+	// 验证代理回调地址规则
+	if _, err := parseProxyCallbackPatterns(req.ProxyCallbackPatterns); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid proxy callback pattern",
+			"data":    gin.H{"error": err.Error()},
+		})
+		return
+	}
+
+	// 生成唯一的ClientID，ClientSecret使用随机字符串，不能从ClientID推测
 	clientID := utils.GenerateTradeIDString("client")
-	clientSecret := utils.GenerateTradeIDString("secret")
+	clientSecret, err := utils.GenerateRandomString(oauth2ClientSecretLength)
+	if err != nil {
+		logger.ErrorError("Failed to generate client secret", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to create application",
+			"data":    nil,
+		})
+		return
+	}
 	appCode := utils.GenerateTradeIDString("app")
 
 	application := models.Application{
@@ -3534,19 +3604,24 @@ func CreateApplicationHandler(c *gin.Context) {
 		ResponseTypes:   req.ResponseTypes,
 		AccessTokenTTL:  req.AccessTokenTTL,
 		RefreshTokenTTL: req.RefreshTokenTTL,
+		PublicClient:    req.PublicClient,
+		RequirePKCE:     req.RequirePKCE,
 
 		// SAML配置
-		EntityID:           req.EntityID,
-		AcsURL:             req.AcsURL,
-		SloURL:             req.SloURL,
-		Certificate:        req.Certificate,
-		SignatureAlgorithm: req.SignatureAlgorithm,
-		DigestAlgorithm:    req.DigestAlgorithm,
+		EntityID:            req.EntityID,
+		AcsURL:              req.AcsURL,
+		SloURL:              req.SloURL,
+		Certificate:         req.Certificate,
+		SignatureAlgorithm:  req.SignatureAlgorithm,
+		DigestAlgorithm:     req.DigestAlgorithm,
+		AllowUnsignedLogout: req.AllowUnsignedLogout,
 
 		// CAS配置
-		ServiceURL: req.ServiceURL,
-		Gateway:    req.Gateway,
-		Renew:      req.Renew,
+		ServiceURL:            req.ServiceURL,
+		Gateway:               req.Gateway,
+		Renew:                 req.Renew,
+		AllowProxy:            req.AllowProxy,
+		ProxyCallbackPatterns: req.ProxyCallbackPatterns,
 
 		// LDAP配置
 		LdapURL:      req.LdapURL,
@@ -3607,19 +3682,24 @@ func UpdateApplicationHandler(c *gin.Context) {
 		ResponseTypes   string `json:"responseTypes"`
 		AccessTokenTTL  int    `json:"accessTokenTTL"`
 		RefreshTokenTTL int    `json:"refreshTokenTTL"`
+		PublicClient    *bool  `json:"publicClient"` // 未提交时保持不变
+		RequirePKCE     *bool  `json:"requirePkce"`
 
 		// SAML配置字段
-		EntityID           string `json:"entity_id"`
-		AcsURL             string `json:"acs_url"`
-		SloURL             string `json:"slo_url"`
-		Certificate        string `json:"certificate"`
-		SignatureAlgorithm string `json:"signature_algorithm"`
-		DigestAlgorithm    string `json:"digest_algorithm"`
+		EntityID            string `json:"entity_id"`
+		AcsURL              string `json:"acs_url"`
+		SloURL              string `json:"slo_url"`
+		Certificate         string `json:"certificate"`
+		SignatureAlgorithm  string `json:"signature_algorithm"`
+		DigestAlgorithm     string `json:"digest_algorithm"`
+		AllowUnsignedLogout *bool  `json:"allow_unsigned_logout"` // 未提交时保持不变
 
 		// CAS配置字段
-		ServiceURL string `json:"service_url"`
-		Gateway    bool   `json:"gateway"`
-		Renew      bool   `json:"renew"`
+		ServiceURL            string  `json:"service_url"`
+		Gateway               bool    `json:"gateway"`
+		Renew                 bool    `json:"renew"`
+		AllowProxy            *bool   `json:"allow_proxy"`             // 未提交时保持不变
+		ProxyCallbackPatterns *string `json:"proxy_callback_patterns"` // 未提交时保持不变
 
 		// LDAP配置字段
 		LdapURL      string `json:"ldapUrl"`
@@ -3703,6 +3783,12 @@ func UpdateApplicationHandler(c *gin.Context) {
 		if req.RefreshTokenTTL > 0 {
 			updateData["refresh_token_ttl"] = req.RefreshTokenTTL
 		}
+		if req.PublicClient != nil {
+			updateData["public_client"] = *req.PublicClient
+		}
+		if req.RequirePKCE != nil {
+			updateData["require_pkce"] = *req.RequirePKCE
+		}
 	}
 
 	// 更新SAML配置字段
@@ -3725,6 +3811,9 @@ func UpdateApplicationHandler(c *gin.Context) {
 		if req.DigestAlgorithm != "" {
 			updateData["digest_algorithm"] = req.DigestAlgorithm
 		}
+		if req.AllowUnsignedLogout != nil {
+			updateData["allow_unsigned_logout"] = *req.AllowUnsignedLogout
+		}
 	}
 
 	// 更新CAS配置字段
@@ -3734,6 +3823,20 @@ func UpdateApplicationHandler(c *gin.Context) {
 		}
 		updateData["gateway"] = req.Gateway
 		updateData["renew"] = req.Renew
+		if req.AllowProxy != nil {
+			updateData["allow_proxy"] = *req.AllowProxy
+		}
+		if req.ProxyCallbackPatterns != nil {
+			if _, err := parseProxyCallbackPatterns(*req.ProxyCallbackPatterns); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code":    400,
+					"message": "Invalid proxy callback pattern",
+					"data":    gin.H{"error": err.Error()},
+				})
+				return
+			}
+			updateData["proxy_callback_patterns"] = *req.ProxyCallbackPatterns
+		}
 	}
 
 	// 更新LDAP配置字段
@@ -4189,6 +4292,10 @@ func GetAuditLogsHandler(c *gin.Context) {
 		query = query.Where("user_id = ?", userID)
 	}
 
+	if actorID := c.Query("actor_id"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
@@ -4218,6 +4325,22 @@ func GetAuditLogsHandler(c *gin.Context) {
 		return
 	}
 
+	// 代登录期间的记录需要显示实际操作的管理员
+	actorNames := make(map[string]string)
+	var actorIDs []string
+	for _, log := range auditLogs {
+		if log.ActorID != "" {
+			actorIDs = append(actorIDs, log.ActorID)
+		}
+	}
+	if len(actorIDs) > 0 {
+		var actors []models.User
+		database.DB.Select("id", "username").Where("id IN ?", actorIDs).Find(&actors)
+		for _, actor := range actors {
+			actorNames[actor.ID] = actor.Username
+		}
+	}
+
 	// 构建响应数据
 	var logs []gin.H
 	for _, log := range auditLogs {
@@ -4230,6 +4353,8 @@ func GetAuditLogsHandler(c *gin.Context) {
 			"id":          log.ID,
 			"user_id":     log.UserID,
 			"user":        userName,
+			"actor_id":    log.ActorID,
+			"actor":       actorNames[log.ActorID],
 			"action":      log.Action,
 			"resource":    log.Resource,
 			"resource_id": log.ResourceID,
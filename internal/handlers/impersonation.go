@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/notify"
+	"eiam-platform/pkg/utils"
+)
+
+// ImpersonateUserRequest 管理员代登录请求
+type ImpersonateUserRequest struct {
+	Reason     string `json:"reason" binding:"required,max=255"` // 代登录原因，通知用户并记录审计日志
+	Duration   int    `json:"duration"`                          // 会话时长（秒），不超过配置的max_duration
+	AllowWrite bool   `json:"allow_write"`                       // 需要配置允许，默认只读
+}
+
+// impersonationDuration 计算代登录会话时长
+func impersonationDuration(cfg *config.ImpersonationConfig, requested int) time.Duration {
+	duration := cfg.Duration
+	if duration <= 0 {
+		duration = 900
+	}
+	maxDuration := cfg.MaxDuration
+	if maxDuration <= 0 {
+		maxDuration = 3600
+	}
+	if requested > 0 {
+		duration = requested
+	}
+	if duration > maxDuration {
+		duration = maxDuration
+	}
+	return time.Duration(duration) * time.Second
+}
+
+// isAdministratorRole 与管理员列表一致，角色编码包含ADMIN的视为管理员
+func isAdministratorRole(code string) bool {
+	return strings.Contains(strings.ToUpper(code), "ADMIN")
+}
+
+// ImpersonateUserHandler 管理员以目标用户身份登录门户，用于排查用户问题
+// 签发的令牌带act声明、有效期短、默认只读且不能刷新，目标用户会收到通知
+func ImpersonateUserHandler(c *gin.Context) {
+	cfg := config.GetConfig()
+	if cfg == nil || !cfg.Login.Impersonation.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.ImpersonationDisabled,
+			"data":    nil,
+		})
+		return
+	}
+	impersonation := cfg.Login.Impersonation
+
+	var req ImpersonateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+	if req.AllowWrite && !impersonation.AllowWrite {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.ImpersonationReadOnly,
+			"data":    nil,
+		})
+		return
+	}
+
+	admin, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18n.UserNotFound,
+				"data":    nil,
+			})
+			return
+		}
+		logger.ErrorError("Failed to get user", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	// 不能代登录自己、已禁用的用户或其他管理员
+	roles := loadUserRoleCodes(user.ID)
+	impersonable := user.ID != admin.ID && user.Status == models.StatusActive
+	for _, role := range roles {
+		if isAdministratorRole(role) {
+			impersonable = false
+		}
+	}
+	if !impersonable {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.CannotImpersonateUser,
+			"data":    nil,
+		})
+		return
+	}
+
+	if sessionManager == nil {
+		respondInternalError(c)
+		return
+	}
+
+	duration := impersonationDuration(&impersonation, req.Duration)
+	readOnly := !req.AllowWrite
+	reason := strings.TrimSpace(req.Reason)
+	sessionID, err := sessionManager.CreateImpersonationSession(
+		context.Background(),
+		user.ID,
+		user.Username,
+		user.Email,
+		user.DisplayName,
+		admin.ID,
+		admin.Username,
+		reason,
+		c.ClientIP(),
+		c.GetHeader("User-Agent"),
+		readOnly,
+		duration,
+	)
+	if err != nil {
+		logger.ErrorError("Failed to create impersonation session",
+			zap.String("user_id", user.ID),
+			zap.String("actor_id", admin.ID),
+			zap.Error(err),
+		)
+		respondInternalError(c)
+		return
+	}
+
+	// 不签发refresh token，auth_time为空使门户的敏感操作始终要求重新认证
+	jwtManager := utils.NewJWTManager(&cfg.JWT)
+	tradeID := utils.GenerateTradeIDString("impersonation")
+	accessToken, err := jwtManager.GenerateAccessToken(&utils.TokenInfo{
+		UserID:      user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Roles:       roles,
+		Permissions: []string{},
+		SessionID:   sessionID,
+		TradeID:     tradeID,
+		Act: &utils.ActorClaim{
+			Subject:  admin.ID,
+			Username: admin.Username,
+		},
+		ReadOnly:  readOnly,
+		ExpiresIn: duration,
+	})
+	if err != nil {
+		logger.ErrorError("Failed to generate impersonation token", zap.String("user_id", user.ID), zap.Error(err))
+		sessionManager.DeleteSession(context.Background(), sessionID)
+		respondInternalError(c)
+		return
+	}
+
+	expiresAt := time.Now().Add(duration)
+	logger.AccessInfo("Impersonation session started",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("actor_id", admin.ID),
+		zap.String("session_id", sessionID),
+		zap.Bool("read_only", readOnly),
+		zap.String("trade_id", tradeID),
+	)
+	utils.CreateAuditLog(c, utils.AuditActionImpersonate, utils.AuditResourceUser, user.ID,
+		"Started impersonating user: "+user.Username, gin.H{
+			"session_id": sessionID,
+			"reason":     reason,
+			"read_only":  readOnly,
+			"expires_at": expiresAt,
+		})
+	go sendImpersonationNotice(&user, admin.Username, reason, readOnly, expiresAt)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.ImpersonationStarted,
+		"data": gin.H{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   int(duration.Seconds()),
+			"expires_at":   expiresAt,
+			"session_id":   sessionID,
+			"read_only":    readOnly,
+			"user": gin.H{
+				"id":           user.ID,
+				"username":     user.Username,
+				"email":        user.Email,
+				"display_name": user.DisplayName,
+				"roles":        roles,
+			},
+		},
+		"trade_id": tradeID,
+	})
+}
+
+// EndImpersonationHandler 结束代登录会话，会话删除后代登录令牌立即失效
+func EndImpersonationHandler(c *gin.Context) {
+	if sessionManager == nil {
+		respondInternalError(c)
+		return
+	}
+
+	sessionID := c.Param("sessionID")
+	ctx := context.Background()
+	sessionInfo, err := sessionManager.GetSession(ctx, sessionID)
+	if err != nil || !sessionInfo.Impersonated() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18n.NotFound,
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := sessionManager.DeleteSession(ctx, sessionID); err != nil {
+		logger.ErrorError("Failed to end impersonation session", zap.String("session_id", sessionID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionImpersonate, utils.AuditResourceUser, sessionInfo.UserID,
+		"Ended impersonation of user: "+sessionInfo.Username, gin.H{
+			"session_id":            sessionID,
+			"impersonator_id":       sessionInfo.ImpersonatorID,
+			"impersonator_username": sessionInfo.ImpersonatorUsername,
+		})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data":    nil,
+	})
+}
+
+// sendImpersonationNotice 通知用户管理员以其身份登录，发送失败只记录日志
+func sendImpersonationNotice(user *models.User, adminUsername, reason string, readOnly bool, expiresAt time.Time) {
+	email := otpDestination(user, notify.ChannelEmail)
+	if email == "" {
+		return
+	}
+
+	access := "view"
+	if !readOnly {
+		access = "view and change"
+	}
+	site := siteDisplayName()
+	msg := &notify.Message{
+		To:      email,
+		Subject: site + " administrator signed in to your account",
+		Body: fmt.Sprintf("Hello %s,\n\nAdministrator %s signed in to your %s account to help resolve an issue. "+
+			"They can %s your portal data until %s.\n\nReason: %s\n\n"+
+			"If you did not expect this, contact your administrator.",
+			user.Username, adminUsername, site, access, expiresAt.Format("2006-01-02 15:04:05 MST"), reason),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := notify.Send(ctx, notify.ChannelEmail, msg); err != nil {
+		logger.ErrorWarn("Failed to send impersonation notice",
+			zap.String("user_id", user.ID),
+			zap.String("sent_to", maskDestination(email)),
+			zap.Error(err),
+		)
+	}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"eiam-platform/config"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/utils"
+)
+
+// loginKeyAlgorithm 登录密码加密算法，客户端使用RSA-OAEP(SHA-256)加密登录载荷
+const loginKeyAlgorithm = "RSA-OAEP-256"
+
+const (
+	loginKeyCurrent  = "login:key:current"
+	loginKeyPrefix   = "login:key:"
+	loginNoncePrefix = "login:nonce:"
+
+	loginNonceMinLength = 16
+	loginNonceMaxLength = 128
+)
+
+var (
+	errLoginKeyUnavailable  = errors.New("login encryption key unavailable")
+	errLoginKeyExpired      = errors.New("login encryption key expired or unknown")
+	errLoginPayloadInvalid  = errors.New("invalid encrypted password")
+	errLoginPayloadReplayed = errors.New("encrypted password already used")
+	// errLoginPlaintextRejected 开启password_encryption.required后提交了明文密码
+	errLoginPlaintextRejected = errors.New("plaintext password rejected")
+)
+
+// loginKey 登录密码加密密钥，保存在Redis中供所有实例共享
+type loginKey struct {
+	KeyID      string    `json:"kid"`
+	PrivateKey string    `json:"private_key"` // PEM格式，加密存储
+	PublicKey  string    `json:"public_key"`  // SPKI DER的base64
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"` // 超过该时间不再接受用该密钥加密的密码
+
+	privateKey *rsa.PrivateKey
+}
+
+// loginKeyPayload 客户端加密的登录载荷，每次提交使用新的nonce
+type loginKeyPayload struct {
+	Password string `json:"password"`
+	Nonce    string `json:"nonce"`
+}
+
+// loginKeyConfig 登录密码加密的生效配置
+type loginKeyConfig struct {
+	Required         bool
+	RotationInterval time.Duration
+	GracePeriod      time.Duration
+}
+
+// loginKeySettings 读取登录密码加密配置，未配置时使用默认值
+func loginKeySettings() loginKeyConfig {
+	settings := loginKeyConfig{
+		RotationInterval: time.Hour,
+		GracePeriod:      5 * time.Minute,
+	}
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return settings
+	}
+
+	encryption := cfg.Login.PasswordEncryption
+	settings.Required = encryption.Required
+	if encryption.RotationInterval > 0 {
+		settings.RotationInterval = time.Duration(encryption.RotationInterval) * time.Second
+	}
+	if encryption.GracePeriod > 0 {
+		settings.GracePeriod = time.Duration(encryption.GracePeriod) * time.Second
+	}
+	return settings
+}
+
+// 已解密的登录密钥，避免每次登录都解密私钥
+var loginKeyCache = struct {
+	sync.RWMutex
+	keys map[string]*loginKey
+}{keys: make(map[string]*loginKey)}
+
+// GetLoginKeyHandler 发布当前的登录密码加密公钥
+func GetLoginKeyHandler(c *gin.Context) {
+	key, err := currentLoginKey()
+	if err != nil {
+		logger.ErrorError("Failed to get login encryption key", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Success",
+		"data": gin.H{
+			"kid":        key.KeyID,
+			"alg":        loginKeyAlgorithm,
+			"public_key": key.PublicKey,
+			"jwk": gin.H{
+				"kty": "RSA",
+				"use": "enc",
+				"alg": loginKeyAlgorithm,
+				"kid": key.KeyID,
+				"n":   base64.RawURLEncoding.EncodeToString(key.privateKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.privateKey.E)).Bytes()),
+			},
+			"expires_at": key.ExpiresAt,
+			"required":   loginKeySettings().Required,
+		},
+	})
+}
+
+// currentLoginKey 返回当前用于加密的密钥，到达轮换间隔后生成新密钥
+func currentLoginKey() (*loginKey, error) {
+	if redis.RDB == nil {
+		return nil, errLoginKeyUnavailable
+	}
+	if kid, err := redis.Get(loginKeyCurrent); err == nil {
+		if key, err := getLoginKey(kid); err == nil {
+			return key, nil
+		}
+	}
+	return rotateLoginKey()
+}
+
+// rotateLoginKey 生成新密钥，多个实例同时轮换时以先写入的为准
+func rotateLoginKey() (*loginKey, error) {
+	settings := loginKeySettings()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := encryptSigningPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	key := &loginKey{
+		KeyID:      signingKeyID(publicDER),
+		PrivateKey: encryptedKey,
+		PublicKey:  base64.StdEncoding.EncodeToString(publicDER),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(settings.RotationInterval + settings.GracePeriod),
+		privateKey: privateKey,
+	}
+	if err := redis.SetJSON(loginKeyPrefix+key.KeyID, key, time.Until(key.ExpiresAt)); err != nil {
+		return nil, err
+	}
+
+	claimed, err := redis.RDB.SetNX(context.Background(), loginKeyCurrent, key.KeyID, settings.RotationInterval).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		// 其他实例已经完成轮换，丢弃本次生成的密钥
+		redis.Del(loginKeyPrefix + key.KeyID)
+		kid, err := redis.Get(loginKeyCurrent)
+		if err != nil {
+			return nil, err
+		}
+		return getLoginKey(kid)
+	}
+
+	cacheLoginKey(key)
+	logger.Info("Login encryption key rotated",
+		zap.String("kid", key.KeyID),
+		zap.Time("expires_at", key.ExpiresAt),
+	)
+	return key, nil
+}
+
+// getLoginKey 按kid获取未过期的密钥
+func getLoginKey(kid string) (*loginKey, error) {
+	loginKeyCache.RLock()
+	key := loginKeyCache.keys[kid]
+	loginKeyCache.RUnlock()
+	if key != nil {
+		if time.Now().After(key.ExpiresAt) {
+			return nil, errLoginKeyExpired
+		}
+		return key, nil
+	}
+
+	if kid == "" || redis.RDB == nil {
+		return nil, errLoginKeyExpired
+	}
+	var stored loginKey
+	if err := redis.GetJSON(loginKeyPrefix+kid, &stored); err != nil {
+		return nil, errLoginKeyExpired
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, errLoginKeyExpired
+	}
+	privateKey, err := decryptSigningPrivateKey(stored.PrivateKey)
+	if err != nil {
+		logger.ErrorWarn("Invalid login encryption key", zap.String("kid", kid), zap.Error(err))
+		return nil, errLoginKeyExpired
+	}
+	stored.privateKey = privateKey
+
+	cacheLoginKey(&stored)
+	return &stored, nil
+}
+
+// cacheLoginKey 缓存密钥并清理已过期的密钥
+func cacheLoginKey(key *loginKey) {
+	now := time.Now()
+	loginKeyCache.Lock()
+	for kid, cached := range loginKeyCache.keys {
+		if now.After(cached.ExpiresAt) {
+			delete(loginKeyCache.keys, kid)
+		}
+	}
+	loginKeyCache.keys[key.KeyID] = key
+	loginKeyCache.Unlock()
+}
+
+// decryptLoginPassword 解密客户端提交的登录载荷，同一个nonce在密钥有效期内只能使用一次
+func decryptLoginPassword(kid, encryptedPassword string) (string, error) {
+	key, err := getLoginKey(kid)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := utils.DecryptRSAOAEP(key.privateKey, encryptedPassword)
+	if err != nil {
+		return "", errLoginPayloadInvalid
+	}
+	var payload loginKeyPayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return "", errLoginPayloadInvalid
+	}
+	if payload.Password == "" || len(payload.Nonce) < loginNonceMinLength || len(payload.Nonce) > loginNonceMaxLength {
+		return "", errLoginPayloadInvalid
+	}
+
+	ttl := time.Until(key.ExpiresAt)
+	if ttl <= 0 {
+		return "", errLoginKeyExpired
+	}
+	fresh, err := redis.RDB.SetNX(context.Background(), loginNoncePrefix+key.KeyID+":"+payload.Nonce, 1, ttl).Result()
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", errLoginPayloadReplayed
+	}
+	return payload.Password, nil
+}
+
+// resolveLoginPassword 返回登录请求中的密码，提交了加密密码时先解密
+// 失败时写入响应并返回false；开启password_encryption.required后拒绝明文密码
+func resolveLoginPassword(c *gin.Context, req *LoginRequest) (string, bool) {
+	password, message, err := decodeLoginPassword(c, req.Username, req.Password, req.KeyID, req.EncryptedPassword)
+	if err == nil {
+		return password, true
+	}
+	if message == "" {
+		respondInternalError(c)
+		return "", false
+	}
+
+	var data gin.H
+	if errors.Is(err, errLoginKeyExpired) {
+		// 客户端应重新获取公钥后再提交
+		data = gin.H{"key_expired": true}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"code":    400,
+		"message": message,
+		"data":    data,
+	})
+	return "", false
+}
+
+// decodeLoginPassword 返回提交的密码，提交了加密密码时先解密
+// 失败时返回提示给用户的消息，消息为空表示服务器内部错误，供JSON接口和登录页面共用
+func decodeLoginPassword(c *gin.Context, username, password, keyID, encryptedPassword string) (string, string, error) {
+	if encryptedPassword == "" {
+		if loginKeySettings().Required {
+			return "", i18n.PasswordEncryptionNeeded, errLoginPlaintextRejected
+		}
+		return password, "", nil
+	}
+
+	password, err := decryptLoginPassword(keyID, encryptedPassword)
+	if err == nil {
+		return password, "", nil
+	}
+
+	logger.AccessWarn("Login failed: encrypted password rejected",
+		zap.String("ip", c.ClientIP()),
+		zap.String("username", username),
+		zap.String("kid", keyID),
+		zap.Error(err),
+	)
+	switch {
+	case errors.Is(err, errLoginKeyExpired):
+		return "", i18n.LoginKeyExpired, err
+	case errors.Is(err, errLoginPayloadReplayed):
+		return "", i18n.EncryptedPasswordReused, err
+	case errors.Is(err, errLoginPayloadInvalid):
+		return "", i18n.InvalidEncryptedPassword, err
+	}
+	return "", "", err
+}
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/utils"
+)
+
+// 登录失败计数保存在Redis中，多实例共享；账户锁定同时写入users表，便于控制台查询
+const (
+	loginFailUserPrefix   = "login:fail:user:"    // 账户维度失败次数
+	loginFailIPPrefix     = "login:fail:ip:"      // IP维度失败次数
+	loginFailIPUserPrefix = "login:fail:ip_user:" // IP+账户维度失败次数，key为<账户哈希>:<IP>
+	loginDelayPrefix      = "login:delay:"        // IP+账户维度的递增延迟
+	loginBlockIPPrefix    = "login:block:ip:"     // 被封禁的IP
+
+	// loginIdentifierKey 保存本次登录提交的账户标识，失败计数时使用
+	loginIdentifierKey = "login_identifier"
+)
+
+// loginFailScript 计数加一，首次计数时设置窗口有效期
+const loginFailScript = `
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`
+
+// loginLockoutConfig 登录失败限制参数
+type loginLockoutConfig struct {
+	MaxAttempts       int
+	Duration          time.Duration
+	IPMaxAttempts     int
+	IPUserMaxAttempts int
+	DelayAfter        int
+	BaseDelay         time.Duration
+	MaxDelay          time.Duration
+}
+
+// loginLockoutSettings 读取安全设置中的失败次数和锁定时长，以及login.lockout中的IP限制
+func loginLockoutSettings() loginLockoutConfig {
+	settings := loginLockoutConfig{
+		MaxAttempts:   securitySettingInt("max_login_attempts", 5),
+		Duration:      time.Duration(securitySettingInt("lockout_duration", 15)) * time.Minute,
+		IPMaxAttempts: 50,
+		DelayAfter:    3,
+		BaseDelay:     time.Second,
+		MaxDelay:      time.Minute,
+	}
+	settings.IPUserMaxAttempts = settings.MaxAttempts
+
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return settings
+	}
+	lockout := cfg.Login.Lockout
+	if lockout.IPMaxAttempts > 0 {
+		settings.IPMaxAttempts = lockout.IPMaxAttempts
+	}
+	if lockout.IPUserMaxAttempts > 0 {
+		settings.IPUserMaxAttempts = lockout.IPUserMaxAttempts
+	}
+	if lockout.DelayAfter > 0 {
+		settings.DelayAfter = lockout.DelayAfter
+	}
+	if lockout.BaseDelay > 0 {
+		settings.BaseDelay = time.Duration(lockout.BaseDelay) * time.Second
+	}
+	if lockout.MaxDelay > 0 {
+		settings.MaxDelay = time.Duration(lockout.MaxDelay) * time.Second
+	}
+	return settings
+}
+
+// loginThrottleRetryAfter 检查IP是否被封禁、IP+账户是否处于延迟期，返回需要等待的时间
+// 同时记录本次提交的账户标识，供recordLoginFailure和clearLoginFailures使用
+func loginThrottleRetryAfter(c *gin.Context, identifier string) time.Duration {
+	identifier = strings.ToLower(strings.TrimSpace(identifier))
+	c.Set(loginIdentifierKey, identifier)
+	if redis.RDB == nil {
+		return 0
+	}
+
+	ctx := context.Background()
+	var wait time.Duration
+	for _, key := range []string{
+		loginBlockIPPrefix + c.ClientIP(),
+		loginDelayPrefix + loginIPUserSuffix(identifier, c.ClientIP()),
+	} {
+		ttl, err := redis.RDB.PTTL(ctx, key).Result()
+		if err != nil {
+			logger.ErrorWarn("Failed to check login throttle", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+	return wait
+}
+
+// checkLoginThrottle 登录被限制时写入429响应并返回false
+func checkLoginThrottle(c *gin.Context, identifier string) bool {
+	wait := loginThrottleRetryAfter(c, identifier)
+	if wait <= 0 {
+		return true
+	}
+
+	seconds := retryAfterSeconds(wait)
+	logger.AccessInfo("Login throttled",
+		zap.String("ip", c.ClientIP()),
+		zap.String("username", identifier),
+		zap.Int("retry_after", seconds),
+	)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"code":    429,
+		"message": i18n.LoginThrottled,
+		"data": gin.H{
+			"retry_after": seconds,
+		},
+	})
+	return false
+}
+
+// retryAfterSeconds 等待时间向上取整为秒，用于Retry-After
+func retryAfterSeconds(wait time.Duration) int {
+	return int((wait + time.Second - 1) / time.Second)
+}
+
+// accountLockedUntil 返回账户锁定的截止时间，未锁定时返回nil
+func accountLockedUntil(user *models.User) *time.Time {
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return user.LockedUntil
+	}
+	return nil
+}
+
+// recordLoginFailure 记录一次登录失败，账户不存在时user为nil，只计入IP和IP+账户维度
+// 达到上限时封禁IP、延迟IP+账户的下一次尝试或锁定账户
+func recordLoginFailure(c *gin.Context, user *models.User) {
+	settings := loginLockoutSettings()
+	ip := c.ClientIP()
+	identifier := c.GetString(loginIdentifierKey)
+	if identifier == "" && user != nil {
+		identifier = strings.ToLower(user.Username)
+	}
+
+	if redis.RDB != nil {
+		if count, err := incrLoginFailure(loginFailIPPrefix+ip, settings.Duration); err == nil && count >= int64(settings.IPMaxAttempts) {
+			if err := redis.Set(loginBlockIPPrefix+ip, count, settings.Duration); err == nil && count == int64(settings.IPMaxAttempts) {
+				logger.AccessWarn("IP blocked after repeated login failures",
+					zap.String("ip", ip),
+					zap.Int64("failed_count", count),
+					zap.Duration("duration", settings.Duration),
+				)
+			}
+		}
+
+		suffix := loginIPUserSuffix(identifier, ip)
+		if count, err := incrLoginFailure(loginFailIPUserPrefix+suffix, settings.Duration); err == nil {
+			if delay := loginFailureDelay(count, settings); delay > 0 {
+				redis.Set(loginDelayPrefix+suffix, count, delay)
+			}
+		}
+	}
+
+	if user == nil {
+		return
+	}
+
+	// Redis不可用时退回到users表中的计数
+	count := int64(user.FailedCount + 1)
+	if redis.RDB != nil {
+		if n, err := incrLoginFailure(loginFailUserPrefix+user.ID, settings.Duration); err == nil {
+			count = n
+		}
+	}
+
+	user.FailedCount = int(count)
+	if count >= int64(settings.MaxAttempts) {
+		lockUntil := time.Now().Add(settings.Duration)
+		user.LockedUntil = &lockUntil
+		if redis.RDB != nil {
+			redis.Del(loginFailUserPrefix + user.ID)
+		}
+		logger.AccessWarn("Account locked after repeated login failures",
+			zap.String("ip", ip),
+			zap.String("user_id", user.ID),
+			zap.Int64("failed_count", count),
+			zap.Time("locked_until", lockUntil),
+		)
+	}
+	database.DB.Model(user).Updates(map[string]interface{}{
+		"failed_count": user.FailedCount,
+		"locked_until": user.LockedUntil,
+	})
+}
+
+// clearLoginFailures 登录成功后清除账户及IP+账户维度的失败计数，IP维度的计数保留
+func clearLoginFailures(c *gin.Context, user *models.User) {
+	if redis.RDB == nil {
+		return
+	}
+	identifier := c.GetString(loginIdentifierKey)
+	if identifier == "" {
+		identifier = strings.ToLower(user.Username)
+	}
+	suffix := loginIPUserSuffix(identifier, c.ClientIP())
+	if err := redis.Del(loginFailUserPrefix+user.ID, loginFailIPUserPrefix+suffix, loginDelayPrefix+suffix); err != nil {
+		logger.ErrorWarn("Failed to clear login failures", zap.String("user_id", user.ID), zap.Error(err))
+	}
+}
+
+// incrLoginFailure 在window内累加失败次数
+func incrLoginFailure(key string, window time.Duration) (int64, error) {
+	count, err := redis.RDB.Eval(context.Background(), loginFailScript, []string{key}, int(window.Seconds())).Int64()
+	if err != nil {
+		logger.ErrorWarn("Failed to record login failure", zap.String("key", key), zap.Error(err))
+	}
+	return count, err
+}
+
+// loginFailureDelay 计算IP+账户维度第count次失败后的等待时间，达到上限后等待整个锁定时长
+func loginFailureDelay(count int64, settings loginLockoutConfig) time.Duration {
+	if count >= int64(settings.IPUserMaxAttempts) {
+		return settings.Duration
+	}
+	if count < int64(settings.DelayAfter) {
+		return 0
+	}
+	delay := settings.BaseDelay
+	for i := int64(settings.DelayAfter); i < count && delay < settings.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > settings.MaxDelay {
+		delay = settings.MaxDelay
+	}
+	return delay
+}
+
+// loginIPUserSuffix 账户标识取哈希放在前面，解锁时可以按账户匹配所有IP
+func loginIPUserSuffix(identifier, ip string) string {
+	return loginIdentifierHash(identifier) + ":" + ip
+}
+
+func loginIdentifierHash(identifier string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(identifier))))
+	return hex.EncodeToString(sum[:16])
+}
+
+// LockedAccountInfo 被锁定的账户
+type LockedAccountInfo struct {
+	ID          string     `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	DisplayName string     `json:"display_name"`
+	FailedCount int        `json:"failed_count"`
+	LockedUntil time.Time  `json:"locked_until"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	LastLoginIP string     `json:"last_login_ip"`
+}
+
+// GetLockedAccountsHandler 获取因登录失败被锁定的账户列表
+func GetLockedAccountsHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	search := c.Query("search")
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	query := database.DB.Model(&models.User{}).Where("locked_until > ?", time.Now())
+	if search != "" {
+		query = query.Where("username LIKE ? OR email LIKE ? OR display_name LIKE ?",
+			"%"+search+"%", "%"+search+"%", "%"+search+"%")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var users []models.User
+	if err := query.Offset((page - 1) * pageSize).Limit(pageSize).Order("locked_until DESC").Find(&users).Error; err != nil {
+		logger.ErrorError("Failed to get locked accounts", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	items := make([]LockedAccountInfo, len(users))
+	for i, user := range users {
+		items[i] = LockedAccountInfo{
+			ID:          user.ID,
+			Username:    user.Username,
+			Email:       user.Email,
+			DisplayName: user.DisplayName,
+			FailedCount: user.FailedCount,
+			LockedUntil: *user.LockedUntil,
+			LastLoginAt: user.LastLoginAt,
+			LastLoginIP: user.LastLoginIP,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data": gin.H{
+			"items":       items,
+			"total":       total,
+			"page":        page,
+			"page_size":   pageSize,
+			"total_pages": int((total + int64(pageSize) - 1) / int64(pageSize)),
+		},
+	})
+}
+
+// UnlockAccountHandler 解除账户锁定，并清除该账户在所有IP上的失败计数和延迟
+func UnlockAccountHandler(c *gin.Context) {
+	userID := c.Param("id")
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18n.UserNotFound,
+				"data":    nil,
+			})
+			return
+		}
+		logger.ErrorError("Failed to get user", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	wasLocked := accountLockedUntil(&user) != nil
+	failedCount := user.FailedCount
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"failed_count": 0,
+		"locked_until": nil,
+	}).Error; err != nil {
+		logger.ErrorError("Failed to unlock account", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	clearAccountThrottle(&user)
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID,
+		"Unlocked account: "+user.Username, gin.H{
+			"was_locked":   wasLocked,
+			"failed_count": failedCount,
+		})
+	logger.Info("Account unlocked",
+		zap.String("user_id", user.ID),
+		zap.String("unlocked_by", c.GetString("user_id")),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.AccountUnlocked,
+		"data":    nil,
+	})
+}
+
+// clearAccountThrottle 清除账户的失败计数，以及用户名和邮箱在所有IP上的失败计数和延迟
+func clearAccountThrottle(user *models.User) {
+	if redis.RDB == nil {
+		return
+	}
+
+	keys := []string{loginFailUserPrefix + user.ID}
+	for _, identifier := range []string{user.Username, user.Email} {
+		if identifier == "" {
+			continue
+		}
+		hash := loginIdentifierHash(identifier)
+		for _, prefix := range []string{loginFailIPUserPrefix, loginDelayPrefix} {
+			matched, err := redis.ScanKeys(prefix + hash + ":*")
+			if err != nil {
+				logger.ErrorWarn("Failed to find login throttle keys", zap.String("user_id", user.ID), zap.Error(err))
+				continue
+			}
+			keys = append(keys, matched...)
+		}
+	}
+	if err := redis.Del(keys...); err != nil {
+		logger.ErrorWarn("Failed to clear login throttle", zap.String("user_id", user.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,724 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/utils"
+)
+
+const (
+	mfaPendingSecretPrefix = "mfa:totp:pending:"
+	mfaLastStepPrefix      = "mfa:totp:last_step:"
+
+	// mfaEnrollmentTTL 绑定流程中未确认密钥的有效期
+	mfaEnrollmentTTL = 10 * time.Minute
+	// totpSkew 允许的时钟偏差（前后各1个时间步）
+	totpSkew = 1
+	// backupCodeCount 每次生成的备用码数量
+	backupCodeCount = 10
+)
+
+// 第二因素类型
+const (
+	mfaMethodTOTP       = "totp"
+	mfaMethodBackupCode = "backup_code"
+)
+
+// totpReplayScript 仅当时间步大于上次使用的时间步时记录并返回1，防止同一动态码被重复使用
+const totpReplayScript = `
+local last = tonumber(redis.call('GET', KEYS[1]) or '-1')
+if last >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return 1
+`
+
+// OTPCodeRequest 提交动态码或备用码
+type OTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// SetupOTPHandler 开始绑定TOTP：生成待确认的密钥，确认前不会启用
+func SetupOTPHandler(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !securitySettingEnabled("enable_totp", true) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.TOTPDisabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	if user.EnableOTP {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": i18n.OTPAlreadyEnabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		logger.ErrorError("Failed to generate TOTP secret", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	encrypted, err := utils.EncryptSecret(secret, signingKeySecret())
+	if err != nil {
+		logger.ErrorError("Failed to encrypt TOTP secret", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if err := redis.Set(mfaPendingSecretPrefix+user.ID, encrypted, mfaEnrollmentTTL); err != nil {
+		logger.ErrorError("Failed to store pending TOTP secret", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	issuer := siteDisplayName()
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+	uri := utils.BuildTOTPURI(issuer, account, secret)
+
+	logger.Info("TOTP enrollment started", zap.String("user_id", user.ID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data": gin.H{
+			"secret":      secret,
+			"otpauth_uri": uri,
+			"qr_payload":  uri,
+			"issuer":      issuer,
+			"account":     account,
+			"algorithm":   utils.TOTPAlgorithm,
+			"digits":      utils.TOTPDigits,
+			"period":      utils.TOTPPeriod,
+			"expires_in":  int(mfaEnrollmentTTL / time.Second),
+		},
+	})
+}
+
+// EnableOTPHandler 使用验证器App生成的动态码确认绑定并启用TOTP，同时返回备用码
+func EnableOTPHandler(c *gin.Context) {
+	var req OTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.EnableOTP {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": i18n.OTPAlreadyEnabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	encrypted, err := redis.Get(mfaPendingSecretPrefix + user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.OTPEnrollmentExpired,
+			"data":    nil,
+		})
+		return
+	}
+	secret, err := utils.DecryptSecret(encrypted, signingKeySecret())
+	if err != nil {
+		logger.ErrorError("Failed to decrypt pending TOTP secret", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(secret, req.Code, time.Now(), totpSkew)
+	if !valid || !markTOTPStepUsed(user.ID, step) {
+		logger.AccessInfo("TOTP enrollment failed: invalid code", zap.String("user_id", user.ID))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidOTP,
+			"data":    nil,
+		})
+		return
+	}
+
+	updates := map[string]interface{}{
+		"enable_otp":   true,
+		"otp_secret":   encrypted,
+		"backup_codes": "",
+	}
+
+	var backupCodes []string
+	if securitySettingEnabled("allow_backup_codes", true) {
+		var stored string
+		backupCodes, stored, err = newBackupCodes(user.ID)
+		if err != nil {
+			logger.ErrorError("Failed to generate backup codes", zap.Error(err))
+			respondInternalError(c)
+			return
+		}
+		updates["backup_codes"] = stored
+	}
+
+	if err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+		logger.ErrorError("Failed to enable TOTP", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	redis.Del(mfaPendingSecretPrefix + user.ID)
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID,
+		"Enabled TOTP for user: "+user.Username, gin.H{
+			"backup_codes": len(backupCodes),
+		})
+	logger.Info("TOTP enabled", zap.String("user_id", user.ID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.SuccessOTPEnabled,
+		"data": gin.H{
+			"backup_codes": backupCodes,
+		},
+	})
+}
+
+// DisableOTPHandler 停用TOTP，需要提交当前动态码或备用码
+func DisableOTPHandler(c *gin.Context) {
+	var req OTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.EnableOTP {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.OTPNotEnabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	method, valid := verifyUserSecondFactor(user, req.Code)
+	if !valid {
+		logger.AccessInfo("Disable TOTP failed: invalid code", zap.String("user_id", user.ID))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidOTP,
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := clearUserMFA(user.ID); err != nil {
+		logger.ErrorError("Failed to disable TOTP", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID,
+		"Disabled TOTP for user: "+user.Username, gin.H{
+			"verified_by": method,
+		})
+	logger.Info("TOTP disabled", zap.String("user_id", user.ID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.SuccessOTPDisabled,
+		"data":    nil,
+	})
+}
+
+// GetBackupCodesHandler 返回剩余备用码数量，备用码只保存哈希，明文仅在生成时返回一次
+func GetBackupCodesHandler(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data": gin.H{
+			"enabled":   user.EnableOTP && securitySettingEnabled("allow_backup_codes", true),
+			"remaining": len(backupCodeHashes(user)),
+			"total":     backupCodeCount,
+		},
+	})
+}
+
+// RegenerateBackupCodesHandler 重新生成备用码，旧备用码全部作废
+func RegenerateBackupCodesHandler(c *gin.Context) {
+	var req OTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.EnableOTP {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.OTPNotEnabled,
+			"data":    nil,
+		})
+		return
+	}
+	if !securitySettingEnabled("allow_backup_codes", true) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.BackupCodesDisabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	// 只接受动态码，避免用即将作废的备用码换取新备用码
+	if !verifyUserTOTP(user, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidOTP,
+			"data":    nil,
+		})
+		return
+	}
+
+	codes, stored, err := newBackupCodes(user.ID)
+	if err != nil {
+		logger.ErrorError("Failed to generate backup codes", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("backup_codes", stored).Error; err != nil {
+		logger.ErrorError("Failed to save backup codes", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID,
+		"Regenerated backup codes for user: "+user.Username, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data": gin.H{
+			"backup_codes": codes,
+		},
+	})
+}
+
+// ResetUserMFAHandler 管理员重置用户的多因素认证，用户需要重新绑定
+func ResetUserMFAHandler(c *gin.Context) {
+	userID := c.Param("id")
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18n.UserNotFound,
+				"data":    nil,
+			})
+			return
+		}
+		logger.ErrorError("Failed to get user", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	if err := clearUserMFA(user.ID); err != nil {
+		logger.ErrorError("Failed to reset user MFA", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	removedCredentials, err := deleteUserWebAuthnCredentials(user.ID)
+	if err != nil {
+		logger.ErrorError("Failed to delete WebAuthn credentials", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID,
+		"Reset MFA for user: "+user.Username, gin.H{
+			"had_otp":                      user.EnableOTP,
+			"removed_webauthn_credentials": removedCredentials,
+		})
+	logger.Info("User MFA reset",
+		zap.String("user_id", user.ID),
+		zap.String("reset_by", c.GetString("user_id")),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.MFAReset,
+		"data":    nil,
+	})
+}
+
+// checkLoginSecondFactor 登录时校验第二因素，返回使用的验证方式，未通过时写入响应并返回false
+// 用户未启用OTP且未注册WebAuthn凭据时直接通过；未提交第二因素时返回require_otp/require_webauthn提示客户端补充
+func checkLoginSecondFactor(c *gin.Context, user *models.User, req *LoginRequest) (string, bool) {
+	hasWebAuthn := userHasWebAuthn(user.ID)
+	if !user.EnableOTP && !hasWebAuthn {
+		return "", true
+	}
+
+	var method string
+	var valid bool
+	switch {
+	case req.WebAuthn != nil && hasWebAuthn:
+		method = mfaMethodWebAuthn
+		if _, err := verifyWebAuthnAssertion(req.WebAuthn, webAuthnCeremonySecondFactor, user.ID); err != nil {
+			logger.AccessInfo("WebAuthn second factor failed",
+				zap.String("username", user.Username),
+				zap.Error(err),
+			)
+		} else {
+			valid = true
+		}
+	case strings.TrimSpace(req.OTPCode) != "":
+		method, valid = verifyUserSecondFactor(user, req.OTPCode)
+	default:
+		respondSecondFactorRequired(c, user, hasWebAuthn)
+		return "", false
+	}
+
+	if !valid {
+		// 第二因素失败与错误的密码一样计入失败次数，防止暴力猜测
+		recordLoginFailure(c, user)
+
+		logger.AccessInfo("Login failed: invalid second factor",
+			zap.String("ip", c.ClientIP()),
+			zap.String("username", user.Username),
+			zap.String("method", method),
+			zap.Int("failed_count", user.FailedCount),
+		)
+		message := i18n.InvalidOTP
+		if method == mfaMethodWebAuthn {
+			message = i18n.InvalidWebAuthn
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": message,
+			"data":    nil,
+		})
+		return "", false
+	}
+
+	logger.AccessInfo("Login second factor verified",
+		zap.String("ip", c.ClientIP()),
+		zap.String("username", user.Username),
+		zap.String("method", method),
+	)
+	return method, true
+}
+
+// respondSecondFactorRequired 提示客户端提交第二因素，注册了WebAuthn凭据时附带断言参数
+func respondSecondFactorRequired(c *gin.Context, user *models.User, hasWebAuthn bool) {
+	logger.AccessInfo("Login requires second factor",
+		zap.String("ip", c.ClientIP()),
+		zap.String("username", user.Username),
+	)
+
+	response := LoginResponse{
+		RequireOTP:      user.EnableOTP,
+		RequireWebAuthn: hasWebAuthn,
+		User: UserInfo{
+			ID:            user.ID,
+			Username:      user.Username,
+			Email:         user.Email,
+			DisplayName:   user.DisplayName,
+			Avatar:        user.Avatar,
+			Status:        user.Status.String(),
+			EmailVerified: user.EmailVerified,
+			PhoneVerified: user.PhoneVerified,
+			EnableOTP:     user.EnableOTP,
+		},
+	}
+	message := i18n.OTPRequired
+	if hasWebAuthn {
+		message = i18n.MFARequired
+		options, err := beginWebAuthnSecondFactor(user.ID)
+		if err != nil {
+			logger.ErrorError("Failed to start WebAuthn second factor", zap.String("user_id", user.ID), zap.Error(err))
+			respondInternalError(c)
+			return
+		}
+		response.WebAuthnOptions = gin.H{"publicKey": options}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": message,
+		"data":    response,
+	})
+}
+
+// loginAMR 登录令牌的amr：首个认证方式，以及通过的第二因素
+func loginAMR(method, secondFactor string) []string {
+	amr := []string{method}
+	switch secondFactor {
+	case "":
+		return amr
+	case mfaMethodWebAuthn:
+		amr = append(amr, utils.AMRHardwareKey)
+	default:
+		amr = append(amr, utils.AMROTP)
+	}
+	return append(amr, utils.AMRMultiFactor)
+}
+
+// verifyUserSecondFactor 校验动态码或备用码，返回使用的验证方式
+func verifyUserSecondFactor(user *models.User, code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) == utils.TOTPDigits && isDigits(code) {
+		return mfaMethodTOTP, verifyUserTOTP(user, code)
+	}
+	if securitySettingEnabled("allow_backup_codes", true) && consumeBackupCode(user, code) {
+		return mfaMethodBackupCode, true
+	}
+	return "", false
+}
+
+// verifyUserTOTP 使用用户已绑定的密钥校验动态码，同一时间步的动态码只能使用一次
+func verifyUserTOTP(user *models.User, code string) bool {
+	if user.OTPSecret == "" {
+		return false
+	}
+	secret, err := utils.DecryptSecret(user.OTPSecret, signingKeySecret())
+	if err != nil {
+		logger.ErrorError("Failed to decrypt TOTP secret", zap.String("user_id", user.ID), zap.Error(err))
+		return false
+	}
+
+	step, valid := utils.ValidateTOTP(secret, code, time.Now(), totpSkew)
+	if !valid {
+		return false
+	}
+	return markTOTPStepUsed(user.ID, step)
+}
+
+// markTOTPStepUsed 记录已使用的时间步，时间步不大于上次记录时返回false
+// Redis不可用时拒绝验证，避免动态码被重放
+func markTOTPStepUsed(userID string, step int64) bool {
+	if redis.RDB == nil {
+		logger.ErrorError("Redis not available for TOTP replay protection", zap.String("user_id", userID))
+		return false
+	}
+
+	// 记录保留到该时间步在偏差窗口内失效之后
+	ttl := (2*totpSkew + 2) * utils.TOTPPeriod
+	accepted, err := redis.RDB.Eval(context.Background(), totpReplayScript,
+		[]string{mfaLastStepPrefix + userID}, step, ttl).Int()
+	if err != nil {
+		logger.ErrorError("Failed to record TOTP step", zap.String("user_id", userID), zap.Error(err))
+		return false
+	}
+	if accepted != 1 {
+		logger.AccessInfo("TOTP code replay rejected", zap.String("user_id", userID), zap.Int64("step", step))
+		return false
+	}
+	return true
+}
+
+// newBackupCodes 生成备用码，返回明文和用于保存的哈希JSON
+func newBackupCodes(userID string) ([]string, string, error) {
+	codes, err := utils.GenerateBackupCodes(backupCodeCount)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, utils.HashBackupCode(code, userID))
+	}
+	data, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, "", err
+	}
+	return codes, string(data), nil
+}
+
+// backupCodeHashes 解析用户剩余的备用码哈希
+func backupCodeHashes(user *models.User) []string {
+	if user.BackupCodes == "" {
+		return nil
+	}
+	var hashes []string
+	if err := json.Unmarshal([]byte(user.BackupCodes), &hashes); err != nil {
+		logger.ErrorWarn("Invalid backup codes data", zap.String("user_id", user.ID), zap.Error(err))
+		return nil
+	}
+	return hashes
+}
+
+// consumeBackupCode 校验并作废备用码
+// 以原值作为更新条件，并发使用同一备用码时只有一个请求能成功
+func consumeBackupCode(user *models.User, code string) bool {
+	if utils.NormalizeBackupCode(code) == "" {
+		return false
+	}
+
+	hashes := backupCodeHashes(user)
+	hash := utils.HashBackupCode(code, user.ID)
+	index := -1
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			index = i
+		}
+	}
+	if index < 0 {
+		return false
+	}
+
+	remaining := append(append([]string{}, hashes[:index]...), hashes[index+1:]...)
+	data, err := json.Marshal(remaining)
+	if err != nil {
+		return false
+	}
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND backup_codes = ?", user.ID, user.BackupCodes).
+		Update("backup_codes", string(data))
+	if result.Error != nil {
+		logger.ErrorError("Failed to consume backup code", zap.String("user_id", user.ID), zap.Error(result.Error))
+		return false
+	}
+	if result.RowsAffected != 1 {
+		return false
+	}
+
+	user.BackupCodes = string(data)
+	logger.Info("Backup code used",
+		zap.String("user_id", user.ID),
+		zap.Int("remaining", len(remaining)),
+	)
+	return true
+}
+
+// clearUserMFA 清除用户的TOTP密钥、备用码及未完成的绑定
+func clearUserMFA(userID string) error {
+	err := database.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"enable_otp":   false,
+		"otp_secret":   "",
+		"backup_codes": "",
+	}).Error
+	if err != nil {
+		return err
+	}
+	redis.Del(mfaPendingSecretPrefix+userID, mfaLastStepPrefix+userID)
+	return nil
+}
+
+// siteDisplayName 站点名称，用作验证器App中的发行方和WebAuthn依赖方名称
+func siteDisplayName() string {
+	var setting models.SystemSetting
+	if err := database.DB.Where("`key` = ? AND category = ?", "site_name", "site").First(&setting).Error; err == nil && setting.Value != "" {
+		return setting.Value
+	}
+	if cfg := config.GetConfig(); cfg != nil && cfg.JWT.Issuer != "" {
+		return cfg.JWT.Issuer
+	}
+	return "EIAM Platform"
+}
+
+// loadCurrentUser 加载当前登录用户，失败时写入响应
+func loadCurrentUser(c *gin.Context) (*models.User, bool) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "User not authenticated",
+			"data":    nil,
+		})
+		return nil, false
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18n.UserNotFound,
+				"data":    nil,
+			})
+			return nil, false
+		}
+		logger.ErrorError("Failed to get current user", zap.Error(err))
+		respondInternalError(c)
+		return nil, false
+	}
+	return &user, true
+}
+
+// respondInternalError 返回500错误
+func respondInternalError(c *gin.Context) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"code":    500,
+		"message": i18n.InternalServerError,
+		"data":    nil,
+	})
+}
+
+// isDigits 判断字符串是否全部为数字
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,835 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/middleware"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/utils"
+)
+
+// OAuth2 授权类型
+const (
+	OAuth2GrantAuthorizationCode = "authorization_code"
+	OAuth2GrantRefreshToken      = "refresh_token"
+	OAuth2GrantClientCredentials = "client_credentials"
+)
+
+// PKCE code_challenge_method (RFC 7636)
+const (
+	PKCEMethodS256  = "S256"
+	PKCEMethodPlain = "plain"
+)
+
+const (
+	// oauth2AuthorizationCodeTTL 授权码有效期
+	oauth2AuthorizationCodeTTL = 10 * time.Minute
+	// oauth2DefaultAccessTokenTTL 应用未配置时的访问令牌有效期(秒)
+	oauth2DefaultAccessTokenTTL = 3600
+	// oauth2DefaultRefreshTokenTTL 应用未配置时的刷新令牌有效期(秒)
+	oauth2DefaultRefreshTokenTTL = 604800
+	// oauth2ClientSecretLength 生成的客户端密钥长度，base64url字符，约288位随机数
+	oauth2ClientSecretLength = 48
+)
+
+// errOAuth2InvalidScope 请求的scope超出应用允许范围
+var errOAuth2InvalidScope = errors.New("requested scope is not allowed for this client")
+
+// OAuth2AuthorizeHandler OAuth2授权端点 (RFC 6749 4.1.1)
+func OAuth2AuthorizeHandler(c *gin.Context) {
+	responseType := c.Query("response_type")
+	clientID := c.Query("client_id")
+	redirectURI := c.Query("redirect_uri")
+	scope := c.Query("scope")
+	state := c.Query("state")
+	nonce := c.Query("nonce")
+	prompt := c.Query("prompt")
+	codeChallenge := c.Query("code_challenge")
+	codeChallengeMethod := c.Query("code_challenge_method")
+
+	logger.Info("OAuth2 authorize request",
+		zap.String("client_id", clientID),
+		zap.String("redirect_uri", redirectURI),
+		zap.String("scope", scope),
+		zap.String("ip", c.ClientIP()),
+	)
+
+	// client_id和redirect_uri校验失败时不能重定向，直接返回错误
+	app, err := findOAuth2Client(clientID)
+	if err != nil {
+		oauth2Error(c, http.StatusBadRequest, "invalid_client", "Unknown or disabled client")
+		return
+	}
+
+	redirectURIs := parseRedirectURIs(app.RedirectURIs)
+	if redirectURI == "" {
+		if len(redirectURIs) != 1 {
+			oauth2Error(c, http.StatusBadRequest, "invalid_request", "redirect_uri is required")
+			return
+		}
+		redirectURI = redirectURIs[0]
+	} else if !containsString(redirectURIs, redirectURI) {
+		oauth2Error(c, http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+		return
+	}
+
+	// 以下错误通过重定向返回给客户端
+	if responseType != "code" {
+		oauth2RedirectError(c, redirectURI, state, "unsupported_response_type", "Only response_type=code is supported")
+		return
+	}
+	if responseTypes := splitOAuth2List(app.ResponseTypes); len(responseTypes) > 0 && !containsString(responseTypes, "code") {
+		oauth2RedirectError(c, redirectURI, state, "unauthorized_client", "Client is not allowed to use response_type=code")
+		return
+	}
+	if !clientAllowsGrant(app, OAuth2GrantAuthorizationCode) {
+		oauth2RedirectError(c, redirectURI, state, "unauthorized_client", "Client is not allowed to use the authorization_code grant")
+		return
+	}
+
+	// PKCE校验 (RFC 7636 4.3)
+	if codeChallenge == "" {
+		if appRequiresPKCE(app) {
+			oauth2RedirectError(c, redirectURI, state, "invalid_request", "code_challenge is required for this client")
+			return
+		}
+	} else {
+		if codeChallengeMethod == "" {
+			codeChallengeMethod = PKCEMethodPlain
+		}
+		if codeChallengeMethod != PKCEMethodS256 && codeChallengeMethod != PKCEMethodPlain {
+			oauth2RedirectError(c, redirectURI, state, "invalid_request", "Unsupported code_challenge_method")
+			return
+		}
+		if !isValidPKCEValue(codeChallenge) {
+			oauth2RedirectError(c, redirectURI, state, "invalid_request", "Invalid code_challenge")
+			return
+		}
+	}
+
+	grantedScope, err := resolveOAuth2Scope(app, scope)
+	if err != nil {
+		oauth2RedirectError(c, redirectURI, state, "invalid_scope", err.Error())
+		return
+	}
+
+	// 检查用户是否已登录
+	user, authTime, authenticated := getOAuth2AuthenticatedUser(c)
+	if !authenticated {
+		if prompt == "none" {
+			oauth2RedirectError(c, redirectURI, state, "login_required", "User is not authenticated")
+			return
+		}
+		// 跳转到统一登录页，登录完成后回到当前授权请求
+		loginURL := "/cas/login?service=" + url.QueryEscape(requestURL(c))
+		c.Redirect(http.StatusFound, loginURL)
+		return
+	}
+
+	if user.Status != models.StatusActive {
+		oauth2RedirectError(c, redirectURI, state, "access_denied", "User account is not active")
+		return
+	}
+
+	code, err := issueOAuth2AuthorizationCode(user, app, redirectURI, grantedScope, state, nonce, codeChallenge, codeChallengeMethod, authTime)
+	if err != nil {
+		logger.ErrorError("Failed to issue OAuth2 authorization code", zap.Error(err))
+		oauth2RedirectError(c, redirectURI, state, "server_error", "Failed to issue authorization code")
+		return
+	}
+
+	recordApplicationAccess(user.ID, app.ID, "oauth2", c.ClientIP())
+
+	c.Redirect(http.StatusFound, buildOAuth2RedirectURL(redirectURI, url.Values{
+		"code":  {code},
+		"state": {state},
+	}))
+}
+
+// OAuth2TokenHandler OAuth2令牌端点 (RFC 6749 3.2)
+func OAuth2TokenHandler(c *gin.Context) {
+	app, ok := authenticateOAuth2Client(c)
+	if !ok {
+		return
+	}
+	// 客户端认证通过后才按client_id计数，未认证的请求只按IP限流
+	if !middleware.CheckRateLimit(c, middleware.RateLimitPolicyOAuth2Token, middleware.RateLimitKeyClient(app.ClientID)) {
+		return
+	}
+
+	grantType := c.PostForm("grant_type")
+	if grantType == "" {
+		oauth2Error(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	}
+	if !clientAllowsGrant(app, grantType) {
+		oauth2Error(c, http.StatusBadRequest, "unauthorized_client", "Client is not allowed to use this grant type")
+		return
+	}
+	// 公共客户端无法证明自身身份，不允许使用客户端凭证模式
+	if app.PublicClient && grantType == OAuth2GrantClientCredentials {
+		oauth2Error(c, http.StatusBadRequest, "unauthorized_client", "Public clients cannot use the client_credentials grant")
+		return
+	}
+
+	logger.Info("OAuth2 token request",
+		zap.String("client_id", app.ClientID),
+		zap.String("grant_type", grantType),
+		zap.String("ip", c.ClientIP()),
+	)
+
+	switch grantType {
+	case OAuth2GrantAuthorizationCode:
+		handleAuthorizationCodeGrant(c, app)
+	case OAuth2GrantRefreshToken:
+		handleRefreshTokenGrant(c, app)
+	case OAuth2GrantClientCredentials:
+		handleClientCredentialsGrant(c, app)
+	default:
+		oauth2Error(c, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+	}
+}
+
+// OAuth2IntrospectHandler OAuth2令牌内省端点 (RFC 7662)
+func OAuth2IntrospectHandler(c *gin.Context) {
+	app, ok := authenticateOAuth2Client(c)
+	if !ok {
+		return
+	}
+	// 内省端点只对机密客户端开放
+	if app.PublicClient {
+		oauth2Error(c, http.StatusUnauthorized, "invalid_client", "Public clients are not allowed to introspect tokens")
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauth2Error(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	inactive := gin.H{"active": false}
+	now := time.Now()
+
+	var record models.OAuth2AccessToken
+	tokenType := "access_token"
+	if c.PostForm("token_type_hint") == "refresh_token" {
+		tokenType = "refresh_token"
+	}
+	if err := database.DB.Where(tokenType+" = ?", token).First(&record).Error; err != nil {
+		// 按提示未找到时按另一种类型再查一次
+		if tokenType == "access_token" {
+			tokenType = "refresh_token"
+		} else {
+			tokenType = "access_token"
+		}
+		if err := database.DB.Where(tokenType+" = ?", token).First(&record).Error; err != nil {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+	}
+
+	// 只允许令牌所属的客户端进行内省
+	if record.ClientID != app.ClientID {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	expiresAt := record.ExpiresAt
+	if tokenType == "refresh_token" {
+		if record.RefreshExpiresAt == nil {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+		expiresAt = *record.RefreshExpiresAt
+	}
+	if now.After(expiresAt) {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	resp := gin.H{
+		"active":     true,
+		"scope":      record.Scope,
+		"client_id":  record.ClientID,
+		"token_type": record.TokenType,
+		"exp":        expiresAt.Unix(),
+		"iat":        record.CreatedAt.Unix(),
+		"iss":        oauth2Issuer(),
+		"aud":        record.ClientID,
+	}
+	if record.UserID != "" {
+		var user models.User
+		if err := database.DB.Where("id = ?", record.UserID).First(&user).Error; err != nil || user.Status != models.StatusActive {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+		resp["sub"] = user.ID
+		resp["username"] = user.Username
+	} else {
+		resp["sub"] = record.ClientID
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// OAuth2RevokeHandler OAuth2令牌撤销端点 (RFC 7009)
+func OAuth2RevokeHandler(c *gin.Context) {
+	app, ok := authenticateOAuth2Client(c)
+	if !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauth2Error(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	// 撤销访问令牌或刷新令牌都会删除整条令牌记录
+	result := database.DB.Where("(access_token = ? OR refresh_token = ?) AND client_id = ?", token, token, app.ClientID).
+		Delete(&models.OAuth2AccessToken{})
+	if result.Error != nil {
+		logger.ErrorError("Failed to revoke OAuth2 token", zap.Error(result.Error))
+		oauth2Error(c, http.StatusServiceUnavailable, "server_error", "Failed to revoke token")
+		return
+	}
+
+	logger.Info("OAuth2 token revoked",
+		zap.String("client_id", app.ClientID),
+		zap.Int64("revoked", result.RowsAffected),
+	)
+
+	// 无论令牌是否存在都返回200
+	c.Status(http.StatusOK)
+}
+
+// handleAuthorizationCodeGrant 授权码换取令牌
+func handleAuthorizationCodeGrant(c *gin.Context, app *models.Application) {
+	code := c.PostForm("code")
+	redirectURI := c.PostForm("redirect_uri")
+	if code == "" {
+		oauth2Error(c, http.StatusBadRequest, "invalid_request", "code is required")
+		return
+	}
+
+	var authCode models.OAuth2AuthorizationCode
+	if err := database.DB.Where("code = ? AND client_id = ?", code, app.ClientID).First(&authCode).Error; err != nil {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
+		return
+	}
+
+	if authCode.Used || time.Now().After(authCode.ExpiresAt) {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "Authorization code is expired or already used")
+		return
+	}
+	if authCode.RedirectURI != redirectURI {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+		return
+	}
+
+	// PKCE校验 (RFC 7636 4.6)
+	codeVerifier := c.PostForm("code_verifier")
+	if authCode.Challenge == "" {
+		if appRequiresPKCE(app) || codeVerifier != "" {
+			oauth2Error(c, http.StatusBadRequest, "invalid_grant", "Authorization code was not issued with a code_challenge")
+			return
+		}
+	} else if !verifyPKCE(authCode.Challenge, authCode.ChallengeMethod, codeVerifier) {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	// 原子地标记授权码为已使用，防止并发重放
+	result := database.DB.Model(&models.OAuth2AuthorizationCode{}).
+		Where("id = ? AND used = ?", authCode.ID, false).
+		Update("used", true)
+	if result.Error != nil || result.RowsAffected != 1 {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "Authorization code is expired or already used")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", authCode.UserID).First(&user).Error; err != nil || user.Status != models.StatusActive {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "User is not active")
+		return
+	}
+
+	token, err := issueOAuth2Tokens(app, user.ID, authCode.Scope, clientAllowsGrant(app, OAuth2GrantRefreshToken), authCode.AuthTime)
+	if err != nil {
+		logger.ErrorError("Failed to issue OAuth2 tokens", zap.Error(err))
+		oauth2Error(c, http.StatusInternalServerError, "server_error", "Failed to issue token")
+		return
+	}
+
+	idToken, err := issueIDTokenIfRequested(app, &user, token, authCode.Nonce, authCode.AuthTime)
+	if err != nil {
+		logger.ErrorError("Failed to issue OIDC ID token", zap.Error(err))
+		oauth2Error(c, http.StatusInternalServerError, "server_error", "Failed to issue ID token")
+		return
+	}
+
+	writeOAuth2TokenResponse(c, token, idToken)
+}
+
+// handleRefreshTokenGrant 使用刷新令牌换取新令牌（刷新令牌轮换）
+func handleRefreshTokenGrant(c *gin.Context, app *models.Application) {
+	refreshToken := c.PostForm("refresh_token")
+	if refreshToken == "" {
+		oauth2Error(c, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	var record models.OAuth2AccessToken
+	if err := database.DB.Where("refresh_token = ? AND client_id = ?", refreshToken, app.ClientID).First(&record).Error; err != nil {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+	if record.RefreshExpiresAt == nil || time.Now().After(*record.RefreshExpiresAt) {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "Refresh token is expired")
+		return
+	}
+
+	// 允许缩小scope，不允许扩大
+	scope := record.Scope
+	if requested := c.PostForm("scope"); requested != "" {
+		granted := splitOAuth2List(record.Scope)
+		for _, s := range splitOAuth2List(requested) {
+			if !containsString(granted, s) {
+				oauth2Error(c, http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the original grant")
+				return
+			}
+		}
+		scope = strings.Join(splitOAuth2List(requested), " ")
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", record.UserID).First(&user).Error; err != nil || user.Status != models.StatusActive {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "User is not active")
+		return
+	}
+
+	// 删除旧令牌，并发请求中只有一个能成功
+	result := database.DB.Where("id = ?", record.ID).Delete(&models.OAuth2AccessToken{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		oauth2Error(c, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+		return
+	}
+
+	token, err := issueOAuth2Tokens(app, record.UserID, scope, true, record.AuthTime)
+	if err != nil {
+		logger.ErrorError("Failed to issue OAuth2 tokens", zap.Error(err))
+		oauth2Error(c, http.StatusInternalServerError, "server_error", "Failed to issue token")
+		return
+	}
+
+	// 刷新时签发的ID Token不包含nonce (OpenID Connect Core 12.2)
+	idToken, err := issueIDTokenIfRequested(app, &user, token, "", record.AuthTime)
+	if err != nil {
+		logger.ErrorError("Failed to issue OIDC ID token", zap.Error(err))
+		oauth2Error(c, http.StatusInternalServerError, "server_error", "Failed to issue ID token")
+		return
+	}
+
+	writeOAuth2TokenResponse(c, token, idToken)
+}
+
+// handleClientCredentialsGrant 客户端凭证模式，令牌不关联用户
+func handleClientCredentialsGrant(c *gin.Context, app *models.Application) {
+	scope, err := resolveOAuth2Scope(app, c.PostForm("scope"))
+	if err != nil {
+		oauth2Error(c, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	// 客户端凭证模式不签发刷新令牌 (RFC 6749 4.4.3)
+	token, err := issueOAuth2Tokens(app, "", scope, false, nil)
+	if err != nil {
+		logger.ErrorError("Failed to issue OAuth2 tokens", zap.Error(err))
+		oauth2Error(c, http.StatusInternalServerError, "server_error", "Failed to issue token")
+		return
+	}
+
+	writeOAuth2TokenResponse(c, token, "")
+}
+
+// issueOAuth2AuthorizationCode 生成并保存授权码
+// authTime为当前登录会话的认证时间
+func issueOAuth2AuthorizationCode(user *models.User, app *models.Application, redirectURI, scope, state, nonce, challenge, challengeMethod string, authTime *time.Time) (string, error) {
+	code, err := utils.GenerateRandomString(43)
+	if err != nil {
+		return "", err
+	}
+
+	authCode := models.OAuth2AuthorizationCode{
+		Code:            code,
+		ClientID:        app.ClientID,
+		UserID:          user.ID,
+		RedirectURI:     redirectURI,
+		Scope:           scope,
+		State:           state,
+		Challenge:       challenge,
+		ChallengeMethod: challengeMethod,
+		Nonce:           nonce,
+		AuthTime:        authTime,
+		ExpiresAt:       time.Now().Add(oauth2AuthorizationCodeTTL),
+	}
+	if err := database.DB.Create(&authCode).Error; err != nil {
+		return "", err
+	}
+
+	logger.Info("OAuth2 authorization code issued",
+		zap.String("client_id", app.ClientID),
+		zap.String("username", user.Username),
+		zap.String("scope", scope),
+	)
+
+	return code, nil
+}
+
+// issueOAuth2Tokens 按应用配置的有效期签发并保存令牌，authTime随刷新令牌保留，用于刷新时签发的ID Token
+func issueOAuth2Tokens(app *models.Application, userID, scope string, withRefresh bool, authTime *time.Time) (*models.OAuth2AccessToken, error) {
+	accessToken, err := utils.GenerateRandomString(64)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTTL := app.AccessTokenTTL
+	if accessTTL <= 0 {
+		accessTTL = oauth2DefaultAccessTokenTTL
+	}
+
+	now := time.Now()
+	token := &models.OAuth2AccessToken{
+		AccessToken: accessToken,
+		ClientID:    app.ClientID,
+		UserID:      userID,
+		Scope:       scope,
+		TokenType:   "Bearer",
+		ExpiresAt:   now.Add(time.Duration(accessTTL) * time.Second),
+		AuthTime:    authTime,
+	}
+
+	if withRefresh {
+		refreshToken, err := utils.GenerateRandomString(64)
+		if err != nil {
+			return nil, err
+		}
+		refreshTTL := app.RefreshTokenTTL
+		if refreshTTL <= 0 {
+			refreshTTL = oauth2DefaultRefreshTokenTTL
+		}
+		refreshExpiresAt := now.Add(time.Duration(refreshTTL) * time.Second)
+		token.RefreshToken = refreshToken
+		token.RefreshExpiresAt = &refreshExpiresAt
+	}
+
+	// refresh_token列有唯一索引，不签发刷新令牌时写入NULL而不是空字符串
+	query := database.DB
+	if !withRefresh {
+		query = query.Omit("RefreshToken")
+	}
+	if err := query.Create(token).Error; err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// issueIDTokenIfRequested 授权范围包含openid时签发ID Token
+func issueIDTokenIfRequested(app *models.Application, user *models.User, token *models.OAuth2AccessToken, nonce string, authTime *time.Time) (string, error) {
+	if !containsString(splitOAuth2List(token.Scope), OIDCScopeOpenID) {
+		return "", nil
+	}
+	return generateIDToken(app, user, token.Scope, nonce, token.AccessToken, authTime)
+}
+
+// writeOAuth2TokenResponse 返回标准令牌响应 (RFC 6749 5.1)
+func writeOAuth2TokenResponse(c *gin.Context, token *models.OAuth2AccessToken, idToken string) {
+	resp := gin.H{
+		"access_token": token.AccessToken,
+		"token_type":   token.TokenType,
+		"expires_in":   int(time.Until(token.ExpiresAt).Seconds()),
+	}
+	if token.Scope != "" {
+		resp["scope"] = token.Scope
+	}
+	if token.RefreshToken != "" {
+		resp["refresh_token"] = token.RefreshToken
+	}
+	if idToken != "" {
+		resp["id_token"] = idToken
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, resp)
+}
+
+// authenticateOAuth2Client 校验客户端凭证（client_secret_basic或client_secret_post）
+// 公共客户端只需提供client_id，校验失败时已写入错误响应
+func authenticateOAuth2Client(c *gin.Context) (*models.Application, bool) {
+	clientID, clientSecret, hasBasic := c.Request.BasicAuth()
+	if hasBasic {
+		// RFC 6749 2.3.1: Basic认证中的凭证需要先进行form-urlencoded解码
+		if id, err := url.QueryUnescape(clientID); err == nil {
+			clientID = id
+		}
+		if secret, err := url.QueryUnescape(clientSecret); err == nil {
+			clientSecret = secret
+		}
+	} else {
+		clientID = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+
+	if clientID == "" {
+		oauth2ClientAuthError(c, hasBasic)
+		return nil, false
+	}
+
+	app, err := findOAuth2Client(clientID)
+	if err == nil && app.PublicClient && clientSecret == "" {
+		return app, true
+	}
+	// 未配置密钥的机密客户端不能通过认证，避免空密钥与空提交值比较通过
+	if err != nil || app.ClientSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(app.ClientSecret), []byte(clientSecret)) != 1 {
+		logger.Warn("OAuth2 client authentication failed",
+			zap.String("client_id", clientID),
+			zap.String("ip", c.ClientIP()),
+		)
+		oauth2ClientAuthError(c, hasBasic)
+		return nil, false
+	}
+
+	return app, true
+}
+
+// oauth2ClientAuthError 客户端认证失败响应
+func oauth2ClientAuthError(c *gin.Context, hasBasic bool) {
+	if hasBasic {
+		c.Header("WWW-Authenticate", `Basic realm="oauth2"`)
+	}
+	oauth2Error(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+}
+
+// findOAuth2Client 根据client_id查找已启用的OAuth2/OIDC应用
+func findOAuth2Client(clientID string) (*models.Application, error) {
+	if clientID == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var app models.Application
+	if err := database.DB.Where("client_id = ? AND protocol IN ? AND status = ?",
+		clientID, []string{"oauth2", "oidc"}, models.StatusActive).First(&app).Error; err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// getOAuth2AuthenticatedUser 从Bearer令牌或统一登录会话中获取当前用户和该会话的认证时间
+func getOAuth2AuthenticatedUser(c *gin.Context) (*models.User, *time.Time, bool) {
+	authHeader := c.GetHeader("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		cfg := config.GetConfig()
+		jwtManager := utils.NewJWTManager(&cfg.JWT)
+		// 代登录令牌不能用于登录应用
+		if claims, err := jwtManager.ValidateAccessToken(token); err == nil && claims.Act == nil {
+			var user models.User
+			if err := database.DB.Where("id = ?", claims.UserID).First(&user).Error; err == nil {
+				return &user, tokenAuthTime(claims), true
+			}
+		}
+	}
+
+	user, sessionInfo, ok := casSessionFromRequest(c)
+	if !ok {
+		return nil, nil, false
+	}
+	return user, &sessionInfo.LoginTime, true
+}
+
+// clientAllowsGrant 检查应用是否允许使用指定授权类型
+// 未配置时默认允许authorization_code和refresh_token
+func clientAllowsGrant(app *models.Application, grantType string) bool {
+	grantTypes := splitOAuth2List(app.GrantTypes)
+	if len(grantTypes) == 0 {
+		return grantType == OAuth2GrantAuthorizationCode || grantType == OAuth2GrantRefreshToken
+	}
+	return containsString(grantTypes, grantType)
+}
+
+// appRequiresPKCE 公共客户端或开启了强制PKCE策略的应用必须使用PKCE
+func appRequiresPKCE(app *models.Application) bool {
+	return app.PublicClient || app.RequirePKCE
+}
+
+// isValidPKCEValue 校验code_challenge/code_verifier格式：43-128位的unreserved字符
+func isValidPKCEValue(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+	for _, r := range value {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-', r == '.', r == '_', r == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// verifyPKCE 使用code_verifier校验授权请求中的code_challenge
+func verifyPKCE(challenge, method, verifier string) bool {
+	if !isValidPKCEValue(verifier) {
+		return false
+	}
+
+	var computed string
+	switch method {
+	case PKCEMethodS256:
+		digest := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(digest[:])
+	case PKCEMethodPlain, "":
+		computed = verifier
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// resolveOAuth2Scope 计算实际授予的scope
+// 未请求scope时授予应用配置的全部scope；应用未配置scope时不做限制
+func resolveOAuth2Scope(app *models.Application, requested string) (string, error) {
+	allowed := splitOAuth2List(app.Scopes)
+	scopes := splitOAuth2List(requested)
+
+	if len(scopes) == 0 {
+		return strings.Join(allowed, " "), nil
+	}
+	if len(allowed) == 0 {
+		return strings.Join(scopes, " "), nil
+	}
+
+	for _, s := range scopes {
+		if !containsString(allowed, s) {
+			return "", errOAuth2InvalidScope
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// splitOAuth2List 解析逗号或空格分隔的列表并去重
+func splitOAuth2List(raw string) []string {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t'
+	})
+
+	result := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if !containsString(result, f) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// parseRedirectURIs 解析应用配置的回调地址，兼容JSON数组和逗号分隔两种格式
+func parseRedirectURIs(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+
+	var uris []string
+	if strings.HasPrefix(raw, "[") {
+		if err := json.Unmarshal([]byte(raw), &uris); err == nil {
+			return uris
+		}
+	}
+
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '\n' || r == ' '
+	})
+}
+
+// containsString 判断切片中是否包含指定字符串
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// buildOAuth2RedirectURL 在回调地址上追加查询参数，忽略空值
+func buildOAuth2RedirectURL(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// oauth2Error 返回OAuth2标准错误响应 (RFC 6749 5.2)
+func oauth2Error(c *gin.Context, status int, errorCode, description string) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, gin.H{
+		"error":             errorCode,
+		"error_description": description,
+		"trade_id":          c.GetString("trade_id"),
+	})
+}
+
+// oauth2RedirectError 通过重定向将错误返回给客户端 (RFC 6749 4.1.2.1)
+func oauth2RedirectError(c *gin.Context, redirectURI, state, errorCode, description string) {
+	c.Redirect(http.StatusFound, buildOAuth2RedirectURL(redirectURI, url.Values{
+		"error":             {errorCode},
+		"error_description": {description},
+		"state":             {state},
+	}))
+}
+
+// oauth2Issuer 返回令牌签发者标识
+func oauth2Issuer() string {
+	if cfg := config.GetConfig(); cfg != nil && cfg.IdP.BaseURL != "" {
+		return strings.TrimRight(cfg.IdP.BaseURL, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// requestURL 还原当前请求的完整URL
+func requestURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + c.Request.URL.RequestURI()
+}
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/utils"
+)
+
+// OIDC 标准scope
+const (
+	OIDCScopeOpenID  = "openid"
+	OIDCScopeProfile = "profile"
+	OIDCScopeEmail   = "email"
+	OIDCScopePhone   = "phone"
+)
+
+// oidcKeySet OIDC签名密钥集合
+type oidcKeySet struct {
+	mu         sync.RWMutex
+	signingKey *rsa.PrivateKey
+	signingKID string
+	publicKeys map[string]*rsa.PublicKey
+}
+
+var oidcKeys = &oidcKeySet{publicKeys: make(map[string]*rsa.PublicKey)}
+
+// InitOIDCProvider 加载OIDC签名密钥，数据库中没有可用密钥时生成并保存一个新密钥
+func InitOIDCProvider() error {
+	if err := loadOIDCSigningKeys(); err != nil {
+		return err
+	}
+
+	oidcKeys.mu.RLock()
+	hasKey := oidcKeys.signingKey != nil
+	oidcKeys.mu.RUnlock()
+	if hasKey {
+		logger.Info("OIDC provider initialized", zap.String("kid", oidcKeys.signingKID))
+		return nil
+	}
+
+	if _, err := createOIDCSigningKey(); err != nil {
+		return fmt.Errorf("failed to create OIDC signing key: %w", err)
+	}
+	if err := loadOIDCSigningKeys(); err != nil {
+		return err
+	}
+
+	logger.Info("OIDC provider initialized with new signing key", zap.String("kid", oidcKeys.signingKID))
+	return nil
+}
+
+// loadOIDCSigningKeys 从数据库加载全部OIDC密钥，最新的启用密钥用于签名，其余只发布公钥
+func loadOIDCSigningKeys() error {
+	var keys []models.SigningKey
+	if err := database.DB.Where("purpose = ?", models.SigningKeyPurposeOIDC).
+		Order("created_at DESC").Find(&keys).Error; err != nil {
+		return fmt.Errorf("failed to load OIDC signing keys: %w", err)
+	}
+
+	publicKeys := make(map[string]*rsa.PublicKey)
+	var signingKey *rsa.PrivateKey
+	var signingKID string
+	for _, key := range keys {
+		privateKey, err := decryptSigningPrivateKey(key.PrivateKey)
+		if err != nil {
+			logger.ErrorWarn("Skipping invalid OIDC signing key", zap.String("kid", key.KeyID), zap.Error(err))
+			continue
+		}
+		publicKeys[key.KeyID] = &privateKey.PublicKey
+		if key.Active && signingKey == nil {
+			signingKey = privateKey
+			signingKID = key.KeyID
+		}
+	}
+
+	oidcKeys.mu.Lock()
+	oidcKeys.signingKey = signingKey
+	oidcKeys.signingKID = signingKID
+	oidcKeys.publicKeys = publicKeys
+	oidcKeys.mu.Unlock()
+	return nil
+}
+
+// createOIDCSigningKey 生成RSA-2048签名密钥并保存到数据库
+func createOIDCSigningKey() (*models.SigningKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := encryptSigningPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.SigningKey{
+		KeyID:      signingKeyID(publicDER),
+		Purpose:    models.SigningKeyPurposeOIDC,
+		Algorithm:  "RS256",
+		PrivateKey: encryptedKey,
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: publicDER,
+		})),
+		Active: true,
+	}
+
+	if err := database.DB.Create(key).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// signingKeyID kid取公钥SHA-256摘要的前16字节
+func signingKeyID(publicDER []byte) string {
+	digest := sha256.Sum256(publicDER)
+	return base64.RawURLEncoding.EncodeToString(digest[:16])
+}
+
+// signingKeySecret 数据库私钥加密密钥
+func signingKeySecret() string {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return ""
+	}
+	if cfg.Encryption.KeyEncryptionKey != "" {
+		return cfg.Encryption.KeyEncryptionKey
+	}
+	return cfg.JWT.Secret
+}
+
+// encryptSigningPrivateKey 将私钥编码为PEM并加密，用于保存到数据库
+func encryptSigningPrivateKey(privateKey *rsa.PrivateKey) (string, error) {
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+	return utils.EncryptSecret(string(keyPEM), signingKeySecret())
+}
+
+// decryptSigningPrivateKey 解密数据库中的私钥，兼容未加密的历史数据
+func decryptSigningPrivateKey(data string) (*rsa.PrivateKey, error) {
+	keyPEM, err := utils.DecryptSecret(data, signingKeySecret())
+	if err != nil {
+		return nil, err
+	}
+	return parseRSAPrivateKeyPEM(keyPEM)
+}
+
+// parseRSAPrivateKeyPEM 解析PKCS#1或PKCS#8格式的RSA私钥
+func parseRSAPrivateKeyPEM(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+	return key, nil
+}
+
+// OIDCDiscoveryHandler OpenID Provider配置文档 (OpenID Connect Discovery 1.0)
+func OIDCDiscoveryHandler(c *gin.Context) {
+	issuer := oauth2Issuer()
+
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth2/authorize",
+		"token_endpoint":                        issuer + "/oauth2/token",
+		"userinfo_endpoint":                     issuer + "/oauth2/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"introspection_endpoint":                issuer + "/oauth2/introspect",
+		"revocation_endpoint":                   issuer + "/oauth2/revoke",
+		"response_types_supported":              []string{"code"},
+		"response_modes_supported":              []string{"query"},
+		"grant_types_supported":                 []string{OAuth2GrantAuthorizationCode, OAuth2GrantRefreshToken, OAuth2GrantClientCredentials},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{OIDCScopeOpenID, OIDCScopeProfile, OIDCScopeEmail, OIDCScopePhone},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{PKCEMethodS256, PKCEMethodPlain},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash",
+			"name", "preferred_username", "picture", "gender", "birthdate", "updated_at", "roles",
+			"email", "email_verified", "phone_number", "phone_number_verified",
+		},
+	})
+}
+
+// OIDCJWKSHandler 发布ID Token验签公钥 (RFC 7517)
+func OIDCJWKSHandler(c *gin.Context) {
+	oidcKeys.mu.RLock()
+	keys := make([]gin.H, 0, len(oidcKeys.publicKeys))
+	for kid, publicKey := range oidcKeys.publicKeys {
+		keys = append(keys, gin.H{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		})
+	}
+	oidcKeys.mu.RUnlock()
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// OIDCUserInfoHandler 返回访问令牌对应用户的声明 (OpenID Connect Core 5.3)
+func OIDCUserInfoHandler(c *gin.Context) {
+	accessToken := ""
+	if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		accessToken = strings.TrimPrefix(authHeader, "Bearer ")
+	} else {
+		accessToken = c.PostForm("access_token")
+	}
+	if accessToken == "" {
+		c.Header("WWW-Authenticate", `Bearer realm="userinfo"`)
+		oauth2Error(c, http.StatusUnauthorized, "invalid_request", "Access token is required")
+		return
+	}
+
+	var token models.OAuth2AccessToken
+	if err := database.DB.Where("access_token = ? AND expires_at > ?", accessToken, time.Now()).First(&token).Error; err != nil || token.UserID == "" {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauth2Error(c, http.StatusUnauthorized, "invalid_token", "Access token is invalid or expired")
+		return
+	}
+
+	scopes := splitOAuth2List(token.Scope)
+	if !containsString(scopes, OIDCScopeOpenID) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		oauth2Error(c, http.StatusForbidden, "insufficient_scope", "The openid scope is required")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", token.UserID).First(&user).Error; err != nil || user.Status != models.StatusActive {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauth2Error(c, http.StatusUnauthorized, "invalid_token", "User is not active")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, buildOIDCUserClaims(&user, scopes))
+}
+
+// buildOIDCUserClaims 按scope返回用户声明
+func buildOIDCUserClaims(user *models.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": user.ID,
+	}
+
+	if containsString(scopes, OIDCScopeProfile) {
+		name := user.DisplayName
+		if name == "" {
+			name = user.Username
+		}
+		claims["name"] = name
+		claims["preferred_username"] = user.Username
+		claims["updated_at"] = user.UpdatedAt.Unix()
+		if user.Avatar != "" {
+			claims["picture"] = user.Avatar
+		}
+		if user.Gender != models.GenderUnknown {
+			claims["gender"] = user.Gender.String()
+		}
+		if user.Birthday != nil {
+			claims["birthdate"] = user.Birthday.Format("2006-01-02")
+		}
+		claims["roles"] = loadUserRoleCodes(user.ID)
+	}
+
+	if email := releasableEmail(user); containsString(scopes, OIDCScopeEmail) && email != "" {
+		claims["email"] = email
+		claims["email_verified"] = user.EmailVerified
+	}
+
+	if containsString(scopes, OIDCScopePhone) && user.Phone != "" {
+		claims["phone_number"] = user.Phone
+		claims["phone_number_verified"] = user.PhoneVerified
+	}
+
+	return claims
+}
+
+// loadUserRoleCodes 查询用户的角色编码
+func loadUserRoleCodes(userID string) []string {
+	var roles []models.Role
+	codes := []string{}
+	if err := database.DB.Table("user_roles").
+		Select("roles.*").
+		Joins("JOIN roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ? AND roles.deleted_at IS NULL", userID).
+		Find(&roles).Error; err != nil {
+		logger.ErrorError("Failed to load user roles", zap.String("user_id", userID), zap.Error(err))
+		return codes
+	}
+
+	for _, role := range roles {
+		codes = append(codes, role.Code)
+	}
+	return codes
+}
+
+// generateIDToken 签发RS256 ID Token (OpenID Connect Core 2)
+func generateIDToken(app *models.Application, user *models.User, scope, nonce, accessToken string, authTime *time.Time) (string, error) {
+	oidcKeys.mu.RLock()
+	signingKey := oidcKeys.signingKey
+	kid := oidcKeys.signingKID
+	oidcKeys.mu.RUnlock()
+	if signingKey == nil {
+		return "", errors.New("OIDC signing key not initialized")
+	}
+
+	ttl := app.AccessTokenTTL
+	if ttl <= 0 {
+		ttl = oauth2DefaultAccessTokenTTL
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range buildOIDCUserClaims(user, splitOAuth2List(scope)) {
+		claims[k] = v
+	}
+	claims["iss"] = oauth2Issuer()
+	claims["aud"] = app.ClientID
+	claims["azp"] = app.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Duration(ttl) * time.Second).Unix()
+	if authTime != nil {
+		claims["auth_time"] = authTime.Unix()
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if accessToken != "" {
+		claims["at_hash"] = oidcTokenHash(accessToken)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(signingKey)
+}
+
+// oidcTokenHash 计算at_hash：SHA-256摘要左半部分的base64url编码
+func oidcTokenHash(value string) string {
+	digest := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(digest[:len(digest)/2])
+}
+
+// tokenAuthTime 平台令牌对应会话的认证时间：优先取令牌的auth_time，其次取会话的登录时间
+// 不使用用户的最近登录时间，其他设备登录不影响当前会话
+func tokenAuthTime(claims *utils.AccessTokenClaims) *time.Time {
+	if claims.AuthTime > 0 {
+		authTime := time.Unix(claims.AuthTime, 0)
+		return &authTime
+	}
+	if sessionManager != nil && claims.SessionID != "" {
+		if sessionInfo, err := sessionManager.GetSession(context.Background(), claims.SessionID); err == nil {
+			return &sessionInfo.LoginTime
+		}
+	}
+	return nil
+}
@@ -0,0 +1,570 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/notify"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/utils"
+)
+
+// 邮件/短信动态码用途，对应UserOTPRecord.Purpose
+const (
+	otpPurposeLogin         = "login"
+	otpPurposeResetPassword = "reset_password"
+	otpPurposeVerifyEmail   = "verify_email"
+	otpPurposeVerifyPhone   = "verify_phone"
+)
+
+const (
+	otpCooldownPrefix   = "otp:cooldown:"
+	otpUserRatePrefix   = "otp:rate:user:"
+	otpTargetRatePrefix = "otp:rate:target:"
+
+	// otpRateWindow 发送次数限制的统计窗口
+	otpRateWindow = time.Hour
+)
+
+var (
+	errOTPInvalid          = errors.New("invalid one-time code")
+	errOTPExpired          = errors.New("one-time code expired")
+	errOTPAttemptsExceeded = errors.New("one-time code attempts exceeded")
+)
+
+// otpRateLimitError 发送过于频繁，RetryAfter后可以重试
+type otpRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *otpRateLimitError) Error() string {
+	return fmt.Sprintf("one-time code rate limited, retry after %s", e.RetryAfter)
+}
+
+// otpReserveScript 检查发送间隔和每小时次数，全部通过后才记录本次发送
+// KEYS: 发送间隔、用户计数、目标计数；ARGV: 间隔秒数、用户上限、目标上限、窗口秒数
+// 返回0表示允许发送，否则返回需要等待的秒数
+const otpReserveScript = `
+local ttl = redis.call('TTL', KEYS[1])
+if ttl > 0 then
+	return ttl
+end
+for i = 2, 3 do
+	local limit = tonumber(ARGV[i])
+	if limit > 0 and tonumber(redis.call('GET', KEYS[i]) or '0') >= limit then
+		local wait = redis.call('TTL', KEYS[i])
+		if wait < 1 then
+			wait = 1
+		end
+		return wait
+	end
+end
+if tonumber(ARGV[1]) > 0 then
+	redis.call('SET', KEYS[1], '1', 'EX', ARGV[1])
+end
+for i = 2, 3 do
+	if redis.call('INCR', KEYS[i]) == 1 then
+		redis.call('EXPIRE', KEYS[i], ARGV[4])
+	end
+end
+return 0
+`
+
+// otpPurposeActions 消息中对用途的描述
+var otpPurposeActions = map[string]string{
+	otpPurposeLogin:         "sign in",
+	otpPurposeResetPassword: "reset your password",
+	otpPurposeVerifyEmail:   "verify your email address",
+	otpPurposeVerifyPhone:   "verify your phone number",
+}
+
+// SendOTPRequest 申请邮件/短信动态码
+type SendOTPRequest struct {
+	Identifier string `json:"identifier" binding:"required"` // 用户名、邮箱或手机号
+	Channel    string `json:"channel" binding:"required,oneof=email sms"`
+	Purpose    string `json:"purpose" binding:"omitempty,oneof=login"` // 默认login
+}
+
+// VerifyOTPRequest 使用邮件/短信动态码登录
+type VerifyOTPRequest struct {
+	Identifier string `json:"identifier" binding:"required"`
+	Code       string `json:"code" binding:"required"`
+	Purpose    string `json:"purpose" binding:"omitempty,oneof=login"`
+
+	// 已启用第二因素的用户还需提交TOTP/备用码或WebAuthn断言
+	OTPCode  string                      `json:"otp_code"`
+	WebAuthn *WebAuthnCredentialResponse `json:"webauthn"`
+}
+
+// SendOTPHandler 向用户的邮箱或手机发送动态码
+// 账户不存在、已停用或未设置对应联系方式时同样返回成功，避免被用来探测账户
+func SendOTPHandler(c *gin.Context) {
+	var req SendOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+	if req.Purpose == "" {
+		req.Purpose = otpPurposeLogin
+	}
+
+	if !otpChannelEnabled(req.Channel) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.OTPChannelDisabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	settings := otpCodeSettings()
+	sent := gin.H{
+		"code":    200,
+		"message": i18n.SuccessOTPSent,
+		"data": gin.H{
+			"expires_in":   int(settings.TTL.Seconds()),
+			"resend_after": int(settings.ResendInterval.Seconds()),
+		},
+	}
+
+	user, err := findUserByIdentifier(req.Identifier)
+	if err != nil {
+		logger.ErrorError("Failed to look up user for OTP", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	destination := ""
+	if user != nil {
+		destination = otpDestination(user, req.Channel)
+	}
+	if user == nil || user.Status != models.StatusActive || destination == "" {
+		logger.AccessInfo("OTP not sent: no eligible account",
+			zap.String("ip", c.ClientIP()),
+			zap.String("channel", req.Channel),
+		)
+		c.JSON(http.StatusOK, sent)
+		return
+	}
+
+	if err := issueOneTimeCode(user, req.Purpose, req.Channel, destination); err != nil {
+		// 限流时返回与不存在账户相同的响应，否则429会暴露账户是否存在
+		var limited *otpRateLimitError
+		if errors.As(err, &limited) {
+			logger.AccessInfo("OTP not sent: rate limited",
+				zap.String("ip", c.ClientIP()),
+				zap.String("user_id", user.ID),
+				zap.String("channel", req.Channel),
+				zap.Duration("retry_after", limited.RetryAfter),
+			)
+			c.JSON(http.StatusOK, sent)
+			return
+		}
+		respondOTPIssueError(c, err)
+		return
+	}
+
+	logger.AccessInfo("OTP sent",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("channel", req.Channel),
+		zap.String("purpose", req.Purpose),
+		zap.String("sent_to", maskDestination(destination)),
+	)
+	c.JSON(http.StatusOK, sent)
+}
+
+// VerifyOTPHandler 校验邮件/短信动态码并完成门户登录
+func VerifyOTPHandler(c *gin.Context) {
+	var req VerifyOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+	if req.Purpose == "" {
+		req.Purpose = otpPurposeLogin
+	}
+
+	// 与密码登录共用IP和IP+账户维度的限制
+	if !checkLoginThrottle(c, req.Identifier) {
+		return
+	}
+
+	user, err := findUserByIdentifier(req.Identifier)
+	if err != nil {
+		logger.ErrorError("Failed to look up user for OTP", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	// 账户不存在、已停用或已锁定时返回与验证码错误相同的响应，避免被用来探测账户
+	if user == nil || user.Status != models.StatusActive || accountLockedUntil(user) != nil {
+		recordLoginFailure(c, nil)
+		fields := []zap.Field{zap.String("ip", c.ClientIP())}
+		if user != nil {
+			fields = append(fields, zap.String("user_id", user.ID), zap.String("status", user.Status.String()))
+		}
+		logger.AccessInfo("OTP verification failed: no eligible account", fields...)
+		respondOTPVerifyError(c, errOTPInvalid)
+		return
+	}
+
+	record, err := verifyOneTimeCode(user.ID, req.Purpose, req.Code)
+	if err != nil {
+		if errors.Is(err, errOTPInvalid) || errors.Is(err, errOTPExpired) || errors.Is(err, errOTPAttemptsExceeded) {
+			recordLoginFailure(c, user)
+		}
+		logger.AccessInfo("OTP verification failed",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_id", user.ID),
+			zap.Error(err),
+		)
+		respondOTPVerifyError(c, err)
+		return
+	}
+
+	// 动态码只证明持有邮箱或手机，已启用的第二因素仍然需要校验；此时动态码暂不消费
+	secondFactor, ok := checkLoginSecondFactor(c, user, &LoginRequest{Username: user.Username, OTPCode: req.OTPCode, WebAuthn: req.WebAuthn})
+	if !ok {
+		return
+	}
+	if err := consumeOneTimeCode(record); err != nil {
+		respondOTPVerifyError(c, err)
+		return
+	}
+
+	logger.AccessInfo("OTP login verified",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("sent_to", maskDestination(record.SentTo)),
+	)
+	// 密码已过期或被要求修改时只签发修改密码用的受限令牌
+	if requirePasswordChange(c, user) {
+		return
+	}
+	completePortalLogin(c, user, loginAMR(utils.AMROTP, secondFactor))
+}
+
+// issueOneTimeCode 生成动态码并通过指定渠道发送到destination，同一用户同一用途的旧动态码随之作废
+func issueOneTimeCode(user *models.User, purpose, channel, destination string) error {
+	settings := otpCodeSettings()
+	if err := reserveOTPSend(user.ID, purpose, destination, settings); err != nil {
+		return err
+	}
+
+	code, err := utils.GenerateNumericCode(settings.Length)
+	if err != nil {
+		return err
+	}
+
+	if err := database.DB.Model(&models.UserOTPRecord{}).
+		Where("user_id = ? AND purpose = ? AND used = ?", user.ID, purpose, false).
+		UpdateColumn("used", true).Error; err != nil {
+		return err
+	}
+	record := models.UserOTPRecord{
+		UserID:      user.ID,
+		Code:        hashOneTimeCode(user.ID, purpose, code),
+		Purpose:     purpose,
+		ExpiresAt:   time.Now().Add(settings.TTL),
+		MaxAttempts: settings.MaxAttempts,
+		SentTo:      destination,
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return err
+	}
+
+	msg := oneTimeCodeMessage(purpose, code, settings.TTL)
+	msg.To = destination
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := notify.Send(ctx, channel, msg); err != nil {
+		database.DB.Model(&record).UpdateColumn("used", true)
+		return fmt.Errorf("deliver %s code: %w", channel, err)
+	}
+	return nil
+}
+
+// verifyOneTimeCode 校验用户最新的未使用动态码，每次调用都会消耗一次校验机会
+// 校验通过后动态码仍然有效，调用方完成后续检查后需调用consumeOneTimeCode
+func verifyOneTimeCode(userID, purpose, code string) (*models.UserOTPRecord, error) {
+	var record models.UserOTPRecord
+	err := database.DB.Where("user_id = ? AND purpose = ? AND used = ?", userID, purpose, false).
+		Order("created_at DESC").First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errOTPInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, errOTPExpired
+	}
+
+	// 先原子地占用一次校验机会，并发请求也无法超过最大次数
+	result := database.DB.Model(&models.UserOTPRecord{}).
+		Where("id = ? AND used = ? AND attempts < max_attempts", record.ID, false).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		database.DB.Model(&record).UpdateColumn("used", true)
+		return nil, errOTPAttemptsExceeded
+	}
+	record.Attempts++
+
+	expected := hashOneTimeCode(userID, purpose, code)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(record.Code)) != 1 {
+		if record.Attempts >= record.MaxAttempts {
+			database.DB.Model(&record).UpdateColumn("used", true)
+			return nil, errOTPAttemptsExceeded
+		}
+		return nil, errOTPInvalid
+	}
+	return &record, nil
+}
+
+// consumeOneTimeCode 将动态码标记为已使用，并发消费时只有一个调用方成功
+func consumeOneTimeCode(record *models.UserOTPRecord) error {
+	result := database.DB.Model(&models.UserOTPRecord{}).
+		Where("id = ? AND used = ?", record.ID, false).
+		UpdateColumn("used", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errOTPInvalid
+	}
+	return nil
+}
+
+// reserveOTPSend 检查发送间隔、每用户和每个目标的发送次数，Redis不可用时拒绝发送
+func reserveOTPSend(userID, purpose, destination string, settings otpCodeConfig) error {
+	if redis.RDB == nil {
+		return errors.New("redis not available for OTP rate limiting")
+	}
+
+	target := sha256.Sum256([]byte(strings.ToLower(destination)))
+	keys := []string{
+		otpCooldownPrefix + purpose + ":" + userID,
+		otpUserRatePrefix + userID,
+		otpTargetRatePrefix + hex.EncodeToString(target[:]),
+	}
+	wait, err := redis.RDB.Eval(context.Background(), otpReserveScript, keys,
+		int(settings.ResendInterval.Seconds()), settings.UserHourlyLimit,
+		settings.DestinationHourlyLimit, int(otpRateWindow.Seconds())).Int()
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &otpRateLimitError{RetryAfter: time.Duration(wait) * time.Second}
+	}
+	return nil
+}
+
+// otpCodeConfig 动态码参数
+type otpCodeConfig struct {
+	Length                 int
+	TTL                    time.Duration
+	MaxAttempts            int
+	ResendInterval         time.Duration
+	UserHourlyLimit        int
+	DestinationHourlyLimit int
+}
+
+// otpCodeSettings 读取login.otp_code配置，未配置的项使用默认值
+func otpCodeSettings() otpCodeConfig {
+	settings := otpCodeConfig{
+		Length:                 6,
+		TTL:                    5 * time.Minute,
+		MaxAttempts:            5,
+		ResendInterval:         time.Minute,
+		UserHourlyLimit:        10,
+		DestinationHourlyLimit: 5,
+	}
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return settings
+	}
+
+	otp := cfg.Login.OTPCode
+	if otp.Length >= 6 && otp.Length <= 10 {
+		settings.Length = otp.Length
+	}
+	if otp.TTL > 0 {
+		settings.TTL = time.Duration(otp.TTL) * time.Second
+	}
+	if otp.MaxAttempts > 0 {
+		settings.MaxAttempts = otp.MaxAttempts
+	}
+	if otp.ResendInterval > 0 {
+		settings.ResendInterval = time.Duration(otp.ResendInterval) * time.Second
+	}
+	if otp.UserHourlyLimit > 0 {
+		settings.UserHourlyLimit = otp.UserHourlyLimit
+	}
+	if otp.DestinationHourlyLimit > 0 {
+		settings.DestinationHourlyLimit = otp.DestinationHourlyLimit
+	}
+	return settings
+}
+
+// otpChannelEnabled 检查安全设置中是否启用了对应的验证渠道
+func otpChannelEnabled(channel string) bool {
+	switch channel {
+	case notify.ChannelEmail:
+		return securitySettingEnabled("enable_email", true)
+	case notify.ChannelSMS:
+		return securitySettingEnabled("enable_sms", false)
+	}
+	return false
+}
+
+// otpDestination 返回用户在对应渠道的联系方式
+// 短信动态码可以用于登录和重置密码，只发往已验证的手机号
+func otpDestination(user *models.User, channel string) string {
+	switch channel {
+	case notify.ChannelEmail:
+		return strings.TrimSpace(user.Email)
+	case notify.ChannelSMS:
+		if !user.PhoneVerified {
+			return ""
+		}
+		return strings.TrimSpace(user.Phone)
+	}
+	return ""
+}
+
+// phoneIdentifierPattern 手机号形式的登录标识
+var phoneIdentifierPattern = regexp.MustCompile(`^\+?[0-9][0-9 -]{5,19}$`)
+
+// identifierColumns 按标识的形式决定匹配的字段及顺序
+// 不同时匹配多个字段，避免一个用户的用户名与另一个用户的邮箱或手机号相同时找错账户
+func identifierColumns(identifier string) []string {
+	switch {
+	case strings.Contains(identifier, "@"):
+		return []string{"email", "username"}
+	case phoneIdentifierPattern.MatchString(identifier):
+		return []string{"phone", "username"}
+	}
+	return []string{"username"}
+}
+
+// findUserByIdentifier 按用户名、邮箱或手机号查找用户，不存在时返回nil
+func findUserByIdentifier(identifier string) (*models.User, error) {
+	identifier = strings.TrimSpace(identifier)
+	if identifier == "" {
+		return nil, nil
+	}
+	for _, column := range identifierColumns(identifier) {
+		var user models.User
+		err := database.DB.Where(column+" = ?", identifier).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	return nil, nil
+}
+
+// hashOneTimeCode 计算动态码的HMAC，绑定用户和用途
+func hashOneTimeCode(userID, purpose, code string) string {
+	return utils.HashOneTimeCode(code, userID+":"+purpose, signingKeySecret())
+}
+
+// oneTimeCodeMessage 生成动态码通知内容
+func oneTimeCodeMessage(purpose, code string, ttl time.Duration) *notify.Message {
+	site := siteDisplayName()
+	action := otpPurposeActions[purpose]
+	if action == "" {
+		action = "continue"
+	}
+	return &notify.Message{
+		Subject: site + " verification code",
+		Body: fmt.Sprintf("Your verification code is %s. Use it to %s on %s. It expires in %d minutes.\n\n"+
+			"If you did not request this code, you can ignore this message.",
+			code, action, site, int(ttl.Minutes())),
+	}
+}
+
+// maskDestination 日志中隐藏邮箱和手机号的大部分字符
+func maskDestination(destination string) string {
+	if at := strings.LastIndex(destination, "@"); at > 0 {
+		return destination[:1] + "***" + destination[at:]
+	}
+	if len(destination) > 4 {
+		return "***" + destination[len(destination)-4:]
+	}
+	return "***"
+}
+
+// respondOTPIssueError 根据发送失败的原因写入响应
+func respondOTPIssueError(c *gin.Context, err error) {
+	var limited *otpRateLimitError
+	if errors.As(err, &limited) {
+		c.Header("Retry-After", strconv.Itoa(int(limited.RetryAfter.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"code":    429,
+			"message": i18n.OTPRateLimited,
+			"data": gin.H{
+				"retry_after": int(limited.RetryAfter.Seconds()),
+			},
+		})
+		return
+	}
+
+	logger.ErrorError("Failed to send one-time code", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"code":    500,
+		"message": i18n.OTPSendFailed,
+		"data":    nil,
+	})
+}
+
+// respondOTPVerifyError 根据校验失败的原因写入响应
+func respondOTPVerifyError(c *gin.Context, err error) {
+	message := i18n.InvalidOTP
+	switch {
+	case errors.Is(err, errOTPExpired):
+		message = i18n.OTPExpired
+	case errors.Is(err, errOTPAttemptsExceeded):
+		message = i18n.OTPAttemptsExceeded
+	case !errors.Is(err, errOTPInvalid):
+		logger.ErrorError("Failed to verify one-time code", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"code":    401,
+		"message": message,
+		"data":    nil,
+	})
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/notify"
+	"eiam-platform/pkg/utils"
+)
+
+// ForgotPasswordRequest 申请重置密码
+type ForgotPasswordRequest struct {
+	Identifier string `json:"identifier" binding:"required"`               // 用户名、邮箱或手机号
+	Channel    string `json:"channel" binding:"omitempty,oneof=email sms"` // 默认email
+}
+
+// ResetPasswordRequest 使用重置码设置新密码
+type ResetPasswordRequest struct {
+	Identifier  string `json:"identifier" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ChangePasswordRequest 修改密码
+type ChangePasswordRequest struct {
+	CurrentPassword     string `json:"current_password" binding:"required"`
+	NewPassword         string `json:"new_password" binding:"required"`
+	LogoutOtherSessions bool   `json:"logout_other_sessions"` // 是否同时下线其他会话
+}
+
+// ChangePasswordHandler 校验当前密码后修改密码
+func ChangePasswordHandler(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CheckPassword(req.CurrentPassword, user.Password) {
+		// 与登录失败一样计数，防止被盗用的会话用来猜测密码
+		recordLoginFailure(c, user)
+		logger.AccessInfo("Password change failed: invalid current password",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_id", user.ID),
+			zap.Int("failed_count", user.FailedCount),
+		)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.OldPassword,
+			"data":    nil,
+		})
+		return
+	}
+	if utils.CheckPassword(req.NewPassword, user.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.PasswordUnchanged,
+			"data":    nil,
+		})
+		return
+	}
+
+	effective, err := effectivePasswordPolicy(user)
+	if err != nil {
+		logger.ErrorError("Failed to get password policy", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	policy := effective.Policy
+	if result := validateNewPassword(user, req.NewPassword, policy); !result.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.WeakPassword,
+			"data":    result,
+		})
+		return
+	}
+
+	if err := applyNewPassword(user, req.NewPassword, policy); err != nil {
+		logger.ErrorError("Failed to change password", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if user.FailedCount > 0 {
+		database.DB.Model(user).Update("failed_count", 0)
+		clearLoginFailures(c, user)
+	}
+
+	revokePasswordChangeToken(c)
+
+	loggedOut := 0
+	if req.LogoutOtherSessions {
+		loggedOut = logoutOtherSessions(user.ID, currentSessionID(c))
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID,
+		"Password changed by user: "+user.Username, gin.H{
+			"logged_out_sessions": loggedOut,
+		})
+	logger.AccessInfo("Password changed",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.Int("logged_out_sessions", loggedOut),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.SuccessPasswordChanged,
+		"data": gin.H{
+			"password_expired_at": user.PasswordExpiredAt,
+			"logged_out_sessions": loggedOut,
+		},
+	})
+}
+
+// logoutOtherSessions 删除用户除keepSessionID以外的所有会话，返回删除的数量
+func logoutOtherSessions(userID, keepSessionID string) int {
+	if sessionManager == nil {
+		return 0
+	}
+
+	ctx := context.Background()
+	sessions, err := sessionManager.GetUserSessions(ctx, userID)
+	if err != nil {
+		logger.ErrorError("Failed to get user sessions", zap.String("user_id", userID), zap.Error(err))
+		return 0
+	}
+
+	count := 0
+	for _, session := range sessions {
+		if session.SessionID == keepSessionID {
+			continue
+		}
+		if err := sessionManager.DeleteSession(ctx, session.SessionID); err != nil {
+			logger.ErrorError("Failed to delete session", zap.String("session_id", session.SessionID), zap.Error(err))
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// ForgotPasswordHandler 向账户的邮箱或手机发送一次性重置码
+// 无论账户是否存在、是否限流或发送失败都返回相同的响应，避免被用来探测账户
+func ForgotPasswordHandler(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+	if req.Channel == "" {
+		req.Channel = notify.ChannelEmail
+	}
+
+	if !otpChannelEnabled(req.Channel) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.OTPChannelDisabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	sendPasswordResetCode(c, &req)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.PasswordResetCodeSent,
+		"data": gin.H{
+			"expires_in": int(otpCodeSettings().TTL.Seconds()),
+		},
+	})
+}
+
+// sendPasswordResetCode 为符合条件的账户签发并发送重置码，失败只记录日志
+func sendPasswordResetCode(c *gin.Context, req *ForgotPasswordRequest) {
+	user, err := findUserByIdentifier(req.Identifier)
+	if err != nil {
+		logger.ErrorError("Failed to look up user for password reset", zap.Error(err))
+		return
+	}
+	destination := ""
+	if user != nil {
+		destination = otpDestination(user, req.Channel)
+	}
+	if user == nil || user.Status != models.StatusActive || destination == "" {
+		logger.AccessInfo("Password reset code not sent: no eligible account",
+			zap.String("ip", c.ClientIP()),
+			zap.String("channel", req.Channel),
+		)
+		return
+	}
+
+	if err := issueOneTimeCode(user, otpPurposeResetPassword, req.Channel, destination); err != nil {
+		logger.AccessWarn("Failed to issue password reset code",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_id", user.ID),
+			zap.Error(err),
+		)
+		return
+	}
+
+	logger.AccessInfo("Password reset code sent",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("channel", req.Channel),
+		zap.String("sent_to", maskDestination(destination)),
+	)
+}
+
+// ResetPasswordHandler 校验重置码并设置新密码，成功后该用户的所有会话都会下线
+func ResetPasswordHandler(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, err := findUserByIdentifier(req.Identifier)
+	if err != nil {
+		logger.ErrorError("Failed to look up user for password reset", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if user == nil {
+		respondOTPVerifyError(c, errOTPInvalid)
+		return
+	}
+
+	record, err := verifyOneTimeCode(user.ID, otpPurposeResetPassword, req.Code)
+	if err != nil {
+		logger.AccessInfo("Password reset code verification failed",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_id", user.ID),
+			zap.Error(err),
+		)
+		respondOTPVerifyError(c, err)
+		return
+	}
+	if user.Status != models.StatusActive {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": i18n.UserInactive,
+			"data":    nil,
+		})
+		return
+	}
+
+	effective, err := effectivePasswordPolicy(user)
+	if err != nil {
+		logger.ErrorError("Failed to get password policy", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	policy := effective.Policy
+	// 密码不符合策略时重置码不作废，用户可以换一个密码重试
+	if result := validateNewPassword(user, req.NewPassword, policy); !result.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.WeakPassword,
+			"data":    result,
+		})
+		return
+	}
+
+	if err := consumeOneTimeCode(record); err != nil {
+		respondOTPVerifyError(c, err)
+		return
+	}
+	if err := applyNewPassword(user, req.NewPassword, policy); err != nil {
+		logger.ErrorError("Failed to reset password", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	// 能收到重置码说明用户已证明身份，同时解除登录失败导致的锁定
+	database.DB.Model(user).Updates(map[string]interface{}{
+		"failed_count": 0,
+		"locked_until": nil,
+	})
+	clearAccountThrottle(user)
+
+	if sessionManager != nil {
+		if err := sessionManager.ForceLogoutUser(context.Background(), user.ID); err != nil {
+			logger.ErrorError("Failed to revoke sessions after password reset", zap.String("user_id", user.ID), zap.Error(err))
+		}
+	}
+
+	// 未登录请求，审计日志记为用户本人操作
+	c.Set("user_id", user.ID)
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID,
+		"Password reset by user: "+user.Username, gin.H{
+			"method":  "reset_code",
+			"sent_to": maskDestination(record.SentTo),
+		})
+	logger.AccessInfo("Password reset",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.SuccessPasswordReset,
+		"data":    nil,
+	})
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/notify"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/utils"
+)
+
+// 需要修改密码的原因
+const (
+	passwordChangeReasonExpired  = "expired"
+	passwordChangeReasonRequired = "admin_required"
+)
+
+const (
+	// passwordChangeTokenTTL 受限令牌有效期
+	passwordChangeTokenTTL = 10 * time.Minute
+
+	passwordReminderPrefix = "password:expiry_reminder:"
+)
+
+// passwordChangeReason 返回用户登录前必须修改密码的原因，无需修改时返回空字符串
+func passwordChangeReason(user *models.User) string {
+	if user.MustChangePassword {
+		return passwordChangeReasonRequired
+	}
+	if expired, _ := CheckPasswordExpiry(user); expired {
+		return passwordChangeReasonExpired
+	}
+	return ""
+}
+
+// requirePasswordChange 密码已过期或被要求修改时返回受限登录响应并返回true，调用方不应再签发正常令牌
+// 受限令牌只能调用修改密码接口，不创建会话
+func requirePasswordChange(c *gin.Context, user *models.User) bool {
+	reason := passwordChangeReason(user)
+	if reason == "" {
+		return false
+	}
+
+	cfg := config.GetConfig()
+	token, err := utils.GeneratePasswordChangeToken(user.ID, user.Username, reason, cfg.JWT.Secret, passwordChangeTokenTTL)
+	if err != nil {
+		logger.ErrorError("Failed to generate password change token", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return true
+	}
+
+	// 登录认证已通过，清除失败计数
+	user.FailedCount = 0
+	user.LockedUntil = nil
+	database.DB.Model(user).Updates(map[string]interface{}{
+		"failed_count": 0,
+		"locked_until": nil,
+	})
+	clearLoginFailures(c, user)
+
+	logger.AccessInfo("Login requires password change",
+		zap.String("ip", c.ClientIP()),
+		zap.String("username", user.Username),
+		zap.String("reason", reason),
+	)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.PasswordChangeRequired,
+		"data": LoginResponse{
+			TokenType:             "Bearer",
+			ExpiresIn:             int64(passwordChangeTokenTTL.Seconds()),
+			RequirePasswordChange: true,
+			PasswordChangeReason:  reason,
+			PasswordChangeToken:   token,
+			User: UserInfo{
+				ID:            user.ID,
+				Username:      user.Username,
+				Email:         user.Email,
+				DisplayName:   user.DisplayName,
+				Avatar:        user.Avatar,
+				Status:        user.Status.String(),
+				EmailVerified: user.EmailVerified,
+				PhoneVerified: user.PhoneVerified,
+				EnableOTP:     user.EnableOTP,
+			},
+		},
+	})
+	return true
+}
+
+// revokePasswordChangeToken 修改成功后作废本次使用的受限令牌
+func revokePasswordChangeToken(c *gin.Context) {
+	value, exists := c.Get("password_change_claims")
+	if !exists || sessionManager == nil {
+		return
+	}
+	claims, ok := value.(*utils.PasswordChangeClaims)
+	if !ok || claims.ExpiresAt == nil {
+		return
+	}
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return
+	}
+	if err := sessionManager.BlacklistToken(context.Background(), claims.TradeID, ttl); err != nil {
+		logger.ErrorWarn("Failed to revoke password change token", zap.String("user_id", claims.UserID), zap.Error(err))
+	}
+}
+
+var passwordReminderOnce sync.Once
+
+// StartPasswordExpiryReminder 启动密码过期提醒任务，在过期前的指定天数通过邮件提醒用户
+// 提醒记录保存在Redis中，多实例部署时每个提醒节点只会发送一次
+func StartPasswordExpiryReminder() {
+	cfg := config.GetConfig()
+	if cfg == nil || !cfg.Notification.PasswordExpiryReminder.Enabled {
+		return
+	}
+	reminder := cfg.Notification.PasswordExpiryReminder
+
+	days := make([]int, 0, len(reminder.DaysBefore))
+	seen := make(map[int]bool)
+	for _, d := range reminder.DaysBefore {
+		if d > 0 && !seen[d] {
+			seen[d] = true
+			days = append(days, d)
+		}
+	}
+	if len(days) == 0 {
+		return
+	}
+	sort.Ints(days)
+
+	interval := time.Hour
+	if reminder.CheckInterval > 0 {
+		interval = time.Duration(reminder.CheckInterval) * time.Second
+	}
+
+	passwordReminderOnce.Do(func() {
+		go func() {
+			sendPasswordExpiryReminders(days)
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				sendPasswordExpiryReminders(days)
+			}
+		}()
+		logger.Info("Password expiry reminder started",
+			zap.Ints("days_before", days),
+			zap.Duration("interval", interval),
+		)
+	})
+}
+
+// sendPasswordExpiryReminders 向即将过期的用户发送提醒，days按升序排列
+func sendPasswordExpiryReminders(days []int) {
+	if redis.RDB == nil {
+		logger.ErrorWarn("Redis not available, skipping password expiry reminders")
+		return
+	}
+
+	now := time.Now()
+	var users []models.User
+	if err := database.DB.Where("status = ? AND email <> '' AND password_expired_at > ? AND password_expired_at <= ?",
+		models.StatusActive, now, now.AddDate(0, 0, days[len(days)-1])).
+		Find(&users).Error; err != nil {
+		logger.ErrorWarn("Failed to query users with expiring passwords", zap.Error(err))
+		return
+	}
+
+	sent := 0
+	for i := range users {
+		if sendPasswordExpiryReminder(&users[i], days, now) {
+			sent++
+		}
+	}
+	if sent > 0 {
+		logger.Info("Password expiry reminders sent", zap.Int("count", sent))
+	}
+}
+
+// sendPasswordExpiryReminder 发送距离过期时间最近的提醒节点对应的提醒，已发送过时跳过
+func sendPasswordExpiryReminder(user *models.User, days []int, now time.Time) bool {
+	remaining := user.PasswordExpiredAt.Sub(now)
+	threshold := days[len(days)-1]
+	for _, d := range days {
+		if remaining <= time.Duration(d)*24*time.Hour {
+			threshold = d
+			break
+		}
+	}
+
+	ctx := context.Background()
+	key := fmt.Sprintf("%s%s:%d:%d", passwordReminderPrefix, user.ID, user.PasswordExpiredAt.Unix(), threshold)
+	claimed, err := redis.RDB.SetNX(ctx, key, 1, remaining+24*time.Hour).Result()
+	if err != nil {
+		logger.ErrorWarn("Failed to record password expiry reminder", zap.String("user_id", user.ID), zap.Error(err))
+		return false
+	}
+	if !claimed {
+		return false
+	}
+
+	site := siteDisplayName()
+	daysLeft := int((remaining + 24*time.Hour - 1) / (24 * time.Hour))
+	msg := &notify.Message{
+		To:      user.Email,
+		Subject: fmt.Sprintf("Your %s password expires in %d day(s)", site, daysLeft),
+		Body: fmt.Sprintf("Hello %s,\n\nYour %s password expires on %s. "+
+			"Please change it before then in the user portal, otherwise you will have to change it the next time you sign in.",
+			user.Username, site, user.PasswordExpiredAt.Format("2006-01-02 15:04 MST")),
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := notify.Send(sendCtx, notify.ChannelEmail, msg); err != nil {
+		// 发送失败时删除记录，下次检查时重试
+		redis.Del(key)
+		logger.ErrorWarn("Failed to send password expiry reminder",
+			zap.String("user_id", user.ID),
+			zap.String("sent_to", maskDestination(user.Email)),
+			zap.Error(err),
+		)
+		return false
+	}
+	return true
+}
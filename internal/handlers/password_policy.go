@@ -4,8 +4,10 @@ import (
 	"net/http"
 	"time"
 
+	"eiam-platform/config"
 	"eiam-platform/internal/models"
 	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
 	"eiam-platform/pkg/logger"
 	"eiam-platform/pkg/utils"
 
@@ -45,12 +47,21 @@ type PasswordValidationResponse struct {
 	StrengthColor string   `json:"strength_color"`
 }
 
-// GetPasswordPolicyHandler 获取密码策略
+// PasswordHashReport 用户密码哈希统计
+type PasswordHashReport struct {
+	Algorithm string           `json:"algorithm"` // 新密码使用的哈希算法
+	Total     int64            `json:"total"`
+	Schemes   map[string]int64 `json:"schemes"`  // 各哈希算法的用户数
+	Legacy    int64            `json:"legacy"`   // 仍使用MD5等旧哈希的用户数
+	Outdated  int64            `json:"outdated"` // 下次登录时会重新计算哈希的用户数，包括Legacy
+}
+
+// GetPasswordPolicyHandler 获取全局密码策略
 func GetPasswordPolicyHandler(c *gin.Context) {
 	var policy models.PasswordPolicy
 
-	// 获取当前激活的密码策略
-	if err := database.DB.Where("is_active = ?", true).First(&policy).Error; err != nil {
+	// 获取当前激活的全局密码策略
+	if err := database.DB.Where("scope = ? AND is_active = ?", models.PasswordPolicyScopeGlobal, true).First(&policy).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			// 如果没有找到策略，返回默认策略
 			defaultPolicy := utils.DefaultPasswordPolicy()
@@ -88,7 +99,7 @@ func GetPasswordPolicyHandler(c *gin.Context) {
 	})
 }
 
-// UpdatePasswordPolicyHandler 更新密码策略
+// UpdatePasswordPolicyHandler 更新全局密码策略
 func UpdatePasswordPolicyHandler(c *gin.Context) {
 	var req PasswordPolicyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -101,31 +112,24 @@ func UpdatePasswordPolicyHandler(c *gin.Context) {
 	}
 
 	// 验证策略参数
-	if req.MinLength > req.MaxLength {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "Minimum length cannot be greater than maximum length",
-		})
-		return
-	}
-
-	// 至少需要启用一种字符类型要求
-	if !req.RequireUppercase && !req.RequireLowercase && !req.RequireNumbers && !req.RequireSpecialChars {
+	if message := checkPasswordPolicyRequest(&req); message != "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
-			"message": "At least one character type requirement must be enabled",
+			"message": message,
 		})
 		return
 	}
 
 	var policy models.PasswordPolicy
 
-	// 查找现有策略或创建新策略
-	if err := database.DB.Where("is_active = ?", true).First(&policy).Error; err != nil {
+	// 查找现有全局策略或创建新策略
+	if err := database.DB.Where("scope = ? AND is_active = ?", models.PasswordPolicyScopeGlobal, true).First(&policy).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			// 创建新策略
 			policy = models.PasswordPolicy{
-				ID: utils.GenerateTradeIDString("policy"),
+				ID:    utils.GenerateTradeIDString("policy"),
+				Name:  "Global password policy",
+				Scope: models.PasswordPolicyScopeGlobal,
 			}
 		} else {
 			logger.Error("Failed to get password policy", zap.Error(err))
@@ -138,17 +142,7 @@ func UpdatePasswordPolicyHandler(c *gin.Context) {
 	}
 
 	// 更新策略
-	policy.MinLength = req.MinLength
-	policy.MaxLength = req.MaxLength
-	policy.RequireUppercase = req.RequireUppercase
-	policy.RequireLowercase = req.RequireLowercase
-	policy.RequireNumbers = req.RequireNumbers
-	policy.RequireSpecialChars = req.RequireSpecialChars
-	policy.HistoryCount = req.HistoryCount
-	policy.ExpiryDays = req.ExpiryDays
-	policy.PreventCommon = req.PreventCommon
-	policy.PreventUsername = req.PreventUsername
-	policy.IsActive = req.IsActive
+	applyPasswordPolicyRequest(&policy, &req)
 
 	if err := database.DB.Save(&policy).Error; err != nil {
 		logger.Error("Failed to update password policy", zap.Error(err))
@@ -178,30 +172,20 @@ func ValidatePasswordHandler(c *gin.Context) {
 		return
 	}
 
-	// 获取当前密码策略
-	var policy models.PasswordPolicy
-	if err := database.DB.Where("is_active = ?", true).First(&policy).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// 使用默认策略
-			defaultPolicy := utils.DefaultPasswordPolicy()
-			validationResult := utils.ValidatePassword(req.Password, defaultPolicy, req.Username, nil)
-
-			strength := utils.CalculatePasswordStrength(req.Password)
-			c.JSON(http.StatusOK, gin.H{
-				"code":    200,
-				"message": "Success",
-				"data": PasswordValidationResponse{
-					Valid:         validationResult.Valid,
-					Errors:        validationResult.Errors,
-					Warnings:      validationResult.Warnings,
-					Strength:      strength,
-					StrengthText:  utils.GetPasswordStrengthText(strength),
-					StrengthColor: utils.GetPasswordStrengthColor(strength),
-				},
-			})
-			return
+	// 提供了用户名时按该用户的生效策略校验，并检查密码历史和账户相关信息
+	var passwordHistory []string
+	accountContext := utils.PasswordContext{Username: req.Username}
+	var user *models.User
+	if req.Username != "" {
+		var existing models.User
+		if err := database.DB.Where("username = ?", req.Username).First(&existing).Error; err == nil {
+			user = &existing
+			accountContext = passwordContext(user)
 		}
+	}
 
+	effective, err := effectivePasswordPolicy(user)
+	if err != nil {
 		logger.Error("Failed to get password policy", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -209,37 +193,19 @@ func ValidatePasswordHandler(c *gin.Context) {
 		})
 		return
 	}
+	utilsPolicy := effective.Policy
 
-	// 转换为utils.PasswordPolicy
-	utilsPolicy := &utils.PasswordPolicy{
-		MinLength:        policy.MinLength,
-		MaxLength:        policy.MaxLength,
-		RequireUppercase: policy.RequireUppercase,
-		RequireLowercase: policy.RequireLowercase,
-		RequireNumbers:   policy.RequireNumbers,
-		RequireSpecial:   policy.RequireSpecialChars,
-		HistoryCount:     policy.HistoryCount,
-		ExpiryDays:       policy.ExpiryDays,
-		PreventCommon:    policy.PreventCommon,
-		PreventUsername:  policy.PreventUsername,
-	}
-
-	// 获取用户密码历史（如果提供了用户名）
-	var passwordHistory []string
-	if req.Username != "" {
-		var user models.User
-		if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err == nil {
-			var histories []models.PasswordHistory
-			if err := database.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Limit(policy.HistoryCount).Find(&histories).Error; err == nil {
-				for _, history := range histories {
-					passwordHistory = append(passwordHistory, history.Password)
-				}
+	if user != nil && utilsPolicy.HistoryCount > 0 {
+		var histories []models.PasswordHistory
+		if err := database.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Limit(utilsPolicy.HistoryCount).Find(&histories).Error; err == nil {
+			for _, history := range histories {
+				passwordHistory = append(passwordHistory, history.Password)
 			}
 		}
 	}
 
 	// 验证密码
-	validationResult := utils.ValidatePassword(req.Password, utilsPolicy, req.Username, passwordHistory)
+	validationResult := utils.ValidatePasswordWithContext(req.Password, utilsPolicy, accountContext, passwordHistory)
 	strength := utils.CalculatePasswordStrength(req.Password)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -256,34 +222,26 @@ func ValidatePasswordHandler(c *gin.Context) {
 	})
 }
 
-// GeneratePasswordHandler 生成强密码
+// GeneratePasswordHandler 按生效的密码策略生成强密码
+// 可选参数user_id或organization_id，未提供时使用全局策略
 func GeneratePasswordHandler(c *gin.Context) {
-	// 获取当前密码策略
-	var policy models.PasswordPolicy
-	if err := database.DB.Where("is_active = ?", true).First(&policy).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// 使用默认策略
-			defaultPolicy := utils.DefaultPasswordPolicy()
-			password, err := utils.GenerateStrongPassword(defaultPolicy)
-			if err != nil {
-				logger.Error("Failed to generate password", zap.Error(err))
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"code":    500,
-					"message": "Failed to generate password",
-				})
-				return
-			}
-
-			c.JSON(http.StatusOK, gin.H{
-				"code":    200,
-				"message": "Success",
-				"data": gin.H{
-					"password": password,
-				},
+	var effective *EffectivePasswordPolicy
+	var err error
+	if userID := c.Query("user_id"); userID != "" {
+		var user models.User
+		if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18n.UserNotFound,
+				"data":    nil,
 			})
 			return
 		}
-
+		effective, err = effectivePasswordPolicy(&user)
+	} else {
+		effective, err = resolvePasswordPolicy(c.Query("organization_id"), nil)
+	}
+	if err != nil {
 		logger.Error("Failed to get password policy", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -292,19 +250,7 @@ func GeneratePasswordHandler(c *gin.Context) {
 		return
 	}
 
-	// 转换为utils.PasswordPolicy
-	utilsPolicy := &utils.PasswordPolicy{
-		MinLength:        policy.MinLength,
-		MaxLength:        policy.MaxLength,
-		RequireUppercase: policy.RequireUppercase,
-		RequireLowercase: policy.RequireLowercase,
-		RequireNumbers:   policy.RequireNumbers,
-		RequireSpecial:   policy.RequireSpecialChars,
-		HistoryCount:     policy.HistoryCount,
-		ExpiryDays:       policy.ExpiryDays,
-		PreventCommon:    policy.PreventCommon,
-		PreventUsername:  policy.PreventUsername,
-	}
+	utilsPolicy := effective.Policy
 
 	password, err := utils.GenerateStrongPassword(utilsPolicy)
 	if err != nil {
@@ -325,6 +271,48 @@ func GeneratePasswordHandler(c *gin.Context) {
 	})
 }
 
+// GetPasswordHashReportHandler 统计用户密码使用的哈希算法，找出仍使用旧哈希的账户
+func GetPasswordHashReportHandler(c *gin.Context) {
+	hasher := passwordHasher()
+	report := PasswordHashReport{
+		Algorithm: hasher.Algorithm,
+		Schemes: map[string]int64{
+			utils.PasswordHashArgon2id: 0,
+			utils.PasswordHashBcrypt:   0,
+			utils.PasswordHashMD5:      0,
+			utils.PasswordHashUnknown:  0,
+		},
+	}
+
+	var users []models.User
+	err := database.DB.Model(&models.User{}).Select("id", "password").
+		FindInBatches(&users, 500, func(tx *gorm.DB, batch int) error {
+			for _, user := range users {
+				scheme := utils.PasswordHashScheme(user.Password)
+				report.Total++
+				report.Schemes[scheme]++
+				if scheme == utils.PasswordHashMD5 || scheme == utils.PasswordHashUnknown {
+					report.Legacy++
+				}
+				if hasher.NeedsRehash(user.Password) {
+					report.Outdated++
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		logger.ErrorError("Failed to build password hash report", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Success",
+		"data":    report,
+	})
+}
+
 // SavePasswordHistory 保存密码历史
 func SavePasswordHistory(userID, password string) error {
 	history := models.PasswordHistory{
@@ -376,3 +364,146 @@ func SetPasswordExpiry(userID string, expiryDays int) error {
 	expiryTime := time.Now().AddDate(0, 0, expiryDays)
 	return database.DB.Model(&models.User{}).Where("id = ?", userID).Update("password_expired_at", expiryTime).Error
 }
+
+// passwordPolicyFromModel 转换为utils.PasswordPolicy
+func passwordPolicyFromModel(policy *models.PasswordPolicy) *utils.PasswordPolicy {
+	return &utils.PasswordPolicy{
+		MinLength:        policy.MinLength,
+		MaxLength:        policy.MaxLength,
+		RequireUppercase: policy.RequireUppercase,
+		RequireLowercase: policy.RequireLowercase,
+		RequireNumbers:   policy.RequireNumbers,
+		RequireSpecial:   policy.RequireSpecialChars,
+		HistoryCount:     policy.HistoryCount,
+		ExpiryDays:       policy.ExpiryDays,
+		PreventCommon:    policy.PreventCommon,
+		PreventUsername:  policy.PreventUsername,
+	}
+}
+
+// checkPasswordPolicyRequest 校验策略参数，不合法时返回错误信息
+func checkPasswordPolicyRequest(req *PasswordPolicyRequest) string {
+	if req.MinLength > req.MaxLength {
+		return "Minimum length cannot be greater than maximum length"
+	}
+	// 至少需要启用一种字符类型要求
+	if !req.RequireUppercase && !req.RequireLowercase && !req.RequireNumbers && !req.RequireSpecialChars {
+		return "At least one character type requirement must be enabled"
+	}
+	return ""
+}
+
+// applyPasswordPolicyRequest 将请求中的规则写入策略
+func applyPasswordPolicyRequest(policy *models.PasswordPolicy, req *PasswordPolicyRequest) {
+	policy.MinLength = req.MinLength
+	policy.MaxLength = req.MaxLength
+	policy.RequireUppercase = req.RequireUppercase
+	policy.RequireLowercase = req.RequireLowercase
+	policy.RequireNumbers = req.RequireNumbers
+	policy.RequireSpecialChars = req.RequireSpecialChars
+	policy.HistoryCount = req.HistoryCount
+	policy.ExpiryDays = req.ExpiryDays
+	policy.PreventCommon = req.PreventCommon
+	policy.PreventUsername = req.PreventUsername
+	policy.IsActive = req.IsActive
+}
+
+// validateNewPassword 按密码策略校验新密码，启用历史检查时当前密码和最近使用过的密码都不能再用
+func validateNewPassword(user *models.User, password string, policy *utils.PasswordPolicy) *utils.PasswordValidationResult {
+	var passwordHistory []string
+	if policy.HistoryCount > 0 {
+		passwordHistory = append(passwordHistory, user.Password)
+		var histories []models.PasswordHistory
+		if err := database.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Limit(policy.HistoryCount).Find(&histories).Error; err != nil {
+			logger.ErrorWarn("Failed to load password history", zap.String("user_id", user.ID), zap.Error(err))
+		}
+		for _, history := range histories {
+			passwordHistory = append(passwordHistory, history.Password)
+		}
+	}
+	return utils.ValidatePasswordWithContext(password, policy, passwordContext(user), passwordHistory)
+}
+
+// applyNewPassword 保存已通过校验的新密码：记录密码历史、按策略设置过期时间并清除强制修改标记
+func applyNewPassword(user *models.User, password string, policy *utils.PasswordPolicy) error {
+	hashedPassword, err := hashUserPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"password":             hashedPassword,
+		"must_change_password": false,
+		"password_expired_at":  nil,
+	}).Error; err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	user.MustChangePassword = false
+	user.PasswordExpiredAt = nil
+
+	if policy.ExpiryDays > 0 {
+		if err := SetPasswordExpiry(user.ID, policy.ExpiryDays); err != nil {
+			return err
+		}
+		expiry := time.Now().AddDate(0, 0, policy.ExpiryDays)
+		user.PasswordExpiredAt = &expiry
+	}
+
+	// 密码历史只影响后续的复用检查，写入失败不影响本次修改
+	if err := SavePasswordHistory(user.ID, hashedPassword); err != nil {
+		logger.ErrorWarn("Failed to save password history", zap.String("user_id", user.ID), zap.Error(err))
+	} else if policy.HistoryCount > 0 {
+		if err := CleanOldPasswordHistory(user.ID, policy.HistoryCount); err != nil {
+			logger.ErrorWarn("Failed to clean password history", zap.String("user_id", user.ID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// passwordHasher 按加密配置创建密码哈希器
+func passwordHasher() *utils.PasswordHasher {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return utils.NewPasswordHasher(nil)
+	}
+	return utils.NewPasswordHasher(&cfg.Encryption)
+}
+
+// hashUserPassword 使用配置的算法计算密码哈希，保存用户密码时都应通过这里生成哈希
+func hashUserPassword(password string) (string, error) {
+	return passwordHasher().Hash(password)
+}
+
+// rehashPasswordIfNeeded 登录验证密码成功后，哈希算法或参数已过时时用明文密码重新计算，失败只记录日志
+func rehashPasswordIfNeeded(user *models.User, password string) {
+	hasher := passwordHasher()
+	if !hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	oldScheme := utils.PasswordHashScheme(user.Password)
+	hashedPassword, err := hasher.Hash(password)
+	if err != nil {
+		logger.ErrorWarn("Failed to rehash password", zap.String("user_id", user.ID), zap.Error(err))
+		return
+	}
+	// 密码在此期间被修改时不覆盖
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hashedPassword)
+	if result.Error != nil {
+		logger.ErrorWarn("Failed to save rehashed password", zap.String("user_id", user.ID), zap.Error(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	user.Password = hashedPassword
+
+	logger.Info("Password hash upgraded",
+		zap.String("user_id", user.ID),
+		zap.String("from", oldScheme),
+		zap.String("to", hasher.Algorithm),
+	)
+}
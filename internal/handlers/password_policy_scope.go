@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// passwordPolicySourceDefault 没有任何启用的策略时使用内置默认策略
+const passwordPolicySourceDefault = "default"
+
+// ScopedPasswordPolicyRequest 组织或角色密码策略请求
+type ScopedPasswordPolicyRequest struct {
+	PasswordPolicyRequest
+	Name           string `json:"name" binding:"required,max=100"`
+	Scope          string `json:"scope" binding:"required,oneof=organization role"`
+	ScopeID        string `json:"scope_id" binding:"required"`
+	IncludeSubOrgs *bool  `json:"include_sub_orgs"` // 默认作用于下级组织
+	Priority       int    `json:"priority"`
+}
+
+// EffectivePasswordPolicy 用户实际生效的密码策略及其来源
+type EffectivePasswordPolicy struct {
+	Source   string                `json:"source"` // role, organization, global, default
+	PolicyID string                `json:"policy_id,omitempty"`
+	Name     string                `json:"name,omitempty"`
+	ScopeID  string                `json:"scope_id,omitempty"`
+	Policy   *utils.PasswordPolicy `json:"policy"`
+}
+
+// GetScopedPasswordPoliciesHandler 获取组织和角色密码策略列表，支持按scope和scope_id筛选
+func GetScopedPasswordPoliciesHandler(c *gin.Context) {
+	query := database.DB.Where("scope <> ?", models.PasswordPolicyScopeGlobal)
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if scopeID := c.Query("scope_id"); scopeID != "" {
+		query = query.Where("scope_id = ?", scopeID)
+	}
+
+	var policies []models.PasswordPolicy
+	if err := query.Order("scope, priority DESC, created_at").Find(&policies).Error; err != nil {
+		logger.ErrorError("Failed to get password policies", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Success",
+		"data":    policies,
+	})
+}
+
+// CreateScopedPasswordPolicyHandler 创建组织或角色密码策略
+func CreateScopedPasswordPolicyHandler(c *gin.Context) {
+	var req ScopedPasswordPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    err.Error(),
+		})
+		return
+	}
+
+	policy := models.PasswordPolicy{
+		ID: utils.GenerateTradeIDString("policy"),
+	}
+	if !applyScopedPasswordPolicyRequest(c, &policy, &req) {
+		return
+	}
+
+	if err := database.DB.Create(&policy).Error; err != nil {
+		logger.ErrorError("Failed to create password policy", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionCreate, utils.AuditResourceSystem, policy.ID,
+		"Created password policy: "+policy.Name, passwordPolicyAuditDetails(&policy))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    201,
+		"message": i18n.PasswordPolicyCreated,
+		"data":    policy,
+	})
+}
+
+// UpdateScopedPasswordPolicyHandler 更新组织或角色密码策略
+func UpdateScopedPasswordPolicyHandler(c *gin.Context) {
+	policy, ok := loadScopedPasswordPolicy(c)
+	if !ok {
+		return
+	}
+
+	var req ScopedPasswordPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    err.Error(),
+		})
+		return
+	}
+	if !applyScopedPasswordPolicyRequest(c, policy, &req) {
+		return
+	}
+
+	if err := database.DB.Save(policy).Error; err != nil {
+		logger.ErrorError("Failed to update password policy", zap.String("policy_id", policy.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceSystem, policy.ID,
+		"Updated password policy: "+policy.Name, passwordPolicyAuditDetails(policy))
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.PasswordPolicyUpdated,
+		"data":    policy,
+	})
+}
+
+// DeleteScopedPasswordPolicyHandler 删除组织或角色密码策略，全局策略不能删除
+func DeleteScopedPasswordPolicyHandler(c *gin.Context) {
+	policy, ok := loadScopedPasswordPolicy(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Delete(policy).Error; err != nil {
+		logger.ErrorError("Failed to delete password policy", zap.String("policy_id", policy.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionDelete, utils.AuditResourceSystem, policy.ID,
+		"Deleted password policy: "+policy.Name, passwordPolicyAuditDetails(policy))
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.PasswordPolicyDeleted,
+		"data":    nil,
+	})
+}
+
+// GetEffectivePasswordPolicyHandler 获取用户实际生效的密码策略
+func GetEffectivePasswordPolicyHandler(c *gin.Context) {
+	var user models.User
+	if err := database.DB.Where("id = ?", c.Param("user_id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18n.UserNotFound,
+			"data":    nil,
+		})
+		return
+	}
+
+	effective, err := effectivePasswordPolicy(&user)
+	if err != nil {
+		logger.ErrorError("Failed to resolve password policy", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Success",
+		"data":    effective,
+	})
+}
+
+// loadScopedPasswordPolicy 按路径参数id加载组织或角色策略，不存在时写入响应
+func loadScopedPasswordPolicy(c *gin.Context) (*models.PasswordPolicy, bool) {
+	var policy models.PasswordPolicy
+	err := database.DB.Where("id = ? AND scope <> ?", c.Param("id"), models.PasswordPolicyScopeGlobal).First(&policy).Error
+	if err == nil {
+		return &policy, true
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": i18n.PasswordPolicyNotFound,
+			"data":    nil,
+		})
+		return nil, false
+	}
+	logger.ErrorError("Failed to get password policy", zap.Error(err))
+	respondInternalError(c)
+	return nil, false
+}
+
+// applyScopedPasswordPolicyRequest 校验请求并写入策略，校验失败时写入响应并返回false
+// 同一个组织或角色只能有一个启用的策略
+func applyScopedPasswordPolicyRequest(c *gin.Context, policy *models.PasswordPolicy, req *ScopedPasswordPolicyRequest) bool {
+	if message := checkPasswordPolicyRequest(&req.PasswordPolicyRequest); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": message,
+			"data":    nil,
+		})
+		return false
+	}
+
+	var target *gorm.DB
+	notFound := i18n.OrganizationNotFound
+	if req.Scope == models.PasswordPolicyScopeRole {
+		target = database.DB.Model(&models.Role{})
+		notFound = i18n.RoleNotFound
+	} else {
+		target = database.DB.Model(&models.Organization{})
+	}
+	var count int64
+	if err := target.Where("id = ?", req.ScopeID).Count(&count).Error; err != nil {
+		logger.ErrorError("Failed to check password policy scope", zap.Error(err))
+		respondInternalError(c)
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": notFound,
+			"data":    nil,
+		})
+		return false
+	}
+
+	if req.IsActive {
+		if err := database.DB.Model(&models.PasswordPolicy{}).
+			Where("scope = ? AND scope_id = ? AND is_active = ? AND id <> ?", req.Scope, req.ScopeID, true, policy.ID).
+			Count(&count).Error; err != nil {
+			logger.ErrorError("Failed to check password policy scope", zap.Error(err))
+			respondInternalError(c)
+			return false
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"code":    409,
+				"message": i18n.PasswordPolicyExists,
+				"data":    nil,
+			})
+			return false
+		}
+	}
+
+	applyPasswordPolicyRequest(policy, &req.PasswordPolicyRequest)
+	scopeID := req.ScopeID
+	policy.Name = req.Name
+	policy.Scope = req.Scope
+	policy.ScopeID = &scopeID
+	policy.IncludeSubOrgs = req.IncludeSubOrgs == nil || *req.IncludeSubOrgs
+	policy.Priority = req.Priority
+	return true
+}
+
+// passwordPolicyAuditDetails 审计日志中记录的策略内容
+func passwordPolicyAuditDetails(policy *models.PasswordPolicy) gin.H {
+	return gin.H{
+		"name":             policy.Name,
+		"scope":            policy.Scope,
+		"scope_id":         policy.ScopeID,
+		"include_sub_orgs": policy.IncludeSubOrgs,
+		"priority":         policy.Priority,
+		"is_active":        policy.IsActive,
+		"rules":            passwordPolicyFromModel(policy),
+	}
+}
+
+// effectivePasswordPolicy 获取用户生效的密码策略，user为nil时返回全局策略
+func effectivePasswordPolicy(user *models.User) (*EffectivePasswordPolicy, error) {
+	if user == nil {
+		return resolvePasswordPolicy("", nil)
+	}
+
+	var roleIDs []string
+	if err := database.DB.Table("user_roles").
+		Joins("JOIN roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ? AND roles.status = ? AND roles.deleted_at IS NULL", user.ID, models.StatusActive).
+		Pluck("user_roles.role_id", &roleIDs).Error; err != nil {
+		return nil, err
+	}
+	return resolvePasswordPolicy(user.OrganizationID, roleIDs)
+}
+
+// resolvePasswordPolicy 按以下顺序确定生效的密码策略：
+// 角色策略（用户有多个角色策略时Priority最高的生效，相同时先创建的生效）>
+// 所属组织的策略 > 最近的上级组织中作用于下级组织的策略 > 全局策略 > 默认策略
+func resolvePasswordPolicy(organizationID string, roleIDs []string) (*EffectivePasswordPolicy, error) {
+	if len(roleIDs) > 0 {
+		var policy models.PasswordPolicy
+		err := database.DB.Where("scope = ? AND scope_id IN ? AND is_active = ?", models.PasswordPolicyScopeRole, roleIDs, true).
+			Order("priority DESC, created_at").First(&policy).Error
+		if err == nil {
+			return effectiveFromModel(&policy), nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if organizationID != "" {
+		policy, err := organizationPasswordPolicy(organizationID)
+		if err != nil {
+			return nil, err
+		}
+		if policy != nil {
+			return effectiveFromModel(policy), nil
+		}
+	}
+
+	var policy models.PasswordPolicy
+	err := database.DB.Where("scope = ? AND is_active = ?", models.PasswordPolicyScopeGlobal, true).First(&policy).Error
+	if err == nil {
+		return effectiveFromModel(&policy), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &EffectivePasswordPolicy{
+		Source: passwordPolicySourceDefault,
+		Policy: utils.DefaultPasswordPolicy(),
+	}, nil
+}
+
+// organizationPasswordPolicy 查找组织自身的策略，没有时沿上级组织向上查找作用于下级组织的策略
+func organizationPasswordPolicy(organizationID string) (*models.PasswordPolicy, error) {
+	var organization models.Organization
+	if err := database.DB.Select("id", "path").Where("id = ?", organizationID).First(&organization).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Path由上级组织ID组成，从根组织开始，例如"/root-id/parent-id/"
+	ancestors := strings.FieldsFunc(organization.Path, func(r rune) bool {
+		return r == '/'
+	})
+	orgIDs := append([]string{organization.ID}, ancestors...)
+
+	var policies []models.PasswordPolicy
+	if err := database.DB.Where("scope = ? AND scope_id IN ? AND is_active = ?", models.PasswordPolicyScopeOrganization, orgIDs, true).
+		Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	byOrganization := make(map[string]*models.PasswordPolicy, len(policies))
+	for i := range policies {
+		if policies[i].ScopeID != nil {
+			byOrganization[*policies[i].ScopeID] = &policies[i]
+		}
+	}
+
+	if policy := byOrganization[organization.ID]; policy != nil {
+		return policy, nil
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		if policy := byOrganization[ancestors[i]]; policy != nil && policy.IncludeSubOrgs {
+			return policy, nil
+		}
+	}
+	return nil, nil
+}
+
+// effectiveFromModel 将启用的策略转换为生效策略
+func effectiveFromModel(policy *models.PasswordPolicy) *EffectivePasswordPolicy {
+	effective := &EffectivePasswordPolicy{
+		Source:   policy.Scope,
+		PolicyID: policy.ID,
+		Name:     policy.Name,
+		Policy:   passwordPolicyFromModel(policy),
+	}
+	if policy.ScopeID != nil {
+		effective.ScopeID = *policy.ScopeID
+	}
+	return effective
+}
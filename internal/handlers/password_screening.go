@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/utils"
+)
+
+// passwordScreeningChannel 重新加载筛查数据时通知其他实例
+const passwordScreeningChannel = "password_screening:reload"
+
+var (
+	passwordScreeningOnce     sync.Once
+	passwordScreeningInstance = uuid.New().String()
+)
+
+// InitPasswordScreening 加载泄露/常见密码数据文件，并订阅其他实例的重新加载通知
+// 加载失败时继续使用内置常见密码列表
+func InitPasswordScreening() error {
+	err := reloadPasswordScreening()
+
+	passwordScreeningOnce.Do(func() {
+		if redis.RDB == nil {
+			return
+		}
+		pubsub := redis.Subscribe(passwordScreeningChannel)
+		go func() {
+			for msg := range pubsub.Channel() {
+				if msg.Payload == passwordScreeningInstance {
+					continue
+				}
+				if err := reloadPasswordScreening(); err != nil {
+					logger.ErrorError("Failed to reload password screening dataset", zap.Error(err))
+				}
+			}
+		}()
+	})
+	return err
+}
+
+// reloadPasswordScreening 按配置重新构建筛查器，失败时保留当前筛查器
+func reloadPasswordScreening() error {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return nil
+	}
+	screening := cfg.PasswordScreening
+
+	screener, err := utils.LoadPasswordScreener(screening.Files, screening.MinOccurrences, screening.FalsePositiveRate)
+	if err != nil {
+		return err
+	}
+	utils.SetPasswordScreener(screener)
+
+	stats := screener.Stats()
+	logger.Info("Password screening dataset loaded",
+		zap.Strings("files", stats.Files),
+		zap.Int("entries", stats.Entries),
+		zap.Int("skipped", stats.Skipped),
+		zap.Int("filter_bytes", stats.FilterBytes),
+	)
+	return nil
+}
+
+// GetPasswordScreeningHandler 获取泄露/常见密码数据集状态
+func GetPasswordScreeningHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Success",
+		"data":    utils.CurrentPasswordScreener().Stats(),
+	})
+}
+
+// ReloadPasswordScreeningHandler 重新加载泄露/常见密码数据文件，并通知其他实例
+func ReloadPasswordScreeningHandler(c *gin.Context) {
+	if err := reloadPasswordScreening(); err != nil {
+		logger.ErrorError("Failed to reload password screening dataset", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18n.PasswordListReloadFailed,
+			"data": gin.H{
+				"error": err.Error(),
+			},
+		})
+		return
+	}
+	if redis.RDB != nil {
+		if err := redis.RDB.Publish(context.Background(), passwordScreeningChannel, passwordScreeningInstance).Err(); err != nil {
+			logger.ErrorWarn("Failed to notify password screening reload", zap.Error(err))
+		}
+	}
+
+	stats := utils.CurrentPasswordScreener().Stats()
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceSystem, "password_screening",
+		"Password screening dataset reloaded", gin.H{
+			"files":   stats.Files,
+			"entries": stats.Entries,
+		})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.PasswordListReloaded,
+		"data":    stats,
+	})
+}
+
+// passwordContext 构建校验密码用的账户信息：显示名称、邮箱用户名、站点名称和组织名称
+func passwordContext(user *models.User) utils.PasswordContext {
+	words := []string{user.DisplayName, emailLocalPart(user.Email), siteDisplayName()}
+	if user.OrganizationID != "" {
+		var organization models.Organization
+		if err := database.DB.Select("name").Where("id = ?", user.OrganizationID).First(&organization).Error; err == nil {
+			words = append(words, organization.Name)
+		}
+	}
+	return utils.PasswordContext{
+		Username: user.Username,
+		Words:    words,
+	}
+}
+
+// emailLocalPart 返回邮箱@之前的部分
+func emailLocalPart(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	return local
+}
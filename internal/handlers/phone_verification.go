@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/notify"
+	"eiam-platform/pkg/utils"
+)
+
+// ChangePhoneRequest 修改手机号，新手机号验证通过后才生效
+type ChangePhoneRequest struct {
+	NewPhone        string `json:"new_phone" binding:"required"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// VerifyPhoneRequest 提交手机验证码
+type VerifyPhoneRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// SendPhoneVerificationHandler 向当前手机号发送验证码
+func SendPhoneVerificationHandler(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	// 未验证的手机号不能接收登录动态码，这里直接使用资料中的号码
+	phone := strings.TrimSpace(user.Phone)
+	if phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.PhoneNotSet,
+			"data":    nil,
+		})
+		return
+	}
+	if user.PhoneVerified {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.PhoneAlreadyVerified,
+			"data":    nil,
+		})
+		return
+	}
+	if !otpChannelEnabled(notify.ChannelSMS) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.OTPChannelDisabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	// 同一用途的旧验证码会作废，包括尚未确认的手机号修改
+	if err := issueOneTimeCode(user, otpPurposeVerifyPhone, notify.ChannelSMS, phone); err != nil {
+		respondOTPIssueError(c, err)
+		return
+	}
+
+	logger.AccessInfo("Phone verification code sent",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("sent_to", maskDestination(phone)),
+	)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.PhoneVerificationSent,
+		"data": gin.H{
+			"sent_to":    maskDestination(phone),
+			"expires_in": int(otpCodeSettings().TTL.Seconds()),
+		},
+	})
+}
+
+// ChangePhoneHandler 校验当前密码后向新手机号发送验证码，并通知邮箱
+// 验证通过前账户仍使用原手机号
+func ChangePhoneHandler(c *gin.Context) {
+	var req ChangePhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+	newPhone := strings.TrimSpace(req.NewPhone)
+	if !phoneIdentifierPattern.MatchString(newPhone) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidPhone,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if !utils.CheckPassword(req.CurrentPassword, user.Password) {
+		recordLoginFailure(c, user)
+		logger.AccessInfo("Phone change failed: invalid current password",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_id", user.ID),
+			zap.Int("failed_count", user.FailedCount),
+		)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.OldPassword,
+			"data":    nil,
+		})
+		return
+	}
+	if newPhone == strings.TrimSpace(user.Phone) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.PhoneUnchanged,
+			"data":    nil,
+		})
+		return
+	}
+
+	taken, err := phoneTaken(newPhone, user.ID)
+	if err != nil {
+		logger.ErrorError("Failed to check phone", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+	if taken {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.PhoneExists,
+			"data":    nil,
+		})
+		return
+	}
+	if !otpChannelEnabled(notify.ChannelSMS) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": i18n.OTPChannelDisabled,
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := issueOneTimeCode(user, otpPurposeVerifyPhone, notify.ChannelSMS, newPhone); err != nil {
+		respondOTPIssueError(c, err)
+		return
+	}
+	if user.FailedCount > 0 {
+		database.DB.Model(user).Update("failed_count", 0)
+		clearLoginFailures(c, user)
+	}
+	sendPhoneChangeNotice(user, newPhone)
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID,
+		"Phone change requested by user: "+user.Username, gin.H{
+			"old_phone": user.Phone,
+			"new_phone": newPhone,
+		})
+	logger.AccessInfo("Phone change requested",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("sent_to", maskDestination(newPhone)),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.PhoneChangePending,
+		"data": gin.H{
+			"pending_phone": newPhone,
+			"expires_in":    int(otpCodeSettings().TTL.Seconds()),
+		},
+	})
+}
+
+// VerifyPhoneHandler 校验手机验证码，验证码发往新手机号时同时完成手机号修改
+func VerifyPhoneHandler(c *gin.Context) {
+	var req VerifyPhoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	record, err := verifyOneTimeCode(user.ID, otpPurposeVerifyPhone, req.Code)
+	if err != nil {
+		logger.AccessInfo("Phone verification failed",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_id", user.ID),
+			zap.Error(err),
+		)
+		respondOTPVerifyError(c, err)
+		return
+	}
+
+	oldPhone := user.Phone
+	changed := record.SentTo != strings.TrimSpace(oldPhone)
+	if changed {
+		// 发送验证码后手机号可能已被其他账户占用
+		taken, err := phoneTaken(record.SentTo, user.ID)
+		if err != nil {
+			logger.ErrorError("Failed to check phone", zap.Error(err))
+			respondInternalError(c)
+			return
+		}
+		if taken {
+			consumeOneTimeCode(record)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": i18n.PhoneExists,
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	if err := consumeOneTimeCode(record); err != nil {
+		respondOTPVerifyError(c, err)
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"phone":             record.SentTo,
+		"phone_verified":    true,
+		"phone_verified_at": now,
+	}).Error; err != nil {
+		logger.ErrorError("Failed to verify phone", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	description := "Phone verified by user: " + user.Username
+	if changed {
+		description = "Phone changed by user: " + user.Username
+	}
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceUser, user.ID, description, gin.H{
+		"old_phone": oldPhone,
+		"phone":     record.SentTo,
+	})
+	logger.AccessInfo("Phone verified",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.Bool("changed", changed),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.SuccessPhoneVerified,
+		"data": gin.H{
+			"phone":             record.SentTo,
+			"phone_verified":    true,
+			"phone_verified_at": now,
+		},
+	})
+}
+
+// pendingPhoneChange 返回尚未验证的新手机号，没有待确认的修改时返回空字符串
+func pendingPhoneChange(user *models.User) string {
+	var record models.UserOTPRecord
+	err := database.DB.Where("user_id = ? AND purpose = ? AND used = ? AND expires_at > ?",
+		user.ID, otpPurposeVerifyPhone, false, time.Now()).
+		Order("created_at DESC").First(&record).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.ErrorWarn("Failed to get pending phone change", zap.String("user_id", user.ID), zap.Error(err))
+		}
+		return ""
+	}
+	if record.SentTo == strings.TrimSpace(user.Phone) {
+		return ""
+	}
+	return record.SentTo
+}
+
+// phoneTaken 检查手机号是否已被其他账户使用，手机号可以作为登录标识，不能重复
+func phoneTaken(phone, userID string) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.User{}).Where("phone = ? AND id <> ?", phone, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// sendPhoneChangeNotice 通过邮箱通知有人申请修改手机号，发送失败只记录日志
+func sendPhoneChangeNotice(user *models.User, newPhone string) {
+	email := otpDestination(user, notify.ChannelEmail)
+	if email == "" {
+		return
+	}
+
+	site := siteDisplayName()
+	msg := &notify.Message{
+		To:      email,
+		Subject: site + " phone number change requested",
+		Body: fmt.Sprintf("Hello %s,\n\nA request was made to change the phone number of your %s account to %s. "+
+			"The change takes effect once the new number is verified.\n\n"+
+			"If you did not make this request, change your password immediately and contact your administrator.",
+			user.Username, site, maskDestination(newPhone)),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := notify.Send(ctx, notify.ChannelEmail, msg); err != nil {
+		logger.ErrorWarn("Failed to send phone change notice",
+			zap.String("user_id", user.ID),
+			zap.String("sent_to", maskDestination(email)),
+			zap.Error(err),
+		)
+	}
+}
@@ -7,11 +7,11 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,19 +24,16 @@ import (
 	"eiam-platform/internal/models"
 	"eiam-platform/pkg/database"
 	"eiam-platform/pkg/logger"
-	"eiam-platform/pkg/utils"
 )
 
-var (
-	samlIDP *samlidp.Server
-)
+var samlBaseURL *url.URL
 
 // InitSAMLIDP 初始化SAML身份提供商
 func InitSAMLIDP() error {
-	// 生成或加载密钥对
-	keyPair, err := generateSAMLKeyPair()
+	// 加载持久化的密钥对，保证重启和多实例使用同一证书
+	keyPair, source, err := loadSAMLKeyPair()
 	if err != nil {
-		return fmt.Errorf("failed to generate SAML key pair: %w", err)
+		return fmt.Errorf("failed to load SAML key pair: %w", err)
 	}
 
 	// 获取基础URL - 从配置读取，如果配置不可用则使用默认值
@@ -51,20 +48,44 @@ func InitSAMLIDP() error {
 	if err != nil {
 		return fmt.Errorf("failed to parse base URL: %w", err)
 	}
+	samlBaseURL = baseURL
+
+	setSAMLIDP(newSAMLIDPServer(keyPair))
 
-	// 创建SAML IdP服务器 - 简化版本
-	samlIDP = &samlidp.Server{
+	var activeKID string
+	if source == samlKeySourceDatabase {
+		if record, err := findActiveSAMLKey(); err == nil {
+			activeKID = record.KeyID
+		}
+		startSAMLKeyRotation()
+	}
+	if err := updateSAMLKeyState(source, activeKID); err != nil {
+		logger.ErrorWarn("Failed to load pending SAML certificates", zap.Error(err))
+	}
+
+	logger.Info("SAML IdP initialized successfully with crewjam/saml library",
+		zap.String("key_source", source),
+		zap.String("kid", activeKID),
+		zap.Time("cert_not_after", keyPair.Leaf.NotAfter),
+	)
+	return nil
+}
+
+// newSAMLIDPServer 使用指定密钥对创建SAML IdP服务器
+func newSAMLIDPServer(keyPair tls.Certificate) *samlidp.Server {
+	return &samlidp.Server{
 		IDP: saml.IdentityProvider{
 			Key:         keyPair.PrivateKey.(*rsa.PrivateKey),
 			Certificate: keyPair.Leaf,
-			MetadataURL: *baseURL.ResolveReference(&url.URL{Path: "/saml/metadata"}),
-			SSOURL:      *baseURL.ResolveReference(&url.URL{Path: "/saml/sso"}),
-			LogoutURL:   *baseURL.ResolveReference(&url.URL{Path: "/saml/sls"}),
+			MetadataURL: *samlBaseURL.ResolveReference(&url.URL{Path: "/saml/metadata"}),
+			SSOURL:      *samlBaseURL.ResolveReference(&url.URL{Path: "/saml/sso"}),
+			LogoutURL:   *samlBaseURL.ResolveReference(&url.URL{Path: "/saml/sls"}),
+			Logger:      zap.NewStdLog(logger.GetLogger()),
+
+			ServiceProviderProvider: applicationServiceProviderProvider{},
+			SessionProvider:         platformSessionProvider{},
 		},
 	}
-
-	logger.Info("SAML IdP initialized successfully with crewjam/saml library")
-	return nil
 }
 
 // generateSAMLKeyPair 生成SAML密钥对
@@ -75,8 +96,11 @@ func generateSAMLKeyPair() (tls.Certificate, error) {
 		return tls.Certificate{}, err
 	}
 
-	// 创建证书模板
-	serialNumber, _ := rand.Int(rand.Reader, big.NewInt(1000000))
+	// 创建证书模板，证书会被持久化，序列号使用128位随机数
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
 	template := x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
@@ -123,20 +147,10 @@ func generateSAMLKeyPair() (tls.Certificate, error) {
 	return keyPair, nil
 }
 
-// TODO: 自定义会话和存储实现将在后续版本中添加
-// 当前使用crewjam/saml的默认实现
-
-/*
-// CustomSessionProvider 自定义会话提供商 - 待实现
-type CustomSessionProvider struct{}
-
-// CustomStore 自定义存储 - 待实现
-type CustomStore struct{}
-*/
-
 // SAMLMetadataHandlerIDP SAML元数据处理器 (使用crewjam/saml)
 func SAMLMetadataHandlerIDP(c *gin.Context) {
-	if samlIDP == nil {
+	idp := currentSAMLIDP()
+	if idp == nil {
 		logger.Error("SAML IdP not initialized")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -145,8 +159,9 @@ func SAMLMetadataHandlerIDP(c *gin.Context) {
 		return
 	}
 
-	// 使用crewjam/saml生成元数据
-	metadata := samlIDP.IDP.Metadata()
+	// 使用crewjam/saml生成元数据，并发布待启用的证书
+	metadata := idp.IDP.Metadata()
+	appendNextSAMLCertificates(metadata)
 	metadataXML, err := xml.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		logger.ErrorError("Failed to marshal SAML metadata", zap.Error(err))
@@ -165,7 +180,8 @@ func SAMLMetadataHandlerIDP(c *gin.Context) {
 
 // SAMLSSOHandlerIDP SAML单点登录处理器 (使用crewjam/saml)
 func SAMLSSOHandlerIDP(c *gin.Context) {
-	if samlIDP == nil {
+	idp := currentSAMLIDP()
+	if idp == nil {
 		logger.Error("SAML IdP not initialized")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -174,23 +190,70 @@ func SAMLSSOHandlerIDP(c *gin.Context) {
 		return
 	}
 
-	// 将gin.Context转换为http.ResponseWriter和*http.Request
 	w := c.Writer
 	r := c.Request
 
-	// 使用crewjam/saml处理SSO请求
-	samlIDP.ServeHTTP(w, r)
+	// 解析并校验AuthnRequest，SP由应用配置解析
+	req, err := saml.NewIdpAuthnRequest(&idp.IDP, r)
+	if err == nil {
+		err = req.Validate()
+	}
+	if err != nil {
+		logger.ErrorWarn("Invalid SAML authn request", zap.String("ip", c.ClientIP()), zap.Error(err))
+		c.String(http.StatusBadRequest, "Invalid SAML request")
+		return
+	}
+
+	// 未登录时会话提供者已跳转到登录页
+	session := idp.IDP.SessionProvider.GetSession(w, r, req)
+	if session == nil {
+		return
+	}
+
+	app, err := findSAMLApplication(req.ServiceProviderMetadata.EntityID)
+	if err != nil {
+		logger.ErrorWarn("SAML application not found", zap.String("entity_id", req.ServiceProviderMetadata.EntityID), zap.Error(err))
+		c.String(http.StatusNotFound, "Service provider not found")
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("username = ?", session.UserName).First(&user).Error; err != nil {
+		c.String(http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	form, err := issueSAMLResponse(req, app, &user, session)
+	if err != nil {
+		if errors.Is(err, errSAMLRequestReplayed) {
+			logger.ErrorWarn("Replayed SAML authn request", zap.String("request_id", req.Request.ID), zap.String("entity_id", app.EntityID))
+			c.String(http.StatusBadRequest, "SAML request has already been used")
+			return
+		}
+		logger.ErrorError("Failed to issue SAML response", zap.String("entity_id", app.EntityID), zap.Error(err))
+		c.String(http.StatusInternalServerError, "Failed to generate SAML response")
+		return
+	}
+
+	recordApplicationAccess(user.ID, app.ID, "saml", c.ClientIP())
 
-	logger.Info("SAML SSO request handled by crewjam/saml",
+	c.HTML(http.StatusOK, "saml_post_form.html", gin.H{
+		"AcsURL":       form.URL,
+		"SAMLResponse": form.SAMLResponse,
+		"RelayState":   form.RelayState,
+	})
+
+	logger.Info("SAML SSO request handled",
 		zap.String("method", r.Method),
-		zap.String("url", r.URL.String()),
+		zap.String("entity_id", app.EntityID),
 		zap.String("ip", c.ClientIP()),
 	)
 }
 
-// SAMLSLSHandlerIDP SAML单点注销处理器 (使用crewjam/saml)
+// SAMLSLSHandlerIDP SAML单点注销处理器
+// 支持SP发起的LogoutRequest、前端通道跳转链返回的LogoutResponse以及IdP发起的注销
 func SAMLSLSHandlerIDP(c *gin.Context) {
-	if samlIDP == nil {
+	if currentSAMLIDP() == nil {
 		logger.Error("SAML IdP not initialized")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -199,37 +262,18 @@ func SAMLSLSHandlerIDP(c *gin.Context) {
 		return
 	}
 
-	// 将gin.Context转换为http.ResponseWriter和*http.Request
-	w := c.Writer
-	r := c.Request
-
-	// 使用crewjam/saml处理SLS请求
-	samlIDP.ServeHTTP(w, r)
-
-	logger.Info("SAML SLS request handled by crewjam/saml",
-		zap.String("method", r.Method),
-		zap.String("url", r.URL.String()),
-		zap.String("ip", c.ClientIP()),
-	)
-}
-
-// checkUserAuthenticationFromRequest 从HTTP请求检查用户认证状态
-func checkUserAuthenticationFromRequest(r *http.Request) (*models.User, bool) {
-	// 尝试JWT token认证
-	authHeader := r.Header.Get("Authorization")
-	if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		jwtManager := &utils.JWTManager{}
-		if claims, err := jwtManager.ValidateAccessToken(token); err == nil {
-			var user models.User
-			if err := database.DB.Where("id = ?", claims.UserID).First(&user).Error; err == nil {
-				return &user, true
-			}
-		}
+	switch {
+	case samlMessageParam(c, "SAMLResponse") != "":
+		handleSAMLLogoutResponse(c)
+	case samlMessageParam(c, "SAMLRequest") != "":
+		handleSAMLLogoutRequest(c)
+	default:
+		// IdP发起注销，结束当前浏览器会话
+		sessionID, _ := c.Cookie("cas_session")
+		logger.Info("IdP initiated SAML logout",
+			zap.String("ip", c.ClientIP()),
+			zap.Bool("has_session", sessionID != ""),
+		)
+		startBrowserLogout(c, sessionID, "", nil)
 	}
-
-	// 可以添加其他认证方式，如session等
-	// TODO: 添加基于Cookie的会话认证
-
-	return nil, false
 }
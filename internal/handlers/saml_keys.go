@@ -0,0 +1,690 @@
+package handlers
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlidp"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/utils"
+)
+
+// SAML签名密钥来源
+const (
+	samlKeySourceConfig   = "config"
+	samlKeySourceFile     = "file"
+	samlKeySourceDatabase = "database"
+)
+
+// samlKeyRefreshInterval 检查计划启用密钥和其他实例轮换结果的间隔
+const samlKeyRefreshInterval = time.Minute
+
+// samlKeyState 当前SAML IdP密钥状态
+type samlKeyState struct {
+	mu        sync.RWMutex
+	server    *samlidp.Server // 密钥轮换时整体替换，只通过currentSAMLIDP读取
+	source    string
+	activeKID string
+	nextCerts []*x509.Certificate // 待启用证书，提前发布在元数据中
+}
+
+var (
+	samlKeys            = &samlKeyState{}
+	samlKeyRotationOnce sync.Once
+)
+
+// loadSAMLKeyPair 按配置、文件、数据库的顺序加载SAML签名密钥，数据库中没有时生成并保存
+func loadSAMLKeyPair() (tls.Certificate, string, error) {
+	var samlCfg config.SAMLKeyConfig
+	if cfg := config.GetConfig(); cfg != nil {
+		samlCfg = cfg.IdP.SAML
+	}
+
+	if samlCfg.Certificate != "" && samlCfg.PrivateKey != "" {
+		keyPair, err := parseSAMLKeyPair(samlCfg.Certificate, samlCfg.PrivateKey)
+		if err != nil {
+			return tls.Certificate{}, "", fmt.Errorf("invalid SAML key in config: %w", err)
+		}
+		return keyPair, samlKeySourceConfig, nil
+	}
+
+	if samlCfg.CertificateFile != "" && samlCfg.PrivateKeyFile != "" {
+		certPEM, err := os.ReadFile(samlCfg.CertificateFile)
+		if err != nil {
+			return tls.Certificate{}, "", fmt.Errorf("failed to read SAML certificate file: %w", err)
+		}
+		keyPEM, err := os.ReadFile(samlCfg.PrivateKeyFile)
+		if err != nil {
+			return tls.Certificate{}, "", fmt.Errorf("failed to read SAML private key file: %w", err)
+		}
+		keyPair, err := parseSAMLKeyPair(string(certPEM), string(keyPEM))
+		if err != nil {
+			return tls.Certificate{}, "", fmt.Errorf("invalid SAML key file: %w", err)
+		}
+		return keyPair, samlKeySourceFile, nil
+	}
+
+	if err := activateDueSAMLKeys(); err != nil {
+		logger.ErrorWarn("Failed to activate scheduled SAML keys", zap.Error(err))
+	}
+
+	record, err := findActiveSAMLKey()
+	if err == nil {
+		keyPair, err := samlKeyPairFromRecord(record)
+		if err != nil {
+			return tls.Certificate{}, "", fmt.Errorf("failed to load SAML key %s: %w", record.KeyID, err)
+		}
+		return keyPair, samlKeySourceDatabase, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return tls.Certificate{}, "", fmt.Errorf("failed to query SAML keys: %w", err)
+	}
+
+	// 首次启动，生成密钥并保存，其他实例和后续重启都使用同一密钥
+	keyPair, err := generateSAMLKeyPair()
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("failed to generate SAML key pair: %w", err)
+	}
+	if _, err := saveSAMLSigningKey(keyPair, true, nil); err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("failed to save SAML key pair: %w", err)
+	}
+	return keyPair, samlKeySourceDatabase, nil
+}
+
+// parseSAMLKeyPair 解析PEM格式的证书和RSA私钥
+func parseSAMLKeyPair(certPEM, keyPEM string) (tls.Certificate, error) {
+	keyPair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if _, ok := keyPair.PrivateKey.(*rsa.PrivateKey); !ok {
+		return tls.Certificate{}, errors.New("only RSA private keys are supported")
+	}
+
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPair.Leaf = leaf
+	return keyPair, nil
+}
+
+// samlKeyPairFromRecord 解密数据库中的密钥记录
+func samlKeyPairFromRecord(record *models.SigningKey) (tls.Certificate, error) {
+	keyPEM, err := utils.DecryptSecret(record.PrivateKey, signingKeySecret())
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return parseSAMLKeyPair(record.Certificate, keyPEM)
+}
+
+// saveSAMLSigningKey 加密保存SAML密钥；active为false时作为待启用密钥
+func saveSAMLSigningKey(keyPair tls.Certificate, active bool, activatesAt *time.Time) (*models.SigningKey, error) {
+	privateKey := keyPair.PrivateKey.(*rsa.PrivateKey)
+	encryptedKey, err := encryptSigningPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.SigningKey{
+		KeyID:      signingKeyID(publicDER),
+		Purpose:    models.SigningKeyPurposeSAML,
+		Algorithm:  "RS256",
+		PrivateKey: encryptedKey,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		Certificate: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: keyPair.Leaf.Raw,
+		})),
+		Active:      active,
+		ActivatesAt: activatesAt,
+	}
+	if err := database.DB.Create(record).Error; err != nil {
+		return nil, err
+	}
+
+	logger.Info("SAML signing key saved",
+		zap.String("kid", record.KeyID),
+		zap.Bool("active", active),
+		zap.Time("not_after", keyPair.Leaf.NotAfter),
+	)
+	return record, nil
+}
+
+// findActiveSAMLKey 查询当前启用的SAML密钥
+func findActiveSAMLKey() (*models.SigningKey, error) {
+	var record models.SigningKey
+	if err := database.DB.Where("purpose = ? AND active = ?", models.SigningKeyPurposeSAML, true).
+		Order("updated_at DESC").First(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// findPendingSAMLKeys 查询待启用的SAML密钥
+func findPendingSAMLKeys() ([]models.SigningKey, error) {
+	var records []models.SigningKey
+	err := database.DB.Where("purpose = ? AND active = ? AND retired_at IS NULL", models.SigningKeyPurposeSAML, false).
+		Order("created_at ASC").Find(&records).Error
+	return records, err
+}
+
+// activateDueSAMLKeys 启用已到计划时间的待启用密钥
+func activateDueSAMLKeys() error {
+	var record models.SigningKey
+	err := database.DB.Where("purpose = ? AND active = ? AND retired_at IS NULL AND activates_at IS NOT NULL AND activates_at <= ?",
+		models.SigningKeyPurposeSAML, false, time.Now()).
+		Order("activates_at DESC").First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return activateSAMLKey(&record)
+}
+
+// activateSAMLKey 将指定密钥设为启用，原启用密钥退役
+func activateSAMLKey(record *models.SigningKey) error {
+	now := time.Now()
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SigningKey{}).
+			Where("purpose = ? AND active = ? AND id <> ?", models.SigningKeyPurposeSAML, true, record.ID).
+			Updates(map[string]interface{}{"active": false, "retired_at": now}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.SigningKey{}).Where("id = ?", record.ID).
+			Updates(map[string]interface{}{"active": true, "activates_at": now, "retired_at": nil}).Error
+	})
+}
+
+// refreshSAMLKeys 重新加载数据库中的密钥，启用密钥变化时替换IdP签名密钥
+func refreshSAMLKeys() error {
+	samlKeys.mu.RLock()
+	source := samlKeys.source
+	activeKID := samlKeys.activeKID
+	samlKeys.mu.RUnlock()
+
+	if source != samlKeySourceDatabase {
+		return nil
+	}
+
+	if err := activateDueSAMLKeys(); err != nil {
+		return err
+	}
+
+	record, err := findActiveSAMLKey()
+	if err != nil {
+		return err
+	}
+
+	if record.KeyID != activeKID {
+		keyPair, err := samlKeyPairFromRecord(record)
+		if err != nil {
+			return err
+		}
+		setSAMLIDP(newSAMLIDPServer(keyPair))
+		logger.Info("SAML IdP signing key switched",
+			zap.String("previous_kid", activeKID),
+			zap.String("kid", record.KeyID),
+		)
+	}
+
+	return updateSAMLKeyState(samlKeySourceDatabase, record.KeyID)
+}
+
+// currentSAMLIDP 返回当前使用的SAML IdP，未初始化时为nil
+func currentSAMLIDP() *samlidp.Server {
+	samlKeys.mu.RLock()
+	defer samlKeys.mu.RUnlock()
+	return samlKeys.server
+}
+
+// setSAMLIDP 替换SAML IdP，正在处理的请求继续使用已取得的实例
+func setSAMLIDP(server *samlidp.Server) {
+	samlKeys.mu.Lock()
+	samlKeys.server = server
+	samlKeys.mu.Unlock()
+}
+
+// updateSAMLKeyState 更新当前启用密钥和待发布证书
+func updateSAMLKeyState(source, activeKID string) error {
+	var nextCerts []*x509.Certificate
+	if source == samlKeySourceDatabase {
+		pending, err := findPendingSAMLKeys()
+		if err != nil {
+			return err
+		}
+		for _, key := range pending {
+			cert, err := parseCertificatePEM(key.Certificate)
+			if err != nil {
+				logger.ErrorWarn("Skipping invalid pending SAML certificate", zap.String("kid", key.KeyID), zap.Error(err))
+				continue
+			}
+			nextCerts = append(nextCerts, cert)
+		}
+	}
+
+	samlKeys.mu.Lock()
+	samlKeys.source = source
+	samlKeys.activeKID = activeKID
+	samlKeys.nextCerts = nextCerts
+	samlKeys.mu.Unlock()
+	return nil
+}
+
+// startSAMLKeyRotation 定期检查计划启用的密钥
+func startSAMLKeyRotation() {
+	samlKeyRotationOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(samlKeyRefreshInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := refreshSAMLKeys(); err != nil {
+					logger.ErrorWarn("Failed to refresh SAML signing keys", zap.Error(err))
+				}
+			}
+		}()
+	})
+}
+
+// appendNextSAMLCertificates 在元数据中发布待启用证书，SP可在切换前提前信任
+func appendNextSAMLCertificates(metadata *saml.EntityDescriptor) {
+	samlKeys.mu.RLock()
+	nextCerts := samlKeys.nextCerts
+	samlKeys.mu.RUnlock()
+
+	if len(nextCerts) == 0 || len(metadata.IDPSSODescriptors) == 0 {
+		return
+	}
+
+	descriptor := &metadata.IDPSSODescriptors[0].SSODescriptor.RoleDescriptor
+	for _, cert := range nextCerts {
+		descriptor.KeyDescriptors = append(descriptor.KeyDescriptors, saml.KeyDescriptor{
+			Use: "signing",
+			KeyInfo: saml.KeyInfo{
+				X509Data: saml.X509Data{
+					X509Certificates: []saml.X509Certificate{
+						{Data: base64.StdEncoding.EncodeToString(cert.Raw)},
+					},
+				},
+			},
+		})
+	}
+}
+
+// parseCertificatePEM 解析PEM格式证书
+func parseCertificatePEM(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("invalid certificate PEM")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// samlKeyInfo 控制台展示的密钥信息
+func samlKeyInfo(record *models.SigningKey) gin.H {
+	status := "pending"
+	if record.Active {
+		status = "active"
+	} else if record.RetiredAt != nil {
+		status = "retired"
+	}
+
+	info := gin.H{
+		"id":           record.ID,
+		"kid":          record.KeyID,
+		"status":       status,
+		"activates_at": record.ActivatesAt,
+		"retired_at":   record.RetiredAt,
+		"created_at":   record.CreatedAt,
+		"certificate":  record.Certificate,
+	}
+	if cert, err := parseCertificatePEM(record.Certificate); err == nil {
+		fingerprint := sha256.Sum256(cert.Raw)
+		info["subject"] = cert.Subject.String()
+		info["not_before"] = cert.NotBefore
+		info["not_after"] = cert.NotAfter
+		info["fingerprint_sha256"] = strings.ToUpper(fmt.Sprintf("%x", fingerprint))
+	}
+	return info
+}
+
+// ensureSAMLKeysManaged 配置或文件提供密钥时不允许在控制台轮换
+func ensureSAMLKeysManaged(c *gin.Context) bool {
+	samlKeys.mu.RLock()
+	source := samlKeys.source
+	samlKeys.mu.RUnlock()
+
+	if source != samlKeySourceDatabase {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": "SAML signing key is managed by configuration and cannot be rotated from the console",
+			"data":    gin.H{"source": source},
+		})
+		return false
+	}
+	return true
+}
+
+// GetSAMLKeysHandler 获取SAML签名密钥列表
+func GetSAMLKeysHandler(c *gin.Context) {
+	var records []models.SigningKey
+	if err := database.DB.Where("purpose = ?", models.SigningKeyPurposeSAML).
+		Order("created_at DESC").Find(&records).Error; err != nil {
+		logger.ErrorError("Failed to get SAML keys", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get SAML keys",
+			"data":    nil,
+		})
+		return
+	}
+
+	items := make([]gin.H, 0, len(records))
+	for i := range records {
+		items = append(items, samlKeyInfo(&records[i]))
+	}
+
+	samlKeys.mu.RLock()
+	source := samlKeys.source
+	activeKID := samlKeys.activeKID
+	samlKeys.mu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Success",
+		"data": gin.H{
+			"source":     source,
+			"active_kid": activeKID,
+			"items":      items,
+		},
+	})
+}
+
+// GenerateSAMLKeyHandler 生成新的待启用SAML密钥
+func GenerateSAMLKeyHandler(c *gin.Context) {
+	if !ensureSAMLKeysManaged(c) {
+		return
+	}
+
+	var req struct {
+		ActivatesAt *time.Time `json:"activates_at"`
+	}
+	// 请求体可以为空，此时密钥不设置计划启用时间
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request data",
+			"data":    nil,
+		})
+		return
+	}
+
+	keyPair, err := generateSAMLKeyPair()
+	if err != nil {
+		logger.ErrorError("Failed to generate SAML key pair", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to generate SAML key",
+			"data":    nil,
+		})
+		return
+	}
+
+	createPendingSAMLKey(c, keyPair, req.ActivatesAt, "Generated SAML signing key")
+}
+
+// UploadSAMLKeyHandler 上传证书和私钥作为待启用SAML密钥
+func UploadSAMLKeyHandler(c *gin.Context) {
+	if !ensureSAMLKeysManaged(c) {
+		return
+	}
+
+	var req struct {
+		Certificate string     `json:"certificate" binding:"required"`
+		PrivateKey  string     `json:"private_key" binding:"required"`
+		ActivatesAt *time.Time `json:"activates_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request data",
+			"data":    nil,
+		})
+		return
+	}
+
+	keyPair, err := parseSAMLKeyPair(req.Certificate, req.PrivateKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid certificate or private key",
+			"data":    gin.H{"error": err.Error()},
+		})
+		return
+	}
+	if time.Now().After(keyPair.Leaf.NotAfter) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Certificate has expired",
+			"data":    nil,
+		})
+		return
+	}
+
+	createPendingSAMLKey(c, keyPair, req.ActivatesAt, "Uploaded SAML signing key")
+}
+
+// createPendingSAMLKey 保存待启用密钥并立即在元数据中发布
+func createPendingSAMLKey(c *gin.Context, keyPair tls.Certificate, activatesAt *time.Time, description string) {
+	record, err := saveSAMLSigningKey(keyPair, false, activatesAt)
+	if err != nil {
+		logger.ErrorError("Failed to save SAML key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to save SAML key",
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := refreshSAMLKeys(); err != nil {
+		logger.ErrorWarn("Failed to refresh SAML keys", zap.Error(err))
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionCreate, utils.AuditResourceSystem, record.ID,
+		description, gin.H{"kid": record.KeyID, "activates_at": activatesAt})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "SAML key created successfully",
+		"data":    samlKeyInfo(record),
+	})
+}
+
+// ScheduleSAMLKeyActivationHandler 设置或取消待启用密钥的计划启用时间
+func ScheduleSAMLKeyActivationHandler(c *gin.Context) {
+	if !ensureSAMLKeysManaged(c) {
+		return
+	}
+
+	var req struct {
+		ActivatesAt *time.Time `json:"activates_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request data",
+			"data":    nil,
+		})
+		return
+	}
+
+	record, ok := findPendingSAMLKeyForUpdate(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(record).Update("activates_at", req.ActivatesAt).Error; err != nil {
+		logger.ErrorError("Failed to schedule SAML key activation", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to schedule SAML key activation",
+			"data":    nil,
+		})
+		return
+	}
+	record.ActivatesAt = req.ActivatesAt
+
+	// 计划时间已到时立即生效
+	if err := refreshSAMLKeys(); err != nil {
+		logger.ErrorWarn("Failed to refresh SAML keys", zap.Error(err))
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceSystem, record.ID,
+		"Scheduled SAML signing key activation", gin.H{"kid": record.KeyID, "activates_at": req.ActivatesAt})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "SAML key activation scheduled successfully",
+		"data":    samlKeyInfo(record),
+	})
+}
+
+// ActivateSAMLKeyHandler 立即启用待启用密钥
+func ActivateSAMLKeyHandler(c *gin.Context) {
+	if !ensureSAMLKeysManaged(c) {
+		return
+	}
+
+	record, ok := findPendingSAMLKeyForUpdate(c)
+	if !ok {
+		return
+	}
+
+	if err := activateSAMLKey(record); err != nil {
+		logger.ErrorError("Failed to activate SAML key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to activate SAML key",
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := refreshSAMLKeys(); err != nil {
+		logger.ErrorError("Failed to switch SAML signing key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to switch SAML signing key",
+			"data":    nil,
+		})
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceSystem, record.ID,
+		"Activated SAML signing key", gin.H{"kid": record.KeyID})
+
+	database.DB.Where("id = ?", record.ID).First(record)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "SAML key activated successfully",
+		"data":    samlKeyInfo(record),
+	})
+}
+
+// DeleteSAMLKeyHandler 删除待启用或已退役的密钥
+func DeleteSAMLKeyHandler(c *gin.Context) {
+	if !ensureSAMLKeysManaged(c) {
+		return
+	}
+
+	var record models.SigningKey
+	if err := database.DB.Where("id = ? AND purpose = ?", c.Param("id"), models.SigningKeyPurposeSAML).First(&record).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "SAML key not found",
+			"data":    nil,
+		})
+		return
+	}
+	if record.Active {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "The active SAML key cannot be deleted",
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := database.DB.Delete(&record).Error; err != nil {
+		logger.ErrorError("Failed to delete SAML key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to delete SAML key",
+			"data":    nil,
+		})
+		return
+	}
+
+	if err := refreshSAMLKeys(); err != nil {
+		logger.ErrorWarn("Failed to refresh SAML keys", zap.Error(err))
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionDelete, utils.AuditResourceSystem, record.ID,
+		"Deleted SAML signing key", gin.H{"kid": record.KeyID})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "SAML key deleted successfully",
+		"data":    nil,
+	})
+}
+
+// findPendingSAMLKeyForUpdate 查找路径参数指定的待启用密钥，失败时已写入响应
+func findPendingSAMLKeyForUpdate(c *gin.Context) (*models.SigningKey, bool) {
+	var record models.SigningKey
+	if err := database.DB.Where("id = ? AND purpose = ?", c.Param("id"), models.SigningKeyPurposeSAML).First(&record).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "SAML key not found",
+			"data":    nil,
+		})
+		return nil, false
+	}
+	if record.Active || record.RetiredAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Only pending SAML keys can be scheduled or activated",
+			"data":    nil,
+		})
+		return nil, false
+	}
+	return &record, true
+}
@@ -1,11 +1,25 @@
 package handlers
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/xmlenc"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
 	"eiam-platform/internal/models"
 	"eiam-platform/pkg/database"
@@ -13,141 +27,359 @@ import (
 	"eiam-platform/pkg/utils"
 )
 
-// createSAMLResponseXML 创建SAML响应XML（简化版本）
-func createSAMLResponseXML(user *models.User, app *models.Application) (string, error) {
-	now := time.Now()
+// errSAMLRequestReplayed 同一AuthnRequest已签发过断言
+var errSAMLRequestReplayed = errors.New("SAML request has already been answered")
 
-	// 生成唯一ID
-	responseID := "_" + utils.GenerateTradeIDString("response")
-	assertionID := "_" + utils.GenerateTradeIDString("assertion")
+// samlSessionForUser 根据用户和平台会话构造SAML会话
+// 除crewjam默认属性外，保留此前版本下发的claims格式属性，兼容已接入的SP
+func samlSessionForUser(user *models.User, sessionID string, authTime time.Time) *saml.Session {
+	var roles []models.Role
+	if err := database.DB.Table("user_roles").
+		Select("roles.*").
+		Joins("JOIN roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ? AND roles.deleted_at IS NULL", user.ID).
+		Find(&roles).Error; err != nil {
+		logger.ErrorError("Failed to load user roles", zap.String("user_id", user.ID), zap.Error(err))
+	}
 
-	// 时间格式化
-	issueInstant := now.UTC().Format("2006-01-02T15:04:05Z")
-	notBefore := now.Add(-5 * time.Minute).UTC().Format("2006-01-02T15:04:05Z")
-	notOnOrAfter := now.Add(5 * time.Minute).UTC().Format("2006-01-02T15:04:05Z")
-	authnInstant := now.UTC().Format("2006-01-02T15:04:05Z")
+	roleCodes := make([]string, 0, len(roles))
+	roleNames := make([]string, 0, len(roles))
+	for _, role := range roles {
+		roleCodes = append(roleCodes, role.Code)
+		roleNames = append(roleNames, role.Name)
+	}
 
-	// 获取IdP信息
-	var issuerURL string
-	if samlIDP != nil {
-		issuerURL = samlIDP.IDP.MetadataURL.String()
-	} else {
-		issuerURL = "http://localhost:3000/saml/metadata"
+	attributes := []saml.Attribute{
+		samlClaimAttribute("http://schemas.xmlsoap.org/ws/2005/05/identity/claims/nameidentifier", user.Username),
+	}
+	email := releasableEmail(user)
+	if email != "" {
+		attributes = append(attributes, samlClaimAttribute("http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress", email))
+	}
+	if user.DisplayName != "" {
+		attributes = append(attributes, samlClaimAttribute("http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name", user.DisplayName))
+	}
+	if len(roleNames) > 0 {
+		attributes = append(attributes, samlClaimAttribute("http://schemas.microsoft.com/ws/2008/06/identity/claims/role", roleNames...))
 	}
 
-	// 获取用户角色
-	var userRoles []models.Role
-	var roleAttributes strings.Builder
-	if err := database.DB.Table("user_roles").
-		Select("roles.*").
-		Joins("JOIN roles ON user_roles.role_id = roles.id").
-		Where("user_roles.user_id = ?", user.ID).
-		Find(&userRoles).Error; err == nil {
+	return &saml.Session{
+		ID:               sessionID,
+		CreateTime:       authTime,
+		ExpireTime:       time.Now().Add(saml.DefaultValidDuration),
+		Index:            ssoSessionIndex(sessionID),
+		NameID:           user.Username,
+		NameIDFormat:     samlNameIDFormatUnspecified,
+		UserName:         user.Username,
+		UserEmail:        email,
+		UserCommonName:   user.DisplayName,
+		Groups:           roleCodes,
+		CustomAttributes: attributes,
+	}
+}
 
-		for _, role := range userRoles {
-			roleAttributes.WriteString(fmt.Sprintf(`
-			<saml:AttributeValue xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">%s</saml:AttributeValue>`, role.Name))
-		}
+// samlClaimAttribute 构造URI格式的字符串属性
+func samlClaimAttribute(name string, values ...string) saml.Attribute {
+	attribute := saml.Attribute{
+		Name:       name,
+		NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:uri",
+	}
+	for _, value := range values {
+		attribute.Values = append(attribute.Values, saml.AttributeValue{Type: "xs:string", Value: value})
 	}
+	return attribute
+}
 
-	// 构建属性语句
-	var attributeStatement string
-	if user.Email != "" || user.DisplayName != "" || roleAttributes.Len() > 0 {
-		attributeStatement = `
-		<saml:AttributeStatement>`
+// newIDPInitiatedSAMLRequest 为IdP发起的登录构造请求上下文
+func newIDPInitiatedSAMLRequest(r *http.Request, app *models.Application, relayState string) (*saml.IdpAuthnRequest, error) {
+	idp := currentSAMLIDP()
+	if idp == nil {
+		return nil, errors.New("SAML IdP not initialized")
+	}
 
-		// 邮箱属性
-		if user.Email != "" {
-			attributeStatement += fmt.Sprintf(`
-			<saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:uri">
-				<saml:AttributeValue xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">%s</saml:AttributeValue>
-			</saml:Attribute>`, user.Email)
-		}
+	metadata, err := buildSPEntityDescriptor(app)
+	if err != nil {
+		return nil, err
+	}
 
-		// 显示名称属性
-		if user.DisplayName != "" {
-			attributeStatement += fmt.Sprintf(`
-			<saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:uri">
-				<saml:AttributeValue xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">%s</saml:AttributeValue>
-			</saml:Attribute>`, user.DisplayName)
-		}
+	descriptor := &metadata.SPSSODescriptors[0]
+	return &saml.IdpAuthnRequest{
+		IDP:                     &idp.IDP,
+		HTTPRequest:             r,
+		RelayState:              relayState,
+		Now:                     saml.TimeNow(),
+		ServiceProviderMetadata: metadata,
+		SPSSODescriptor:         descriptor,
+		ACSEndpoint:             &descriptor.AssertionConsumerServices[0],
+	}, nil
+}
 
-		// 用户名属性
-		attributeStatement += fmt.Sprintf(`
-		<saml:Attribute Name="http://schemas.xmlsoap.org/ws/2005/05/identity/claims/nameidentifier" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:uri">
-			<saml:AttributeValue xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">%s</saml:AttributeValue>
-		</saml:Attribute>`, user.Username)
-
-		// 角色属性
-		if roleAttributes.Len() > 0 {
-			attributeStatement += fmt.Sprintf(`
-			<saml:Attribute Name="http://schemas.microsoft.com/ws/2008/06/identity/claims/role" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:uri">%s
-			</saml:Attribute>`, roleAttributes.String())
-		}
+// issueSAMLResponse 生成签名（配置SP证书时加密断言）的SAML Response，并记录断言
+func issueSAMLResponse(req *saml.IdpAuthnRequest, app *models.Application, user *models.User, session *saml.Session) (*saml.IdpAuthnRequestForm, error) {
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		return nil, fmt.Errorf("failed to make assertion: %w", err)
+	}
 
-		attributeStatement += `
-		</saml:AttributeStatement>`
-	}
-
-	// 构建完整的SAML响应XML
-	samlResponseXML := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" 
-				xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" 
-				ID="%s" 
-				Version="2.0" 
-				IssueInstant="%s" 
-				Destination="%s">
-	<saml:Issuer>%s</saml:Issuer>
-	<samlp:Status>
-		<samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/>
-	</samlp:Status>
-	<saml:Assertion xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" 
-					xmlns:xs="http://www.w3.org/2001/XMLSchema" 
-					ID="%s" 
-					Version="2.0" 
-					IssueInstant="%s">
-		<saml:Issuer>%s</saml:Issuer>
-		<saml:Subject>
-			<saml:NameID Format="urn:oasis:names:tc:SAML:2.0:nameid-format:persistent">%s</saml:NameID>
-			<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
-				<saml:SubjectConfirmationData NotOnOrAfter="%s" Recipient="%s"/>
-			</saml:SubjectConfirmation>
-		</saml:Subject>
-		<saml:Conditions NotBefore="%s" NotOnOrAfter="%s">
-			<saml:AudienceRestriction>
-				<saml:Audience>%s</saml:Audience>
-			</saml:AudienceRestriction>
-		</saml:Conditions>
-		<saml:AuthnStatement AuthnInstant="%s">
-			<saml:AuthnContext>
-				<saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef>
-			</saml:AuthnContext>
-		</saml:AuthnStatement>%s
-	</saml:Assertion>
-</samlp:Response>`,
-		responseID,         // Response ID
-		issueInstant,       // Response IssueInstant
-		app.AcsURL,         // Destination
-		issuerURL,          // Response Issuer
-		assertionID,        // Assertion ID
-		issueInstant,       // Assertion IssueInstant
-		issuerURL,          // Assertion Issuer
-		user.Username,      // NameID
-		notOnOrAfter,       // SubjectConfirmationData NotOnOrAfter
-		app.AcsURL,         // SubjectConfirmationData Recipient
-		notBefore,          // Conditions NotBefore
-		notOnOrAfter,       // Conditions NotOnOrAfter
-		app.EntityID,       // Audience
-		authnInstant,       // AuthnStatement AuthnInstant
-		attributeStatement, // AttributeStatement
-	)
+	encrypted, err := buildSAMLResponseElement(req, app)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordSAMLAssertion(req, app, user, session, encrypted); err != nil {
+		return nil, err
+	}
+
+	form, err := req.PostBinding()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SAML response: %w", err)
+	}
 
-	logger.Info("SAML response XML created",
-		zap.String("response_id", responseID),
-		zap.String("assertion_id", assertionID),
+	logger.Info("SAML response issued",
+		zap.String("assertion_id", req.Assertion.ID),
+		zap.String("in_response_to", req.Request.ID),
 		zap.String("username", user.Username),
 		zap.String("audience", app.EntityID),
+		zap.Bool("encrypted", encrypted),
 	)
+	return &form, nil
+}
+
+// buildSAMLResponseElement 签名断言，按需加密后放入签名的Response中
+func buildSAMLResponseElement(req *saml.IdpAuthnRequest, app *models.Application) (bool, error) {
+	signatureHash, digestHash, err := resolveSAMLSigningHashes(app)
+	if err != nil {
+		return false, err
+	}
+
+	key, ok := req.IDP.Key.(*rsa.PrivateKey)
+	if !ok {
+		return false, errors.New("SAML IdP key is not an RSA key")
+	}
+
+	assertionSig, err := signSAMLElement(req.Assertion.Element(), key, req.IDP.Certificate, signatureHash, digestHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to sign assertion: %w", err)
+	}
+	req.Assertion.Signature = assertionSig
+	assertionEl := req.Assertion.Element()
+
+	encrypted := false
+	if app.Certificate != "" {
+		assertionEl, err = encryptSAMLAssertion(assertionEl, app.Certificate)
+		if err != nil {
+			return false, fmt.Errorf("failed to encrypt assertion: %w", err)
+		}
+		encrypted = true
+	}
+	req.AssertionEl = assertionEl
+
+	responseID, err := utils.GenerateRandomString(40)
+	if err != nil {
+		return false, err
+	}
+	response := &saml.Response{
+		Destination:  req.ACSEndpoint.Location,
+		ID:           "id-" + responseID,
+		InResponseTo: req.Request.ID,
+		IssueInstant: req.Now,
+		Version:      "2.0",
+		Issuer: &saml.Issuer{
+			Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+			Value:  req.IDP.MetadataURL.String(),
+		},
+		Status: saml.Status{
+			StatusCode: saml.StatusCode{Value: saml.StatusSuccess},
+		},
+	}
+
+	responseEl := response.Element()
+	responseEl.AddChild(assertionEl)
+	responseSig, err := signSAMLElement(responseEl, key, req.IDP.Certificate, signatureHash, digestHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to sign response: %w", err)
+	}
+	response.Signature = responseSig
+	responseEl = response.Element()
+	responseEl.AddChild(assertionEl)
+
+	req.ResponseEl = responseEl
+	return encrypted, nil
+}
 
-	return samlResponseXML, nil
+// resolveSAMLSigningHashes 解析应用配置的签名和摘要算法，未配置时使用SHA-256
+// 支持sha256等简写及XML-DSig算法URI
+func resolveSAMLSigningHashes(app *models.Application) (crypto.Hash, crypto.Hash, error) {
+	signatureHash, err := parseSAMLHashAlgorithm(app.SignatureAlgorithm)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid signature algorithm: %w", err)
+	}
+	digestHash, err := parseSAMLHashAlgorithm(app.DigestAlgorithm)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid digest algorithm: %w", err)
+	}
+	return signatureHash, digestHash, nil
+}
+
+// parseSAMLHashAlgorithm 将算法名称映射为哈希算法
+func parseSAMLHashAlgorithm(name string) (crypto.Hash, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case name == "":
+		return crypto.SHA256, nil
+	case strings.HasSuffix(name, "sha512"):
+		return crypto.SHA512, nil
+	case strings.HasSuffix(name, "sha384"):
+		return crypto.SHA384, nil
+	case strings.HasSuffix(name, "sha256"):
+		return crypto.SHA256, nil
+	case strings.HasSuffix(name, "sha1"):
+		return crypto.SHA1, nil
+	}
+	return 0, fmt.Errorf("unsupported algorithm %q", name)
+}
+
+// signSAMLElement 生成元素的enveloped签名，签名算法和摘要算法可分别指定
+func signSAMLElement(el *etree.Element, key *rsa.PrivateKey, cert *x509.Certificate, signatureHash, digestHash crypto.Hash) (*etree.Element, error) {
+	ctx, err := dsig.NewSigningContext(key, [][]byte{cert.Raw})
+	if err != nil {
+		return nil, err
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	// goxmldsig使用同一哈希计算摘要和签名，先按摘要算法生成签名元素
+	ctx.Hash = digestHash
+	sig, err := ctx.ConstructSignature(el, true)
+	if err != nil {
+		return nil, err
+	}
+	if signatureHash == digestHash {
+		return sig, nil
+	}
+
+	// 算法不同时替换SignatureMethod并按签名算法重新签名SignedInfo
+	ctx.Hash = signatureHash
+	signatureMethodID := ctx.GetSignatureMethodIdentifier()
+	if signatureMethodID == "" {
+		return nil, errors.New("unsupported signature method")
+	}
+
+	signedInfo := sig.SelectElement("SignedInfo")
+	signatureValue := sig.SelectElement("SignatureValue")
+	if signedInfo == nil || signatureValue == nil || signedInfo.SelectElement("SignatureMethod") == nil {
+		return nil, errors.New("malformed signature element")
+	}
+	signedInfo.SelectElement("SignatureMethod").CreateAttr("Algorithm", signatureMethodID)
+
+	rootNSCtx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, err
+	}
+	elNSCtx, err := rootNSCtx.SubContext(el)
+	if err != nil {
+		return nil, err
+	}
+	sigNSCtx, err := elNSCtx.SubContext(sig)
+	if err != nil {
+		return nil, err
+	}
+	detachedSignedInfo, err := etreeutils.NSDetatch(sigNSCtx, signedInfo)
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := ctx.Canonicalizer.Canonicalize(detachedSignedInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := signatureHash.New()
+	hash.Write(canonical)
+	rawSignature, err := rsa.SignPKCS1v15(rand.Reader, key, signatureHash, hash.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	signatureValue.SetText(base64.StdEncoding.EncodeToString(rawSignature))
+	return sig, nil
+}
+
+// encryptSAMLAssertion 使用SP证书加密已签名的断言
+func encryptSAMLAssertion(assertionEl *etree.Element, certificate string) (*etree.Element, error) {
+	certData, err := normalizeSPCertificate(certificate)
+	if err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(certData)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(assertionEl.Copy())
+	plaintext, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	encryptor := xmlenc.OAEP()
+	encryptor.BlockCipher = xmlenc.AES256CBC
+	encryptor.DigestMethod = &xmlenc.SHA1
+	encryptedDataEl, err := encryptor.Encrypt(cert, plaintext, nil)
+	if err != nil {
+		return nil, err
+	}
+	encryptedDataEl.CreateAttr("Type", "http://www.w3.org/2001/04/xmlenc#Element")
+
+	encryptedAssertionEl := etree.NewElement("saml:EncryptedAssertion")
+	encryptedAssertionEl.AddChild(encryptedDataEl)
+	return encryptedAssertionEl, nil
+}
+
+// recordSAMLAssertion 持久化已签发的断言，用于防重放和审计
+func recordSAMLAssertion(req *saml.IdpAuthnRequest, app *models.Application, user *models.User, session *saml.Session, encrypted bool) error {
+	attributes := map[string][]string{}
+	for _, statement := range req.Assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			for _, value := range attribute.Values {
+				attributes[attribute.Name] = append(attributes[attribute.Name], value.Value)
+			}
+		}
+	}
+	attributesJSON, _ := json.Marshal(attributes)
+
+	expiresAt := req.Now.Add(saml.MaxIssueDelay)
+	if req.Assertion.Conditions != nil {
+		expiresAt = req.Assertion.Conditions.NotOnOrAfter
+	}
+
+	// IdP发起时没有请求ID，存为NULL不参与唯一约束
+	var inResponseTo *string
+	if req.Request.ID != "" {
+		inResponseTo = &req.Request.ID
+	}
+
+	record := models.SAMLAssertion{
+		AssertionID:  req.Assertion.ID,
+		InResponseTo: inResponseTo,
+		UserID:       user.ID,
+		ClientID:     app.ClientID,
+		Recipient:    req.ACSEndpoint.Location,
+		Audience:     req.ServiceProviderMetadata.EntityID,
+		NameID:       session.NameID,
+		NameIDFormat: session.NameIDFormat,
+		SessionIndex: session.Index,
+		Attributes:   string(attributesJSON),
+		Encrypted:    encrypted,
+		ExpiresAt:    expiresAt,
+	}
+	// 同一个AuthnRequest只能换取一次断言，由(client_id, in_response_to)唯一索引保证，并发重放时只有一个插入成功
+	if err := database.DB.Create(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errSAMLRequestReplayed
+		}
+		return fmt.Errorf("failed to record SAML assertion: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/utils"
+)
+
+const (
+	// samlNameIDFormatUnspecified 默认NameID格式，值为用户名
+	samlNameIDFormatUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	// samlMetadataFetchTimeout 拉取SP元数据的超时时间
+	samlMetadataFetchTimeout = 10 * time.Second
+	// samlMetadataMaxSize SP元数据最大字节数
+	samlMetadataMaxSize = 1 << 20
+)
+
+// samlApplicationProtocols SAML应用的协议标识，控制台使用saml，模型注释中为saml2
+var samlApplicationProtocols = []string{"saml", "saml2"}
+
+// applicationServiceProviderProvider 从应用配置中解析SAML SP元数据
+type applicationServiceProviderProvider struct{}
+
+// GetServiceProvider 根据SP EntityID查找启用的SAML应用，未找到时返回os.ErrNotExist
+func (applicationServiceProviderProvider) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	app, err := findSAMLApplication(serviceProviderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	return buildSPEntityDescriptor(app)
+}
+
+// findSAMLApplication 根据EntityID查找启用的SAML应用
+func findSAMLApplication(entityID string) (*models.Application, error) {
+	if entityID == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var app models.Application
+	if err := database.DB.Where("entity_id = ? AND protocol IN ? AND status = ?",
+		entityID, samlApplicationProtocols, models.StatusActive).First(&app).Error; err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// buildSPEntityDescriptor 将应用的SAML配置转换为SP元数据
+func buildSPEntityDescriptor(app *models.Application) (*saml.EntityDescriptor, error) {
+	if app.AcsURL == "" {
+		return nil, fmt.Errorf("application %s has no ACS URL configured", app.ID)
+	}
+
+	descriptor := saml.SPSSODescriptor{
+		SSODescriptor: saml.SSODescriptor{
+			RoleDescriptor: saml.RoleDescriptor{
+				ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+			},
+		},
+		AssertionConsumerServices: []saml.IndexedEndpoint{
+			{Binding: saml.HTTPPostBinding, Location: app.AcsURL, Index: 1},
+		},
+	}
+
+	if app.SloURL != "" {
+		descriptor.SingleLogoutServices = []saml.Endpoint{
+			{Binding: saml.HTTPRedirectBinding, Location: app.SloURL},
+			{Binding: saml.HTTPPostBinding, Location: app.SloURL},
+		}
+	}
+
+	if app.Certificate != "" {
+		certData, err := normalizeSPCertificate(app.Certificate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate for application %s: %w", app.ID, err)
+		}
+		descriptor.KeyDescriptors = []saml.KeyDescriptor{
+			{
+				KeyInfo: saml.KeyInfo{
+					X509Data: saml.X509Data{
+						X509Certificates: []saml.X509Certificate{{Data: certData}},
+					},
+				},
+			},
+		}
+	}
+
+	return &saml.EntityDescriptor{
+		EntityID:         app.EntityID,
+		SPSSODescriptors: []saml.SPSSODescriptor{descriptor},
+	}, nil
+}
+
+// normalizeSPCertificate 将PEM或纯Base64格式的证书转换为元数据中使用的Base64 DER
+func normalizeSPCertificate(certificate string) (string, error) {
+	data := strings.TrimSpace(certificate)
+	if block, _ := pem.Decode([]byte(data)); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return "", errors.New("PEM block is not a certificate")
+		}
+		return base64.StdEncoding.EncodeToString(block.Bytes), nil
+	}
+
+	data = strings.Join(strings.Fields(data), "")
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+		return "", errors.New("certificate is neither PEM nor base64")
+	}
+	return data, nil
+}
+
+// platformSessionProvider 通过平台会话(cas_session Cookie或Bearer Token)识别SAML登录用户
+type platformSessionProvider struct{}
+
+// GetSession 返回当前用户的SAML会话；未登录时跳转到统一登录页并返回nil
+func (platformSessionProvider) GetSession(w http.ResponseWriter, r *http.Request, req *saml.IdpAuthnRequest) *saml.Session {
+	user, sessionID, authTime, ok := samlSessionFromRequest(r)
+	if !ok {
+		loginURL := "/cas/login?service=" + url.QueryEscape(samlLoginReturnURL(r, req))
+		http.Redirect(w, r, loginURL, http.StatusFound)
+		return nil
+	}
+
+	return samlSessionForUser(user, sessionID, authTime)
+}
+
+// samlSessionFromRequest 从HTTP请求识别平台会话，返回用户、会话ID和认证时间
+func samlSessionFromRequest(r *http.Request) (*models.User, string, time.Time, bool) {
+	authHeader := r.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		cfg := config.GetConfig()
+		jwtManager := utils.NewJWTManager(&cfg.JWT)
+		// 代登录令牌不能用于登录应用
+		if claims, err := jwtManager.ValidateAccessToken(token); err == nil && claims.SessionID != "" && claims.Act == nil {
+			// AuthnInstant取登录时间而不是令牌签发时间，刷新令牌不会改变它
+			var user models.User
+			authTime := tokenAuthTime(claims)
+			if authTime != nil && database.DB.Where("id = ? AND status = ?", claims.UserID, models.StatusActive).First(&user).Error == nil {
+				return &user, claims.SessionID, *authTime, true
+			}
+		}
+	}
+
+	cookie, err := r.Cookie("cas_session")
+	if err != nil || cookie.Value == "" {
+		return nil, "", time.Time{}, false
+	}
+
+	sessionInfo, err := GetSessionManager().GetSession(r.Context(), cookie.Value)
+	if err != nil {
+		return nil, "", time.Time{}, false
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ? AND status = ?", sessionInfo.UserID, models.StatusActive).First(&user).Error; err != nil {
+		return nil, "", time.Time{}, false
+	}
+	return &user, sessionInfo.SessionID, sessionInfo.LoginTime, true
+}
+
+// ssoSessionIndex 由平台会话ID派生SessionIndex，避免向SP暴露会话Cookie
+func ssoSessionIndex(sessionID string) string {
+	sum := sha256.Sum256([]byte("saml-session-index:" + sessionID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// samlLoginReturnURL 构造登录完成后返回的SSO地址
+// SP发起的请求统一转换为HTTP-Redirect绑定，保证POST绑定的请求登录后也能继续
+func samlLoginReturnURL(r *http.Request, req *saml.IdpAuthnRequest) string {
+	if req == nil || len(req.RequestBuffer) == 0 {
+		return samlBaseURL.ResolveReference(&url.URL{Path: r.URL.Path, RawQuery: r.URL.RawQuery}).String()
+	}
+
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err == nil {
+		_, err = writer.Write(req.RequestBuffer)
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return req.IDP.SSOURL.String()
+	}
+
+	query := url.Values{}
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if req.RelayState != "" {
+		query.Set("RelayState", req.RelayState)
+	}
+	ssoURL := req.IDP.SSOURL
+	ssoURL.RawQuery = query.Encode()
+	return ssoURL.String()
+}
+
+// ImportSAMLMetadataHandler 从SP元数据URL或XML导入SAML应用配置
+// 指定application_id时更新已有应用，否则创建新的SAML应用
+func ImportSAMLMetadataHandler(c *gin.Context) {
+	var req struct {
+		URL           string `json:"url"`
+		XML           string `json:"xml"`
+		ApplicationID string `json:"application_id"`
+		Name          string `json:"name"`
+		GroupID       string `json:"group_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || (req.URL == "") == (req.XML == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Either url or xml must be provided",
+			"data":    nil,
+		})
+		return
+	}
+
+	data := []byte(req.XML)
+	if req.URL != "" {
+		fetched, err := fetchSAMLMetadata(req.URL)
+		if err != nil {
+			logger.ErrorWarn("Failed to fetch SP metadata", zap.String("url", req.URL), zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Failed to fetch metadata: " + err.Error(),
+				"data":    nil,
+			})
+			return
+		}
+		data = fetched
+	}
+
+	entity, err := parseSPMetadata(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid SP metadata: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	imported, err := spConfigFromMetadata(entity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid SP metadata: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	// EntityID不能被其他应用占用
+	var conflict models.Application
+	query := database.DB.Where("entity_id = ? AND protocol IN ?", imported.EntityID, samlApplicationProtocols)
+	if req.ApplicationID != "" {
+		query = query.Where("id <> ?", req.ApplicationID)
+	}
+	if err := query.First(&conflict).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": "Entity ID is already used by application " + conflict.Name,
+			"data":    nil,
+		})
+		return
+	}
+
+	var application models.Application
+	auditAction := utils.AuditActionCreate
+	if req.ApplicationID != "" {
+		auditAction = utils.AuditActionUpdate
+		if err := database.DB.Where("id = ?", req.ApplicationID).First(&application).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": "Application not found",
+				"data":    nil,
+			})
+			return
+		}
+		if !containsString(samlApplicationProtocols, application.Protocol) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Application is not a SAML application",
+				"data":    nil,
+			})
+			return
+		}
+
+		application.EntityID = imported.EntityID
+		application.AcsURL = imported.AcsURL
+		application.SloURL = imported.SloURL
+		application.Certificate = imported.Certificate
+		if err := database.DB.Model(&application).Updates(map[string]interface{}{
+			"entity_id":   application.EntityID,
+			"acs_url":     application.AcsURL,
+			"slo_url":     application.SloURL,
+			"certificate": application.Certificate,
+		}).Error; err != nil {
+			logger.ErrorError("Failed to update application from SP metadata", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to update application",
+				"data":    nil,
+			})
+			return
+		}
+	} else {
+		if req.GroupID != "" {
+			var group models.ApplicationGroup
+			if err := database.DB.Where("id = ?", req.GroupID).First(&group).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code":    400,
+					"message": "Application group not found",
+					"data":    nil,
+				})
+				return
+			}
+		}
+
+		name := req.Name
+		if name == "" {
+			name = imported.EntityID
+		}
+		application = models.Application{
+			BaseModel:    models.BaseModel{ID: utils.GenerateTradeIDString("app")},
+			Name:         name,
+			Code:         utils.GenerateTradeIDString("app"),
+			ClientID:     utils.GenerateTradeIDString("client"),
+			ClientSecret: utils.GenerateTradeIDString("secret"),
+			Status:       models.StatusActive,
+			Protocol:     "saml",
+			AppType:      "web",
+			EntityID:     imported.EntityID,
+			AcsURL:       imported.AcsURL,
+			SloURL:       imported.SloURL,
+			Certificate:  imported.Certificate,
+		}
+		if req.GroupID != "" {
+			application.GroupID = &req.GroupID
+		}
+		if err := database.DB.Create(&application).Error; err != nil {
+			logger.ErrorError("Failed to create application from SP metadata", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to create application",
+				"data":    nil,
+			})
+			return
+		}
+	}
+
+	utils.CreateAuditLog(c, auditAction, utils.AuditResourceApplication, application.ID,
+		"Imported SAML SP metadata",
+		map[string]interface{}{
+			"application_id": application.ID,
+			"entity_id":      application.EntityID,
+			"acs_url":        application.AcsURL,
+			"source_url":     req.URL,
+		})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "SP metadata imported successfully",
+		"data":    application,
+	})
+}
+
+// fetchSAMLMetadata 拉取SP元数据，限制协议、超时和大小
+func fetchSAMLMetadata(metadataURL string) ([]byte, error) {
+	u, err := url.Parse(metadataURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("metadata URL must be an absolute http(s) URL")
+	}
+
+	client := &http.Client{Timeout: samlMetadataFetchTimeout}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, samlMetadataMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > samlMetadataMaxSize {
+		return nil, errors.New("metadata is too large")
+	}
+	return data, nil
+}
+
+// parseSPMetadata 解析SP元数据，支持EntityDescriptor和EntitiesDescriptor
+func parseSPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	err := xml.Unmarshal(data, &entity)
+	if err == nil {
+		if len(entity.SPSSODescriptors) == 0 {
+			return nil, errors.New("no SPSSODescriptor found")
+		}
+		return &entity, nil
+	}
+
+	var entities saml.EntitiesDescriptor
+	if xml.Unmarshal(data, &entities) != nil {
+		return nil, err
+	}
+	for i := range entities.EntityDescriptors {
+		if len(entities.EntityDescriptors[i].SPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, errors.New("no entity found with SPSSODescriptor")
+}
+
+// importedSPConfig 从SP元数据提取的应用配置
+type importedSPConfig struct {
+	EntityID    string
+	AcsURL      string
+	SloURL      string
+	Certificate string
+}
+
+// spConfigFromMetadata 提取EntityID、HTTP-POST ACS、SLO地址和证书
+func spConfigFromMetadata(entity *saml.EntityDescriptor) (*importedSPConfig, error) {
+	if entity.EntityID == "" {
+		return nil, errors.New("entityID is required")
+	}
+
+	imported := &importedSPConfig{EntityID: entity.EntityID}
+	for _, descriptor := range entity.SPSSODescriptors {
+		for _, acs := range descriptor.AssertionConsumerServices {
+			if acs.Binding != saml.HTTPPostBinding {
+				continue
+			}
+			if imported.AcsURL == "" || (acs.IsDefault != nil && *acs.IsDefault) {
+				imported.AcsURL = acs.Location
+			}
+		}
+
+		for _, slo := range descriptor.SingleLogoutServices {
+			if imported.SloURL == "" || slo.Binding == saml.HTTPRedirectBinding {
+				imported.SloURL = slo.Location
+			}
+		}
+
+		for _, keyDescriptor := range descriptor.KeyDescriptors {
+			certs := keyDescriptor.KeyInfo.X509Data.X509Certificates
+			if len(certs) == 0 || certs[0].Data == "" {
+				continue
+			}
+			// 优先使用加密证书，其次使用未声明用途的证书
+			if imported.Certificate != "" && keyDescriptor.Use != "encryption" {
+				continue
+			}
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(certs[0].Data), ""))
+			if err != nil {
+				return nil, errors.New("invalid X509Certificate")
+			}
+			imported.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+		}
+	}
+
+	if imported.AcsURL == "" {
+		return nil, errors.New("no HTTP-POST AssertionConsumerService found")
+	}
+	return imported, nil
+}
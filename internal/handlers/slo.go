@@ -0,0 +1,751 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	dsig "github.com/russellhaering/goxmldsig"
+	"go.uber.org/zap"
+
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/utils"
+)
+
+// 单点注销参与方协议及通知状态
+const (
+	sloProtocolSAML = "saml"
+	sloProtocolCAS  = "cas"
+
+	sloStatusSuccess = "success"
+	sloStatusFailed  = "failed"
+	sloStatusPending = "pending"
+)
+
+const (
+	// sloBackChannelTimeout 后端通道注销请求超时时间
+	sloBackChannelTimeout = 5 * time.Second
+	// sloStateTTL 前端通道注销跳转链状态有效期
+	sloStateTTL = 10 * time.Minute
+	// sloStateKeyPrefix 前端通道注销状态的Redis键前缀
+	sloStateKeyPrefix = "slo:state:"
+	// samlMessageMaxSize 入站SAML消息解压后的最大字节数
+	samlMessageMaxSize = 1 << 20
+)
+
+// sloParticipant 会话中需要通知注销的应用
+type sloParticipant struct {
+	Protocol        string `json:"protocol"`
+	ApplicationID   string `json:"application_id"`
+	ApplicationName string `json:"application_name"`
+	ClientID        string `json:"-"`
+	Endpoint        string `json:"-"`
+	NameID          string `json:"-"`
+	NameIDFormat    string `json:"-"`
+	SessionIndex    string `json:"-"` // SAML为会话索引，CAS为服务票据
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+}
+
+// sloResult 单点注销结果，存在未成功通知的应用时为部分注销
+type sloResult struct {
+	Partial      bool             `json:"partial"`
+	Participants []sloParticipant `json:"participants"`
+}
+
+// sloInitiator SP发起注销时需要回复LogoutResponse的应用
+type sloInitiator struct {
+	ApplicationID string `json:"application_id"`
+	RequestID     string `json:"request_id"`
+	Endpoint      string `json:"endpoint"`
+	RelayState    string `json:"relay_state"`
+}
+
+// sloState 前端通道注销跳转链状态
+type sloState struct {
+	ID               string        `json:"id"`
+	Result           sloResult     `json:"result"`
+	Current          int           `json:"current"`
+	PendingRequestID string        `json:"pending_request_id"`
+	ReturnURL        string        `json:"return_url"`
+	Initiator        *sloInitiator `json:"initiator"`
+}
+
+// collectSLOParticipants 根据会话索引收集签发过SAML断言或CAS票据的应用
+// 只通知配置了注销地址的已注册应用
+func collectSLOParticipants(sessionID, excludeApplicationID string) []sloParticipant {
+	participants := []sloParticipant{}
+	if sessionID == "" {
+		return participants
+	}
+	sessionIndex := ssoSessionIndex(sessionID)
+
+	var assertions []models.SAMLAssertion
+	if err := database.DB.Where("session_index = ?", sessionIndex).
+		Order("created_at DESC").Find(&assertions).Error; err != nil {
+		logger.ErrorError("Failed to load SAML assertions for logout", zap.Error(err))
+	}
+	seen := map[string]bool{}
+	for _, assertion := range assertions {
+		if seen[assertion.ClientID] {
+			continue
+		}
+		seen[assertion.ClientID] = true
+
+		var app models.Application
+		if err := database.DB.Where("client_id = ? AND protocol IN ? AND slo_url <> ''",
+			assertion.ClientID, samlApplicationProtocols).First(&app).Error; err != nil {
+			continue
+		}
+		if app.ID == excludeApplicationID {
+			continue
+		}
+		participants = append(participants, sloParticipant{
+			Protocol:        sloProtocolSAML,
+			ApplicationID:   app.ID,
+			ApplicationName: app.Name,
+			ClientID:        app.ClientID,
+			Endpoint:        app.SloURL,
+			NameID:          assertion.NameID,
+			NameIDFormat:    assertion.NameIDFormat,
+			SessionIndex:    assertion.SessionIndex,
+		})
+	}
+
+	var tickets []CASServiceTicket
+	if err := database.DB.Where("session_index = ?", sessionIndex).Find(&tickets).Error; err != nil {
+		logger.ErrorError("Failed to load CAS tickets for logout", zap.Error(err))
+	}
+	for _, ticket := range tickets {
+		var app models.Application
+		if err := database.DB.Where("service_url = ? AND protocol = ?", ticket.Service, "cas").First(&app).Error; err != nil {
+			continue
+		}
+		if app.ID == excludeApplicationID {
+			continue
+		}
+		endpoint := app.LogoutURI
+		if endpoint == "" {
+			endpoint = app.ServiceURL
+		}
+		participants = append(participants, sloParticipant{
+			Protocol:        sloProtocolCAS,
+			ApplicationID:   app.ID,
+			ApplicationName: app.Name,
+			ClientID:        app.ClientID,
+			Endpoint:        endpoint,
+			NameID:          ticket.Username,
+			SessionIndex:    ticket.Ticket,
+		})
+	}
+
+	return participants
+}
+
+// notifyLogoutParticipants 通过后端通道并发通知会话中的所有应用
+func notifyLogoutParticipants(sessionID, excludeApplicationID string) *sloResult {
+	result := &sloResult{Participants: collectSLOParticipants(sessionID, excludeApplicationID)}
+	revokeSessionCASTickets(sessionID)
+
+	var wg sync.WaitGroup
+	for i := range result.Participants {
+		wg.Add(1)
+		go func(p *sloParticipant) {
+			defer wg.Done()
+			if err := sendBackChannelLogout(p); err != nil {
+				p.Status = sloStatusFailed
+				p.Error = err.Error()
+				return
+			}
+			p.Status = sloStatusSuccess
+		}(&result.Participants[i])
+	}
+	wg.Wait()
+
+	result.updatePartial()
+	for _, p := range result.Participants {
+		logger.Info("Single logout notification",
+			zap.String("protocol", p.Protocol),
+			zap.String("application_id", p.ApplicationID),
+			zap.String("status", p.Status),
+			zap.String("error", p.Error),
+		)
+	}
+	return result
+}
+
+// updatePartial 更新是否为部分注销
+func (r *sloResult) updatePartial() {
+	r.Partial = false
+	for _, p := range r.Participants {
+		if p.Status != sloStatusSuccess {
+			r.Partial = true
+			return
+		}
+	}
+}
+
+// sendBackChannelLogout 发送后端通道注销请求：SAML使用SOAP绑定，CAS使用logoutRequest表单
+func sendBackChannelLogout(p *sloParticipant) error {
+	client := &http.Client{Timeout: sloBackChannelTimeout}
+
+	switch p.Protocol {
+	case sloProtocolSAML:
+		requestEl, _, err := buildSAMLLogoutRequest(p, true)
+		if err != nil {
+			return err
+		}
+		envelope := etree.NewElement("soap:Envelope")
+		envelope.CreateAttr("xmlns:soap", "http://schemas.xmlsoap.org/soap/envelope/")
+		envelope.CreateElement("soap:Body").AddChild(requestEl)
+		doc := etree.NewDocument()
+		doc.SetRoot(envelope)
+		body, err := doc.WriteToBytes()
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, p.Endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+		req.Header.Set("SOAPAction", "http://www.oasis-open.org/committees/security")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+
+		respDoc := etree.NewDocument()
+		if _, err := respDoc.ReadFrom(io.LimitReader(resp.Body, samlMessageMaxSize)); err != nil {
+			return fmt.Errorf("invalid SOAP response: %w", err)
+		}
+		statusCode := respDoc.FindElement("//LogoutResponse/Status/StatusCode")
+		if statusCode == nil {
+			return errors.New("SOAP response does not contain a LogoutResponse")
+		}
+		if value := statusCode.SelectAttrValue("Value", ""); value != saml.StatusSuccess {
+			return fmt.Errorf("logout status %s", value)
+		}
+		return nil
+
+	case sloProtocolCAS:
+		requestEl, _, err := buildSAMLLogoutRequest(p, false)
+		if err != nil {
+			return err
+		}
+		doc := etree.NewDocument()
+		doc.SetRoot(requestEl)
+		logoutRequest, err := doc.WriteToString()
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.PostForm(p.Endpoint, url.Values{"logoutRequest": {logoutRequest}})
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported protocol %s", p.Protocol)
+}
+
+// buildSAMLLogoutRequest 构造LogoutRequest，sign为true时附加enveloped签名
+func buildSAMLLogoutRequest(p *sloParticipant, sign bool) (*etree.Element, string, error) {
+	idp := currentSAMLIDP()
+	if idp == nil {
+		return nil, "", errors.New("SAML IdP not initialized")
+	}
+	requestID, err := utils.GenerateRandomString(40)
+	if err != nil {
+		return nil, "", err
+	}
+
+	request := &saml.LogoutRequest{
+		ID:           "id-" + requestID,
+		Version:      "2.0",
+		IssueInstant: saml.TimeNow(),
+		NameID:       &saml.NameID{Format: p.NameIDFormat, Value: p.NameID},
+		SessionIndex: &saml.SessionIndex{Value: p.SessionIndex},
+	}
+	if p.Protocol == sloProtocolSAML {
+		request.Destination = p.Endpoint
+		request.Issuer = &saml.Issuer{
+			Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+			Value:  idp.IDP.MetadataURL.String(),
+		}
+	}
+
+	if sign {
+		signatureHash, digestHash, key, cert, err := sloSigningParams(p.ApplicationID)
+		if err != nil {
+			return nil, "", err
+		}
+		sig, err := signSAMLElement(request.Element(), key, cert, signatureHash, digestHash)
+		if err != nil {
+			return nil, "", err
+		}
+		request.Signature = sig
+	}
+	return request.Element(), request.ID, nil
+}
+
+// sloSigningParams 获取签名注销消息使用的算法和IdP密钥
+func sloSigningParams(applicationID string) (crypto.Hash, crypto.Hash, *rsa.PrivateKey, *x509.Certificate, error) {
+	idp := currentSAMLIDP()
+	if idp == nil {
+		return 0, 0, nil, nil, errors.New("SAML IdP not initialized")
+	}
+	key, ok := idp.IDP.Key.(*rsa.PrivateKey)
+	if !ok {
+		return 0, 0, nil, nil, errors.New("SAML IdP key is not an RSA key")
+	}
+
+	app := &models.Application{}
+	if applicationID != "" {
+		if err := database.DB.Where("id = ?", applicationID).First(app).Error; err != nil {
+			return 0, 0, nil, nil, err
+		}
+	}
+	signatureHash, digestHash, err := resolveSAMLSigningHashes(app)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	return signatureHash, digestHash, key, idp.IDP.Certificate, nil
+}
+
+// samlRedirectBindingURL 构造签名的HTTP-Redirect绑定地址
+func samlRedirectBindingURL(endpoint, param string, message *etree.Element, relayState, applicationID string) (string, error) {
+	doc := etree.NewDocument()
+	doc.SetRoot(message)
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write(raw); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	signatureHash, _, key, _, err := sloSigningParams(applicationID)
+	if err != nil {
+		return "", err
+	}
+	ctx, err := dsig.NewSigningContext(key, nil)
+	if err != nil {
+		return "", err
+	}
+	ctx.Hash = signatureHash
+	sigAlg := ctx.GetSignatureMethodIdentifier()
+
+	// 签名内容为按顺序拼接的URL编码参数
+	signedQuery := param + "=" + url.QueryEscape(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		signedQuery += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	signedQuery += "&SigAlg=" + url.QueryEscape(sigAlg)
+
+	hash := signatureHash.New()
+	hash.Write([]byte(signedQuery))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, signatureHash, hash.Sum(nil))
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	query := signedQuery + "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature))
+	if u.RawQuery != "" {
+		query = u.RawQuery + "&" + query
+	}
+	u.RawQuery = query
+	return u.String(), nil
+}
+
+// startBrowserLogout 结束浏览器会话：先通过后端通道通知所有应用，
+// 后端通道失败的SAML应用再通过前端通道跳转链逐个注销
+func startBrowserLogout(c *gin.Context, sessionID, returnURL string, initiator *sloInitiator) {
+	result := &sloResult{Participants: []sloParticipant{}}
+	if sessionID != "" {
+		excludeApplicationID := ""
+		if initiator != nil {
+			excludeApplicationID = initiator.ApplicationID
+		}
+		result = notifyLogoutParticipants(sessionID, excludeApplicationID)
+
+		if sessionManager := GetSessionManager(); sessionManager != nil {
+			if err := sessionManager.DeleteSession(c.Request.Context(), sessionID); err != nil {
+				logger.ErrorError("Failed to delete session during single logout",
+					zap.String("session_id", sessionID),
+					zap.Error(err),
+				)
+			}
+		}
+		c.SetCookie("cas_session", "", -1, "/", "", false, true)
+	}
+
+	state := &sloState{Result: *result, ReturnURL: returnURL, Initiator: initiator}
+	hasPending := false
+	for i := range state.Result.Participants {
+		p := &state.Result.Participants[i]
+		if p.Protocol == sloProtocolSAML && p.Status == sloStatusFailed {
+			p.Status = sloStatusPending
+			hasPending = true
+		}
+	}
+
+	if hasPending && redis.GetRedis() != nil {
+		stateID, err := utils.GenerateRandomString(32)
+		if err == nil {
+			state.ID = stateID
+			continueFrontChannelLogout(c, state)
+			return
+		}
+		logger.ErrorError("Failed to create single logout state", zap.Error(err))
+	}
+
+	// 无法使用前端通道时，保持后端通道的失败结果
+	for i := range state.Result.Participants {
+		if state.Result.Participants[i].Status == sloStatusPending {
+			state.Result.Participants[i].Status = sloStatusFailed
+		}
+	}
+	finishBrowserLogout(c, state)
+}
+
+// continueFrontChannelLogout 跳转到下一个待注销的SAML应用，全部完成后结束注销
+func continueFrontChannelLogout(c *gin.Context, state *sloState) {
+	for state.Current < len(state.Result.Participants) {
+		p := &state.Result.Participants[state.Current]
+		if p.Status != sloStatusPending {
+			state.Current++
+			continue
+		}
+
+		requestEl, requestID, err := buildSAMLLogoutRequest(p, false)
+		var redirectURL string
+		if err == nil {
+			redirectURL, err = samlRedirectBindingURL(p.Endpoint, "SAMLRequest", requestEl, state.ID, p.ApplicationID)
+		}
+		if err == nil {
+			state.PendingRequestID = requestID
+			err = redis.SetJSON(sloStateKeyPrefix+state.ID, state, sloStateTTL)
+		}
+		if err != nil {
+			logger.ErrorError("Failed to start front-channel logout", zap.String("application_id", p.ApplicationID), zap.Error(err))
+			p.Status = sloStatusFailed
+			p.Error = err.Error()
+			state.Current++
+			continue
+		}
+
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+
+	if state.ID != "" {
+		redis.Del(sloStateKeyPrefix + state.ID)
+	}
+	finishBrowserLogout(c, state)
+}
+
+// finishBrowserLogout 注销完成：回复发起方SP，或跳转到service，或展示注销结果
+func finishBrowserLogout(c *gin.Context, state *sloState) {
+	state.Result.updatePartial()
+
+	if state.Initiator != nil {
+		redirectURL, err := buildSAMLLogoutResponseURL(state.Initiator, state.Result.Partial)
+		if err == nil {
+			c.Redirect(http.StatusFound, redirectURL)
+			return
+		}
+		logger.ErrorError("Failed to build SAML logout response", zap.String("application_id", state.Initiator.ApplicationID), zap.Error(err))
+	}
+
+	if state.ReturnURL != "" && !state.Result.Partial {
+		c.Redirect(http.StatusFound, state.ReturnURL)
+		return
+	}
+
+	c.HTML(http.StatusOK, "cas_logout.html", gin.H{
+		"title":        "Logout",
+		"partial":      state.Result.Partial,
+		"participants": state.Result.Participants,
+		"service":      state.ReturnURL,
+	})
+}
+
+// buildSAMLLogoutResponseURL 构造回复发起方SP的LogoutResponse，未全部注销时返回PartialLogout
+func buildSAMLLogoutResponseURL(initiator *sloInitiator, partial bool) (string, error) {
+	idp := currentSAMLIDP()
+	if idp == nil {
+		return "", errors.New("SAML IdP not initialized")
+	}
+	responseID, err := utils.GenerateRandomString(40)
+	if err != nil {
+		return "", err
+	}
+
+	status := saml.StatusCode{Value: saml.StatusSuccess}
+	if partial {
+		status.StatusCode = &saml.StatusCode{Value: saml.StatusPartialLogout}
+	}
+	response := &saml.LogoutResponse{
+		ID:           "id-" + responseID,
+		InResponseTo: initiator.RequestID,
+		Version:      "2.0",
+		IssueInstant: saml.TimeNow(),
+		Destination:  initiator.Endpoint,
+		Issuer: &saml.Issuer{
+			Format: "urn:oasis:names:tc:SAML:2.0:nameid-format:entity",
+			Value:  idp.IDP.MetadataURL.String(),
+		},
+		Status: saml.Status{StatusCode: status},
+	}
+	return samlRedirectBindingURL(initiator.Endpoint, "SAMLResponse", response.Element(), initiator.RelayState, initiator.ApplicationID)
+}
+
+// handleSAMLLogoutRequest 处理SP发起的LogoutRequest
+func handleSAMLLogoutRequest(c *gin.Context) {
+	raw, err := decodeSAMLMessage(c, "SAMLRequest")
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid SAML logout request")
+		return
+	}
+
+	var request saml.LogoutRequest
+	if err := xml.Unmarshal(raw, &request); err != nil || request.Issuer == nil {
+		c.String(http.StatusBadRequest, "Invalid SAML logout request")
+		return
+	}
+
+	app, err := findSAMLApplication(request.Issuer.Value)
+	if err != nil || app.SloURL == "" {
+		c.String(http.StatusBadRequest, "Unknown service provider")
+		return
+	}
+
+	// 注销请求必须签名，否则知道NameID和SessionIndex即可跨站结束用户会话
+	// 仅当未配置SP证书且应用明确允许时接受未签名请求
+	switch {
+	case app.Certificate != "":
+		if err := verifySAMLRequestSignature(c, raw, app.Certificate); err != nil {
+			logger.ErrorWarn("SAML logout request signature verification failed",
+				zap.String("entity_id", app.EntityID),
+				zap.Error(err),
+			)
+			c.String(http.StatusBadRequest, "Invalid SAML logout request signature")
+			return
+		}
+	case !app.AllowUnsignedLogout:
+		logger.Warn("Unsigned SAML logout request rejected",
+			zap.String("entity_id", app.EntityID),
+			zap.String("ip", c.ClientIP()),
+		)
+		c.String(http.StatusBadRequest, "SAML logout request must be signed")
+		return
+	}
+
+	initiator := &sloInitiator{
+		ApplicationID: app.ID,
+		RequestID:     request.ID,
+		Endpoint:      app.SloURL,
+		RelayState:    samlMessageParam(c, "RelayState"),
+	}
+
+	// 仅注销与请求匹配的当前会话，避免跨站请求注销其他会话
+	sessionID := ""
+	if user, currentSessionID, _, ok := samlSessionFromRequest(c.Request); ok {
+		matches := request.NameID != nil && request.NameID.Value == user.Username
+		if request.SessionIndex != nil && request.SessionIndex.Value != "" {
+			matches = request.SessionIndex.Value == ssoSessionIndex(currentSessionID)
+		}
+		if matches {
+			sessionID = currentSessionID
+		}
+	}
+
+	logger.Info("SAML logout request received",
+		zap.String("entity_id", app.EntityID),
+		zap.String("request_id", request.ID),
+		zap.Bool("session_matched", sessionID != ""),
+	)
+	startBrowserLogout(c, sessionID, "", initiator)
+}
+
+// handleSAMLLogoutResponse 处理前端通道跳转链中SP返回的LogoutResponse
+func handleSAMLLogoutResponse(c *gin.Context) {
+	raw, err := decodeSAMLMessage(c, "SAMLResponse")
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid SAML logout response")
+		return
+	}
+
+	var response saml.LogoutResponse
+	if err := xml.Unmarshal(raw, &response); err != nil {
+		c.String(http.StatusBadRequest, "Invalid SAML logout response")
+		return
+	}
+
+	var state sloState
+	stateID := samlMessageParam(c, "RelayState")
+	if stateID == "" || redis.GetJSON(sloStateKeyPrefix+stateID, &state) != nil {
+		c.String(http.StatusBadRequest, "Logout session expired")
+		return
+	}
+	if response.InResponseTo != state.PendingRequestID || state.Current >= len(state.Result.Participants) {
+		c.String(http.StatusBadRequest, "Unexpected SAML logout response")
+		return
+	}
+
+	p := &state.Result.Participants[state.Current]
+	if response.Status.StatusCode.Value == saml.StatusSuccess {
+		p.Status = sloStatusSuccess
+		p.Error = ""
+	} else {
+		p.Status = sloStatusFailed
+		p.Error = "logout status " + response.Status.StatusCode.Value
+	}
+	state.Current++
+	state.PendingRequestID = ""
+	continueFrontChannelLogout(c, &state)
+}
+
+// samlMessageParam 读取HTTP-Redirect(查询参数)或HTTP-POST(表单)绑定的参数
+func samlMessageParam(c *gin.Context, name string) string {
+	if c.Request.Method == http.MethodPost {
+		return c.PostForm(name)
+	}
+	return c.Query(name)
+}
+
+// decodeSAMLMessage 解码SAML消息，HTTP-Redirect绑定需要解压
+func decodeSAMLMessage(c *gin.Context, name string) ([]byte, error) {
+	encoded := samlMessageParam(c, name)
+	if encoded == "" {
+		return nil, errors.New("missing " + name)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if c.Request.Method == http.MethodPost {
+		return data, nil
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(data)), samlMessageMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > samlMessageMaxSize {
+		return nil, errors.New("SAML message is too large")
+	}
+	return raw, nil
+}
+
+// verifySAMLRequestSignature 使用SP证书校验请求签名
+// HTTP-Redirect绑定校验查询参数签名，HTTP-POST绑定校验XML签名
+func verifySAMLRequestSignature(c *gin.Context, raw []byte, certificate string) error {
+	certData, err := normalizeSPCertificate(certificate)
+	if err != nil {
+		return err
+	}
+	der, err := base64.StdEncoding.DecodeString(certData)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	if c.Request.Method == http.MethodPost {
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(raw); err != nil {
+			return err
+		}
+		ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{cert}})
+		_, err := ctx.Validate(doc.Root())
+		return err
+	}
+
+	// 按原始编码取出参与签名的参数
+	rawParams := map[string]string{}
+	for _, part := range strings.Split(c.Request.URL.RawQuery, "&") {
+		if key, value, ok := strings.Cut(part, "="); ok {
+			rawParams[key] = value
+		}
+	}
+	if rawParams["Signature"] == "" || rawParams["SigAlg"] == "" {
+		return errors.New("request is not signed")
+	}
+
+	signedQuery := "SAMLRequest=" + rawParams["SAMLRequest"]
+	if relayState, ok := rawParams["RelayState"]; ok {
+		signedQuery += "&RelayState=" + relayState
+	}
+	signedQuery += "&SigAlg=" + rawParams["SigAlg"]
+
+	sigAlg, err := url.QueryUnescape(rawParams["SigAlg"])
+	if err != nil {
+		return err
+	}
+	hashAlgorithm, err := parseSAMLHashAlgorithm(sigAlg)
+	if err != nil {
+		return err
+	}
+	signature, err := url.QueryUnescape(rawParams["Signature"])
+	if err != nil {
+		return err
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("SP certificate does not contain an RSA key")
+	}
+	hash := hashAlgorithm.New()
+	hash.Write([]byte(signedQuery))
+	return rsa.VerifyPKCS1v15(publicKey, hashAlgorithm, hash.Sum(nil), signatureBytes)
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/middleware"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/utils"
+)
+
+// ReauthRequest 重新认证请求，至少提交一种认证方式；同时提交密码和第二因素时视为多因素认证
+type ReauthRequest struct {
+	Password          string                      `json:"password"`
+	EncryptedPassword string                      `json:"encrypted_password"` // 使用/public/login-key公钥加密的载荷
+	KeyID             string                      `json:"key_id"`
+	OTPCode           string                      `json:"otp_code"` // 动态码或备用码
+	WebAuthn          *WebAuthnCredentialResponse `json:"webauthn"` // 先调用/auth/reauth/webauthn/begin获取断言参数
+}
+
+// stepUpWindow 重新认证后会话保持提升状态的时长
+func stepUpWindow() time.Duration {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Login.StepUp.Window > 0 {
+		return time.Duration(cfg.Login.StepUp.Window) * time.Second
+	}
+	return 5 * time.Minute
+}
+
+// ReauthWebAuthnBeginHandler 为重新认证创建WebAuthn断言参数
+func ReauthWebAuthnBeginHandler(c *gin.Context) {
+	if !requireWebAuthnEnabled(c) {
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	options, err := beginWebAuthnSecondFactor(user.ID)
+	if err != nil {
+		logger.ErrorError("Failed to start WebAuthn re-authentication", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data": gin.H{
+			"publicKey": options,
+		},
+	})
+}
+
+// ReauthHandler 重新验证当前用户，在短时间内提升当前会话的认证时间，不签发新令牌
+// 失败与登录失败一样计入失败次数
+func ReauthHandler(c *gin.Context) {
+	value, _ := c.Get("claims")
+	claims, ok := value.(*utils.AccessTokenClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": i18n.Unauthorized,
+			"data":    nil,
+		})
+		return
+	}
+
+	var req ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if accountLockedUntil(user) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": i18n.AccountLocked,
+			"data":    nil,
+		})
+		return
+	}
+
+	var amr []string
+	if req.Password != "" || req.EncryptedPassword != "" {
+		password, ok := resolveLoginPassword(c, &LoginRequest{
+			Username:          user.Username,
+			Password:          req.Password,
+			EncryptedPassword: req.EncryptedPassword,
+			KeyID:             req.KeyID,
+		})
+		if !ok {
+			return
+		}
+		if !utils.CheckPassword(password, user.Password) {
+			respondReauthFailure(c, user, utils.AMRPassword, i18n.InvalidCredentials)
+			return
+		}
+		amr = append(amr, utils.AMRPassword)
+	}
+
+	switch {
+	case req.WebAuthn != nil:
+		if !requireWebAuthnEnabled(c) {
+			return
+		}
+		if _, err := verifyWebAuthnAssertion(req.WebAuthn, webAuthnCeremonySecondFactor, user.ID); err != nil {
+			logger.AccessInfo("WebAuthn re-authentication failed", zap.String("user_id", user.ID), zap.Error(err))
+			respondReauthFailure(c, user, utils.AMRHardwareKey, i18n.InvalidWebAuthn)
+			return
+		}
+		amr = append(amr, utils.AMRHardwareKey)
+	case strings.TrimSpace(req.OTPCode) != "":
+		if _, valid := verifyUserSecondFactor(user, req.OTPCode); !valid {
+			respondReauthFailure(c, user, utils.AMROTP, i18n.InvalidOTP)
+			return
+		}
+		amr = append(amr, utils.AMROTP)
+	}
+
+	if len(amr) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+	if len(amr) > 1 {
+		amr = append(amr, utils.AMRMultiFactor)
+	}
+
+	now := time.Now()
+	window := stepUpWindow()
+	elevation := &middleware.StepUpElevation{
+		UserID:   user.ID,
+		AuthTime: now.Unix(),
+		AMR:      amr,
+	}
+	if err := middleware.SaveStepUpElevation(claims, elevation, window); err != nil {
+		logger.ErrorError("Failed to save re-authentication", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	logger.AccessInfo("User re-authenticated",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("session_id", claims.SessionID),
+		zap.Strings("amr", amr),
+	)
+	utils.CreateAuditLog(c, utils.AuditActionLogin, utils.AuditResourceUser, user.ID,
+		"Re-authenticated for sensitive operations: "+user.Username, gin.H{
+			"amr":        amr,
+			"session_id": claims.SessionID,
+		})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.ReauthSuccess,
+		"data": gin.H{
+			"auth_time":  elevation.AuthTime,
+			"amr":        amr,
+			"expires_at": now.Add(window),
+		},
+	})
+}
+
+// respondReauthFailure 记录重新认证失败并返回401
+func respondReauthFailure(c *gin.Context, user *models.User, method, message string) {
+	recordLoginFailure(c, user)
+	logger.AccessInfo("Re-authentication failed",
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_id", user.ID),
+		zap.String("method", method),
+		zap.Int("failed_count", user.FailedCount),
+	)
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"code":    401,
+		"message": message,
+		"data":    nil,
+	})
+}
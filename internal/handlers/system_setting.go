@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"time"
 
+	"eiam-platform/internal/middleware"
 	"eiam-platform/internal/models"
 	"eiam-platform/pkg/database"
 	"eiam-platform/pkg/i18n"
@@ -216,38 +217,6 @@ func GetSecuritySettingsHandler(c *gin.Context) {
 	for _, setting := range settings {
 		value := convertValue(setting.Value, setting.Type)
 		switch setting.Key {
-		case "min_password_length":
-			if num, ok := value.(int); ok {
-				securitySettings.MinPasswordLength = num
-			}
-		case "max_password_length":
-			if num, ok := value.(int); ok {
-				securitySettings.MaxPasswordLength = num
-			}
-		case "password_expiry_days":
-			if num, ok := value.(int); ok {
-				securitySettings.PasswordExpiryDays = num
-			}
-		case "require_uppercase":
-			if b, ok := value.(bool); ok {
-				securitySettings.RequireUppercase = b
-			}
-		case "require_lowercase":
-			if b, ok := value.(bool); ok {
-				securitySettings.RequireLowercase = b
-			}
-		case "require_numbers":
-			if b, ok := value.(bool); ok {
-				securitySettings.RequireNumbers = b
-			}
-		case "require_special_chars":
-			if b, ok := value.(bool); ok {
-				securitySettings.RequireSpecialChars = b
-			}
-		case "password_history_count":
-			if num, ok := value.(int); ok {
-				securitySettings.PasswordHistoryCount = num
-			}
 		case "session_timeout":
 			if num, ok := value.(int); ok {
 				securitySettings.SessionTimeout = num
@@ -288,6 +257,10 @@ func GetSecuritySettingsHandler(c *gin.Context) {
 			if b, ok := value.(bool); ok {
 				securitySettings.EnableEmail = b
 			}
+		case "enable_webauthn":
+			if b, ok := value.(bool); ok {
+				securitySettings.EnableWebAuthn = b
+			}
 		case "max_login_attempts":
 			if num, ok := value.(int); ok {
 				securitySettings.MaxLoginAttempts = num
@@ -320,6 +293,10 @@ func GetSecuritySettingsHandler(c *gin.Context) {
 			if b, ok := value.(bool); ok {
 				securitySettings.NotifyPasswordChanges = b
 			}
+		case "withhold_unverified_email":
+			if b, ok := value.(bool); ok {
+				securitySettings.WithholdUnverifiedEmail = b
+			}
 		}
 	}
 
@@ -428,14 +405,6 @@ func UpdateSiteSettingsHandler(c *gin.Context) {
 // UpdateSecuritySettingsHandler 更新安全设置
 func UpdateSecuritySettingsHandler(c *gin.Context) {
 	var req struct {
-		MinPasswordLength          int  `json:"min_password_length"`
-		MaxPasswordLength          int  `json:"max_password_length"`
-		PasswordExpiryDays         int  `json:"password_expiry_days"`
-		RequireUppercase           bool `json:"require_uppercase"`
-		RequireLowercase           bool `json:"require_lowercase"`
-		RequireNumbers             bool `json:"require_numbers"`
-		RequireSpecialChars        bool `json:"require_special_chars"`
-		PasswordHistoryCount       int  `json:"password_history_count"`
 		SessionTimeout             int  `json:"session_timeout"`
 		MaxConcurrentSessions      int  `json:"max_concurrent_sessions"`
 		AllowMultiDeviceLogin      bool `json:"allow_multi_device_login"`
@@ -446,6 +415,7 @@ func UpdateSecuritySettingsHandler(c *gin.Context) {
 		EnableTOTP                 bool `json:"enable_totp"`
 		EnableSMS                  bool `json:"enable_sms"`
 		EnableEmail                bool `json:"enable_email"`
+		EnableWebAuthn             bool `json:"enable_webauthn"`
 		MaxLoginAttempts           int  `json:"max_login_attempts"`
 		LockoutDuration            int  `json:"lockout_duration"`
 		EnableIPWhitelist          bool `json:"enable_ip_whitelist"`
@@ -454,6 +424,7 @@ func UpdateSecuritySettingsHandler(c *gin.Context) {
 		NotifyFailedLogins         bool `json:"notify_failed_logins"`
 		NotifyNewDevices           bool `json:"notify_new_devices"`
 		NotifyPasswordChanges      bool `json:"notify_password_changes"`
+		WithholdUnverifiedEmail    bool `json:"withhold_unverified_email"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -472,14 +443,6 @@ func UpdateSecuritySettingsHandler(c *gin.Context) {
 		value interface{}
 		typ   string
 	}{
-		{"min_password_length", req.MinPasswordLength, "number"},
-		{"max_password_length", req.MaxPasswordLength, "number"},
-		{"password_expiry_days", req.PasswordExpiryDays, "number"},
-		{"require_uppercase", req.RequireUppercase, "boolean"},
-		{"require_lowercase", req.RequireLowercase, "boolean"},
-		{"require_numbers", req.RequireNumbers, "boolean"},
-		{"require_special_chars", req.RequireSpecialChars, "boolean"},
-		{"password_history_count", req.PasswordHistoryCount, "number"},
 		{"session_timeout", req.SessionTimeout, "number"},
 		{"max_concurrent_sessions", req.MaxConcurrentSessions, "number"},
 		{"allow_multi_device_login", req.AllowMultiDeviceLogin, "boolean"},
@@ -490,6 +453,7 @@ func UpdateSecuritySettingsHandler(c *gin.Context) {
 		{"enable_totp", req.EnableTOTP, "boolean"},
 		{"enable_sms", req.EnableSMS, "boolean"},
 		{"enable_email", req.EnableEmail, "boolean"},
+		{"enable_webauthn", req.EnableWebAuthn, "boolean"},
 		{"max_login_attempts", req.MaxLoginAttempts, "number"},
 		{"lockout_duration", req.LockoutDuration, "number"},
 		{"enable_ip_whitelist", req.EnableIPWhitelist, "boolean"},
@@ -498,6 +462,7 @@ func UpdateSecuritySettingsHandler(c *gin.Context) {
 		{"notify_failed_logins", req.NotifyFailedLogins, "boolean"},
 		{"notify_new_devices", req.NotifyNewDevices, "boolean"},
 		{"notify_password_changes", req.NotifyPasswordChanges, "boolean"},
+		{"withhold_unverified_email", req.WithholdUnverifiedEmail, "boolean"},
 	}
 
 	for _, setting := range settings {
@@ -569,6 +534,87 @@ func UpdateSecuritySettingsHandler(c *gin.Context) {
 	})
 }
 
+// GetRateLimitSettingsHandler 获取各接口组的限流规则，未配置的使用默认值
+func GetRateLimitSettingsHandler(c *gin.Context) {
+	rules := make(map[string]middleware.RateLimitRule, len(middleware.DefaultRateLimitRules))
+	for policy := range middleware.DefaultRateLimitRules {
+		rules[policy] = middleware.GetRateLimitRule(policy)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data":    rules,
+	})
+}
+
+// UpdateRateLimitSettingsHandler 更新限流规则，当前实例立即生效，其他实例在缓存过期后生效
+func UpdateRateLimitSettingsHandler(c *gin.Context) {
+	var req map[string]middleware.RateLimitRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+	for policy, rule := range req {
+		if _, ok := middleware.DefaultRateLimitRules[policy]; !ok ||
+			rule.Limit <= 0 || rule.Window <= 0 || rule.Window > 86400 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": i18n.InvalidRequestData,
+				"data":    gin.H{"policy": policy},
+			})
+			return
+		}
+	}
+
+	for policy, rule := range req {
+		key := middleware.RateLimitSettingPrefix + policy
+		value := convertToString(rule)
+		now := time.Now()
+
+		var setting models.SystemSetting
+		err := database.DB.Where("`key` = ? AND category = ?", key, middleware.RateLimitSettingCategory).First(&setting).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			setting = models.SystemSetting{
+				ID:        utils.GenerateTradeIDString("setting"),
+				Key:       key,
+				Value:     value,
+				Category:  middleware.RateLimitSettingCategory,
+				Type:      "json",
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			err = database.DB.Create(&setting).Error
+		} else if err == nil {
+			err = database.DB.Model(&setting).Updates(map[string]interface{}{
+				"value":      value,
+				"updated_at": now,
+			}).Error
+		}
+		if err != nil {
+			logger.ErrorError("Failed to save rate limit setting", zap.String("key", key), zap.Error(err))
+			respondInternalError(c)
+			return
+		}
+	}
+
+	middleware.ReloadRateLimitRules()
+	utils.CreateAuditLog(c, utils.AuditActionUpdate, utils.AuditResourceSystem, middleware.RateLimitSettingCategory,
+		"Rate limit settings updated", gin.H{
+			"rules": req,
+		})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.SuccessUpdated,
+		"data":    nil,
+	})
+}
+
 // Helper functions
 func convertValue(value string, valueType string) interface{} {
 	switch valueType {
@@ -632,6 +678,9 @@ func getCategoryFromKey(key string) string {
 	if len(key) >= 5 && key[:5] == "email" {
 		return "email"
 	}
+	if strings.HasPrefix(key, middleware.RateLimitSettingPrefix) {
+		return middleware.RateLimitSettingCategory
+	}
 	return "other"
 }
 
@@ -1139,22 +1188,27 @@ func GetCASServerInfoHandler(c *gin.Context) {
 
 	// CAS服务端信息 (Improved Implementation)
 	casServerInfo := gin.H{
-		"server_url":           baseURL,
-		"login_url":            fmt.Sprintf("%s/cas/login", baseURL),
-		"validate_url":         fmt.Sprintf("%s/cas/validate", baseURL),
-		"service_validate_url": fmt.Sprintf("%s/cas/serviceValidate", baseURL),
-		"proxy_validate_url":   fmt.Sprintf("%s/cas/proxyValidate", baseURL),
-		"proxy_url":            fmt.Sprintf("%s/cas/proxy", baseURL),
-		"logout_url":           fmt.Sprintf("%s/cas/logout", baseURL),
-		"protocol_version":     "CAS 2.0 (Improved Implementation)",
-		"library":              "go-cache v2.1.0 + Custom Implementation",
+		"server_url":              baseURL,
+		"login_url":               fmt.Sprintf("%s/cas/login", baseURL),
+		"validate_url":            fmt.Sprintf("%s/cas/validate", baseURL),
+		"service_validate_url":    fmt.Sprintf("%s/cas/serviceValidate", baseURL),
+		"proxy_validate_url":      fmt.Sprintf("%s/cas/proxyValidate", baseURL),
+		"p3_service_validate_url": fmt.Sprintf("%s/cas/p3/serviceValidate", baseURL),
+		"p3_proxy_validate_url":   fmt.Sprintf("%s/cas/p3/proxyValidate", baseURL),
+		"proxy_url":               fmt.Sprintf("%s/cas/proxy", baseURL),
+		"logout_url":              fmt.Sprintf("%s/cas/logout", baseURL),
+		"protocol_version":        "CAS 3.0 (Improved Implementation)",
+		"library":                 "Custom Implementation",
 		"supported_features": []string{
 			"CAS 1.0 validate",
 			"CAS 2.0 serviceValidate",
 			"CAS 2.0 JSON response format",
+			"CAS 3.0 p3/serviceValidate and p3/proxyValidate",
+			"CAS 3.0 attribute release",
+			"Proxy tickets",
 			"Gateway mode",
 			"Renew mode",
-			"In-memory ticket caching",
+			"Redis ticket registry (shared across replicas)",
 			"Database persistence",
 			"Automatic cleanup",
 		},
@@ -1442,3 +1496,31 @@ func syncSecuritySettingsToRedis() {
 			zap.String("value", setting.Value))
 	}
 }
+
+// securitySettingEnabled 读取安全设置中的布尔开关，设置不存在时返回fallback
+func securitySettingEnabled(key string, fallback bool) bool {
+	var setting models.SystemSetting
+	if err := database.DB.Where("`key` = ? AND category = ?", key, "security").First(&setting).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.ErrorWarn("Failed to get security setting", zap.String("key", key), zap.Error(err))
+		}
+		return fallback
+	}
+	return setting.Value == "true"
+}
+
+// securitySettingInt 读取安全设置中的正整数，设置不存在或无效时返回fallback
+func securitySettingInt(key string, fallback int) int {
+	var setting models.SystemSetting
+	if err := database.DB.Where("`key` = ? AND category = ?", key, "security").First(&setting).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.ErrorWarn("Failed to get security setting", zap.String("key", key), zap.Error(err))
+		}
+		return fallback
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(setting.Value))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
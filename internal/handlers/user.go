@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"eiam-platform/internal/models"
 	"eiam-platform/pkg/database"
@@ -171,6 +172,16 @@ func CreateUserHandler(c *gin.Context) {
 		return
 	}
 
+	// OTP需要用户自行绑定密钥后才能启用
+	if req.EnableOTP {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.OTPEnrollmentRequired,
+			"data":    nil,
+		})
+		return
+	}
+
 	// 检查用户名是否已存在
 	var existingUser models.User
 	if err := database.DB.Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
@@ -206,57 +217,34 @@ func CreateUserHandler(c *gin.Context) {
 	}
 	logger.Info("Organization found", zap.String("org_id", organization.ID), zap.String("org_name", organization.Name))
 
-	// 验证密码策略
-	var policy models.PasswordPolicy
-	if err := database.DB.Where("is_active = ?", true).First(&policy).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			// 使用默认策略
-			defaultPolicy := utils.DefaultPasswordPolicy()
-			validationResult := utils.ValidatePassword(req.Password, defaultPolicy, req.Username, nil)
-			if !validationResult.Valid {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"code":    400,
-					"message": "Password does not meet policy requirements",
-					"errors":  validationResult.Errors,
-				})
-				return
-			}
-		} else {
-			logger.Error("Failed to get password policy", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": i18n.InternalServerError,
-				"data":    nil,
-			})
-			return
-		}
-	} else {
-		// 使用数据库中的策略
-		utilsPolicy := &utils.PasswordPolicy{
-			MinLength:        policy.MinLength,
-			MaxLength:        policy.MaxLength,
-			RequireUppercase: policy.RequireUppercase,
-			RequireLowercase: policy.RequireLowercase,
-			RequireNumbers:   policy.RequireNumbers,
-			RequireSpecial:   policy.RequireSpecialChars,
-			HistoryCount:     policy.HistoryCount,
-			ExpiryDays:       policy.ExpiryDays,
-			PreventCommon:    policy.PreventCommon,
-			PreventUsername:  policy.PreventUsername,
-		}
-		validationResult := utils.ValidatePassword(req.Password, utilsPolicy, req.Username, nil)
-		if !validationResult.Valid {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"code":    400,
-				"message": "Password does not meet policy requirements",
-				"errors":  validationResult.Errors,
-			})
-			return
-		}
+	// 验证密码策略，密码不能包含显示名称、邮箱、站点和组织名称等相关词
+	accountContext := utils.PasswordContext{
+		Username: req.Username,
+		Words:    []string{req.DisplayName, emailLocalPart(req.Email), siteDisplayName(), organization.Name},
+	}
+	// 新用户还没有角色，按所属组织确定生效的密码策略
+	effective, err := resolvePasswordPolicy(req.OrganizationID, nil)
+	if err != nil {
+		logger.Error("Failed to get password policy", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": i18n.InternalServerError,
+			"data":    nil,
+		})
+		return
+	}
+	validationResult := utils.ValidatePasswordWithContext(req.Password, effective.Policy, accountContext, nil)
+	if !validationResult.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Password does not meet policy requirements",
+			"errors":  validationResult.Errors,
+		})
+		return
 	}
 
 	// 加密密码
-	hashedPassword, err := utils.HashPassword(req.Password, 12)
+	hashedPassword, err := hashUserPassword(req.Password)
 	if err != nil {
 		logger.ErrorError("Failed to hash password", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -299,6 +287,10 @@ func CreateUserHandler(c *gin.Context) {
 		EnableOTP:          req.EnableOTP,
 		MustChangePassword: true, // 新用户必须修改密码
 	}
+	if user.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
 		logger.ErrorError("Failed to create user", zap.Error(err))
@@ -446,6 +438,11 @@ func UpdateUserHandler(c *gin.Context) {
 	}
 	if req.Phone != "" {
 		updates["phone"] = req.Phone
+		// 管理员修改手机号后需要重新验证，除非同时明确标记为已验证
+		if req.Phone != user.Phone && req.PhoneVerified == nil {
+			updates["phone_verified"] = false
+			updates["phone_verified_at"] = nil
+		}
 	}
 	if req.OrganizationID != "" {
 		// 检查组织是否存在
@@ -463,14 +460,35 @@ func UpdateUserHandler(c *gin.Context) {
 	if req.Status != nil {
 		updates["status"] = *req.Status
 	}
-	if req.EnableOTP != nil {
-		updates["enable_otp"] = *req.EnableOTP
+	if req.EnableOTP != nil && *req.EnableOTP != user.EnableOTP {
+		// 管理员只能停用OTP，启用需要用户自行绑定密钥
+		if *req.EnableOTP {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": i18n.OTPEnrollmentRequired,
+				"data":    nil,
+			})
+			return
+		}
+		updates["enable_otp"] = false
+		updates["otp_secret"] = ""
+		updates["backup_codes"] = ""
 	}
-	if req.EmailVerified != nil {
+	if req.EmailVerified != nil && *req.EmailVerified != user.EmailVerified {
 		updates["email_verified"] = *req.EmailVerified
+		if *req.EmailVerified {
+			updates["email_verified_at"] = time.Now()
+		} else {
+			updates["email_verified_at"] = nil
+		}
 	}
-	if req.PhoneVerified != nil {
+	if req.PhoneVerified != nil && *req.PhoneVerified != user.PhoneVerified {
 		updates["phone_verified"] = *req.PhoneVerified
+		if *req.PhoneVerified {
+			updates["phone_verified_at"] = time.Now()
+		} else {
+			updates["phone_verified_at"] = nil
+		}
 	}
 
 	// 执行更新
@@ -0,0 +1,740 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"eiam-platform/config"
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/utils"
+)
+
+const webAuthnChallengePrefix = "webauthn:challenge:"
+
+// WebAuthn仪式类型
+const (
+	webAuthnCeremonyRegister     = "register"
+	webAuthnCeremonyLogin        = "login"         // 无密码登录
+	webAuthnCeremonySecondFactor = "second_factor" // 密码之后的第二因素
+)
+
+// mfaMethodWebAuthn WebAuthn第二因素
+const mfaMethodWebAuthn = "webauthn"
+
+// webAuthnTransports 允许保存的传输方式
+var webAuthnTransports = map[string]bool{
+	"usb": true, "nfc": true, "ble": true, "internal": true, "hybrid": true, "smart-card": true,
+}
+
+// webAuthnCeremony 保存在Redis中的仪式状态，以挑战值为键，只能使用一次
+type webAuthnCeremony struct {
+	Type             string `json:"type"`
+	UserID           string `json:"user_id,omitempty"`
+	UserVerification string `json:"user_verification"`
+}
+
+// WebAuthnCredentialResponse 浏览器返回的PublicKeyCredential，二进制字段使用base64url编码
+type WebAuthnCredentialResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject,omitempty"`
+		AuthenticatorData string   `json:"authenticatorData,omitempty"`
+		Signature         string   `json:"signature,omitempty"`
+		UserHandle        string   `json:"userHandle,omitempty"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// WebAuthnRegisterRequest 完成注册请求
+type WebAuthnRegisterRequest struct {
+	FriendlyName string                     `json:"friendly_name"`
+	Credential   WebAuthnCredentialResponse `json:"credential" binding:"required"`
+}
+
+// WebAuthnLoginBeginRequest 无密码登录开始请求，用户名可选，不提供时使用可发现凭据(通行密钥)
+type WebAuthnLoginBeginRequest struct {
+	Username string `json:"username"`
+}
+
+// WebAuthnLoginFinishRequest 无密码登录完成请求
+type WebAuthnLoginFinishRequest struct {
+	Credential WebAuthnCredentialResponse `json:"credential" binding:"required"`
+}
+
+// webAuthnSettings 读取依赖方配置，未配置时根据idp.base_url推导RP ID和允许的源
+func webAuthnSettings() (*utils.WebAuthnRelyingParty, string, time.Duration) {
+	var cfg config.WebAuthnConfig
+	baseURL := ""
+	if appConfig := config.GetConfig(); appConfig != nil {
+		cfg = appConfig.Login.WebAuthn
+		baseURL = appConfig.IdP.BaseURL
+	}
+
+	rp := &utils.WebAuthnRelyingParty{ID: cfg.RPID, Origins: cfg.Origins}
+	if parsed, err := url.Parse(baseURL); err == nil && parsed.Host != "" {
+		if rp.ID == "" {
+			rp.ID = parsed.Hostname()
+		}
+		if len(rp.Origins) == 0 {
+			rp.Origins = []string{parsed.Scheme + "://" + parsed.Host}
+		}
+	}
+	if rp.ID == "" {
+		rp.ID = "localhost"
+	}
+
+	name := cfg.RPName
+	if name == "" {
+		name = siteDisplayName()
+	}
+	timeout := 5 * time.Minute
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	return rp, name, timeout
+}
+
+// WebAuthnRegisterBeginHandler 开始注册安全密钥或通行密钥，返回navigator.credentials.create的参数
+func WebAuthnRegisterBeginHandler(c *gin.Context) {
+	if !requireWebAuthnEnabled(c) {
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	rp, rpName, timeout := webAuthnSettings()
+	challenge, err := startWebAuthnCeremony(webAuthnCeremony{
+		Type:             webAuthnCeremonyRegister,
+		UserID:           user.ID,
+		UserVerification: "preferred",
+	}, timeout)
+	if err != nil {
+		logger.ErrorError("Failed to start WebAuthn registration", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	credentials, err := userWebAuthnCredentials(user.ID)
+	if err != nil {
+		logger.ErrorError("Failed to load WebAuthn credentials", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Username
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data": gin.H{
+			"publicKey": gin.H{
+				"challenge": challenge,
+				"rp": gin.H{
+					"id":   rp.ID,
+					"name": rpName,
+				},
+				"user": gin.H{
+					"id":          utils.EncodeBase64URL([]byte(user.ID)),
+					"name":        user.Username,
+					"displayName": displayName,
+				},
+				"pubKeyCredParams": []gin.H{
+					{"type": "public-key", "alg": utils.COSEAlgES256},
+					{"type": "public-key", "alg": utils.COSEAlgEdDSA},
+					{"type": "public-key", "alg": utils.COSEAlgRS256},
+				},
+				"timeout":            timeout.Milliseconds(),
+				"attestation":        "none",
+				"excludeCredentials": webAuthnDescriptors(credentials),
+				"authenticatorSelection": gin.H{
+					"residentKey":        "preferred",
+					"requireResidentKey": false,
+					"userVerification":   "preferred",
+				},
+			},
+		},
+	})
+}
+
+// WebAuthnRegisterFinishHandler 校验注册响应并保存凭据
+func WebAuthnRegisterFinishHandler(c *gin.Context) {
+	var req WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	registration, err := verifyWebAuthnRegistration(user.ID, &req.Credential)
+	if err != nil {
+		logger.AccessInfo("WebAuthn registration failed",
+			zap.String("user_id", user.ID),
+			zap.Error(err),
+		)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidWebAuthn,
+			"data":    nil,
+		})
+		return
+	}
+
+	credentialID := utils.EncodeBase64URL(registration.CredentialID)
+	if len(credentialID) > 255 {
+		logger.AccessInfo("WebAuthn registration rejected: credential ID too long",
+			zap.String("user_id", user.ID),
+			zap.Int("length", len(registration.CredentialID)),
+		)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidWebAuthn,
+			"data":    nil,
+		})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credentialID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": i18n.WebAuthnCredentialExists,
+			"data":    nil,
+		})
+		return
+	}
+
+	friendlyName := strings.TrimSpace(req.FriendlyName)
+	if friendlyName == "" {
+		friendlyName = "Security key"
+		if registration.BackupEligible {
+			friendlyName = "Passkey"
+		}
+	}
+	if len([]rune(friendlyName)) > 100 {
+		friendlyName = string([]rune(friendlyName)[:100])
+	}
+
+	credential := models.WebAuthnCredential{
+		UserID:         user.ID,
+		CredentialID:   credentialID,
+		PublicKey:      utils.EncodeBase64URL(registration.PublicKey),
+		Algorithm:      int(registration.Algorithm),
+		SignCount:      registration.SignCount,
+		Transports:     normalizeWebAuthnTransports(req.Credential.Response.Transports),
+		FriendlyName:   friendlyName,
+		AAGUID:         formatAAGUID(registration.AAGUID),
+		BackupEligible: registration.BackupEligible,
+	}
+	if err := database.DB.Create(&credential).Error; err != nil {
+		logger.ErrorError("Failed to save WebAuthn credential", zap.String("user_id", user.ID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionCreate, utils.AuditResourceUser, user.ID,
+		"Registered WebAuthn credential for user: "+user.Username, gin.H{
+			"credential_id":      credential.ID,
+			"friendly_name":      credential.FriendlyName,
+			"attestation_format": registration.AttestationFormat,
+			"backup_eligible":    credential.BackupEligible,
+		})
+	logger.Info("WebAuthn credential registered",
+		zap.String("user_id", user.ID),
+		zap.String("credential_id", credential.ID),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.SuccessCreated,
+		"data":    credential,
+	})
+}
+
+// ListWebAuthnCredentialsHandler 列出当前用户的WebAuthn凭据
+func ListWebAuthnCredentialsHandler(c *gin.Context) {
+	userID := c.GetString("user_id")
+	credentials, err := userWebAuthnCredentials(userID)
+	if err != nil {
+		logger.ErrorError("Failed to load WebAuthn credentials", zap.String("user_id", userID), zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data":    credentials,
+	})
+}
+
+// DeleteWebAuthnCredentialHandler 删除当前用户的WebAuthn凭据
+func DeleteWebAuthnCredentialHandler(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var credential models.WebAuthnCredential
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": i18n.NotFound,
+				"data":    nil,
+			})
+			return
+		}
+		logger.ErrorError("Failed to get WebAuthn credential", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	// 硬删除，凭据ID唯一，删除后允许重新注册同一认证器
+	if err := database.DB.Unscoped().Delete(&credential).Error; err != nil {
+		logger.ErrorError("Failed to delete WebAuthn credential", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	utils.CreateAuditLog(c, utils.AuditActionDelete, utils.AuditResourceUser, userID,
+		"Removed WebAuthn credential: "+credential.FriendlyName, gin.H{
+			"credential_id": credential.ID,
+		})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.SuccessDeleted,
+		"data":    nil,
+	})
+}
+
+// WebAuthnLoginBeginHandler 开始无密码登录，返回navigator.credentials.get的参数
+// 提供用户名时列出该用户的凭据；用户不存在时返回同样格式的响应，避免泄露用户是否存在
+func WebAuthnLoginBeginHandler(c *gin.Context) {
+	if !requireWebAuthnEnabled(c) {
+		return
+	}
+
+	var req WebAuthnLoginBeginRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return
+	}
+
+	ceremony := webAuthnCeremony{
+		Type:             webAuthnCeremonyLogin,
+		UserVerification: "required",
+	}
+	var credentials []models.WebAuthnCredential
+	if req.Username != "" {
+		var user models.User
+		if err := database.DB.Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error; err == nil {
+			ceremony.UserID = user.ID
+			credentials, _ = userWebAuthnCredentials(user.ID)
+		}
+	}
+
+	options, err := webAuthnAssertionOptions(ceremony, credentials)
+	if err != nil {
+		logger.ErrorError("Failed to start WebAuthn login", zap.Error(err))
+		respondInternalError(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": i18n.Success,
+		"data": gin.H{
+			"publicKey": options,
+		},
+	})
+}
+
+// PortalWebAuthnLoginFinishHandler 门户无密码登录
+func PortalWebAuthnLoginFinishHandler(c *gin.Context) {
+	user, ok := finishWebAuthnLogin(c)
+	if !ok {
+		return
+	}
+	// 管理员创建的账户或密码已过期时，无密码登录同样只能先修改密码
+	if requirePasswordChange(c, user) {
+		return
+	}
+	completePortalLogin(c, user, loginAMR(utils.AMRHardwareKey, ""))
+}
+
+// ConsoleWebAuthnLoginFinishHandler 管理端无密码登录
+func ConsoleWebAuthnLoginFinishHandler(c *gin.Context) {
+	user, ok := finishWebAuthnLogin(c)
+	if !ok {
+		return
+	}
+	// 管理员创建的账户或密码已过期时，无密码登录同样只能先修改密码
+	if requirePasswordChange(c, user) {
+		return
+	}
+	completeConsoleLogin(c, user, "console_webauthn", loginAMR(utils.AMRHardwareKey, ""))
+}
+
+// finishWebAuthnLogin 校验无密码登录断言并检查用户状态，失败时写入响应
+func finishWebAuthnLogin(c *gin.Context) (*models.User, bool) {
+	if !requireWebAuthnEnabled(c) {
+		return nil, false
+	}
+
+	var req WebAuthnLoginFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": i18n.InvalidRequestData,
+			"data":    nil,
+		})
+		return nil, false
+	}
+
+	// 被封禁的IP不再校验断言，账户确定后再检查IP+账户维度的延迟
+	if !checkLoginThrottle(c, "") {
+		return nil, false
+	}
+
+	credential, err := verifyWebAuthnAssertion(&req.Credential, webAuthnCeremonyLogin, "")
+	if err != nil {
+		recordLoginFailure(c, nil)
+		logger.AccessInfo("WebAuthn login failed",
+			zap.String("ip", c.ClientIP()),
+			zap.Error(err),
+		)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": i18n.InvalidWebAuthn,
+			"data":    nil,
+		})
+		return nil, false
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", credential.UserID).First(&user).Error; err != nil {
+		recordLoginFailure(c, nil)
+		logger.AccessInfo("WebAuthn login failed: user not found",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_id", credential.UserID),
+		)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": i18n.InvalidWebAuthn,
+			"data":    nil,
+		})
+		return nil, false
+	}
+
+	if !checkLoginThrottle(c, user.Username) {
+		return nil, false
+	}
+	if user.Status != models.StatusActive {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": i18n.UserInactive,
+			"data":    nil,
+		})
+		return nil, false
+	}
+	if accountLockedUntil(&user) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": i18n.AccountLocked,
+			"data":    nil,
+		})
+		return nil, false
+	}
+
+	logger.AccessInfo("WebAuthn login verified",
+		zap.String("ip", c.ClientIP()),
+		zap.String("username", user.Username),
+		zap.String("credential_id", credential.ID),
+	)
+	return &user, true
+}
+
+// beginWebAuthnSecondFactor 密码验证通过后为用户创建第二因素断言参数
+func beginWebAuthnSecondFactor(userID string) (gin.H, error) {
+	credentials, err := userWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+	return webAuthnAssertionOptions(webAuthnCeremony{
+		Type:             webAuthnCeremonySecondFactor,
+		UserID:           userID,
+		UserVerification: "discouraged",
+	}, credentials)
+}
+
+// webAuthnAssertionOptions 创建认证仪式并返回navigator.credentials.get的参数
+func webAuthnAssertionOptions(ceremony webAuthnCeremony, credentials []models.WebAuthnCredential) (gin.H, error) {
+	rp, _, timeout := webAuthnSettings()
+	challenge, err := startWebAuthnCeremony(ceremony, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"challenge":        challenge,
+		"rpId":             rp.ID,
+		"timeout":          timeout.Milliseconds(),
+		"userVerification": ceremony.UserVerification,
+		"allowCredentials": webAuthnDescriptors(credentials),
+	}, nil
+}
+
+// startWebAuthnCeremony 生成挑战值并保存仪式状态
+func startWebAuthnCeremony(ceremony webAuthnCeremony, timeout time.Duration) (string, error) {
+	challenge, err := utils.GenerateWebAuthnChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	if err := redis.SetJSON(webAuthnChallengePrefix+challenge, ceremony, timeout); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnCeremony 根据clientDataJSON中的挑战值取出仪式状态，挑战值只能使用一次
+func consumeWebAuthnCeremony(clientDataJSON []byte, ceremonyType string) (*webAuthnCeremony, string, error) {
+	clientData, err := utils.ParseWebAuthnClientData(clientDataJSON)
+	if err != nil {
+		return nil, "", err
+	}
+	if clientData.Challenge == "" {
+		return nil, "", errors.New("challenge missing")
+	}
+
+	value, err := getDelScript.Run(context.Background(), redis.RDB, []string{webAuthnChallengePrefix + clientData.Challenge}).Text()
+	if err != nil {
+		return nil, "", fmt.Errorf("unknown or expired challenge: %v", err)
+	}
+
+	var ceremony webAuthnCeremony
+	if err := json.Unmarshal([]byte(value), &ceremony); err != nil {
+		return nil, "", err
+	}
+	if ceremony.Type != ceremonyType {
+		return nil, "", fmt.Errorf("unexpected ceremony type %q", ceremony.Type)
+	}
+	return &ceremony, clientData.Challenge, nil
+}
+
+// verifyWebAuthnRegistration 校验注册响应，仪式必须由同一用户发起
+func verifyWebAuthnRegistration(userID string, resp *WebAuthnCredentialResponse) (*utils.WebAuthnRegistration, error) {
+	clientDataJSON, err := utils.DecodeBase64URL(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clientDataJSON: %v", err)
+	}
+	attestationObject, err := utils.DecodeBase64URL(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestationObject: %v", err)
+	}
+
+	ceremony, challenge, err := consumeWebAuthnCeremony(clientDataJSON, webAuthnCeremonyRegister)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID != userID {
+		return nil, errors.New("ceremony was started by another user")
+	}
+
+	rp, _, _ := webAuthnSettings()
+	return rp.VerifyRegistration(clientDataJSON, attestationObject, challenge, ceremony.UserVerification == "required")
+}
+
+// verifyWebAuthnAssertion 校验认证响应并更新签名计数，返回使用的凭据
+// expectedUserID为空时由仪式或凭据确定用户
+func verifyWebAuthnAssertion(resp *WebAuthnCredentialResponse, ceremonyType, expectedUserID string) (*models.WebAuthnCredential, error) {
+	clientDataJSON, err := utils.DecodeBase64URL(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clientDataJSON: %v", err)
+	}
+	authenticatorData, err := utils.DecodeBase64URL(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authenticatorData: %v", err)
+	}
+	signature, err := utils.DecodeBase64URL(resp.Response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %v", err)
+	}
+	userHandle, err := utils.DecodeBase64URL(resp.Response.UserHandle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid userHandle: %v", err)
+	}
+	rawID := resp.RawID
+	if rawID == "" {
+		rawID = resp.ID
+	}
+	credentialID, err := utils.DecodeBase64URL(rawID)
+	if err != nil || len(credentialID) == 0 {
+		return nil, errors.New("invalid credential ID")
+	}
+
+	ceremony, challenge, err := consumeWebAuthnCeremony(clientDataJSON, ceremonyType)
+	if err != nil {
+		return nil, err
+	}
+	if ceremony.UserID != "" {
+		if expectedUserID != "" && expectedUserID != ceremony.UserID {
+			return nil, errors.New("ceremony was started for another user")
+		}
+		expectedUserID = ceremony.UserID
+	}
+
+	var credential models.WebAuthnCredential
+	if err := database.DB.Where("credential_id = ?", utils.EncodeBase64URL(credentialID)).First(&credential).Error; err != nil {
+		return nil, fmt.Errorf("unknown credential: %v", err)
+	}
+	if expectedUserID != "" && credential.UserID != expectedUserID {
+		return nil, errors.New("credential belongs to another user")
+	}
+	// 未预先确定用户时(通行密钥)必须提供userHandle
+	if len(userHandle) > 0 || expectedUserID == "" {
+		if string(userHandle) != credential.UserID {
+			return nil, errors.New("user handle mismatch")
+		}
+	}
+
+	publicKey, err := utils.DecodeBase64URL(credential.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored public key: %v", err)
+	}
+
+	rp, _, _ := webAuthnSettings()
+	authData, err := rp.VerifyAssertion(clientDataJSON, authenticatorData, signature, publicKey, challenge, ceremony.UserVerification == "required")
+	if err != nil {
+		return nil, err
+	}
+
+	// 签名计数不递增说明认证器可能被克隆；计数始终为0的认证器不支持计数
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		logger.ErrorWarn("WebAuthn sign count did not increase, possible cloned authenticator",
+			zap.String("user_id", credential.UserID),
+			zap.String("credential_id", credential.ID),
+			zap.Uint32("stored", credential.SignCount),
+			zap.Uint32("received", authData.SignCount),
+		)
+		return nil, errors.New("sign count did not increase")
+	}
+
+	now := time.Now()
+	database.DB.Model(&credential).Updates(map[string]interface{}{
+		"sign_count":   authData.SignCount,
+		"last_used_at": &now,
+	})
+	credential.SignCount = authData.SignCount
+	credential.LastUsedAt = &now
+	return &credential, nil
+}
+
+// userWebAuthnCredentials 查询用户的凭据
+func userWebAuthnCredentials(userID string) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	err := database.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&credentials).Error
+	return credentials, err
+}
+
+// userHasWebAuthn 用户是否注册了可用的WebAuthn凭据
+func userHasWebAuthn(userID string) bool {
+	if !securitySettingEnabled("enable_webauthn", true) {
+		return false
+	}
+	var count int64
+	database.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&count)
+	return count > 0
+}
+
+// deleteUserWebAuthnCredentials 删除用户的所有凭据，返回删除的数量
+func deleteUserWebAuthnCredentials(userID string) (int64, error) {
+	result := database.DB.Unscoped().Where("user_id = ?", userID).Delete(&models.WebAuthnCredential{})
+	return result.RowsAffected, result.Error
+}
+
+// webAuthnDescriptors 转换为PublicKeyCredentialDescriptor列表
+func webAuthnDescriptors(credentials []models.WebAuthnCredential) []gin.H {
+	descriptors := make([]gin.H, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptor := gin.H{
+			"type": "public-key",
+			"id":   credential.CredentialID,
+		}
+		if credential.Transports != "" {
+			descriptor["transports"] = strings.Split(credential.Transports, ",")
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+	return descriptors
+}
+
+// normalizeWebAuthnTransports 过滤未知的传输方式并以逗号连接
+func normalizeWebAuthnTransports(transports []string) string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(transports))
+	for _, transport := range transports {
+		transport = strings.ToLower(strings.TrimSpace(transport))
+		if webAuthnTransports[transport] && !seen[transport] {
+			seen[transport] = true
+			result = append(result, transport)
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+// formatAAGUID 将AAGUID格式化为UUID字符串
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	h := hex.EncodeToString(aaguid)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// requireWebAuthnEnabled 检查管理员是否启用了WebAuthn，未启用时写入响应
+func requireWebAuthnEnabled(c *gin.Context) bool {
+	if securitySettingEnabled("enable_webauthn", true) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"code":    403,
+		"message": i18n.WebAuthnDisabled,
+		"data":    nil,
+	})
+	return false
+}
@@ -99,6 +99,51 @@ func AuthMiddleware(jwtManager *utils.JWTManager, sessionManager *session.Sessio
 		c.Set("permissions", claims.Permissions)
 		c.Set("claims", claims)
 
+		// 管理员代登录：会话必须存在，每个请求都记录审计日志
+		if claims.Act != nil {
+			c.Set("actor_id", claims.Act.Subject)
+			c.Set("actor_username", claims.Act.Username)
+			defer auditImpersonatedRequest(c, claims)
+			if !checkImpersonation(c, claims, sessionManager) {
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// PasswordChangeAuthMiddleware authentication for the change-password endpoint.
+// Besides regular access tokens it accepts the restricted token issued at login
+// when the password has expired or must be changed.
+func PasswordChangeAuthMiddleware(jwtManager *utils.JWTManager, sessionManager *session.SessionManager) gin.HandlerFunc {
+	authenticate := AuthMiddleware(jwtManager, sessionManager)
+	return func(c *gin.Context) {
+		token := utils.ExtractTokenFromHeader(c.GetHeader("Authorization"))
+		if token == "" {
+			authenticate(c)
+			return
+		}
+		claims, err := jwtManager.ValidatePasswordChangeToken(token)
+		if err != nil {
+			authenticate(c)
+			return
+		}
+
+		// 受限令牌只能使用一次，修改成功后会被加入黑名单
+		if sessionManager != nil && sessionManager.IsTokenBlacklisted(context.Background(), claims.TradeID) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": "Token has been revoked",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("password_change_claims", claims)
+
 		c.Next()
 	}
 }
@@ -111,7 +156,8 @@ func OptionalAuthMiddleware(jwtManager *utils.JWTManager) gin.HandlerFunc {
 			token := utils.ExtractTokenFromHeader(authHeader)
 			if token != "" {
 				claims, err := jwtManager.ValidateAccessToken(token)
-				if err == nil {
+				// Impersonation tokens are only accepted by AuthMiddleware, which enforces and audits them
+				if err == nil && claims.Act == nil {
 					c.Set("user_id", claims.UserID)
 					c.Set("username", claims.Username)
 					c.Set("email", claims.Email)
@@ -129,6 +175,16 @@ func OptionalAuthMiddleware(jwtManager *utils.JWTManager) gin.HandlerFunc {
 // RoleMiddleware role permission middleware
 func RoleMiddleware(requiredRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Impersonation tokens never carry the administrator's own privileges
+		if IsImpersonating(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": i18n.ImpersonationNotAllowed,
+			})
+			c.Abort()
+			return
+		}
+
 		roles, exists := c.Get("roles")
 		if !exists {
 			c.JSON(http.StatusForbidden, gin.H{
@@ -96,14 +96,6 @@ func SecurityHeadersMiddleware() gin.HandlerFunc {
 	}
 }
 
-// RateLimitMiddleware 限流中间件 (简单示例)
-func RateLimitMiddleware() gin.HandlerFunc {
-	// TODO: 实现基于Redis的分布式限流
-	return func(c *gin.Context) {
-		c.Next()
-	}
-}
-
 // IPWhitelistMiddleware IP白名单中间件
 func IPWhitelistMiddleware(allowedIPs []string) gin.HandlerFunc {
 	allowedIPSet := make(map[string]bool)
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"eiam-platform/internal/models"
+	"eiam-platform/pkg/database"
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/redis"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Rate limit policies. Each policy is stored as a JSON system setting
+// "rate_limit_<policy>" in the rate_limit category.
+const (
+	RateLimitPolicyLogin         = "login"
+	RateLimitPolicyOTPSend       = "otp_send"
+	RateLimitPolicyPasswordReset = "password_reset"
+	RateLimitPolicyOAuth2Token   = "oauth2_token"    // per authenticated client
+	RateLimitPolicyOAuth2TokenIP = "oauth2_token_ip" // per client IP, before the client is authenticated
+
+	RateLimitSettingCategory = "rate_limit"
+	RateLimitSettingPrefix   = "rate_limit_"
+
+	rateLimitKeyPrefix = "ratelimit:"
+	// rateLimitRulesTTL how long rules loaded from system settings are cached
+	rateLimitRulesTTL = 30 * time.Second
+)
+
+// RateLimitRule limit of a policy: at most Limit requests in any Window seconds
+type RateLimitRule struct {
+	Enabled bool `json:"enabled"`
+	Limit   int  `json:"limit"`
+	Window  int  `json:"window"`
+}
+
+// DefaultRateLimitRules rules used when a policy has no system setting
+var DefaultRateLimitRules = map[string]RateLimitRule{
+	RateLimitPolicyLogin:         {Enabled: true, Limit: 30, Window: 60},
+	RateLimitPolicyOTPSend:       {Enabled: true, Limit: 10, Window: 60},
+	RateLimitPolicyPasswordReset: {Enabled: true, Limit: 10, Window: 300},
+	RateLimitPolicyOAuth2Token:   {Enabled: true, Limit: 300, Window: 60},
+	RateLimitPolicyOAuth2TokenIP: {Enabled: true, Limit: 600, Window: 60},
+}
+
+// RateLimitKeyFunc returns the identity a request is counted against
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitKeyIP counts requests per client IP
+func RateLimitKeyIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitKeyUser counts requests per authenticated user, falling back to the client IP.
+// It must be mounted after the authentication middleware.
+func RateLimitKeyUser(c *gin.Context) string {
+	if userID := c.GetString("user_id"); userID != "" {
+		return "user:" + userID
+	}
+	return RateLimitKeyIP(c)
+}
+
+// RateLimitKeyClient identity of an authenticated OAuth2 client, for CheckRateLimit.
+// A client_id is only counted once the client has authenticated, otherwise anyone could
+// use up a real client's quota or rotate fake client_ids to avoid the limit.
+func RateLimitKeyClient(clientID string) string {
+	return "client:" + clientID
+}
+
+// rateLimitScript sliding window log. Returns {allowed, remaining, reset_ms}.
+const rateLimitScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], 0, now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	count = count + 1
+	allowed = 1
+end
+local reset = window
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, limit - count, reset}
+`
+
+// RateLimitMiddleware Redis-backed sliding window rate limiter shared by all instances.
+// Limits are read from system settings and take effect without a restart.
+// Requests are allowed when Redis is unavailable.
+func RateLimitMiddleware(policy string, keyFunc RateLimitKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CheckRateLimit(c, policy, keyFunc(c)) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// CheckRateLimit counts the request against identity under the policy. When the limit is
+// exceeded it writes the 429 response, aborts the request and returns false. Handlers use it
+// for limits that need data only known after authentication.
+func CheckRateLimit(c *gin.Context, policy, identity string) bool {
+	rule := GetRateLimitRule(policy)
+	if !rule.Enabled || rule.Limit <= 0 || rule.Window <= 0 || redis.RDB == nil {
+		return true
+	}
+
+	window := time.Duration(rule.Window) * time.Second
+	key := rateLimitKeyPrefix + policy + ":" + identity
+	result, err := redis.RDB.Eval(context.Background(), rateLimitScript, []string{key},
+		time.Now().UnixMilli(), window.Milliseconds(), rule.Limit, uuid.New().String()).Int64Slice()
+	if err != nil || len(result) != 3 {
+		logger.Warn("Rate limit check failed",
+			zap.String("policy", policy),
+			zap.String("trade_id", c.GetString("trade_id")),
+			zap.Error(err),
+		)
+		return true
+	}
+
+	allowed, remaining := result[0] == 1, result[1]
+	reset := int((time.Duration(result[2])*time.Millisecond + time.Second - 1) / time.Second)
+	c.Header("RateLimit-Limit", strconv.Itoa(rule.Limit))
+	c.Header("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	c.Header("RateLimit-Reset", strconv.Itoa(reset))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Limit, rule.Window))
+
+	if !allowed {
+		logger.AccessWarn("Rate limit exceeded",
+			zap.String("policy", policy),
+			zap.String("ip", c.ClientIP()),
+			zap.String("path", c.Request.URL.Path),
+			zap.String("trade_id", c.GetString("trade_id")),
+		)
+		c.Header("Retry-After", strconv.Itoa(reset))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"code":    429,
+			"message": i18n.RateLimitExceeded,
+			"data": gin.H{
+				"retry_after": reset,
+			},
+			"trade_id": c.GetString("trade_id"),
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+var rateLimitRules struct {
+	sync.RWMutex
+	rules    map[string]RateLimitRule
+	loadedAt time.Time
+}
+
+// GetRateLimitRule returns the effective rule of a policy
+func GetRateLimitRule(policy string) RateLimitRule {
+	rateLimitRules.RLock()
+	rules, loadedAt := rateLimitRules.rules, rateLimitRules.loadedAt
+	rateLimitRules.RUnlock()
+
+	if rules == nil || time.Since(loadedAt) > rateLimitRulesTTL {
+		rules = loadRateLimitRules()
+	}
+	return rules[policy]
+}
+
+// ReloadRateLimitRules drops the cached rules so the next request reads the system settings again
+func ReloadRateLimitRules() {
+	rateLimitRules.Lock()
+	rateLimitRules.rules = nil
+	rateLimitRules.Unlock()
+}
+
+// loadRateLimitRules merges rate limit system settings over the defaults
+func loadRateLimitRules() map[string]RateLimitRule {
+	rules := make(map[string]RateLimitRule, len(DefaultRateLimitRules))
+	for policy, rule := range DefaultRateLimitRules {
+		rules[policy] = rule
+	}
+
+	if database.DB != nil {
+		var settings []models.SystemSetting
+		if err := database.DB.Where("category = ?", RateLimitSettingCategory).Find(&settings).Error; err != nil {
+			logger.Warn("Failed to load rate limit settings", zap.Error(err))
+		}
+		for _, setting := range settings {
+			policy := strings.TrimPrefix(setting.Key, RateLimitSettingPrefix)
+			if _, ok := rules[policy]; !ok {
+				continue
+			}
+			var rule RateLimitRule
+			if err := json.Unmarshal([]byte(setting.Value), &rule); err != nil {
+				logger.Warn("Invalid rate limit setting", zap.String("key", setting.Key), zap.Error(err))
+				continue
+			}
+			rules[policy] = rule
+		}
+	}
+
+	rateLimitRules.Lock()
+	rateLimitRules.rules = rules
+	rateLimitRules.loadedAt = time.Now()
+	rateLimitRules.Unlock()
+	return rules
+}
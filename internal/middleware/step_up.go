@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"eiam-platform/pkg/i18n"
+	"eiam-platform/pkg/logger"
+	"eiam-platform/pkg/redis"
+	"eiam-platform/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// stepUpKeyPrefix elevations granted by re-authentication, one per session
+const stepUpKeyPrefix = "stepup:"
+
+// StepUpElevation authentication state of a session after the user re-authenticated
+type StepUpElevation struct {
+	UserID   string   `json:"user_id"`
+	AuthTime int64    `json:"auth_time"`
+	AMR      []string `json:"amr"`
+}
+
+// stepUpKey tokens without a platform session are elevated by their own token ID
+func stepUpKey(claims *utils.AccessTokenClaims) string {
+	if claims.SessionID != "" {
+		return stepUpKeyPrefix + claims.SessionID
+	}
+	return stepUpKeyPrefix + "token:" + claims.ID
+}
+
+// SaveStepUpElevation elevates the session of claims for window without issuing new tokens
+func SaveStepUpElevation(claims *utils.AccessTokenClaims, elevation *StepUpElevation, window time.Duration) error {
+	return redis.SetJSON(stepUpKey(claims), elevation, window)
+}
+
+// GetStepUpElevation returns the current elevation of the session of claims, nil when there is none
+func GetStepUpElevation(claims *utils.AccessTokenClaims) *StepUpElevation {
+	if redis.RDB == nil {
+		return nil
+	}
+	var elevation StepUpElevation
+	if err := redis.GetJSON(stepUpKey(claims), &elevation); err != nil || elevation.UserID != claims.UserID {
+		return nil
+	}
+	return &elevation
+}
+
+// StepUpMiddleware requires the user to have authenticated within maxAge using all of factors
+// (amr values such as utils.AMRMultiFactor). Either the token's auth_time/amr or an elevation
+// granted by re-authentication must satisfy it. It must be mounted after AuthMiddleware.
+func StepUpMiddleware(maxAge time.Duration, factors ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("claims")
+		claims, ok := value.(*utils.AccessTokenClaims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    401,
+				"message": i18n.Unauthorized,
+			})
+			c.Abort()
+			return
+		}
+
+		authTime := claims.AuthTime
+		if stepUpSatisfied(claims.AuthTime, claims.AMR, maxAge, factors) {
+			c.Next()
+			return
+		}
+		if elevation := GetStepUpElevation(claims); elevation != nil {
+			if stepUpSatisfied(elevation.AuthTime, elevation.AMR, maxAge, factors) {
+				c.Next()
+				return
+			}
+			if elevation.AuthTime > authTime {
+				authTime = elevation.AuthTime
+			}
+		}
+
+		logger.AccessInfo("Re-authentication required",
+			zap.String("user_id", claims.UserID),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int64("auth_time", authTime),
+			zap.Strings("factors", factors),
+			zap.String("trade_id", c.GetString("trade_id")),
+		)
+		// RFC 9470 step-up authentication challenge
+		c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", error_description="A more recent authentication is required", max_age=%d`,
+			int(maxAge.Seconds())))
+		// factors is shared by every request, respond with a copy
+		required := append([]string{}, factors...)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": i18n.ReauthRequired,
+			"data": gin.H{
+				"reauth_required": true,
+				"max_age":         int(maxAge.Seconds()),
+				"factors":         required,
+				"auth_time":       authTime,
+			},
+			"trade_id": c.GetString("trade_id"),
+		})
+		c.Abort()
+	}
+}
+
+// stepUpSatisfied authenticated within maxAge with every required factor
+func stepUpSatisfied(authTime int64, amr []string, maxAge time.Duration, factors []string) bool {
+	if authTime <= 0 || time.Since(time.Unix(authTime, 0)) > maxAge {
+		return false
+	}
+	for _, factor := range factors {
+		found := false
+		for _, method := range amr {
+			if method == factor {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -47,6 +47,8 @@ type Application struct {
 	Scopes          string `json:"scopes" gorm:"type:varchar(500)"`         // openid,profile,email
 	AccessTokenTTL  int    `json:"access_token_ttl" gorm:"default:3600"`    // 访问令牌过期时间(秒)
 	RefreshTokenTTL int    `json:"refresh_token_ttl" gorm:"default:604800"` // 刷新令牌过期时间(秒)
+	PublicClient    bool   `json:"public_client" gorm:"default:false"`      // 公共客户端(移动端/SPA)，不使用ClientSecret，必须使用PKCE
+	RequirePKCE     bool   `json:"require_pkce" gorm:"default:false"`       // 强制授权码流程使用PKCE
 
 	// SAML2 特有配置
 	EntityID           string `json:"entity_id" gorm:"type:varchar(255)"`
@@ -55,12 +57,17 @@ type Application struct {
 	Certificate        string `json:"certificate" gorm:"type:text"`
 	SignatureAlgorithm string `json:"signature_algorithm" gorm:"type:varchar(100)"`
 	DigestAlgorithm    string `json:"digest_algorithm" gorm:"type:varchar(100)"`
+	// AllowUnsignedLogout 未配置证书时默认拒绝未签名的LogoutRequest，仅对无法签名的SP开启
+	AllowUnsignedLogout bool `json:"allow_unsigned_logout" gorm:"default:false"`
 
 	// CAS 特有配置
-	ServiceURL      string `json:"service_url" gorm:"type:varchar(500)"`
-	Gateway         bool   `json:"gateway" gorm:"default:false"`
-	Renew           bool   `json:"renew" gorm:"default:false"`
+	ServiceURL       string `json:"service_url" gorm:"type:varchar(500)"`
+	Gateway          bool   `json:"gateway" gorm:"default:false"`
+	Renew            bool   `json:"renew" gorm:"default:false"`
 	AttributeMapping string `json:"attribute_mapping" gorm:"type:text"` // JSON格式的属性映射配置
+	AllowProxy       bool   `json:"allow_proxy" gorm:"default:false"`   // 允许作为代理获取PGT
+	// ProxyCallbackPatterns 允许的pgtUrl正则，每行一个，整串匹配
+	ProxyCallbackPatterns string `json:"proxy_callback_patterns" gorm:"type:text"`
 
 	// LDAP 特有配置
 	LdapURL      string `json:"ldap_url" gorm:"type:varchar(500)"`
@@ -88,16 +95,18 @@ func (Application) TableName() string {
 // OAuth2AuthorizationCode OAuth2授权码
 type OAuth2AuthorizationCode struct {
 	BaseModel
-	Code            string    `json:"code" gorm:"type:varchar(255);uniqueIndex;not null"`
-	ClientID        string    `json:"client_id" gorm:"type:varchar(100);not null;index"`
-	UserID          string    `json:"user_id" gorm:"type:varchar(36);not null;index"`
-	RedirectURI     string    `json:"redirect_uri" gorm:"type:varchar(500);not null"`
-	Scope           string    `json:"scope" gorm:"type:varchar(500)"`
-	State           string    `json:"state" gorm:"type:varchar(255)"`
-	Challenge       string    `json:"challenge" gorm:"type:varchar(255)"`       // PKCE
-	ChallengeMethod string    `json:"challenge_method" gorm:"type:varchar(10)"` // S256, plain
-	ExpiresAt       time.Time `json:"expires_at" gorm:"not null"`
-	Used            bool      `json:"used" gorm:"default:false"`
+	Code            string     `json:"code" gorm:"type:varchar(255);uniqueIndex;not null"`
+	ClientID        string     `json:"client_id" gorm:"type:varchar(100);not null;index"`
+	UserID          string     `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	RedirectURI     string     `json:"redirect_uri" gorm:"type:varchar(500);not null"`
+	Scope           string     `json:"scope" gorm:"type:varchar(500)"`
+	State           string     `json:"state" gorm:"type:varchar(255)"`
+	Challenge       string     `json:"challenge" gorm:"type:varchar(255)"`       // PKCE
+	ChallengeMethod string     `json:"challenge_method" gorm:"type:varchar(10)"` // S256, plain
+	Nonce           string     `json:"nonce" gorm:"type:varchar(255)"`           // OIDC
+	AuthTime        *time.Time `json:"auth_time"`                                // OIDC 用户认证时间
+	ExpiresAt       time.Time  `json:"expires_at" gorm:"not null"`
+	Used            bool       `json:"used" gorm:"default:false"`
 
 	// 关联关系
 	User        User        `json:"user" gorm:"foreignKey:UserID"`
@@ -120,9 +129,10 @@ type OAuth2AccessToken struct {
 	TokenType        string     `json:"token_type" gorm:"type:varchar(50);default:'Bearer'"`
 	ExpiresAt        time.Time  `json:"expires_at" gorm:"not null"`
 	RefreshExpiresAt *time.Time `json:"refresh_expires_at"`
+	AuthTime         *time.Time `json:"auth_time"` // OIDC 用户认证时间，刷新时签发的ID Token沿用
 
-	// 关联关系
-	User        User        `json:"user" gorm:"foreignKey:UserID"`
+	// 关联关系（client_credentials模式的令牌不关联用户，因此不创建用户外键）
+	User        User        `json:"user" gorm:"foreignKey:UserID;-:migration"`
 	Application Application `json:"application" gorm:"foreignKey:ClientID;references:ClientID"`
 }
 
@@ -135,14 +145,16 @@ func (OAuth2AccessToken) TableName() string {
 type SAMLAssertion struct {
 	BaseModel
 	AssertionID  string    `json:"assertion_id" gorm:"type:varchar(255);uniqueIndex;not null"`
+	InResponseTo *string   `json:"in_response_to" gorm:"type:varchar(255);uniqueIndex:idx_saml_assertions_client_request,priority:2"` // SP AuthnRequest ID，IdP发起时为空
 	UserID       string    `json:"user_id" gorm:"type:varchar(36);not null;index"`
-	ClientID     string    `json:"client_id" gorm:"type:varchar(100);not null;index"`
+	ClientID     string    `json:"client_id" gorm:"type:varchar(100);not null;index;uniqueIndex:idx_saml_assertions_client_request,priority:1"`
 	Recipient    string    `json:"recipient" gorm:"type:varchar(500);not null"`
 	Audience     string    `json:"audience" gorm:"type:varchar(500);not null"`
 	NameID       string    `json:"name_id" gorm:"type:varchar(255);not null"`
 	NameIDFormat string    `json:"name_id_format" gorm:"type:varchar(255)"`
-	SessionIndex string    `json:"session_index" gorm:"type:varchar(255)"`
+	SessionIndex string    `json:"session_index" gorm:"type:varchar(255);index"`
 	Attributes   string    `json:"attributes" gorm:"type:text"` // JSON格式
+	Encrypted    bool      `json:"encrypted" gorm:"default:false"`
 	ExpiresAt    time.Time `json:"expires_at" gorm:"not null"`
 	Used         bool      `json:"used" gorm:"default:false"`
 
@@ -24,9 +24,21 @@ func (PasswordHistory) TableName() string {
 	return "password_history"
 }
 
-// PasswordPolicy 密码策略配置
+// 密码策略作用范围
+const (
+	PasswordPolicyScopeGlobal       = "global"
+	PasswordPolicyScopeOrganization = "organization"
+	PasswordPolicyScopeRole         = "role"
+)
+
+// PasswordPolicy 密码策略配置，可以全局生效，也可以绑定到组织（含下级组织）或角色
 type PasswordPolicy struct {
 	ID                  string         `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	Name                string         `json:"name" gorm:"type:varchar(100)"`
+	Scope               string         `json:"scope" gorm:"type:varchar(20);default:'global';index"` // global, organization, role
+	ScopeID             *string        `json:"scope_id" gorm:"type:varchar(36);index"`               // 组织ID或角色ID
+	IncludeSubOrgs      bool           `json:"include_sub_orgs" gorm:"default:true"`                 // 组织策略是否同时作用于下级组织
+	Priority            int            `json:"priority" gorm:"default:0"`                            // 用户的多个角色都有策略时优先级高的生效
 	MinLength           int            `json:"min_length" gorm:"default:8"`
 	MaxLength           int            `json:"max_length" gorm:"default:128"`
 	RequireUppercase    bool           `json:"require_uppercase" gorm:"default:true"`
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// 签名密钥用途
+const (
+	SigningKeyPurposeOIDC = "oidc"
+	SigningKeyPurposeSAML = "saml"
+)
+
+// SigningKey 协议签名密钥（OIDC ID Token、SAML IdP证书等）
+// 私钥加密存储；SAML密钥未启用且未退役时为待启用密钥，会提前发布在元数据中
+type SigningKey struct {
+	BaseModel
+	KeyID       string     `json:"kid" gorm:"type:varchar(64);uniqueIndex;not null"`
+	Purpose     string     `json:"purpose" gorm:"type:varchar(20);not null;index"` // oidc, saml
+	Algorithm   string     `json:"algorithm" gorm:"type:varchar(20);not null"`     // RS256
+	PrivateKey  string     `json:"-" gorm:"type:text;not null"`                    // PEM格式，加密存储
+	PublicKey   string     `json:"public_key" gorm:"type:text;not null"`           // PEM格式
+	Active      bool       `json:"active" gorm:"default:false;index"`              // 是否用于签名
+	Certificate string     `json:"certificate" gorm:"type:text"`                   // PEM格式X.509证书(SAML)
+	ActivatesAt *time.Time `json:"activates_at"`                                   // 计划启用时间
+	RetiredAt   *time.Time `json:"retired_at"`                                     // 退役时间
+}
+
+// TableName 指定表名
+func (SigningKey) TableName() string {
+	return "signing_keys"
+}
@@ -38,17 +38,8 @@ type SiteSettings struct {
 }
 
 // SecuritySettings 安全设置结构
+// 密码策略见PasswordPolicy
 type SecuritySettings struct {
-	// 密码策略
-	MinPasswordLength    int  `json:"min_password_length"`
-	MaxPasswordLength    int  `json:"max_password_length"`
-	PasswordExpiryDays   int  `json:"password_expiry_days"`
-	RequireUppercase     bool `json:"require_uppercase"`
-	RequireLowercase     bool `json:"require_lowercase"`
-	RequireNumbers       bool `json:"require_numbers"`
-	RequireSpecialChars  bool `json:"require_special_chars"`
-	PasswordHistoryCount int  `json:"password_history_count"`
-
 	// 会话管理
 	SessionTimeout        int `json:"session_timeout"`
 	MaxConcurrentSessions int `json:"max_concurrent_sessions"`
@@ -62,6 +53,7 @@ type SecuritySettings struct {
 	EnableTOTP          bool `json:"enable_totp"`
 	EnableSMS           bool `json:"enable_sms"`
 	EnableEmail         bool `json:"enable_email"`
+	EnableWebAuthn      bool `json:"enable_webauthn"`
 
 	// 登录安全
 	MaxLoginAttempts           int  `json:"max_login_attempts"`
@@ -72,4 +64,7 @@ type SecuritySettings struct {
 	NotifyFailedLogins         bool `json:"notify_failed_logins"`
 	NotifyNewDevices           bool `json:"notify_new_devices"`
 	NotifyPasswordChanges      bool `json:"notify_password_changes"`
+
+	// 属性下发
+	WithholdUnverifiedEmail bool `json:"withhold_unverified_email"` // 不向应用下发未验证的邮箱
 }
@@ -122,7 +122,7 @@ func (UserLoginLog) TableName() string {
 type UserOTPRecord struct {
 	BaseModel
 	UserID      string    `json:"user_id" gorm:"type:varchar(36);not null;index"`
-	Code        string    `json:"code" gorm:"type:varchar(32);not null"`
+	Code        string    `json:"-" gorm:"type:varchar(64);not null"`       // HMAC of the code, never the code itself
 	Purpose     string    `json:"purpose" gorm:"type:varchar(50);not null"` // login, reset_password, verify_email
 	ExpiresAt   time.Time `json:"expires_at" gorm:"not null"`
 	Attempts    int       `json:"attempts" gorm:"default:0"`
@@ -143,6 +143,7 @@ func (UserOTPRecord) TableName() string {
 type AuditLog struct {
 	BaseModel
 	UserID      string `json:"user_id" gorm:"type:varchar(36);index"`           // 操作用户ID
+	ActorID     string `json:"actor_id" gorm:"type:varchar(36);index"`          // 代登录时实际操作的管理员ID
 	Action      string `json:"action" gorm:"type:varchar(100);not null;index"`  // 操作类型: create, update, delete, login, logout, etc.
 	Resource    string `json:"resource" gorm:"type:varchar(100);not null;index"` // 资源类型: user, organization, role, permission, etc.
 	ResourceID  string `json:"resource_id" gorm:"type:varchar(36);index"`       // 资源ID
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// WebAuthnCredential 用户注册的WebAuthn凭据（安全密钥、平台认证器或通行密钥）
+type WebAuthnCredential struct {
+	BaseModel
+	UserID         string     `json:"user_id" gorm:"type:varchar(36);not null;index"`
+	CredentialID   string     `json:"credential_id" gorm:"type:varchar(255);uniqueIndex;not null"` // base64url编码
+	PublicKey      string     `json:"-" gorm:"type:text;not null"`                                 // base64url编码的COSE公钥
+	Algorithm      int        `json:"algorithm" gorm:"not null"`                                   // COSE算法：-7 ES256，-8 EdDSA，-257 RS256
+	SignCount      uint32     `json:"sign_count" gorm:"default:0"`
+	Transports     string     `json:"transports" gorm:"type:varchar(255)"` // 逗号分隔：usb,nfc,ble,internal,hybrid
+	FriendlyName   string     `json:"friendly_name" gorm:"type:varchar(100)"`
+	AAGUID         string     `json:"aaguid" gorm:"type:varchar(36)"`
+	BackupEligible bool       `json:"backup_eligible" gorm:"default:false"` // 可同步的通行密钥
+	LastUsedAt     *time.Time `json:"last_used_at"`
+
+	// Relationships
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
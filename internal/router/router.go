@@ -58,17 +58,20 @@ func SetupRouter(cfg *config.Config, jwtManager *utils.JWTManager) *gin.Engine {
 	r.GET("/public/cas-server-info", handlers.GetCASServerInfoHandler)
 	r.GET("/public/saml-server-info", handlers.GetSAMLServerInfoHandler)
 	r.GET("/public/oidc-server-info", handlers.GetOIDCServerInfoHandler)
+	r.GET("/public/login-key", handlers.GetLoginKeyHandler)
 
 	// CAS协议端点（不需要认证）- 改进版实现
 	cas := r.Group("/cas")
 	{
 		cas.GET("/login", handlers.CASLoginHandlerImproved)
-		cas.POST("/login", handlers.CASLoginSubmitHandlerImproved)
+		cas.POST("/login", middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyIP), handlers.CASLoginSubmitHandlerImproved)
 		cas.GET("/validate", handlers.CASValidateHandlerImproved)
 		cas.GET("/serviceValidate", handlers.CASServiceValidateHandlerImproved)
-		cas.GET("/proxyValidate", handlers.CASProxyValidateHandler) // Keep original for now
-		cas.GET("/proxy", handlers.CASProxyHandler)                 // Keep original for now
-		cas.GET("/logout", handlers.CASLogoutHandler)               // Keep original for now
+		cas.GET("/proxyValidate", handlers.CASProxyValidateHandler)
+		cas.GET("/p3/serviceValidate", handlers.CASP3ServiceValidateHandler)
+		cas.GET("/p3/proxyValidate", handlers.CASP3ProxyValidateHandler)
+		cas.GET("/proxy", handlers.CASProxyHandler)
+		cas.GET("/logout", handlers.CASLogoutHandler)
 	}
 
 	// SAML协议端点（不需要认证）- 使用crewjam/saml库
@@ -81,6 +84,22 @@ func SetupRouter(cfg *config.Config, jwtManager *utils.JWTManager) *gin.Engine {
 		saml.Any("/login", handlers.SAMLSSOHandlerIDP) // Alternative login endpoint
 	}
 
+	// OAuth2/OIDC协议端点（客户端认证在处理器内完成）
+	oauth2 := r.Group("/oauth2")
+	{
+		oauth2.GET("/authorize", handlers.OAuth2AuthorizeHandler)
+		oauth2.POST("/token", middleware.RateLimitMiddleware(middleware.RateLimitPolicyOAuth2TokenIP, middleware.RateLimitKeyIP), handlers.OAuth2TokenHandler)
+		oauth2.POST("/introspect", handlers.OAuth2IntrospectHandler)
+		oauth2.POST("/revoke", handlers.OAuth2RevokeHandler)
+		oauth2.GET("/userinfo", handlers.OIDCUserInfoHandler)
+		oauth2.POST("/userinfo", handlers.OIDCUserInfoHandler)
+	}
+
+	// OIDC发现端点
+	r.GET("/.well-known/openid-configuration", handlers.OIDCDiscoveryHandler)
+	r.GET("/.well-known/openid_configuration", handlers.OIDCDiscoveryHandler) // 兼容server-info中公布的地址
+	r.GET("/.well-known/jwks.json", handlers.OIDCJWKSHandler)
+
 	// API路由组
 	api := r.Group("/api")
 	{
@@ -88,10 +107,11 @@ func SetupRouter(cfg *config.Config, jwtManager *utils.JWTManager) *gin.Engine {
 		{
 			// 公开API端点（不需要认证）
 			v1.GET("/public/site-info", handlers.GetPublicSiteInfoHandler)
+			v1.GET("/public/login-key", handlers.GetLoginKeyHandler)
 			// 通用认证API
 			auth := v1.Group("/auth")
 			{
-				auth.POST("/login", handlers.LoginHandler)
+				auth.POST("/login", middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyIP), handlers.LoginHandler)
 				auth.POST("/refresh", handlers.RefreshTokenHandler)
 				auth.POST("/logout", middleware.AuthMiddleware(jwtManager, sessionManager), handlers.LogoutHandler)
 			}
@@ -117,12 +137,18 @@ func SetupRouter(cfg *config.Config, jwtManager *utils.JWTManager) *gin.Engine {
 func setupConsoleRoutes(console *gin.RouterGroup, jwtManager *utils.JWTManager) {
 	// 获取sessionManager实例
 	sessionManager := handlers.GetSessionManager()
+	// 高风险操作要求5分钟内使用密码登录或重新认证过，仅凭备用码或动态码不能通过
+	consoleStepUp := middleware.StepUpMiddleware(5*time.Minute, utils.AMRPassword)
 	// 管理员认证
 	auth := console.Group("/auth")
 	{
-		auth.POST("/login", handlers.ConsoleLoginHandler)
+		auth.POST("/login", middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyIP), handlers.ConsoleLoginHandler)
+		auth.POST("/webauthn/begin", middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyIP), handlers.WebAuthnLoginBeginHandler)
+		auth.POST("/webauthn/finish", middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyIP), handlers.ConsoleWebAuthnLoginFinishHandler)
 		auth.POST("/logout", middleware.AuthMiddleware(jwtManager, sessionManager), handlers.LogoutHandler)
 		auth.POST("/refresh", handlers.ConsoleRefreshTokenHandler)
+		auth.POST("/reauth", middleware.AuthMiddleware(jwtManager, sessionManager), middleware.DenyImpersonationMiddleware(), middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyUser), handlers.ReauthHandler)
+		auth.POST("/reauth/webauthn/begin", middleware.AuthMiddleware(jwtManager, sessionManager), middleware.DenyImpersonationMiddleware(), handlers.ReauthWebAuthnBeginHandler)
 		auth.GET("/me", middleware.AuthMiddleware(jwtManager, sessionManager), handlers.ConsoleGetMeHandler)
 	}
 
@@ -131,10 +157,11 @@ func setupConsoleRoutes(console *gin.RouterGroup, jwtManager *utils.JWTManager)
 	sessions.Use(middleware.AuthMiddleware(jwtManager, sessionManager))
 	sessions.Use(middleware.AdminMiddleware())
 	{
-		sessions.GET("", handlers.GetAllSessionsHandler)                        // 获取所有在线会话
-		sessions.GET("/users/:userID", handlers.GetUserSessionsHandler)         // 获取用户会话列表
-		sessions.DELETE("/users/:userID", handlers.ForceLogoutUserHandler)      // 强制用户下线
-		sessions.POST("/force-logout-all", handlers.ForceLogoutAllUsersHandler) // 强制所有用户下线
+		sessions.GET("", handlers.GetAllSessionsHandler)                                       // 获取所有在线会话
+		sessions.GET("/users/:userID", handlers.GetUserSessionsHandler)                        // 获取用户会话列表
+		sessions.DELETE("/users/:userID", handlers.ForceLogoutUserHandler)                     // 强制用户下线
+		sessions.POST("/force-logout-all", consoleStepUp, handlers.ForceLogoutAllUsersHandler) // 强制所有用户下线
+		sessions.DELETE("/impersonations/:sessionID", handlers.EndImpersonationHandler)        // 结束代登录会话
 	}
 
 	// 用户管理（需要管理员权限）
@@ -143,10 +170,14 @@ func setupConsoleRoutes(console *gin.RouterGroup, jwtManager *utils.JWTManager)
 	users.Use(middleware.AdminMiddleware())
 	{
 		users.GET("", handlers.GetUsersHandler)
+		users.GET("/locked", handlers.GetLockedAccountsHandler)
 		users.POST("", handlers.CreateUserHandler)
 		users.GET("/:id", handlers.GetUserHandler)
 		users.PUT("/:id", handlers.UpdateUserHandler)
-		users.DELETE("/:id", handlers.DeleteUserHandler)
+		users.DELETE("/:id", consoleStepUp, handlers.DeleteUserHandler)
+		users.POST("/:id/reset-mfa", consoleStepUp, handlers.ResetUserMFAHandler)
+		users.POST("/:id/unlock", handlers.UnlockAccountHandler)
+		users.POST("/:id/impersonate", consoleStepUp, handlers.ImpersonateUserHandler) // 代登录用户门户
 	}
 
 	// 组织管理（需要管理员权限）
@@ -179,8 +210,8 @@ func setupConsoleRoutes(console *gin.RouterGroup, jwtManager *utils.JWTManager)
 	administrators.Use(middleware.AdminMiddleware())
 	{
 		administrators.GET("", handlers.GetAdministratorsHandler)
-		administrators.POST("/assign", handlers.AssignAdministratorRoleHandler)
-		administrators.DELETE("/:userID/:roleID", handlers.RemoveAdministratorRoleHandler)
+		administrators.POST("/assign", consoleStepUp, handlers.AssignAdministratorRoleHandler)
+		administrators.DELETE("/:userID/:roleID", consoleStepUp, handlers.RemoveAdministratorRoleHandler)
 	}
 
 	// 权限管理（需要管理员权限）
@@ -234,6 +265,7 @@ func setupConsoleRoutes(console *gin.RouterGroup, jwtManager *utils.JWTManager)
 		applications.POST("", handlers.CreateApplicationHandler)
 		applications.PUT("/:id", handlers.UpdateApplicationHandler)
 		applications.DELETE("/:id", handlers.DeleteApplicationHandler)
+		applications.POST("/saml/import-metadata", handlers.ImportSAMLMetadataHandler)
 	}
 
 	// 应用分组管理（需要管理员权限）
@@ -265,10 +297,25 @@ func setupConsoleRoutes(console *gin.RouterGroup, jwtManager *utils.JWTManager)
 		system.GET("/site-settings", handlers.GetSiteSettingsHandler)
 		system.PUT("/site-settings", handlers.UpdateSiteSettingsHandler)
 		system.GET("/security-settings", handlers.GetSecuritySettingsHandler)
-		system.PUT("/security-settings", handlers.UpdateSecuritySettingsHandler)
+		system.PUT("/security-settings", consoleStepUp, handlers.UpdateSecuritySettingsHandler)
+		system.GET("/rate-limit-settings", handlers.GetRateLimitSettingsHandler)
+		system.PUT("/rate-limit-settings", consoleStepUp, handlers.UpdateRateLimitSettingsHandler)
 		system.POST("/upload-logo", handlers.UploadLogoHandler)
 	}
 
+	// SAML IdP签名密钥管理（需要管理员权限）
+	samlKeys := console.Group("/saml-keys")
+	samlKeys.Use(middleware.AuthMiddleware(jwtManager, sessionManager))
+	samlKeys.Use(middleware.AdminMiddleware())
+	{
+		samlKeys.GET("", handlers.GetSAMLKeysHandler)
+		samlKeys.POST("/generate", handlers.GenerateSAMLKeyHandler)
+		samlKeys.POST("/upload", consoleStepUp, handlers.UploadSAMLKeyHandler)
+		samlKeys.PUT("/:id/activation", consoleStepUp, handlers.ScheduleSAMLKeyActivationHandler)
+		samlKeys.POST("/:id/activate", consoleStepUp, handlers.ActivateSAMLKeyHandler)
+		samlKeys.DELETE("/:id", handlers.DeleteSAMLKeyHandler)
+	}
+
 	// 密码策略管理（需要管理员权限）
 	passwordPolicy := console.Group("/password-policy")
 	passwordPolicy.Use(middleware.AuthMiddleware(jwtManager, sessionManager))
@@ -278,6 +325,14 @@ func setupConsoleRoutes(console *gin.RouterGroup, jwtManager *utils.JWTManager)
 		passwordPolicy.PUT("", handlers.UpdatePasswordPolicyHandler)
 		passwordPolicy.POST("/validate", handlers.ValidatePasswordHandler)
 		passwordPolicy.POST("/generate", handlers.GeneratePasswordHandler)
+		passwordPolicy.GET("/hash-report", handlers.GetPasswordHashReportHandler)
+		passwordPolicy.GET("/screening", handlers.GetPasswordScreeningHandler)
+		passwordPolicy.POST("/screening/reload", handlers.ReloadPasswordScreeningHandler)
+		passwordPolicy.GET("/policies", handlers.GetScopedPasswordPoliciesHandler)
+		passwordPolicy.POST("/policies", handlers.CreateScopedPasswordPolicyHandler)
+		passwordPolicy.PUT("/policies/:id", handlers.UpdateScopedPasswordPolicyHandler)
+		passwordPolicy.DELETE("/policies/:id", handlers.DeleteScopedPasswordPolicyHandler)
+		passwordPolicy.GET("/effective/:user_id", handlers.GetEffectivePasswordPolicyHandler)
 	}
 
 	// 系统API（需要管理员权限）
@@ -306,28 +361,36 @@ func setupConsoleRoutes(console *gin.RouterGroup, jwtManager *utils.JWTManager)
 func setupPortalRoutes(portal *gin.RouterGroup, jwtManager *utils.JWTManager) {
 	// 获取sessionManager实例
 	sessionManager := handlers.GetSessionManager()
+	// 修改认证方式要求10分钟内登录或重新认证过
+	portalStepUp := middleware.StepUpMiddleware(10 * time.Minute)
+	// 管理员代登录时不能修改登录凭据和联系方式，也不能登录应用
+	noImpersonation := middleware.DenyImpersonationMiddleware()
 	// 用户认证
 	auth := portal.Group("/auth")
 	{
-		auth.POST("/login", handlers.PortalLoginHandler)
+		auth.POST("/login", middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyIP), handlers.PortalLoginHandler)
+		auth.POST("/webauthn/begin", middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyIP), handlers.WebAuthnLoginBeginHandler)
+		auth.POST("/webauthn/finish", middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyIP), handlers.PortalWebAuthnLoginFinishHandler)
 		auth.POST("/logout", middleware.AuthMiddleware(jwtManager, sessionManager), handlers.PortalLogoutHandler)
 		auth.POST("/refresh", handlers.PortalRefreshTokenHandler)
+		auth.POST("/reauth", middleware.AuthMiddleware(jwtManager, sessionManager), noImpersonation, middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyUser), handlers.ReauthHandler)
+		auth.POST("/reauth/webauthn/begin", middleware.AuthMiddleware(jwtManager, sessionManager), noImpersonation, handlers.ReauthWebAuthnBeginHandler)
 		auth.GET("/me", middleware.AuthMiddleware(jwtManager, sessionManager), handlers.PortalGetMeHandler)
 	}
 
 	// OTP相关
 	otp := portal.Group("/otp")
 	{
-		otp.POST("/send", handlers.SendOTPHandler)
-		otp.POST("/verify", handlers.VerifyOTPHandler)
+		otp.POST("/send", middleware.RateLimitMiddleware(middleware.RateLimitPolicyOTPSend, middleware.RateLimitKeyIP), handlers.SendOTPHandler)
+		otp.POST("/verify", middleware.RateLimitMiddleware(middleware.RateLimitPolicyLogin, middleware.RateLimitKeyIP), handlers.VerifyOTPHandler)
 	}
 
 	// 密码管理
 	password := portal.Group("/password")
 	{
-		password.POST("/forgot", handlers.ForgotPasswordHandler)
-		password.POST("/reset", handlers.ResetPasswordHandler)
-		password.PUT("/change", middleware.AuthMiddleware(jwtManager, sessionManager), handlers.ChangePasswordHandler)
+		password.POST("/forgot", middleware.RateLimitMiddleware(middleware.RateLimitPolicyPasswordReset, middleware.RateLimitKeyIP), handlers.ForgotPasswordHandler)
+		password.POST("/reset", middleware.RateLimitMiddleware(middleware.RateLimitPolicyPasswordReset, middleware.RateLimitKeyIP), handlers.ResetPasswordHandler)
+		password.PUT("/change", middleware.PasswordChangeAuthMiddleware(jwtManager, sessionManager), noImpersonation, handlers.ChangePasswordHandler)
 	}
 
 	// 用户资料管理（需要认证）
@@ -335,21 +398,31 @@ func setupPortalRoutes(portal *gin.RouterGroup, jwtManager *utils.JWTManager) {
 	profile.Use(middleware.AuthMiddleware(jwtManager, sessionManager))
 	{
 		profile.GET("", handlers.GetProfileHandler)
-		profile.PUT("", handlers.UpdateProfileHandler)
+		profile.PUT("", noImpersonation, handlers.UpdateProfileHandler)
 		profile.POST("/avatar", handlers.UploadAvatarHandler)
-		profile.PUT("/password", handlers.ChangePasswordHandler)
-		profile.POST("/verify-email", handlers.VerifyEmailHandler)
-		profile.POST("/setup-otp", handlers.SetupOTPHandler)
-		profile.POST("/disable-otp", handlers.DisableOTPHandler)
-		profile.GET("/backup-codes", handlers.GetBackupCodesHandler)
+		profile.PUT("/password", noImpersonation, handlers.ChangePasswordHandler)
+		profile.POST("/verify-email", noImpersonation, handlers.VerifyEmailHandler)
+		profile.POST("/verify-email/send", noImpersonation, middleware.RateLimitMiddleware(middleware.RateLimitPolicyOTPSend, middleware.RateLimitKeyUser), handlers.SendEmailVerificationHandler)
+		profile.POST("/email", noImpersonation, middleware.RateLimitMiddleware(middleware.RateLimitPolicyOTPSend, middleware.RateLimitKeyUser), handlers.ChangeEmailHandler)
+		profile.POST("/verify-phone", noImpersonation, handlers.VerifyPhoneHandler)
+		profile.POST("/verify-phone/send", noImpersonation, middleware.RateLimitMiddleware(middleware.RateLimitPolicyOTPSend, middleware.RateLimitKeyUser), handlers.SendPhoneVerificationHandler)
+		profile.POST("/phone", noImpersonation, middleware.RateLimitMiddleware(middleware.RateLimitPolicyOTPSend, middleware.RateLimitKeyUser), handlers.ChangePhoneHandler)
+		profile.POST("/setup-otp", noImpersonation, handlers.SetupOTPHandler)
+		profile.POST("/disable-otp", noImpersonation, handlers.DisableOTPHandler)
+		profile.GET("/backup-codes", noImpersonation, handlers.GetBackupCodesHandler)
+		profile.POST("/backup-codes", portalStepUp, handlers.RegenerateBackupCodesHandler)
+		profile.POST("/webauthn/register/begin", portalStepUp, handlers.WebAuthnRegisterBeginHandler)
+		profile.POST("/webauthn/register/finish", noImpersonation, handlers.WebAuthnRegisterFinishHandler)
+		profile.GET("/webauthn/credentials", handlers.ListWebAuthnCredentialsHandler)
+		profile.DELETE("/webauthn/credentials/:id", portalStepUp, handlers.DeleteWebAuthnCredentialHandler)
 	}
 
 	// OTP设置（需要认证）
 	otpSettings := portal.Group("/otp-settings")
 	otpSettings.Use(middleware.AuthMiddleware(jwtManager, sessionManager))
 	{
-		otpSettings.POST("/enable", handlers.EnableOTPHandler)
-		otpSettings.POST("/disable", handlers.DisableOTPHandler)
+		otpSettings.POST("/enable", noImpersonation, handlers.EnableOTPHandler)
+		otpSettings.POST("/disable", noImpersonation, handlers.DisableOTPHandler)
 	}
 
 	// 用户应用（需要认证）
@@ -358,7 +431,7 @@ func setupPortalRoutes(portal *gin.RouterGroup, jwtManager *utils.JWTManager) {
 	{
 		userApps.GET("", handlers.GetUserApplicationsHandler)
 		userApps.GET("/:id", handlers.GetUserApplicationHandler)
-		userApps.GET("/:id/launch", handlers.LaunchApplicationHandler) // 应用启动端点
+		userApps.GET("/:id/launch", noImpersonation, handlers.LaunchApplicationHandler) // 应用启动端点
 	}
 }
 
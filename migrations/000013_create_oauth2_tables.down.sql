@@ -0,0 +1,3 @@
+-- 删除OAuth2相关表
+DROP TABLE IF EXISTS `oauth2_access_tokens`;
+DROP TABLE IF EXISTS `oauth2_authorization_codes`;
@@ -0,0 +1,42 @@
+-- 创建OAuth2相关表
+
+-- OAuth2授权码表
+CREATE TABLE IF NOT EXISTS `oauth2_authorization_codes` (
+    `id` varchar(36) NOT NULL PRIMARY KEY,
+    `created_at` datetime(3) NOT NULL,
+    `updated_at` datetime(3) NOT NULL,
+    `deleted_at` datetime(3) NULL,
+    `code` varchar(255) NOT NULL UNIQUE,
+    `client_id` varchar(100) NOT NULL,
+    `user_id` varchar(36) NOT NULL,
+    `redirect_uri` varchar(500) NOT NULL,
+    `scope` varchar(500),
+    `state` varchar(255),
+    `challenge` varchar(255),
+    `challenge_method` varchar(10),
+    `expires_at` datetime(3) NOT NULL,
+    `used` boolean DEFAULT false,
+    INDEX `idx_oauth2_authorization_codes_client_id` (`client_id`),
+    INDEX `idx_oauth2_authorization_codes_user_id` (`user_id`),
+    INDEX `idx_oauth2_authorization_codes_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- OAuth2访问令牌表（client_credentials模式的令牌user_id为空）
+CREATE TABLE IF NOT EXISTS `oauth2_access_tokens` (
+    `id` varchar(36) NOT NULL PRIMARY KEY,
+    `created_at` datetime(3) NOT NULL,
+    `updated_at` datetime(3) NOT NULL,
+    `deleted_at` datetime(3) NULL,
+    `access_token` varchar(500) NOT NULL UNIQUE,
+    `refresh_token` varchar(500) NULL UNIQUE,
+    `client_id` varchar(100) NOT NULL,
+    `user_id` varchar(36) NOT NULL,
+    `scope` varchar(500),
+    `token_type` varchar(50) DEFAULT 'Bearer',
+    `expires_at` datetime(3) NOT NULL,
+    `refresh_expires_at` datetime(3) NULL,
+    INDEX `idx_oauth2_access_tokens_client_id` (`client_id`),
+    INDEX `idx_oauth2_access_tokens_user_id` (`user_id`),
+    INDEX `idx_oauth2_access_tokens_expires_at` (`expires_at`),
+    INDEX `idx_oauth2_access_tokens_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
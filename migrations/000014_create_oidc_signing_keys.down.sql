@@ -0,0 +1,4 @@
+-- 删除OIDC相关表和字段
+ALTER TABLE `oauth2_authorization_codes` DROP COLUMN `auth_time`;
+ALTER TABLE `oauth2_authorization_codes` DROP COLUMN `nonce`;
+DROP TABLE IF EXISTS `signing_keys`;
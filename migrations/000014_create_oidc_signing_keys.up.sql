@@ -0,0 +1,22 @@
+-- 创建OIDC相关表和字段
+
+-- 协议签名密钥表
+CREATE TABLE IF NOT EXISTS `signing_keys` (
+    `id` varchar(36) NOT NULL PRIMARY KEY,
+    `created_at` datetime(3) NOT NULL,
+    `updated_at` datetime(3) NOT NULL,
+    `deleted_at` datetime(3) NULL,
+    `key_id` varchar(64) NOT NULL UNIQUE,
+    `purpose` varchar(20) NOT NULL,
+    `algorithm` varchar(20) NOT NULL,
+    `private_key` text NOT NULL,
+    `public_key` text NOT NULL,
+    `active` boolean DEFAULT true,
+    INDEX `idx_signing_keys_purpose` (`purpose`),
+    INDEX `idx_signing_keys_active` (`active`),
+    INDEX `idx_signing_keys_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 授权码表增加OIDC字段
+ALTER TABLE `oauth2_authorization_codes` ADD COLUMN `nonce` varchar(255) NULL COMMENT 'OIDC nonce' AFTER `challenge_method`;
+ALTER TABLE `oauth2_authorization_codes` ADD COLUMN `auth_time` datetime(3) NULL COMMENT '用户认证时间' AFTER `nonce`;
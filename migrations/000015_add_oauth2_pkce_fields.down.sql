@@ -0,0 +1,3 @@
+-- 删除OAuth2公共客户端和PKCE策略字段
+ALTER TABLE `applications` DROP COLUMN `require_pkce`;
+ALTER TABLE `applications` DROP COLUMN `public_client`;
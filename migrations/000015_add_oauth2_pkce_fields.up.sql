@@ -0,0 +1,3 @@
+-- 添加OAuth2公共客户端和PKCE策略字段
+ALTER TABLE `applications` ADD COLUMN `public_client` boolean DEFAULT false COMMENT '公共客户端(不使用ClientSecret)' AFTER `refresh_token_ttl`;
+ALTER TABLE `applications` ADD COLUMN `require_pkce` boolean DEFAULT false COMMENT '强制使用PKCE' AFTER `public_client`;
@@ -0,0 +1,6 @@
+-- 回滚SAML IdP签名密钥轮换字段
+DELETE FROM `signing_keys` WHERE `purpose` = 'saml';
+ALTER TABLE `signing_keys` ALTER COLUMN `active` SET DEFAULT true;
+ALTER TABLE `signing_keys` DROP COLUMN `retired_at`;
+ALTER TABLE `signing_keys` DROP COLUMN `activates_at`;
+ALTER TABLE `signing_keys` DROP COLUMN `certificate`;
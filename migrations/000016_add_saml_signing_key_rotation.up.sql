@@ -0,0 +1,8 @@
+-- 支持SAML IdP签名密钥持久化和轮换
+
+ALTER TABLE `signing_keys` ADD COLUMN `certificate` text NULL COMMENT 'PEM格式X.509证书' AFTER `active`;
+ALTER TABLE `signing_keys` ADD COLUMN `activates_at` datetime(3) NULL COMMENT '计划启用时间' AFTER `certificate`;
+ALTER TABLE `signing_keys` ADD COLUMN `retired_at` datetime(3) NULL COMMENT '退役时间' AFTER `activates_at`;
+
+-- 待启用密钥需要显式写入active=false
+ALTER TABLE `signing_keys` ALTER COLUMN `active` SET DEFAULT false;
@@ -0,0 +1,16 @@
+-- 回滚SAML断言记录字段
+DROP INDEX `idx_saml_assertions_deleted_at` ON `saml_assertions`;
+DROP INDEX `idx_saml_assertions_client_id` ON `saml_assertions`;
+DROP INDEX `idx_saml_assertions_in_response_to` ON `saml_assertions`;
+
+ALTER TABLE `saml_assertions` DROP COLUMN `deleted_at`;
+ALTER TABLE `saml_assertions` DROP COLUMN `encrypted`;
+ALTER TABLE `saml_assertions` DROP COLUMN `attributes`;
+ALTER TABLE `saml_assertions` DROP COLUMN `session_index`;
+ALTER TABLE `saml_assertions` DROP COLUMN `name_id_format`;
+ALTER TABLE `saml_assertions` DROP COLUMN `name_id`;
+ALTER TABLE `saml_assertions` DROP COLUMN `recipient`;
+ALTER TABLE `saml_assertions` DROP COLUMN `client_id`;
+ALTER TABLE `saml_assertions` DROP COLUMN `in_response_to`;
+DELETE FROM `saml_assertions` WHERE `username` IS NULL;
+ALTER TABLE `saml_assertions` MODIFY COLUMN `username` varchar(100) NOT NULL;
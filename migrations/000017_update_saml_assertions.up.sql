@@ -0,0 +1,16 @@
+-- SAML断言记录：签名响应审计和AuthnRequest防重放
+
+ALTER TABLE `saml_assertions` MODIFY COLUMN `username` varchar(100) NULL;
+ALTER TABLE `saml_assertions` ADD COLUMN `in_response_to` varchar(255) NULL COMMENT 'SP AuthnRequest ID' AFTER `assertion_id`;
+ALTER TABLE `saml_assertions` ADD COLUMN `client_id` varchar(100) NOT NULL DEFAULT '' COMMENT '应用ClientID' AFTER `user_id`;
+ALTER TABLE `saml_assertions` ADD COLUMN `recipient` varchar(500) NOT NULL DEFAULT '' COMMENT 'ACS地址' AFTER `client_id`;
+ALTER TABLE `saml_assertions` ADD COLUMN `name_id` varchar(255) NOT NULL DEFAULT '' COMMENT 'NameID' AFTER `audience`;
+ALTER TABLE `saml_assertions` ADD COLUMN `name_id_format` varchar(255) NULL COMMENT 'NameID格式' AFTER `name_id`;
+ALTER TABLE `saml_assertions` ADD COLUMN `session_index` varchar(255) NULL COMMENT '会话索引' AFTER `name_id_format`;
+ALTER TABLE `saml_assertions` ADD COLUMN `attributes` text NULL COMMENT '下发属性(JSON)' AFTER `session_index`;
+ALTER TABLE `saml_assertions` ADD COLUMN `encrypted` boolean DEFAULT false COMMENT '断言是否加密' AFTER `attributes`;
+ALTER TABLE `saml_assertions` ADD COLUMN `deleted_at` datetime(3) NULL AFTER `updated_at`;
+
+CREATE INDEX `idx_saml_assertions_in_response_to` ON `saml_assertions` (`in_response_to`);
+CREATE INDEX `idx_saml_assertions_client_id` ON `saml_assertions` (`client_id`);
+CREATE INDEX `idx_saml_assertions_deleted_at` ON `saml_assertions` (`deleted_at`);
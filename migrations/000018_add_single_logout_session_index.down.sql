@@ -0,0 +1,5 @@
+-- 回滚单点注销会话索引
+DROP INDEX `idx_saml_assertions_session_index` ON `saml_assertions`;
+
+DROP INDEX `idx_cas_service_tickets_session_index` ON `cas_service_tickets`;
+ALTER TABLE `cas_service_tickets` DROP COLUMN `session_index`;
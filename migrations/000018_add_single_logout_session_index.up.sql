@@ -0,0 +1,6 @@
+-- 单点注销：记录CAS票据所属的平台会话索引
+ALTER TABLE `cas_service_tickets` ADD COLUMN `session_index` varchar(64) NULL COMMENT '平台会话索引' AFTER `username`;
+CREATE INDEX `idx_cas_service_tickets_session_index` ON `cas_service_tickets` (`session_index`);
+
+-- 按会话索引查找签发过断言的SAML应用
+CREATE INDEX `idx_saml_assertions_session_index` ON `saml_assertions` (`session_index`);
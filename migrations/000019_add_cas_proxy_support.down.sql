@@ -0,0 +1,11 @@
+-- 回滚CAS代理支持
+ALTER TABLE `cas_proxy_tickets` DROP COLUMN `proxies`;
+
+DROP INDEX `idx_cas_proxy_granting_tickets_session_index` ON `cas_proxy_granting_tickets`;
+ALTER TABLE `cas_proxy_granting_tickets` DROP COLUMN `session_index`;
+ALTER TABLE `cas_proxy_granting_tickets` DROP COLUMN `proxies`;
+ALTER TABLE `cas_proxy_granting_tickets` DROP COLUMN `proxy_callback_url`;
+ALTER TABLE `cas_proxy_granting_tickets` DROP COLUMN `service`;
+
+ALTER TABLE `applications` DROP COLUMN `proxy_callback_patterns`;
+ALTER TABLE `applications` DROP COLUMN `allow_proxy`;
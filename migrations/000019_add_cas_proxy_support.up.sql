@@ -0,0 +1,13 @@
+-- CAS代理：应用级代理开关和允许的回调地址
+ALTER TABLE `applications` ADD COLUMN `allow_proxy` boolean DEFAULT false COMMENT '允许作为代理获取PGT' AFTER `attribute_mapping`;
+ALTER TABLE `applications` ADD COLUMN `proxy_callback_patterns` text NULL COMMENT '允许的pgtUrl正则，每行一个' AFTER `allow_proxy`;
+
+-- 代理授权票据记录代理链和所属会话
+ALTER TABLE `cas_proxy_granting_tickets` ADD COLUMN `service` varchar(500) NULL COMMENT '获得PGT的代理服务' AFTER `username`;
+ALTER TABLE `cas_proxy_granting_tickets` ADD COLUMN `proxy_callback_url` varchar(500) NULL COMMENT 'pgtUrl回调地址' AFTER `service`;
+ALTER TABLE `cas_proxy_granting_tickets` ADD COLUMN `proxies` text NULL COMMENT '代理链(JSON)' AFTER `proxy_callback_url`;
+ALTER TABLE `cas_proxy_granting_tickets` ADD COLUMN `session_index` varchar(64) NULL COMMENT '平台会话索引' AFTER `proxies`;
+CREATE INDEX `idx_cas_proxy_granting_tickets_session_index` ON `cas_proxy_granting_tickets` (`session_index`);
+
+-- 代理票据记录代理链
+ALTER TABLE `cas_proxy_tickets` ADD COLUMN `proxies` text NULL COMMENT '代理链(JSON)' AFTER `proxy_granting_ticket`;
@@ -0,0 +1,2 @@
+-- 回滚CAS服务票据登录来源字段
+ALTER TABLE `cas_service_tickets` DROP COLUMN `from_new_login`;
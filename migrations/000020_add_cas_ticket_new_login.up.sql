@@ -0,0 +1,2 @@
+-- CAS renew：记录服务票据是否由输入凭据登录签发
+ALTER TABLE `cas_service_tickets` ADD COLUMN `from_new_login` boolean DEFAULT false COMMENT '是否由本次凭据登录签发' AFTER `used`;
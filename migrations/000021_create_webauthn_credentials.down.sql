@@ -0,0 +1,3 @@
+-- 删除WebAuthn凭据表
+DELETE FROM system_settings WHERE `key` = 'enable_webauthn' AND category = 'security';
+DROP TABLE IF EXISTS `webauthn_credentials`;
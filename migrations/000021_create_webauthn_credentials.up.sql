@@ -0,0 +1,25 @@
+-- WebAuthn凭据表
+CREATE TABLE IF NOT EXISTS `webauthn_credentials` (
+    `id` varchar(36) NOT NULL PRIMARY KEY,
+    `created_at` datetime(3) NOT NULL,
+    `updated_at` datetime(3) NOT NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` varchar(36) NOT NULL,
+    `credential_id` varchar(255) NOT NULL UNIQUE COMMENT '凭据ID(base64url)',
+    `public_key` text NOT NULL COMMENT 'COSE公钥(base64url)',
+    `algorithm` int NOT NULL COMMENT 'COSE算法',
+    `sign_count` int unsigned DEFAULT 0 COMMENT '签名计数',
+    `transports` varchar(255) NULL COMMENT '传输方式，逗号分隔',
+    `friendly_name` varchar(100) NULL COMMENT '用户设置的名称',
+    `aaguid` varchar(36) NULL COMMENT '认证器型号标识',
+    `backup_eligible` boolean DEFAULT false COMMENT '是否为可同步的通行密钥',
+    `last_used_at` datetime(3) NULL,
+    INDEX `idx_webauthn_credentials_user_id` (`user_id`),
+    INDEX `idx_webauthn_credentials_deleted_at` (`deleted_at`),
+    FOREIGN KEY (`user_id`) REFERENCES `users`(`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- WebAuthn开关
+INSERT INTO system_settings (id, `key`, value, description, category, type, created_at, updated_at) VALUES
+('security-026', 'enable_webauthn', 'true', 'Enable WebAuthn security keys and passkeys', 'security', 'boolean', NOW(), NOW())
+ON DUPLICATE KEY UPDATE updated_at = NOW();
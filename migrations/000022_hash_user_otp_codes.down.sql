@@ -0,0 +1,3 @@
+-- 恢复动态码字段长度，HMAC无法还原，直接清空记录
+DELETE FROM `user_otp_records`;
+ALTER TABLE `user_otp_records` MODIFY COLUMN `code` VARCHAR(32) NOT NULL;
@@ -0,0 +1,3 @@
+-- 邮件/短信动态码改为保存HMAC，旧的明文记录全部作废
+UPDATE `user_otp_records` SET `used` = true WHERE `used` = false;
+ALTER TABLE `user_otp_records` MODIFY COLUMN `code` VARCHAR(64) NOT NULL COMMENT '动态码的HMAC';
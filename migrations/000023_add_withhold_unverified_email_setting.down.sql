@@ -0,0 +1,2 @@
+-- 删除未验证邮箱下发开关
+DELETE FROM system_settings WHERE `key` = 'withhold_unverified_email' AND category = 'security';
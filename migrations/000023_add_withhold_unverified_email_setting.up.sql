@@ -0,0 +1,4 @@
+-- 是否向CAS/SAML/OIDC应用隐藏未验证的邮箱
+INSERT INTO system_settings (id, `key`, value, description, category, type, created_at, updated_at) VALUES
+('security-027', 'withhold_unverified_email', 'false', 'Do not release unverified email addresses to applications', 'security', 'boolean', NOW(), NOW())
+ON DUPLICATE KEY UPDATE updated_at = NOW();
@@ -0,0 +1,2 @@
+-- 删除接口限流规则
+DELETE FROM system_settings WHERE category = 'rate_limit';
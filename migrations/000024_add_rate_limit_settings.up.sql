@@ -0,0 +1,7 @@
+-- 接口限流规则，value为JSON：enabled是否启用，limit为窗口内最大请求数，window为窗口长度（秒）
+INSERT INTO system_settings (id, `key`, value, description, category, type, created_at, updated_at) VALUES
+('rate-limit-001', 'rate_limit_login', '{"enabled":true,"limit":30,"window":60}', 'Sign-in requests per client IP', 'rate_limit', 'json', NOW(), NOW()),
+('rate-limit-002', 'rate_limit_otp_send', '{"enabled":true,"limit":10,"window":60}', 'Verification code requests per client IP or user', 'rate_limit', 'json', NOW(), NOW()),
+('rate-limit-003', 'rate_limit_password_reset', '{"enabled":true,"limit":10,"window":300}', 'Password reset requests per client IP', 'rate_limit', 'json', NOW(), NOW()),
+('rate-limit-004', 'rate_limit_oauth2_token', '{"enabled":true,"limit":300,"window":60}', 'OAuth2 token requests per client', 'rate_limit', 'json', NOW(), NOW())
+ON DUPLICATE KEY UPDATE updated_at = NOW();
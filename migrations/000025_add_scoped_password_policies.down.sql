@@ -0,0 +1,21 @@
+-- 删除组织和角色密码策略，恢复为单一全局策略
+DELETE FROM `password_policies` WHERE `scope` <> 'global';
+ALTER TABLE `password_policies`
+    DROP INDEX `idx_password_policies_scope`,
+    DROP COLUMN `priority`,
+    DROP COLUMN `include_sub_orgs`,
+    DROP COLUMN `scope_id`,
+    DROP COLUMN `scope`,
+    DROP COLUMN `name`;
+
+-- 恢复安全设置中的密码策略字段
+INSERT INTO system_settings (id, `key`, value, description, category, type, created_at, updated_at) VALUES
+('security-001', 'min_password_length', '8', 'Minimum password length', 'security', 'number', NOW(), NOW()),
+('security-002', 'max_password_length', '128', 'Maximum password length', 'security', 'number', NOW(), NOW()),
+('security-003', 'password_expiry_days', '90', 'Password expiry in days', 'security', 'number', NOW(), NOW()),
+('security-004', 'require_uppercase', 'true', 'Require uppercase letters in password', 'security', 'boolean', NOW(), NOW()),
+('security-005', 'require_lowercase', 'true', 'Require lowercase letters in password', 'security', 'boolean', NOW(), NOW()),
+('security-006', 'require_numbers', 'true', 'Require numbers in password', 'security', 'boolean', NOW(), NOW()),
+('security-007', 'require_special_chars', 'true', 'Require special characters in password', 'security', 'boolean', NOW(), NOW()),
+('security-008', 'password_history_count', '5', 'Number of previous passwords to remember', 'security', 'number', NOW(), NOW())
+ON DUPLICATE KEY UPDATE updated_at = NOW();
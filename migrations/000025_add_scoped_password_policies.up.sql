@@ -0,0 +1,16 @@
+-- 密码策略支持绑定到组织（含下级组织）或角色，原有策略作为全局策略
+ALTER TABLE `password_policies`
+    ADD COLUMN `name` VARCHAR(100) NULL COMMENT '策略名称' AFTER `id`,
+    ADD COLUMN `scope` VARCHAR(20) NOT NULL DEFAULT 'global' COMMENT '作用范围：global, organization, role' AFTER `name`,
+    ADD COLUMN `scope_id` VARCHAR(36) NULL COMMENT '组织ID或角色ID' AFTER `scope`,
+    ADD COLUMN `include_sub_orgs` BOOLEAN DEFAULT TRUE COMMENT '组织策略是否作用于下级组织' AFTER `scope_id`,
+    ADD COLUMN `priority` INT DEFAULT 0 COMMENT '多个角色策略同时适用时优先级高的生效' AFTER `include_sub_orgs`,
+    ADD INDEX `idx_password_policies_scope` (`scope`, `scope_id`);
+
+UPDATE `password_policies` SET `name` = 'Global password policy' WHERE `scope` = 'global' AND `name` IS NULL;
+
+-- 安全设置中重复的密码策略字段不再使用，以password_policies为准
+DELETE FROM system_settings WHERE category = 'security' AND `key` IN (
+    'min_password_length', 'max_password_length', 'password_expiry_days', 'require_uppercase',
+    'require_lowercase', 'require_numbers', 'require_special_chars', 'password_history_count'
+);
@@ -0,0 +1,4 @@
+-- 删除审计日志的代登录管理员字段
+ALTER TABLE `audit_logs`
+    DROP INDEX `idx_audit_logs_actor_id`,
+    DROP COLUMN `actor_id`;
@@ -0,0 +1,4 @@
+-- 管理员代登录期间的操作同时记录被代登录用户和实际操作的管理员
+ALTER TABLE `audit_logs`
+    ADD COLUMN `actor_id` VARCHAR(36) NULL COMMENT '代登录时实际操作的管理员ID' AFTER `user_id`,
+    ADD INDEX `idx_audit_logs_actor_id` (`actor_id`);
@@ -0,0 +1,2 @@
+-- 删除令牌的用户认证时间
+ALTER TABLE `oauth2_access_tokens` DROP COLUMN `auth_time`;
@@ -0,0 +1,3 @@
+-- 记录令牌对应的用户认证时间，刷新令牌时签发的ID Token沿用原始认证时间
+ALTER TABLE `oauth2_access_tokens`
+    ADD COLUMN `auth_time` DATETIME(3) NULL COMMENT 'OIDC 用户认证时间' AFTER `refresh_expires_at`;
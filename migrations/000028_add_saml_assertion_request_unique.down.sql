@@ -0,0 +1,3 @@
+-- 回滚AuthnRequest唯一索引
+DROP INDEX `idx_saml_assertions_client_request` ON `saml_assertions`;
+CREATE INDEX `idx_saml_assertions_in_response_to` ON `saml_assertions` (`in_response_to`);
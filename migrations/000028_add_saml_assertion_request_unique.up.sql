@@ -0,0 +1,6 @@
+-- AuthnRequest防重放改为唯一索引，避免并发提交同一请求时都签发断言
+-- IdP发起的断言没有请求ID，置为NULL不参与唯一约束
+UPDATE `saml_assertions` SET `in_response_to` = NULL WHERE `in_response_to` = '';
+
+DROP INDEX `idx_saml_assertions_in_response_to` ON `saml_assertions`;
+CREATE UNIQUE INDEX `idx_saml_assertions_client_request` ON `saml_assertions` (`client_id`, `in_response_to`);
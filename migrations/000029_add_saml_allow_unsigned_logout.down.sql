@@ -0,0 +1,2 @@
+-- 回滚SAML未签名注销请求开关
+ALTER TABLE `applications` DROP COLUMN `allow_unsigned_logout`;
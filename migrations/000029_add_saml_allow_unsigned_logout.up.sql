@@ -0,0 +1,3 @@
+-- SAML单点注销：默认拒绝未签名的LogoutRequest，无法签名的SP需显式开启
+ALTER TABLE `applications`
+    ADD COLUMN `allow_unsigned_logout` BOOLEAN DEFAULT FALSE COMMENT '允许未签名的SAML注销请求' AFTER `digest_algorithm`;
@@ -0,0 +1,5 @@
+-- 删除OAuth2令牌端点的IP限流规则
+DELETE FROM system_settings WHERE `key` = 'rate_limit_oauth2_token_ip';
+
+UPDATE system_settings SET description = 'OAuth2 token requests per client'
+WHERE `key` = 'rate_limit_oauth2_token';
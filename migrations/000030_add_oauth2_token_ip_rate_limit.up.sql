@@ -0,0 +1,7 @@
+-- OAuth2令牌端点在客户端认证前按IP限流，认证通过后再按client_id限流
+INSERT INTO system_settings (id, `key`, value, description, category, type, created_at, updated_at) VALUES
+('rate-limit-005', 'rate_limit_oauth2_token_ip', '{"enabled":true,"limit":600,"window":60}', 'OAuth2 token requests per client IP before client authentication', 'rate_limit', 'json', NOW(), NOW())
+ON DUPLICATE KEY UPDATE updated_at = NOW();
+
+UPDATE system_settings SET description = 'OAuth2 token requests per authenticated client'
+WHERE `key` = 'rate_limit_oauth2_token';
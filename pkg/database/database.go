@@ -53,6 +53,8 @@ func InitDatabase(cfg *config.DatabaseConfig) error {
 			SingularTable: false,
 		},
 		Logger: gormLogger.Default.LogMode(gormLogger.Info),
+		// 将唯一键冲突等驱动错误转换为gorm.ErrDuplicatedKey，便于跨数据库判断
+		TranslateError: true,
 	}
 
 	var err error
@@ -14,8 +14,19 @@ const (
 	SuccessOTPVerified     = "OTP verified successfully"
 	SuccessPasswordChanged = "Password changed successfully"
 	SuccessPasswordReset   = "Password reset successfully"
+	PasswordResetCodeSent  = "If the account exists, a verification code has been sent"
+	EmailVerificationSent  = "Verification code sent to your email address"
+	EmailChangePending     = "Verification code sent to the new email address. The change takes effect once it is verified."
+	SuccessEmailVerified   = "Email address verified successfully"
+	PhoneVerificationSent  = "Verification code sent to your phone"
+	PhoneChangePending     = "Verification code sent to the new phone number. The change takes effect once it is verified."
+	SuccessPhoneVerified   = "Phone number verified successfully"
 	SuccessOTPEnabled      = "OTP enabled successfully"
 	SuccessOTPDisabled     = "OTP disabled successfully"
+	MFAReset               = "MFA reset successfully"
+	AccountUnlocked        = "Account unlocked successfully"
+	PasswordListReloaded   = "Password screening dataset reloaded successfully"
+	ReauthSuccess          = "Re-authenticated successfully"
 
 	// Error messages
 	InvalidCredentials       = "Invalid username or password. Please check your credentials."
@@ -36,10 +47,42 @@ const (
 	InvalidPhone             = "Invalid phone format"
 	WeakPassword             = "Password is too weak"
 	OldPassword              = "Old password is incorrect"
+	PasswordUnchanged        = "New password must be different from the current password"
+	PasswordChangeRequired   = "Your password must be changed before you can continue"
+	PasswordChangeInPortal   = "Your password must be changed. Please sign in to the user portal to change it."
 	InvalidRequestData       = "Invalid request data"
 	UserInactive             = "Your account has been deactivated. Please contact administrator."
 	AccountLocked            = "Account is locked due to multiple failed login attempts. Please contact administrator or try again later."
+	LoginThrottled           = "Too many failed sign-in attempts. Please try again later."
+	RateLimitExceeded        = "Too many requests. Please try again later."
+	LoginKeyExpired          = "The sign-in encryption key has expired. Please try again."
+	InvalidEncryptedPassword = "Invalid encrypted password"
+	EncryptedPasswordReused  = "This sign-in request has already been used. Please try again."
+	PasswordEncryptionNeeded = "The password must be encrypted with the sign-in encryption key"
+	PasswordListReloadFailed = "Failed to reload password screening dataset"
+	ReauthRequired           = "Please verify your identity again to continue"
 	OTPRequired              = "OTP verification required"
+	OTPAlreadyEnabled        = "OTP is already enabled"
+	OTPNotEnabled            = "OTP is not enabled"
+	OTPEnrollmentExpired     = "OTP enrollment expired. Please set up OTP again."
+	OTPEnrollmentRequired    = "OTP must be enrolled by the user before it can be enabled"
+	TOTPDisabled             = "TOTP is disabled by the administrator"
+	BackupCodesDisabled      = "Backup codes are disabled by the administrator"
+	MFARequired              = "Multi-factor verification required"
+	WebAuthnDisabled         = "Security keys and passkeys are disabled by the administrator"
+	InvalidWebAuthn          = "Security key or passkey verification failed"
+	WebAuthnCredentialExists = "This security key is already registered"
+	OTPChannelDisabled       = "This verification channel is disabled by the administrator"
+	OTPRateLimited           = "Too many verification codes requested. Please try again later."
+	OTPSendFailed            = "Failed to send verification code"
+	OTPAttemptsExceeded      = "Too many incorrect attempts. Please request a new code."
+	EmailNotSet              = "No email address is set for this account"
+	EmailAlreadyVerified     = "Email address is already verified"
+	EmailUnchanged           = "New email address must be different from the current one"
+	PhoneNotSet              = "No phone number is set for this account"
+	PhoneAlreadyVerified     = "Phone number is already verified"
+	PhoneUnchanged           = "New phone number must be different from the current one"
+	PhoneChangeRequired      = "Phone number can only be changed after verifying the new number"
 
 	// Status messages
 	StatusHealthy      = "healthy"
@@ -71,6 +114,7 @@ const (
 	OrganizationNotFound        = "Organization not found"
 	OrganizationExists          = "Organization already exists"
 	EmailExists                 = "Email already exists"
+	PhoneExists                 = "Phone number already exists"
 	ManagerNotFound             = "Manager user not found"
 	CannotDeleteOrgWithChildren = "Cannot delete organization with child organizations"
 	CannotDeleteOrgWithUsers    = "Cannot delete organization with users"
@@ -90,6 +134,17 @@ const (
 	AppGroupCreated             = "Application group created successfully"
 	AppGroupUpdated             = "Application group updated successfully"
 	AppGroupDeleted             = "Application group deleted successfully"
+	RoleNotFound                = "Role not found"
+	PasswordPolicyNotFound      = "Password policy not found"
+	PasswordPolicyExists        = "An active password policy already exists for this organization or role"
+	PasswordPolicyCreated       = "Password policy created successfully"
+	PasswordPolicyUpdated       = "Password policy updated successfully"
+	PasswordPolicyDeleted       = "Password policy deleted successfully"
+	ImpersonationStarted        = "Impersonation session created successfully"
+	ImpersonationDisabled       = "User impersonation is disabled"
+	CannotImpersonateUser       = "This user cannot be impersonated"
+	ImpersonationReadOnly       = "This impersonation session is read-only"
+	ImpersonationNotAllowed     = "This operation is not available while impersonating a user"
 
 	// System messages
 	SystemStartup          = "EIAM IdP platform starting..."
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"eiam-platform/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// logChannel 开发环境使用的渠道，把消息写入文件或服务日志而不真正发送
+type logChannel struct {
+	kind string
+	path string
+	mu   sync.Mutex
+}
+
+func newLogChannel(kind, path string) *logChannel {
+	return &logChannel{kind: kind, path: path}
+}
+
+func (l *logChannel) Name() string {
+	return "log"
+}
+
+func (l *logChannel) Send(ctx context.Context, msg *Message) error {
+	if l.path == "" {
+		logger.ServiceInfo("Notification message",
+			zap.String("channel", l.kind),
+			zap.String("to", msg.To),
+			zap.String("subject", msg.Subject),
+			zap.String("body", msg.Body),
+		)
+		return nil
+	}
+
+	line, err := json.Marshal(map[string]string{
+		"time":    time.Now().Format(time.RFC3339),
+		"channel": l.kind,
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"eiam-platform/config"
+	"eiam-platform/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 通知渠道类型
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// ErrChannelUnavailable 渠道未初始化
+var ErrChannelUnavailable = errors.New("notification channel is not configured")
+
+// Message 通知消息，短信渠道只使用Body
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Channel 通知渠道
+type Channel interface {
+	// Name 渠道实现名称，用于日志
+	Name() string
+	// Send 发送消息，返回nil表示消息已被邮件服务器或短信网关接受
+	Send(ctx context.Context, msg *Message) error
+}
+
+var (
+	channelsMu sync.RWMutex
+	channels   = map[string]Channel{}
+)
+
+// InitNotify 根据配置初始化邮件和短信渠道
+func InitNotify(cfg *config.NotificationConfig) error {
+	email, err := newEmailChannel(&cfg.Email, cfg.LogFile)
+	if err != nil {
+		return fmt.Errorf("email channel: %v", err)
+	}
+	sms, err := newSMSChannel(&cfg.SMS, cfg.LogFile)
+	if err != nil {
+		return fmt.Errorf("sms channel: %v", err)
+	}
+
+	Register(ChannelEmail, email)
+	Register(ChannelSMS, sms)
+
+	logger.Info("Notification channels initialized",
+		zap.String("email", email.Name()),
+		zap.String("sms", sms.Name()),
+	)
+	if email.Name() == "log" || sms.Name() == "log" {
+		logger.Warn("Notification log driver is enabled, messages are not delivered to users")
+	}
+	return nil
+}
+
+// Register 注册或替换指定类型的渠道
+func Register(kind string, channel Channel) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	channels[kind] = channel
+}
+
+// GetChannel 获取指定类型的渠道
+func GetChannel(kind string) (Channel, error) {
+	channelsMu.RLock()
+	defer channelsMu.RUnlock()
+	channel, ok := channels[kind]
+	if !ok {
+		return nil, ErrChannelUnavailable
+	}
+	return channel, nil
+}
+
+// Send 通过指定类型的渠道发送消息
+func Send(ctx context.Context, kind string, msg *Message) error {
+	channel, err := GetChannel(kind)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return errors.New("invalid recipient or subject")
+	}
+	return channel.Send(ctx, msg)
+}
+
+func newEmailChannel(cfg *config.EmailConfig, logFile string) (Channel, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return newSMTPChannel(cfg)
+	case "", "log":
+		return newLogChannel(ChannelEmail, logFile), nil
+	}
+	return nil, fmt.Errorf("unsupported driver %q", cfg.Driver)
+}
+
+func newSMSChannel(cfg *config.SMSConfig, logFile string) (Channel, error) {
+	switch cfg.Driver {
+	case "http":
+		return newHTTPSMSChannel(cfg)
+	case "", "log":
+		return newLogChannel(ChannelSMS, logFile), nil
+	}
+	return nil, fmt.Errorf("unsupported driver %q", cfg.Driver)
+}
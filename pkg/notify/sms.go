@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"eiam-platform/config"
+)
+
+// httpSMSChannel 通用HTTP短信网关，把手机号和短信内容连同固定参数提交给网关
+type httpSMSChannel struct {
+	cfg    config.SMSConfig
+	client *http.Client
+}
+
+func newHTTPSMSChannel(cfg *config.SMSConfig) (*httpSMSChannel, error) {
+	target, err := url.Parse(cfg.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.New("a valid sms gateway url is required")
+	}
+	switch cfg.ContentType {
+	case "", "json", "form":
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", cfg.ContentType)
+	}
+
+	channel := &httpSMSChannel{cfg: *cfg, client: &http.Client{Timeout: 10 * time.Second}}
+	if channel.cfg.Method == "" {
+		channel.cfg.Method = http.MethodPost
+	}
+	if channel.cfg.ToField == "" {
+		channel.cfg.ToField = "to"
+	}
+	if channel.cfg.MessageField == "" {
+		channel.cfg.MessageField = "message"
+	}
+	if cfg.Timeout > 0 {
+		channel.client.Timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	return channel, nil
+}
+
+func (h *httpSMSChannel) Name() string {
+	return "http"
+}
+
+func (h *httpSMSChannel) Send(ctx context.Context, msg *Message) error {
+	params := make(map[string]string, len(h.cfg.Params)+2)
+	for k, v := range h.cfg.Params {
+		params[k] = v
+	}
+	params[h.cfg.ToField] = msg.To
+	params[h.cfg.MessageField] = msg.Body
+
+	var body []byte
+	contentType := "application/json"
+	if h.cfg.ContentType == "form" {
+		values := url.Values{}
+		for k, v := range params {
+			values.Set(k, v)
+		}
+		body = []byte(values.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	} else {
+		var err error
+		if body, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(h.cfg.Method), h.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range h.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sms gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	return nil
+}
@@ -211,3 +211,13 @@ func FlushDB() error {
 func Keys(pattern string) ([]string, error) {
 	return RDB.Keys(ctx, pattern).Result()
 }
+
+// ScanKeys 使用SCAN增量获取匹配的键，不会像KEYS一样阻塞Redis
+func ScanKeys(pattern string) ([]string, error) {
+	var keys []string
+	iter := RDB.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
@@ -29,6 +29,17 @@ type SessionInfo struct {
 	LastActivity      time.Time `json:"last_activity"`
 	ExpiresAt         time.Time `json:"expires_at"`
 	TokenID           string    `json:"token_id"` // JWT Token ID
+
+	// 管理员代登录的会话
+	ImpersonatorID       string `json:"impersonator_id,omitempty"`
+	ImpersonatorUsername string `json:"impersonator_username,omitempty"`
+	ImpersonationReason  string `json:"impersonation_reason,omitempty"`
+	ReadOnly             bool   `json:"read_only,omitempty"`
+}
+
+// Impersonated 是否为管理员代登录的会话
+func (s *SessionInfo) Impersonated() bool {
+	return s.ImpersonatorID != ""
 }
 
 // SessionManager 会话管理器
@@ -126,6 +137,65 @@ func (sm *SessionManager) CreateSession(ctx context.Context, userID, username, e
 	return sessionID, nil
 }
 
+// CreateImpersonationSession 为管理员代登录创建会话
+// 不受单设备模式影响，用户自己的会话保持有效
+func (sm *SessionManager) CreateImpersonationSession(ctx context.Context, userID, username, email, displayName, impersonatorID, impersonatorUsername, reason, loginIP, userAgent string, readOnly bool, expireDuration time.Duration) (string, error) {
+	sessionID := utils.GenerateTradeIDString("session")
+	now := time.Now()
+
+	sessionInfo := &SessionInfo{
+		SessionID:            sessionID,
+		UserID:               userID,
+		Username:             username,
+		Email:                email,
+		DisplayName:          displayName,
+		LoginIP:              loginIP,
+		UserAgent:            userAgent,
+		DeviceFingerprint:    sm.generateDeviceFingerprint(loginIP, userAgent),
+		DeviceType:           sm.detectDeviceType(userAgent),
+		LoginTime:            now,
+		LastActivity:         now,
+		ExpiresAt:            now.Add(expireDuration),
+		ImpersonatorID:       impersonatorID,
+		ImpersonatorUsername: impersonatorUsername,
+		ImpersonationReason:  reason,
+		ReadOnly:             readOnly,
+	}
+
+	sessionData, err := json.Marshal(sessionInfo)
+	if err != nil {
+		sm.logger.Error("Failed to marshal session info", zap.Error(err))
+		return "", err
+	}
+
+	sessionKey := fmt.Sprintf("session:%s", sessionID)
+	userSessionKey := fmt.Sprintf("user_sessions:%s", userID)
+
+	// 不缩短用户会话列表的有效期
+	ttl, _ := sm.redisClient.TTL(ctx, userSessionKey).Result()
+
+	pipe := sm.redisClient.Pipeline()
+	pipe.Set(ctx, sessionKey, sessionData, expireDuration)
+	pipe.SAdd(ctx, userSessionKey, sessionID)
+	if ttl < expireDuration {
+		pipe.Expire(ctx, userSessionKey, expireDuration)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		sm.logger.Error("Failed to create session in Redis", zap.Error(err))
+		return "", err
+	}
+
+	sm.logger.Info("Impersonation session created",
+		zap.String("session_id", sessionID),
+		zap.String("user_id", userID),
+		zap.String("username", username),
+		zap.String("impersonator_id", impersonatorID),
+		zap.Bool("read_only", readOnly),
+	)
+
+	return sessionID, nil
+}
+
 // GetSession 获取会话信息
 func (sm *SessionManager) GetSession(ctx context.Context, sessionID string) (*SessionInfo, error) {
 	sessionKey := fmt.Sprintf("session:%s", sessionID)
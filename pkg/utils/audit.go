@@ -18,6 +18,8 @@ const (
 	AuditActionDelete = "delete"
 	AuditActionLogin  = "login"
 	AuditActionLogout = "logout"
+
+	AuditActionImpersonate = "impersonate" // 管理员代登录及代登录期间的请求
 )
 
 // AuditResource 审计资源类型
@@ -38,6 +40,9 @@ func CreateAuditLog(c *gin.Context, action, resource, resourceID, description st
 		userID = "system" // 系统操作
 	}
 
+	// 代登录时同时记录实际操作的管理员
+	actorID := c.GetString("actor_id")
+
 	// 获取IP地址
 	ipAddress := c.ClientIP()
 	if ipAddress == "" {
@@ -58,6 +63,7 @@ func CreateAuditLog(c *gin.Context, action, resource, resourceID, description st
 	// 创建审计日志记录
 	auditLog := models.AuditLog{
 		UserID:      userID,
+		ActorID:     actorID,
 		Action:      action,
 		Resource:    resource,
 		ResourceID:  resourceID,
@@ -84,6 +90,9 @@ func CreateAuditLogWithError(c *gin.Context, action, resource, resourceID, descr
 		userID = "system" // 系统操作
 	}
 
+	// 代登录时同时记录实际操作的管理员
+	actorID := c.GetString("actor_id")
+
 	// 获取IP地址
 	ipAddress := c.ClientIP()
 	if ipAddress == "" {
@@ -104,6 +113,7 @@ func CreateAuditLogWithError(c *gin.Context, action, resource, resourceID, descr
 	// 创建审计日志记录
 	auditLog := models.AuditLog{
 		UserID:      userID,
+		ActorID:     actorID,
 		Action:      action,
 		Resource:    resource,
 		ResourceID:  resourceID,
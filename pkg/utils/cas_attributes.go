@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"eiam-platform/internal/models"
 )
@@ -108,6 +112,10 @@ func getUserFieldValue(user *models.User, field string) interface{} {
 	case "username", "user_name":
 		return user.Username
 	case "email", "email_address":
+		// 没有邮箱或邮箱不允许下发时不返回该属性
+		if user.Email == "" {
+			return nil
+		}
 		return user.Email
 	case "display_name", "displayname", "full_name":
 		return user.DisplayName
@@ -128,15 +136,26 @@ func getUserFieldValue(user *models.User, field string) interface{} {
 }
 
 // FormatAttributesForCAS 格式化属性为CAS XML格式
+// 属性按名称排序，值做XML转义，多值属性输出多个同名元素
 func FormatAttributesForCAS(attributes map[string]interface{}) string {
 	if len(attributes) == 0 {
 		return ""
 	}
 
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	var parts []string
-	for key, value := range attributes {
-		if value != nil {
-			parts = append(parts, fmt.Sprintf("            <cas:%s>%v</cas:%s>", key, value, key))
+	for _, key := range keys {
+		for _, value := range casAttributeValues(attributes[key]) {
+			var escaped bytes.Buffer
+			if err := xml.EscapeText(&escaped, []byte(value)); err != nil {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("            <cas:%s>%s</cas:%s>", key, escaped.String(), key))
 		}
 	}
 
@@ -152,12 +171,43 @@ func FormatAttributesForCAS(attributes map[string]interface{}) string {
 
 // FormatAttributesForJSON 格式化属性为JSON格式
 func FormatAttributesForJSON(attributes map[string]interface{}) map[string]interface{} {
-	// 过滤掉nil值
+	// 过滤掉nil值，时间统一为RFC3339格式
 	result := make(map[string]interface{})
 	for key, value := range attributes {
-		if value != nil {
-			result[key] = value
+		if normalized := normalizeCASAttributeValue(value); normalized != nil {
+			result[key] = normalized
 		}
 	}
 	return result
 }
+
+// casAttributeValues 将属性值转换为字符串列表，nil值返回空列表
+func casAttributeValues(value interface{}) []string {
+	switch v := normalizeCASAttributeValue(value).(type) {
+	case nil:
+		return nil
+	case []string:
+		return v
+	default:
+		return []string{fmt.Sprintf("%v", v)}
+	}
+}
+
+// normalizeCASAttributeValue 解引用时间指针并格式化时间
+func normalizeCASAttributeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.Format(time.RFC3339)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case *string:
+		if v == nil {
+			return nil
+		}
+		return *v
+	}
+	return value
+}
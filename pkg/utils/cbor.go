@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// 本文件实现WebAuthn所需的最小CBOR(RFC 8949)解码，只支持定长编码
+// 认证器按CTAP2规范输出确定性编码，不会出现不定长数组、映射或字符串
+
+// cborMaxDepth 最大嵌套深度，防止恶意数据导致栈溢出
+const cborMaxDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// DecodeCBOR 解码一个CBOR数据项，返回解码值和消耗的字节数
+// 整数解码为int64，字节串为[]byte，文本为string，数组为[]interface{}，映射为map[interface{}]interface{}
+func DecodeCBOR(data []byte) (interface{}, int, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > cborMaxDepth {
+		return nil, 0, errors.New("cbor: nesting too deep")
+	}
+	if len(data) == 0 {
+		return nil, 0, errCBORTruncated
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	// 简单值和浮点数
+	if major == 7 {
+		return decodeCBORSimple(data, info)
+	}
+
+	arg, offset, err := decodeCBORArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, 0, errors.New("cbor: integer overflow")
+		}
+		return int64(arg), offset, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, 0, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(arg), offset, nil
+	case 2, 3:
+		if arg > uint64(len(data)-offset) {
+			return nil, 0, errCBORTruncated
+		}
+		end := offset + int(arg)
+		if major == 2 {
+			value := make([]byte, arg)
+			copy(value, data[offset:end])
+			return value, end, nil
+		}
+		return string(data[offset:end]), end, nil
+	case 4:
+		// 每个元素至少占1字节
+		if arg > uint64(len(data)-offset) {
+			return nil, 0, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, n, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			offset += n
+		}
+		return items, offset, nil
+	case 5:
+		if arg > uint64(len(data)-offset)/2 {
+			return nil, 0, errCBORTruncated
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, n, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+			if _, exists := items[key]; exists {
+				return nil, 0, errors.New("cbor: duplicate map key")
+			}
+
+			value, n, err := decodeCBORItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+			items[key] = value
+		}
+		return items, offset, nil
+	case 6:
+		// 标签：忽略标签号，返回被标记的数据项
+		value, n, err := decodeCBORItem(data[offset:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return value, offset + n, nil
+	}
+	return nil, 0, fmt.Errorf("cbor: unsupported major type %d", major)
+}
+
+// decodeCBORArgument 解析数据项头部的参数（长度或整数值）
+func decodeCBORArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24:
+		if len(data) < 2 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(data[1]), 2, nil
+	case info == 25:
+		if len(data) < 3 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data[1:3])), 3, nil
+	case info == 26:
+		if len(data) < 5 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data[1:5])), 5, nil
+	case info == 27:
+		if len(data) < 9 {
+			return 0, 0, errCBORTruncated
+		}
+		return binary.BigEndian.Uint64(data[1:9]), 9, nil
+	}
+	return 0, 0, errors.New("cbor: indefinite length items are not supported")
+}
+
+// decodeCBORSimple 解析false/true/null/undefined及浮点数
+func decodeCBORSimple(data []byte, info byte) (interface{}, int, error) {
+	switch info {
+	case 20:
+		return false, 1, nil
+	case 21:
+		return true, 1, nil
+	case 22, 23:
+		return nil, 1, nil
+	case 25:
+		if len(data) < 3 {
+			return nil, 0, errCBORTruncated
+		}
+		return float16ToFloat64(binary.BigEndian.Uint16(data[1:3])), 3, nil
+	case 26:
+		if len(data) < 5 {
+			return nil, 0, errCBORTruncated
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data[1:5]))), 5, nil
+	case 27:
+		if len(data) < 9 {
+			return nil, 0, errCBORTruncated
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data[1:9])), 9, nil
+	}
+	return nil, 0, fmt.Errorf("cbor: unsupported simple value %d", info)
+}
+
+// float16ToFloat64 半精度浮点数转换
+func float16ToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1.0
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(mant+1024, exp-25)
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return data
+}
+
+// 示例取自RFC 8949附录A
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		want interface{}
+		n    int
+	}{
+		{"uint 0", "00", int64(0), 1},
+		{"uint 23", "17", int64(23), 1},
+		{"uint 24", "1818", int64(24), 2},
+		{"uint 1000", "1903e8", int64(1000), 3},
+		{"uint 1000000", "1a000f4240", int64(1000000), 5},
+		{"uint 1000000000000", "1b000000e8d4a51000", int64(1000000000000), 9},
+		{"uint max int64", "1b7fffffffffffffff", int64(math.MaxInt64), 9},
+		{"nint -1", "20", int64(-1), 1},
+		{"nint -10", "29", int64(-10), 1},
+		{"nint -100", "3863", int64(-100), 2},
+		{"nint -1000", "3903e7", int64(-1000), 3},
+		{"empty bytes", "40", []byte{}, 1},
+		{"bytes", "4401020304", []byte{1, 2, 3, 4}, 5},
+		{"empty text", "60", "", 1},
+		{"text a", "6161", "a", 2},
+		{"text IETF", "6449455446", "IETF", 5},
+		{"text unicode", "62c3bc", "ü", 3},
+		{"empty array", "80", []interface{}{}, 1},
+		{"array", "83010203", []interface{}{int64(1), int64(2), int64(3)}, 4},
+		{"nested array", "8301820203820405", []interface{}{
+			int64(1),
+			[]interface{}{int64(2), int64(3)},
+			[]interface{}{int64(4), int64(5)},
+		}, 8},
+		{"empty map", "a0", map[interface{}]interface{}{}, 1},
+		{"int map", "a201020304", map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}, 5},
+		{"text map", "a26161016162820203", map[interface{}]interface{}{
+			"a": int64(1),
+			"b": []interface{}{int64(2), int64(3)},
+		}, 9},
+		{"false", "f4", false, 1},
+		{"true", "f5", true, 1},
+		{"null", "f6", nil, 1},
+		{"undefined", "f7", nil, 1},
+		{"half 1.0", "f93c00", 1.0, 3},
+		{"half 65504", "f97bff", 65504.0, 3},
+		{"half subnormal", "f90001", 5.960464477539063e-8, 3},
+		{"half -4", "f9c400", -4.0, 3},
+		{"single 100000", "fa47c35000", 100000.0, 5},
+		{"double 1.1", "fb3ff199999999999a", 1.1, 9},
+		{"tagged epoch", "c11a514b67b0", int64(1363896240), 6},
+		{"trailing data", "0102", int64(1), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n, err := DecodeCBOR(mustHex(t, tt.hex))
+			if err != nil {
+				t.Fatalf("DecodeCBOR() error = %v", err)
+			}
+			if n != tt.n {
+				t.Errorf("DecodeCBOR() consumed %d bytes, want %d", n, tt.n)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeCBOR() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORSpecialFloats(t *testing.T) {
+	got, _, err := DecodeCBOR(mustHex(t, "f97c00"))
+	if err != nil || !math.IsInf(got.(float64), 1) {
+		t.Errorf("half +Inf = %v, %v", got, err)
+	}
+	got, _, err = DecodeCBOR(mustHex(t, "f9fc00"))
+	if err != nil || !math.IsInf(got.(float64), -1) {
+		t.Errorf("half -Inf = %v, %v", got, err)
+	}
+	got, _, err = DecodeCBOR(mustHex(t, "f97e00"))
+	if err != nil || !math.IsNaN(got.(float64)) {
+		t.Errorf("half NaN = %v, %v", got, err)
+	}
+}
+
+func TestDecodeCBORRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+	}{
+		// 截断
+		{"empty", ""},
+		{"uint8 missing", "18"},
+		{"uint16 short", "1903"},
+		{"uint32 short", "1a000f42"},
+		{"uint64 short", "1b000000e8d4a510"},
+		{"bytes short", "44010203"},
+		{"text short", "64494554"},
+		{"array short", "830102"},
+		{"map missing pair", "a20102"},
+		{"map value missing", "a101"},
+		{"tag missing item", "c1"},
+		{"half short", "f93c"},
+		{"single short", "fa47c350"},
+		{"double short", "fb3ff19999999999"},
+
+		// 长度超出实际数据
+		{"huge bytes", "5bffffffffffffffff00"},
+		{"huge text", "7bffffffffffffffff00"},
+		{"huge array", "9bffffffffffffffff00"},
+		{"huge map", "bbffffffffffffffff0000"},
+		{"bytes longer than data", "5a0000ffff00"},
+		{"array longer than data", "9a0000ffff00"},
+		{"map longer than data", "ba0000ffff0000"},
+		{"uint overflow", "1bffffffffffffffff"},
+		{"nint overflow", "3bffffffffffffffff"},
+		{"uint just over int64", "1b8000000000000000"},
+
+		// 不支持的编码
+		{"indefinite bytes", "5f4101ff"},
+		{"indefinite text", "7f6161ff"},
+		{"indefinite array", "9f01ff"},
+		{"indefinite map", "bf0101ff"},
+		{"reserved info", "1c"},
+		{"one byte simple", "f820"},
+		{"reserved simple", "fc"},
+		{"break", "ff"},
+		{"bytes map key", "a1410101"},
+		{"array map key", "a1800101"},
+		{"duplicate int key", "a201020103"},
+		{"duplicate text key", "a2616101616102"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, n, err := DecodeCBOR(mustHex(t, tt.hex)); err == nil {
+				t.Fatalf("DecodeCBOR() = %#v (%d bytes), want error", got, n)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORNestingLimit(t *testing.T) {
+	nested := func(prefix byte, depth int) []byte {
+		return append(bytes.Repeat([]byte{prefix}, depth), 0x00)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"arrays at limit", nested(0x81, cborMaxDepth), false},
+		{"arrays over limit", nested(0x81, cborMaxDepth+1), true},
+		{"tags at limit", nested(0xc0, cborMaxDepth), false},
+		{"tags over limit", nested(0xc0, cborMaxDepth+1), true},
+		{"maps over limit", append(bytes.Repeat([]byte{0xa1, 0x00}, cborMaxDepth+1), 0x00), true},
+		{"very deep arrays", nested(0x81, 1<<20), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := DecodeCBOR(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeCBOR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
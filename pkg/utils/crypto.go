@@ -3,17 +3,20 @@ package utils
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/md5"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"math/big"
 	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hash password using bcrypt (recommended) or MD5 (legacy)
+// HashPassword hash password using bcrypt, use PasswordHasher for the configured scheme
 func HashPassword(password string, cost int) (string, error) {
 	// 默认使用bcrypt加密
 	if cost == 0 {
@@ -27,45 +30,19 @@ func HashPassword(password string, cost int) (string, error) {
 	return string(hashedBytes), nil
 }
 
-// HashPasswordMD5 hash password using MD5 (legacy support)
-func HashPasswordMD5(password string) string {
-	hash := md5.Sum([]byte(password))
-	return fmt.Sprintf("%x", hash)
-}
-
-// CheckPassword verify password (supports both bcrypt and MD5)
+// CheckPassword verify password against an argon2id, bcrypt or legacy MD5 hash
+// 客户端提交的始终是明文密码，MD5哈希本身不能作为密码使用
 func CheckPassword(password, hash string) bool {
-	// 检查是否是bcrypt哈希（以$2a$, $2b$, $2x$, $2y$开头）
-	if strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") ||
-		strings.HasPrefix(hash, "$2x$") || strings.HasPrefix(hash, "$2y$") {
-		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-		return err == nil
-	}
-
-	// 兼容旧的MD5哈希
-	if len(hash) == 32 {
-		// 如果传入的密码已经是MD5格式，直接比较
-		if len(password) == 32 {
-			return password == hash
-		}
-		// 否则计算密码的MD5值
-		passwordHash := md5.Sum([]byte(password))
-		passwordHashStr := fmt.Sprintf("%x", passwordHash)
-		return passwordHashStr == hash
+	switch PasswordHashScheme(hash) {
+	case PasswordHashArgon2id:
+		return checkArgon2id(password, hash)
+	case PasswordHashBcrypt:
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case PasswordHashMD5:
+		return checkLegacyMD5(password, hash)
+	default:
+		return false
 	}
-
-	return false
-}
-
-// ShouldUpgradePassword 检查密码是否需要升级到bcrypt
-func ShouldUpgradePassword(hash string) bool {
-	// 如果是MD5哈希（32位十六进制），建议升级
-	return len(hash) == 32 && !strings.HasPrefix(hash, "$2")
-}
-
-// UpgradePasswordHash 将密码哈希升级到bcrypt
-func UpgradePasswordHash(plainPassword string) (string, error) {
-	return HashPassword(plainPassword, bcrypt.DefaultCost)
 }
 
 // GenerateSalt generate random salt
@@ -112,69 +89,98 @@ func GenerateClientID() (string, error) {
 	return GenerateRandomString(16)
 }
 
-// DecryptPassword decrypt password from frontend
-func DecryptPassword(encryptedPassword string) (string, error) {
-	// 加密密钥（应该与前端保持一致）
-	key := []byte("eiam-platform-2024")
-
-	// 如果密钥长度不是32字节，需要填充或截断
-	if len(key) < 32 {
-		// 填充到32字节
-		paddedKey := make([]byte, 32)
-		copy(paddedKey, key)
-		key = paddedKey
-	} else if len(key) > 32 {
-		// 截断到32字节
-		key = key[:32]
+// GenerateNumericCode 生成指定位数的数字验证码
+func GenerateNumericCode(digits int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
 	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
 
-	// 解码base64
-	ciphertext, err := base64.StdEncoding.DecodeString(encryptedPassword)
+// HashOneTimeCode 使用服务端密钥计算一次性验证码的HMAC，数据库泄露时也无法离线穷举短验证码
+func HashOneTimeCode(code, salt, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(salt + ":" + strings.TrimSpace(code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DecryptRSAOAEP decrypt base64 data encrypted with RSA-OAEP (SHA-256), such as passwords submitted by login clients
+func DecryptRSAOAEP(privateKey *rsa.PrivateKey, data string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(data)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode base64: %v", err)
+		return nil, fmt.Errorf("failed to decode base64: %v", err)
 	}
+	plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %v", err)
+	}
+	return plaintext, nil
+}
 
-	// 创建AES cipher
-	block, err := aes.NewCipher(key)
+// encryptedSecretPrefix 加密数据前缀，用于区分明文和密文
+const encryptedSecretPrefix = "enc:v1:"
+
+// EncryptSecret encrypt sensitive data (such as private keys) with AES-256-GCM
+func EncryptSecret(plaintext, secret string) (string, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
 	if err != nil {
 		return "", fmt.Errorf("failed to create cipher: %v", err)
 	}
 
-	// 检查密文长度
-	if len(ciphertext) < aes.BlockSize {
-		return "", fmt.Errorf("ciphertext too short")
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCM: %v", err)
 	}
 
-	// 提取IV
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
 
-	// 创建CBC解密器
-	mode := cipher.NewCBCDecrypter(block, iv)
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
 
-	// 解密
-	plaintext := make([]byte, len(ciphertext))
-	mode.CryptBlocks(plaintext, ciphertext)
+// DecryptSecret decrypt data produced by EncryptSecret, plaintext input is returned unchanged
+func DecryptSecret(data, secret string) (string, error) {
+	if !IsEncryptedSecret(data) {
+		return data, nil
+	}
 
-	// 去除填充
-	plaintext = removePKCS7Padding(plaintext)
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(data, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %v", err)
+	}
 
-	return string(plaintext), nil
-}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %v", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GCM: %v", err)
+	}
 
-// removePKCS7Padding removes PKCS7 padding
-func removePKCS7Padding(data []byte) []byte {
-	length := len(data)
-	if length == 0 {
-		return data
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
 	}
 
-	padding := int(data[length-1])
-	if padding > length {
-		return data
+	nonce := ciphertext[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %v", err)
 	}
+	return string(plaintext), nil
+}
 
-	return data[:length-padding]
+// IsEncryptedSecret check whether data was produced by EncryptSecret
+func IsEncryptedSecret(data string) bool {
+	return strings.HasPrefix(data, encryptedSecretPrefix)
 }
 
 // Base64Encode encode data to base64 string
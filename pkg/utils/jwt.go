@@ -11,24 +11,57 @@ import (
 
 // AccessTokenClaims access token claims
 type AccessTokenClaims struct {
-	UserID      string   `json:"user_id"`
-	Username    string   `json:"username"`
-	Email       string   `json:"email"`
-	DisplayName string   `json:"display_name"`
-	Roles       []string `json:"roles"`
-	Permissions []string `json:"permissions"`
-	SessionID   string   `json:"session_id"` // 添加session_id关联
-	TradeID     string   `json:"trade_id"`
-	TokenType   string   `json:"token_type"` // "access"
+	UserID      string      `json:"user_id"`
+	Username    string      `json:"username"`
+	Email       string      `json:"email"`
+	DisplayName string      `json:"display_name"`
+	Roles       []string    `json:"roles"`
+	Permissions []string    `json:"permissions"`
+	SessionID   string      `json:"session_id"` // 添加session_id关联
+	TradeID     string      `json:"trade_id"`
+	TokenType   string      `json:"token_type"`          // "access"
+	AuthTime    int64       `json:"auth_time,omitempty"` // 用户完成认证的时间，刷新令牌时不变
+	AMR         []string    `json:"amr,omitempty"`       // 认证方式
+	Act         *ActorClaim `json:"act,omitempty"`       // 代登录时实际操作的管理员
+	ReadOnly    bool        `json:"read_only,omitempty"` // 只允许读取操作
 	jwt.RegisteredClaims
 }
 
+// ActorClaim actor of an impersonation token (RFC 8693 act claim)
+type ActorClaim struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username,omitempty"`
+}
+
 // RefreshTokenClaims refresh token claims
 type RefreshTokenClaims struct {
+	UserID    string   `json:"user_id"`
+	SessionID string   `json:"session_id"`
+	TradeID   string   `json:"trade_id"`
+	TokenType string   `json:"token_type"` // "refresh"
+	AuthTime  int64    `json:"auth_time,omitempty"`
+	AMR       []string `json:"amr,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Authentication method references (RFC 8176) carried in the amr claim
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRHardwareKey = "hwk"
+	AMRMultiFactor = "mfa"
+)
+
+// PasswordChangeTokenType 受限令牌类型，只能用于修改密码
+const PasswordChangeTokenType = "password_change"
+
+// PasswordChangeClaims 登录时密码已过期或被要求修改而签发的受限令牌
+type PasswordChangeClaims struct {
 	UserID    string `json:"user_id"`
-	SessionID string `json:"session_id"`
+	Username  string `json:"username"`
+	Reason    string `json:"reason"` // expired, admin_required
 	TradeID   string `json:"trade_id"`
-	TokenType string `json:"token_type"` // "refresh"
+	TokenType string `json:"token_type"` // "password_change"
 	jwt.RegisteredClaims
 }
 
@@ -52,19 +85,28 @@ func NewJWTManager(cfg *config.JWTConfig) *JWTManager {
 
 // TokenInfo token information structure
 type TokenInfo struct {
-	UserID      string   `json:"user_id"`
-	Username    string   `json:"username"`
-	Email       string   `json:"email"`
-	DisplayName string   `json:"display_name"`
-	Roles       []string `json:"roles"`
-	Permissions []string `json:"permissions"`
-	SessionID   string   `json:"session_id"`
-	TradeID     string   `json:"trade_id"`
+	UserID      string        `json:"user_id"`
+	Username    string        `json:"username"`
+	Email       string        `json:"email"`
+	DisplayName string        `json:"display_name"`
+	Roles       []string      `json:"roles"`
+	Permissions []string      `json:"permissions"`
+	SessionID   string        `json:"session_id"`
+	TradeID     string        `json:"trade_id"`
+	AuthTime    int64         `json:"auth_time"` // unix seconds the user authenticated
+	AMR         []string      `json:"amr"`
+	Act         *ActorClaim   `json:"act,omitempty"`
+	ReadOnly    bool          `json:"read_only"`
+	ExpiresIn   time.Duration `json:"-"` // overrides the configured access token lifetime when set
 }
 
 // GenerateAccessToken generate access token
 func (j *JWTManager) GenerateAccessToken(tokenInfo *TokenInfo) (string, error) {
 	now := time.Now()
+	expiresIn := j.accessTokenDuration
+	if tokenInfo.ExpiresIn > 0 {
+		expiresIn = tokenInfo.ExpiresIn
+	}
 	claims := AccessTokenClaims{
 		UserID:      tokenInfo.UserID,
 		Username:    tokenInfo.Username,
@@ -75,8 +117,12 @@ func (j *JWTManager) GenerateAccessToken(tokenInfo *TokenInfo) (string, error) {
 		SessionID:   tokenInfo.SessionID, // 添加session_id
 		TradeID:     tokenInfo.TradeID,
 		TokenType:   "access",
+		AuthTime:    tokenInfo.AuthTime,
+		AMR:         tokenInfo.AMR,
+		Act:         tokenInfo.Act,
+		ReadOnly:    tokenInfo.ReadOnly,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(j.accessTokenDuration)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    j.issuer,
@@ -89,20 +135,22 @@ func (j *JWTManager) GenerateAccessToken(tokenInfo *TokenInfo) (string, error) {
 	return token.SignedString(j.secretKey)
 }
 
-// GenerateRefreshToken generate refresh token
-func (j *JWTManager) GenerateRefreshToken(userID, sessionID, tradeID string) (string, error) {
+// GenerateRefreshToken generate refresh token, auth_time and amr are kept for the refreshed access tokens
+func (j *JWTManager) GenerateRefreshToken(tokenInfo *TokenInfo) (string, error) {
 	now := time.Now()
 	claims := RefreshTokenClaims{
-		UserID:    userID,
-		SessionID: sessionID,
-		TradeID:   tradeID,
+		UserID:    tokenInfo.UserID,
+		SessionID: tokenInfo.SessionID,
+		TradeID:   tokenInfo.TradeID,
 		TokenType: "refresh",
+		AuthTime:  tokenInfo.AuthTime,
+		AMR:       tokenInfo.AMR,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(j.refreshTokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 			Issuer:    j.issuer,
-			Subject:   userID,
+			Subject:   tokenInfo.UserID,
 			ID:        GenerateTradeIDString("refresh"),
 		},
 	}
@@ -157,6 +205,29 @@ func (j *JWTManager) ValidateRefreshToken(tokenString string) (*RefreshTokenClai
 	return nil, errors.New("invalid refresh token")
 }
 
+// ValidatePasswordChangeToken validate password change token
+func (j *JWTManager) ValidatePasswordChangeToken(tokenString string) (*PasswordChangeClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &PasswordChangeClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return j.secretKey, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*PasswordChangeClaims); ok && token.Valid {
+		if claims.TokenType != PasswordChangeTokenType {
+			return nil, errors.New("token type mismatch")
+		}
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid password change token")
+}
+
 // ExtractTokenFromHeader extract token from request header
 func ExtractTokenFromHeader(authHeader string) string {
 	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
@@ -249,3 +320,26 @@ func ValidateRefreshToken(tokenString, secret string) (*RefreshTokenClaims, erro
 
 	return nil, errors.New("invalid refresh token")
 }
+
+// GeneratePasswordChangeToken generate password change token
+func GeneratePasswordChangeToken(userID, username, reason, secret string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := PasswordChangeClaims{
+		UserID:    userID,
+		Username:  username,
+		Reason:    reason,
+		TradeID:   GenerateTradeIDString("pwdchange"),
+		TokenType: PasswordChangeTokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "eiam-platform",
+			Subject:   userID,
+			ID:        GenerateTradeIDString("pwdchange"),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
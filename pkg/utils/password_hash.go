@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"eiam-platform/config"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash schemes. New passwords are hashed with argon2id (default) or bcrypt;
+// legacy MD5 hashes can only be verified and are replaced on the next successful login.
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashMD5      = "md5"
+	PasswordHashUnknown  = "unknown"
+)
+
+// Argon2idParams argon2id cost parameters
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams parameters used when none are configured (OWASP recommendation)
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// PasswordHasher hashes new passwords with the configured scheme and tells
+// whether a stored hash should be replaced
+type PasswordHasher struct {
+	Algorithm  string
+	Argon2id   Argon2idParams
+	BcryptCost int
+}
+
+// NewPasswordHasher create password hasher from encryption config, missing values use defaults
+func NewPasswordHasher(cfg *config.EncryptionConfig) *PasswordHasher {
+	hasher := &PasswordHasher{
+		Algorithm:  PasswordHashArgon2id,
+		Argon2id:   DefaultArgon2idParams,
+		BcryptCost: 12,
+	}
+	if cfg == nil {
+		return hasher
+	}
+
+	if cfg.PasswordHash == PasswordHashBcrypt {
+		hasher.Algorithm = PasswordHashBcrypt
+	}
+	if cfg.BcryptCost >= bcrypt.MinCost && cfg.BcryptCost <= bcrypt.MaxCost {
+		hasher.BcryptCost = cfg.BcryptCost
+	}
+	if cfg.Argon2Memory > 0 {
+		hasher.Argon2id.Memory = uint32(cfg.Argon2Memory)
+	}
+	if cfg.Argon2Iterations > 0 {
+		hasher.Argon2id.Iterations = uint32(cfg.Argon2Iterations)
+	}
+	if cfg.Argon2Parallelism > 0 && cfg.Argon2Parallelism <= 255 {
+		hasher.Argon2id.Parallelism = uint8(cfg.Argon2Parallelism)
+	}
+	return hasher
+}
+
+// Hash hash password with the configured scheme
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.Algorithm == PasswordHashBcrypt {
+		return HashPassword(password, h.BcryptCost)
+	}
+	return hashArgon2id(password, h.Argon2id)
+}
+
+// NeedsRehash check whether hash uses another scheme or outdated parameters
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	switch PasswordHashScheme(hash) {
+	case PasswordHashArgon2id:
+		if h.Algorithm != PasswordHashArgon2id {
+			return true
+		}
+		params, _, _, err := decodeArgon2idHash(hash)
+		return err != nil || params.Memory != h.Argon2id.Memory ||
+			params.Iterations != h.Argon2id.Iterations || params.Parallelism != h.Argon2id.Parallelism ||
+			params.KeyLength != h.Argon2id.KeyLength
+	case PasswordHashBcrypt:
+		if h.Algorithm != PasswordHashBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.BcryptCost
+	default:
+		return true
+	}
+}
+
+// PasswordHashScheme detect scheme of a stored password hash
+func PasswordHashScheme(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return PasswordHashArgon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"),
+		strings.HasPrefix(hash, "$2x$"), strings.HasPrefix(hash, "$2y$"):
+		return PasswordHashBcrypt
+	case isLegacyMD5Hash(hash):
+		return PasswordHashMD5
+	default:
+		return PasswordHashUnknown
+	}
+}
+
+// hashArgon2id encode as $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+func hashArgon2id(password string, params Argon2idParams) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkArgon2id verify password against an argon2id hash
+func checkArgon2id(password, hash string) bool {
+	params, salt, key, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return false
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+// decodeArgon2idHash parse hash produced by hashArgon2id
+func decodeArgon2idHash(hash string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != PasswordHashArgon2id {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %v", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %v", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id key: %v", err)
+	}
+	if params.Iterations == 0 || params.Parallelism == 0 || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// checkLegacyMD5 verify password against a legacy unsalted MD5 hash
+func checkLegacyMD5(password, hash string) bool {
+	sum := md5.Sum([]byte(password))
+	computed := hex.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(strings.ToLower(hash))) == 1
+}
+
+// isLegacyMD5Hash 32 hex characters
+func isLegacyMD5Hash(hash string) bool {
+	if len(hash) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"eiam-platform/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// md5("password")
+const testLegacyMD5Hash = "5f4dcc3b5aa765d61d8327deb882cf99"
+
+// testArgon2idParams 测试中使用较小的参数以缩短耗时
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func testHasher(algorithm string) *PasswordHasher {
+	return &PasswordHasher{Algorithm: algorithm, Argon2id: testArgon2idParams, BcryptCost: bcrypt.MinCost}
+}
+
+func mustHash(t *testing.T, h *PasswordHasher, password string) string {
+	t.Helper()
+	hash, err := h.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	return hash
+}
+
+func TestPasswordHasherRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{PasswordHashArgon2id, PasswordHashBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			h := testHasher(algorithm)
+			hash := mustHash(t, h, "correct horse battery staple")
+
+			if scheme := PasswordHashScheme(hash); scheme != algorithm {
+				t.Errorf("PasswordHashScheme() = %q, want %q", scheme, algorithm)
+			}
+			if !CheckPassword("correct horse battery staple", hash) {
+				t.Error("CheckPassword() rejected the correct password")
+			}
+			for _, wrong := range []string{"", "correct horse battery stapl", "Correct horse battery staple", hash} {
+				if CheckPassword(wrong, hash) {
+					t.Errorf("CheckPassword(%q) accepted a wrong password", wrong)
+				}
+			}
+			if h.NeedsRehash(hash) {
+				t.Error("NeedsRehash() = true for a hash made with the current parameters")
+			}
+			// 每次使用随机盐
+			if other := mustHash(t, h, "correct horse battery staple"); other == hash {
+				t.Error("Hash() returned the same hash twice")
+			}
+		})
+	}
+}
+
+func TestArgon2idHashFormat(t *testing.T) {
+	hash := mustHash(t, testHasher(PasswordHashArgon2id), "secret")
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, unexpected encoding", hash)
+	}
+	params, salt, key, err := decodeArgon2idHash(hash)
+	if err != nil {
+		t.Fatalf("decodeArgon2idHash() error = %v", err)
+	}
+	if params != testArgon2idParams || len(salt) != 16 || len(key) != 32 {
+		t.Errorf("decodeArgon2idHash() = %+v, salt %d bytes, key %d bytes", params, len(salt), len(key))
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.EncryptionConfig
+		want PasswordHasher
+	}{
+		{"nil config", nil, PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2id: DefaultArgon2idParams, BcryptCost: 12}},
+		{"empty config", &config.EncryptionConfig{}, PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2id: DefaultArgon2idParams, BcryptCost: 12}},
+		{"bcrypt", &config.EncryptionConfig{PasswordHash: "bcrypt", BcryptCost: 10},
+			PasswordHasher{Algorithm: PasswordHashBcrypt, Argon2id: DefaultArgon2idParams, BcryptCost: 10}},
+		{"bcrypt cost out of range", &config.EncryptionConfig{PasswordHash: "bcrypt", BcryptCost: 40},
+			PasswordHasher{Algorithm: PasswordHashBcrypt, Argon2id: DefaultArgon2idParams, BcryptCost: 12}},
+		{"argon2id parameters", &config.EncryptionConfig{Argon2Memory: 19456, Argon2Iterations: 2, Argon2Parallelism: 1},
+			PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2id: Argon2idParams{
+				Memory: 19456, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+			}, BcryptCost: 12}},
+		{"unknown algorithm", &config.EncryptionConfig{PasswordHash: "md5"},
+			PasswordHasher{Algorithm: PasswordHashArgon2id, Argon2id: DefaultArgon2idParams, BcryptCost: 12}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPasswordHasher(tt.cfg); *got != tt.want {
+				t.Errorf("NewPasswordHasher() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	current := testHasher(PasswordHashArgon2id)
+	argon2Hash := mustHash(t, current, "secret")
+	bcryptHash := mustHash(t, testHasher(PasswordHashBcrypt), "secret")
+
+	changed := func(modify func(h *PasswordHasher)) *PasswordHasher {
+		h := testHasher(PasswordHashArgon2id)
+		modify(h)
+		return h
+	}
+	bcryptHasher := testHasher(PasswordHashBcrypt)
+
+	tests := []struct {
+		name   string
+		hasher *PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{"argon2id current", current, argon2Hash, false},
+		{"argon2id memory changed", changed(func(h *PasswordHasher) { h.Argon2id.Memory = 2048 }), argon2Hash, true},
+		{"argon2id iterations changed", changed(func(h *PasswordHasher) { h.Argon2id.Iterations = 2 }), argon2Hash, true},
+		{"argon2id parallelism changed", changed(func(h *PasswordHasher) { h.Argon2id.Parallelism = 2 }), argon2Hash, true},
+		{"argon2id key length changed", changed(func(h *PasswordHasher) { h.Argon2id.KeyLength = 64 }), argon2Hash, true},
+		{"argon2id salt length changed", changed(func(h *PasswordHasher) { h.Argon2id.SaltLength = 32 }), argon2Hash, false},
+		{"argon2id to bcrypt", bcryptHasher, argon2Hash, true},
+		{"bcrypt current", bcryptHasher, bcryptHash, false},
+		{"bcrypt cost changed", &PasswordHasher{Algorithm: PasswordHashBcrypt, BcryptCost: bcrypt.MinCost + 1}, bcryptHash, true},
+		{"bcrypt to argon2id", current, bcryptHash, true},
+		{"legacy md5", current, testLegacyMD5Hash, true},
+		{"legacy md5 with bcrypt", bcryptHasher, testLegacyMD5Hash, true},
+		{"malformed argon2id", current, "$argon2id$v=19$m=1024,t=1,p=1$bad", true},
+		{"unknown", current, "plaintext", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordLegacyMD5(t *testing.T) {
+	if scheme := PasswordHashScheme(testLegacyMD5Hash); scheme != PasswordHashMD5 {
+		t.Fatalf("PasswordHashScheme() = %q, want %q", scheme, PasswordHashMD5)
+	}
+	if !CheckPassword("password", testLegacyMD5Hash) {
+		t.Error("CheckPassword() rejected the correct password for a legacy MD5 hash")
+	}
+	if !CheckPassword("password", strings.ToUpper(testLegacyMD5Hash)) {
+		t.Error("CheckPassword() rejected an upper case legacy MD5 hash")
+	}
+	if CheckPassword("Password", testLegacyMD5Hash) {
+		t.Error("CheckPassword() accepted a wrong password for a legacy MD5 hash")
+	}
+
+	// MD5只用于校验，新密码不会使用MD5
+	for _, algorithm := range []string{PasswordHashArgon2id, PasswordHashBcrypt, PasswordHashMD5} {
+		hash := mustHash(t, testHasher(algorithm), "password")
+		if PasswordHashScheme(hash) == PasswordHashMD5 {
+			t.Errorf("Hash() with algorithm %q produced a legacy MD5 hash", algorithm)
+		}
+	}
+}
+
+// 数据库泄露后不能直接用存储的哈希登录
+func TestCheckPasswordRejectsStoredHash(t *testing.T) {
+	argon2Hash := mustHash(t, testHasher(PasswordHashArgon2id), "password")
+	bcryptHash := mustHash(t, testHasher(PasswordHashBcrypt), "password")
+
+	tests := []struct {
+		name     string
+		password string
+		hash     string
+	}{
+		{"md5 hash as password", testLegacyMD5Hash, testLegacyMD5Hash},
+		{"upper case md5 hash as password", strings.ToUpper(testLegacyMD5Hash), testLegacyMD5Hash},
+		{"argon2id hash as password", argon2Hash, argon2Hash},
+		{"bcrypt hash as password", bcryptHash, bcryptHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if CheckPassword(tt.password, tt.hash) {
+				t.Fatal("CheckPassword() accepted the stored hash as the password")
+			}
+		})
+	}
+}
+
+func TestCheckPasswordMalformedHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"password",
+		"5f4dcc3b5aa765d61d8327deb882cf9",    // 31位
+		"5f4dcc3b5aa765d61d8327deb882cf99aa", // 34位
+		"zf4dcc3b5aa765d61d8327deb882cf99",   // 非十六进制
+		"$argon2id$v=19$m=1024,t=1,p=1$",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+		"$2a$04$invalid",
+	} {
+		if CheckPassword("password", hash) {
+			t.Errorf("CheckPassword() accepted malformed hash %q", hash)
+		}
+	}
+}
@@ -45,8 +45,20 @@ func DefaultPasswordPolicy() *PasswordPolicy {
 	}
 }
 
+// PasswordContext 校验密码时与账户相关的信息
+type PasswordContext struct {
+	Username string
+	Words    []string // 显示名称、邮箱、站点名称、组织名称等，启用PreventCommon时不能出现在密码中
+}
+
 // ValidatePassword 验证密码是否符合策略
 func ValidatePassword(password string, policy *PasswordPolicy, username string, passwordHistory []string) *PasswordValidationResult {
+	return ValidatePasswordWithContext(password, policy, PasswordContext{Username: username}, passwordHistory)
+}
+
+// ValidatePasswordWithContext 验证密码是否符合策略，同时检查与账户相关的词
+func ValidatePasswordWithContext(password string, policy *PasswordPolicy, passwordContext PasswordContext, passwordHistory []string) *PasswordValidationResult {
+	username := passwordContext.Username
 	result := &PasswordValidationResult{
 		Valid:    true,
 		Errors:   []string{},
@@ -126,20 +138,15 @@ func ValidatePassword(password string, policy *PasswordPolicy, username string,
 		}
 	}
 
-	// 检查常见密码
+	// 检查泄露/常见密码以及与账户相关的词
 	if policy.PreventCommon {
-		commonPasswords := []string{
-			"password", "123456", "12345678", "qwerty", "abc123",
-			"password123", "admin", "admin123", "root", "root123",
-			"test", "test123", "guest", "guest123", "user", "user123",
+		if CurrentPasswordScreener().Contains(password) {
+			result.Valid = false
+			result.Errors = append(result.Errors, "密码出现在已泄露或常见的密码列表中，请更换")
 		}
-		lowerPassword := strings.ToLower(password)
-		for _, common := range commonPasswords {
-			if lowerPassword == common {
-				result.Valid = false
-				result.Errors = append(result.Errors, "不能使用常见密码")
-				break
-			}
+		if word := findContextWord(password, passwordContext.Words); word != "" {
+			result.Valid = false
+			result.Errors = append(result.Errors, fmt.Sprintf("密码不能包含与账户相关的词：%s", word))
 		}
 	}
 
@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// builtinCommonPasswords 未配置数据文件时也会拒绝的常见密码
+var builtinCommonPasswords = []string{
+	"password", "123456", "12345678", "qwerty", "abc123",
+	"password123", "admin", "admin123", "root", "root123",
+	"test", "test123", "guest", "guest123", "user", "user123",
+}
+
+// 上下文词和基础词的最小长度，过短的词容易误判
+const passwordScreeningMinWordLength = 4
+
+// PasswordScreeningStats 筛查数据集状态
+type PasswordScreeningStats struct {
+	Files             []string  `json:"files"`
+	Entries           int       `json:"entries"` // 已加载的哈希和禁用词数量，包括内置常见密码
+	Skipped           int       `json:"skipped"` // 无效或出现次数低于阈值的行
+	FilterBytes       int       `json:"filter_bytes"`
+	FalsePositiveRate float64   `json:"false_positive_rate"`
+	LoadedAt          time.Time `json:"loaded_at"`
+}
+
+// PasswordScreener 离线的泄露/常见密码筛查器，数据保存在布隆过滤器中
+// 数据文件每行一条：40位SHA-1十六进制（可带":出现次数"，即HIBP格式）或禁用词明文，#开头为注释
+type PasswordScreener struct {
+	bits  []uint64
+	m     uint64
+	k     uint64
+	stats PasswordScreeningStats
+}
+
+var currentPasswordScreener struct {
+	sync.RWMutex
+	screener *PasswordScreener
+}
+
+// LoadPasswordScreener 从数据文件构建筛查器，先统计行数确定过滤器大小再逐行加载
+// minOccurrences大于0时跳过HIBP出现次数低于该值的哈希
+func LoadPasswordScreener(files []string, minOccurrences int, falsePositiveRate float64) (*PasswordScreener, error) {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.001
+	}
+
+	capacity := len(builtinCommonPasswords)
+	for _, file := range files {
+		lines, err := countScreeningLines(file)
+		if err != nil {
+			return nil, err
+		}
+		capacity += lines
+	}
+
+	screener := newPasswordScreener(capacity, falsePositiveRate)
+	screener.stats.Files = files
+	for _, word := range builtinCommonPasswords {
+		screener.addWord(word)
+	}
+	for _, file := range files {
+		if err := screener.loadFile(file, minOccurrences); err != nil {
+			return nil, err
+		}
+	}
+	screener.stats.LoadedAt = time.Now()
+	return screener, nil
+}
+
+// SetPasswordScreener 替换ValidatePassword使用的筛查器
+func SetPasswordScreener(screener *PasswordScreener) {
+	currentPasswordScreener.Lock()
+	currentPasswordScreener.screener = screener
+	currentPasswordScreener.Unlock()
+}
+
+// CurrentPasswordScreener 返回当前筛查器，未加载数据文件时只包含内置常见密码
+func CurrentPasswordScreener() *PasswordScreener {
+	currentPasswordScreener.RLock()
+	screener := currentPasswordScreener.screener
+	currentPasswordScreener.RUnlock()
+	if screener != nil {
+		return screener
+	}
+
+	screener, _ = LoadPasswordScreener(nil, 0, 0)
+	currentPasswordScreener.Lock()
+	if currentPasswordScreener.screener == nil {
+		currentPasswordScreener.screener = screener
+	}
+	screener = currentPasswordScreener.screener
+	currentPasswordScreener.Unlock()
+	return screener
+}
+
+// Stats 返回数据集状态
+func (s *PasswordScreener) Stats() PasswordScreeningStats {
+	return s.stats
+}
+
+// Contains 检查密码本身、小写形式以及去掉首尾数字符号并还原常见替换字符后的基础词是否在数据集中
+func (s *PasswordScreener) Contains(password string) bool {
+	if s.containsDigest(sha1.Sum([]byte(password))) {
+		return true
+	}
+	lower := strings.ToLower(password)
+	if s.containsDigest(sha1.Sum([]byte(lower))) {
+		return true
+	}
+	base := passwordBaseWord(lower)
+	if len(base) >= passwordScreeningMinWordLength && base != lower {
+		return s.containsDigest(sha1.Sum([]byte(base)))
+	}
+	return false
+}
+
+func newPasswordScreener(capacity int, falsePositiveRate float64) *PasswordScreener {
+	if capacity < 1 {
+		capacity = 1
+	}
+	n := float64(capacity)
+	m := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / n * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	words := (m + 63) / 64
+	return &PasswordScreener{
+		bits: make([]uint64, words),
+		m:    m,
+		k:    k,
+		stats: PasswordScreeningStats{
+			FilterBytes:       int(words * 8),
+			FalsePositiveRate: falsePositiveRate,
+		},
+	}
+}
+
+// loadFile 逐行加载数据文件
+func (s *PasswordScreener) loadFile(file string, minOccurrences int) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open password screening file: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, count, isHash := parseBreachedHashLine(line)
+		switch {
+		case isHash && count < minOccurrences:
+			s.stats.Skipped++
+		case isHash:
+			var digest [sha1.Size]byte
+			copy(digest[:], hash)
+			s.addDigest(digest)
+		default:
+			s.addWord(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read password screening file %s: %v", file, err)
+	}
+	return nil
+}
+
+// parseBreachedHashLine 解析"SHA1"或"SHA1:出现次数"格式的行，未带次数时视为满足阈值
+func parseBreachedHashLine(line string) ([]byte, int, bool) {
+	hashPart, countPart, hasCount := strings.Cut(line, ":")
+	if len(hashPart) != sha1.Size*2 {
+		return nil, 0, false
+	}
+	hash, err := hex.DecodeString(hashPart)
+	if err != nil {
+		return nil, 0, false
+	}
+	if !hasCount {
+		return hash, math.MaxInt32, true
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countPart))
+	if err != nil {
+		return nil, 0, false
+	}
+	return hash, count, true
+}
+
+func (s *PasswordScreener) addWord(word string) {
+	s.addDigest(sha1.Sum([]byte(strings.ToLower(word))))
+}
+
+func (s *PasswordScreener) addDigest(digest [sha1.Size]byte) {
+	h1, h2 := bloomHashes(digest)
+	for i := uint64(0); i < s.k; i++ {
+		bit := (h1 + i*h2) % s.m
+		s.bits[bit/64] |= 1 << (bit % 64)
+	}
+	s.stats.Entries++
+}
+
+func (s *PasswordScreener) containsDigest(digest [sha1.Size]byte) bool {
+	h1, h2 := bloomHashes(digest)
+	for i := uint64(0); i < s.k; i++ {
+		bit := (h1 + i*h2) % s.m
+		if s.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes SHA-1摘要已均匀分布，直接取两段作为双重哈希的种子
+func bloomHashes(digest [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(digest[0:8]), binary.BigEndian.Uint64(digest[8:16]) | 1
+}
+
+// countScreeningLines 统计数据文件中的非空行数
+func countScreeningLines(file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open password screening file: %v", err)
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) > 0 {
+			count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read password screening file %s: %v", file, err)
+	}
+	return count, nil
+}
+
+// leetReplacer 还原常见的字符替换
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// passwordBaseWord 去掉首尾的数字和符号并还原替换字符，例如"P@ssw0rd2024!"得到"password"
+func passwordBaseWord(lower string) string {
+	trimmed := strings.TrimFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return leetReplacer.Replace(trimmed)
+}
+
+// findContextWord 返回密码中包含的上下文词，按非字母数字字符拆分后长度不足的片段忽略
+func findContextWord(password string, words []string) string {
+	lower := strings.ToLower(password)
+	normalized := leetReplacer.Replace(lower)
+	for _, word := range words {
+		tokens := strings.FieldsFunc(strings.ToLower(word), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, token := range tokens {
+			if len([]rune(token)) < passwordScreeningMinWordLength {
+				continue
+			}
+			if strings.Contains(lower, token) || strings.Contains(normalized, token) {
+				return token
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP参数（RFC 6238），与主流验证器App的默认值保持一致
+const (
+	TOTPDigits    = 6
+	TOTPPeriod    = 30
+	TOTPAlgorithm = "SHA1"
+
+	totpSecretSize = 20 // 160位，RFC 4226推荐的密钥长度
+)
+
+// backupCodeAlphabet 备用码字符集，去掉了容易混淆的0/1/i/l/o
+const backupCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成Base32编码的TOTP密钥
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// decodeTOTPSecret 解码Base32密钥，兼容小写、空格和填充符
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	return totpEncoding.DecodeString(secret)
+}
+
+// GenerateTOTPCode 计算指定时间步的动态码（RFC 4226 HOTP）
+func GenerateTOTPCode(secret string, step int64) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// 动态截断
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%1000000), nil
+}
+
+// TOTPStep 返回时间对应的时间步
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / TOTPPeriod
+}
+
+// ValidateTOTP 在前后skew个时间步内校验动态码，成功时返回匹配的时间步
+// 调用方需要记录已使用的时间步以防止重放
+func ValidateTOTP(secret, code string, t time.Time, skew int) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := TOTPStep(t)
+	for i := -skew; i <= skew; i++ {
+		step := current + int64(i)
+		expected, err := GenerateTOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// BuildTOTPURI 生成otpauth://格式的密钥URI，可直接编码为二维码供验证器App扫描
+func BuildTOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	if issuer != "" {
+		params.Set("issuer", issuer)
+	}
+	params.Set("algorithm", TOTPAlgorithm)
+	params.Set("digits", fmt.Sprintf("%d", TOTPDigits))
+	params.Set("period", fmt.Sprintf("%d", TOTPPeriod))
+
+	// 验证器App对查询参数中的"+"支持不一，空格统一编码为%20
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+}
+
+// GenerateBackupCodes 生成一次性备用码，格式为xxxxx-xxxxx
+func GenerateBackupCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		code, err := randomBackupCodeChars(10)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// randomBackupCodeChars 从备用码字符集中均匀随机选取字符，丢弃会导致取模偏差的字节
+func randomBackupCodeChars(n int) (string, error) {
+	limit := 256 - 256%len(backupCodeAlphabet)
+	result := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(result) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			result = append(result, backupCodeAlphabet[int(b)%len(backupCodeAlphabet)])
+			if len(result) == n {
+				break
+			}
+		}
+	}
+	return string(result), nil
+}
+
+// NormalizeBackupCode 去掉用户输入中的分隔符和空格并转为小写
+func NormalizeBackupCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// HashBackupCode 计算备用码哈希，salt使用用户ID避免不同用户的相同备用码哈希一致
+func HashBackupCode(code, salt string) string {
+	sum := sha256.Sum256([]byte(salt + ":" + NormalizeBackupCode(code)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,405 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// WebAuthn认证器数据标志位
+const (
+	WebAuthnFlagUserPresent    = 0x01
+	WebAuthnFlagUserVerified   = 0x04
+	WebAuthnFlagBackupEligible = 0x08
+	WebAuthnFlagBackupState    = 0x10
+	WebAuthnFlagAttestedData   = 0x40
+	WebAuthnFlagExtensionData  = 0x80
+)
+
+// 支持的COSE算法
+const (
+	COSEAlgES256 int64 = -7
+	COSEAlgEdDSA int64 = -8
+	COSEAlgRS256 int64 = -257
+)
+
+// WebAuthn客户端数据类型
+const (
+	WebAuthnTypeCreate = "webauthn.create"
+	WebAuthnTypeGet    = "webauthn.get"
+)
+
+// WebAuthnClientData 浏览器生成的clientDataJSON
+type WebAuthnClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// WebAuthnAuthenticatorData 认证器数据
+type WebAuthnAuthenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	// 以下字段仅在注册时（AT标志）存在
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte // COSE_Key
+}
+
+// HasFlag 判断是否设置了标志位
+func (d *WebAuthnAuthenticatorData) HasFlag(flag byte) bool {
+	return d.Flags&flag != 0
+}
+
+// WebAuthnRelyingParty 依赖方配置
+type WebAuthnRelyingParty struct {
+	ID      string   // RP ID，通常为站点域名
+	Origins []string // 允许发起仪式的页面源
+}
+
+// WebAuthnRegistration 注册仪式验证通过后需要保存的凭据信息
+type WebAuthnRegistration struct {
+	CredentialID      []byte
+	PublicKey         []byte
+	Algorithm         int64
+	SignCount         uint32
+	AAGUID            []byte
+	UserVerified      bool
+	BackupEligible    bool
+	AttestationFormat string
+}
+
+// DecodeBase64URL 解码base64url，兼容带填充和标准base64的输入
+func DecodeBase64URL(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// EncodeBase64URL 编码为不带填充的base64url
+func EncodeBase64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// GenerateWebAuthnChallenge 生成32字节随机挑战值，返回base64url编码
+func GenerateWebAuthnChallenge() (string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	return EncodeBase64URL(challenge), nil
+}
+
+// ParseWebAuthnClientData 解析clientDataJSON
+func ParseWebAuthnClientData(raw []byte) (*WebAuthnClientData, error) {
+	var clientData WebAuthnClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, fmt.Errorf("invalid client data: %v", err)
+	}
+	return &clientData, nil
+}
+
+// verifyClientData 校验客户端数据的类型、挑战和来源
+func (rp *WebAuthnRelyingParty) verifyClientData(raw []byte, ceremonyType, challenge string) error {
+	clientData, err := ParseWebAuthnClientData(raw)
+	if err != nil {
+		return err
+	}
+	if clientData.Type != ceremonyType {
+		return fmt.Errorf("unexpected client data type %q", clientData.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(challenge)) != 1 {
+		return errors.New("challenge mismatch")
+	}
+	if clientData.CrossOrigin {
+		return errors.New("cross-origin ceremonies are not allowed")
+	}
+	for _, origin := range rp.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", clientData.Origin)
+}
+
+// verifyAuthenticatorData 校验RP ID哈希和用户在场/用户验证标志
+func (rp *WebAuthnRelyingParty) verifyAuthenticatorData(authData *WebAuthnAuthenticatorData, requireUserVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.RPIDHash, rpIDHash[:]) != 1 {
+		return errors.New("RP ID hash mismatch")
+	}
+	if !authData.HasFlag(WebAuthnFlagUserPresent) {
+		return errors.New("user presence flag not set")
+	}
+	if requireUserVerification && !authData.HasFlag(WebAuthnFlagUserVerified) {
+		return errors.New("user verification required")
+	}
+	return nil
+}
+
+// ParseWebAuthnAuthenticatorData 解析认证器数据
+func ParseWebAuthnAuthenticatorData(data []byte) (*WebAuthnAuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+
+	authData := &WebAuthnAuthenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.HasFlag(WebAuthnFlagAttestedData) {
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		authData.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength > 1023 || len(rest) < idLength {
+			return nil, errors.New("invalid credential ID length")
+		}
+		authData.CredentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		// 公钥是一个CBOR数据项，需要解码才能知道长度
+		_, n, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %v", err)
+		}
+		authData.PublicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if authData.HasFlag(WebAuthnFlagExtensionData) {
+		_, n, err := DecodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extension data: %v", err)
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.New("unexpected trailing authenticator data")
+	}
+	return authData, nil
+}
+
+// VerifyRegistration 验证注册仪式(navigator.credentials.create)的响应
+// 只信任凭据本身，不校验认证器厂商证书链：none格式直接接受，packed格式校验签名，其他格式按none处理
+func (rp *WebAuthnRelyingParty) VerifyRegistration(clientDataJSON, attestationObject []byte, challenge string, requireUserVerification bool) (*WebAuthnRegistration, error) {
+	if err := rp.verifyClientData(clientDataJSON, WebAuthnTypeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := DecodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %v", err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+	format, _ := attestation["fmt"].(string)
+	rawAuthData, _ := attestation["authData"].([]byte)
+	attStmt, _ := attestation["attStmt"].(map[interface{}]interface{})
+
+	authData, err := ParseWebAuthnAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUserVerification); err != nil {
+		return nil, err
+	}
+	if !authData.HasFlag(WebAuthnFlagAttestedData) {
+		return nil, errors.New("attested credential data missing")
+	}
+
+	publicKey, algorithm, err := ParseCOSEKey(authData.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "none":
+		if len(attStmt) != 0 {
+			return nil, errors.New("none attestation must have an empty statement")
+		}
+	case "packed":
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+		if err := verifyPackedAttestation(attStmt, signed, publicKey, algorithm); err != nil {
+			return nil, err
+		}
+	}
+
+	return &WebAuthnRegistration{
+		CredentialID:      authData.CredentialID,
+		PublicKey:         authData.PublicKey,
+		Algorithm:         algorithm,
+		SignCount:         authData.SignCount,
+		AAGUID:            authData.AAGUID,
+		UserVerified:      authData.HasFlag(WebAuthnFlagUserVerified),
+		BackupEligible:    authData.HasFlag(WebAuthnFlagBackupEligible),
+		AttestationFormat: format,
+	}, nil
+}
+
+// verifyPackedAttestation 校验packed格式的证明签名，有证书时使用证书公钥，否则为自证明
+func verifyPackedAttestation(attStmt map[interface{}]interface{}, signed []byte, credentialKey crypto.PublicKey, credentialAlg int64) error {
+	alg, _ := attStmt["alg"].(int64)
+	sig, _ := attStmt["sig"].([]byte)
+	if len(sig) == 0 {
+		return errors.New("packed attestation signature missing")
+	}
+
+	if x5c, ok := attStmt["x5c"].([]interface{}); ok && len(x5c) > 0 {
+		der, _ := x5c[0].([]byte)
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("invalid attestation certificate: %v", err)
+		}
+		return verifyCOSESignature(cert.PublicKey, alg, signed, sig)
+	}
+
+	if alg != credentialAlg {
+		return errors.New("self attestation algorithm mismatch")
+	}
+	return verifyCOSESignature(credentialKey, alg, signed, sig)
+}
+
+// VerifyAssertion 验证认证仪式(navigator.credentials.get)的响应，返回认证器数据供调用方检查签名计数
+func (rp *WebAuthnRelyingParty) VerifyAssertion(clientDataJSON, authenticatorData, signature, publicKey []byte, challenge string, requireUserVerification bool) (*WebAuthnAuthenticatorData, error) {
+	if err := rp.verifyClientData(clientDataJSON, WebAuthnTypeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := ParseWebAuthnAuthenticatorData(authenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUserVerification); err != nil {
+		return nil, err
+	}
+
+	key, algorithm, err := ParseCOSEKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	if err := verifyCOSESignature(key, algorithm, signed, signature); err != nil {
+		return nil, err
+	}
+	return authData, nil
+}
+
+// ParseCOSEKey 解析COSE_Key格式的公钥，支持ES256(P-256)、EdDSA(Ed25519)和RS256
+func ParseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	decoded, n, err := DecodeCBOR(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid COSE key: %v", err)
+	}
+	if n != len(raw) {
+		return nil, 0, errors.New("invalid COSE key: trailing data")
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errors.New("invalid COSE key")
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+
+	switch alg {
+	case COSEAlgES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if kty != 2 || crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("invalid ES256 key")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, errors.New("ES256 key is not on curve")
+		}
+		return pub, alg, nil
+	case COSEAlgEdDSA:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		if kty != 1 || crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("invalid EdDSA key")
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case COSEAlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if kty != 3 || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, errors.New("invalid RS256 key")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, alg, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported COSE algorithm %d", alg)
+}
+
+// verifyCOSESignature 按COSE算法校验签名
+func verifyCOSESignature(key crypto.PublicKey, alg int64, data, sig []byte) error {
+	switch alg {
+	case COSEAlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("key type does not match ES256")
+		}
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case COSEAlgEdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("key type does not match EdDSA")
+		}
+		if !ed25519.Verify(pub, data, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case COSEAlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key type does not match RS256")
+		}
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported signature algorithm %d", alg)
+}
@@ -0,0 +1,470 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+const (
+	testRPID      = "login.example.com"
+	testOrigin    = "https://login.example.com"
+	testChallenge = "dGVzdC1jaGFsbGVuZ2UtMDEyMzQ1Njc4OWFiY2RlZg"
+)
+
+var testRP = &WebAuthnRelyingParty{ID: testRPID, Origins: []string{testOrigin}}
+
+// 测试用CBOR编码，只输出认证器使用的定长确定性编码
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
+
+func cborInt(v int64) []byte {
+	if v < 0 {
+		return cborHead(1, uint64(-1-v))
+	}
+	return cborHead(0, uint64(v))
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, uint64(len(b))), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, uint64(len(s))), s...)
+}
+
+// cborMap 按传入顺序编码键值对，调用方负责使用规范顺序
+func cborMap(pairs ...[]byte) []byte {
+	out := cborHead(5, uint64(len(pairs)/2))
+	for _, p := range pairs {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func cborArray(items ...[]byte) []byte {
+	out := cborHead(4, uint64(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// testAuthenticator 模拟认证器，按CTAP2格式生成证明对象和断言
+type testAuthenticator struct {
+	alg    int64
+	signer crypto.Signer
+	credID []byte
+	cose   []byte
+	aaguid []byte
+}
+
+func newTestAuthenticator(t *testing.T, alg int64) *testAuthenticator {
+	t.Helper()
+	a := &testAuthenticator{alg: alg, credID: make([]byte, 32), aaguid: make([]byte, 16)}
+	rand.Read(a.credID)
+	rand.Read(a.aaguid)
+
+	switch alg {
+	case COSEAlgES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.signer = key
+		a.cose = coseES256Key(&key.PublicKey)
+	case COSEAlgEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.signer = priv
+		a.cose = cborMap(cborInt(1), cborInt(1), cborInt(3), cborInt(COSEAlgEdDSA), cborInt(-1), cborInt(6), cborInt(-2), cborBytes(pub))
+	case COSEAlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.signer = key
+		a.cose = cborMap(cborInt(1), cborInt(3), cborInt(3), cborInt(COSEAlgRS256),
+			cborInt(-1), cborBytes(key.N.Bytes()), cborInt(-2), cborBytes(big.NewInt(int64(key.E)).Bytes()))
+	default:
+		t.Fatalf("unsupported algorithm %d", alg)
+	}
+	return a
+}
+
+func coseES256Key(pub *ecdsa.PublicKey) []byte {
+	x := pub.X.FillBytes(make([]byte, 32))
+	y := pub.Y.FillBytes(make([]byte, 32))
+	return cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(COSEAlgES256),
+		cborInt(-1), cborInt(1), cborInt(-2), cborBytes(x), cborInt(-3), cborBytes(y))
+}
+
+func signWithAlgorithm(t *testing.T, signer crypto.Signer, alg int64, data []byte) []byte {
+	t.Helper()
+	var sig []byte
+	var err error
+	switch alg {
+	case COSEAlgEdDSA:
+		sig, err = signer.Sign(rand.Reader, data, crypto.Hash(0))
+	default:
+		digest := sha256.Sum256(data)
+		sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func (a *testAuthenticator) authData(flags byte, signCount uint32, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+	if attested {
+		data = append(data, a.aaguid...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credID)))
+		data = append(data, a.credID...)
+		data = append(data, a.cose...)
+	}
+	return data
+}
+
+func testClientData(ceremonyType, challenge, origin string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremonyType,
+		"challenge":   challenge,
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// attestationObject 认证器输出的键顺序为fmt、attStmt、authData
+func attestationObject(format string, attStmt, authData []byte) []byte {
+	return cborMap(cborText("fmt"), cborText(format), cborText("attStmt"), attStmt, cborText("authData"), cborBytes(authData))
+}
+
+func (a *testAuthenticator) register(t *testing.T, format string) (clientDataJSON, attObj []byte) {
+	t.Helper()
+	clientDataJSON = testClientData(WebAuthnTypeCreate, testChallenge, testOrigin)
+	authData := a.authData(WebAuthnFlagUserPresent|WebAuthnFlagUserVerified|WebAuthnFlagAttestedData, 0, true)
+
+	attStmt := cborMap()
+	if format == "packed" {
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		sig := signWithAlgorithm(t, a.signer, a.alg, append(append([]byte{}, authData...), clientDataHash[:]...))
+		attStmt = cborMap(cborText("alg"), cborInt(a.alg), cborText("sig"), cborBytes(sig))
+	}
+	return clientDataJSON, attestationObject(format, attStmt, authData)
+}
+
+func (a *testAuthenticator) assert(t *testing.T, flags byte, signCount uint32) (clientDataJSON, authData, sig []byte) {
+	t.Helper()
+	clientDataJSON = testClientData(WebAuthnTypeGet, testChallenge, testOrigin)
+	authData = a.authData(flags, signCount, false)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	sig = signWithAlgorithm(t, a.signer, a.alg, append(append([]byte{}, authData...), clientDataHash[:]...))
+	return clientDataJSON, authData, sig
+}
+
+func TestWebAuthnRegistrationAndAssertion(t *testing.T) {
+	algorithms := []struct {
+		name string
+		alg  int64
+	}{
+		{"ES256", COSEAlgES256},
+		{"EdDSA", COSEAlgEdDSA},
+		{"RS256", COSEAlgRS256},
+	}
+	for _, alg := range algorithms {
+		for _, format := range []string{"none", "packed"} {
+			t.Run(alg.name+"/"+format, func(t *testing.T) {
+				a := newTestAuthenticator(t, alg.alg)
+				clientDataJSON, attObj := a.register(t, format)
+
+				reg, err := testRP.VerifyRegistration(clientDataJSON, attObj, testChallenge, true)
+				if err != nil {
+					t.Fatalf("VerifyRegistration() error = %v", err)
+				}
+				if !bytes.Equal(reg.CredentialID, a.credID) || !bytes.Equal(reg.PublicKey, a.cose) || !bytes.Equal(reg.AAGUID, a.aaguid) {
+					t.Errorf("VerifyRegistration() returned wrong credential data")
+				}
+				if reg.Algorithm != alg.alg || reg.AttestationFormat != format || !reg.UserVerified {
+					t.Errorf("VerifyRegistration() = %+v", reg)
+				}
+
+				clientDataJSON, authData, sig := a.assert(t, WebAuthnFlagUserPresent|WebAuthnFlagUserVerified, 7)
+				got, err := testRP.VerifyAssertion(clientDataJSON, authData, sig, reg.PublicKey, testChallenge, true)
+				if err != nil {
+					t.Fatalf("VerifyAssertion() error = %v", err)
+				}
+				if got.SignCount != 7 {
+					t.Errorf("VerifyAssertion() sign count = %d, want 7", got.SignCount)
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyRegistrationPackedWithCertificate(t *testing.T) {
+	a := newTestAuthenticator(t, COSEAlgES256)
+	attestationKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Authenticator Attestation"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &attestationKey.PublicKey, attestationKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientDataJSON := testClientData(WebAuthnTypeCreate, testChallenge, testOrigin)
+	authData := a.authData(WebAuthnFlagUserPresent|WebAuthnFlagAttestedData, 0, true)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	build := func(signer crypto.Signer) []byte {
+		sig := signWithAlgorithm(t, signer, COSEAlgES256, signed)
+		attStmt := cborMap(cborText("alg"), cborInt(COSEAlgES256), cborText("sig"), cborBytes(sig),
+			cborText("x5c"), cborArray(cborBytes(certDER)))
+		return attestationObject("packed", attStmt, authData)
+	}
+
+	if _, err := testRP.VerifyRegistration(clientDataJSON, build(attestationKey), testChallenge, false); err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+	// 证书存在时必须使用证书私钥签名，凭据私钥的签名不被接受
+	if _, err := testRP.VerifyRegistration(clientDataJSON, build(a.signer), testChallenge, false); err == nil {
+		t.Fatal("VerifyRegistration() accepted a signature that does not match the attestation certificate")
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	a := newTestAuthenticator(t, COSEAlgES256)
+	validClientData := testClientData(WebAuthnTypeCreate, testChallenge, testOrigin)
+	validAuthData := a.authData(WebAuthnFlagUserPresent|WebAuthnFlagUserVerified|WebAuthnFlagAttestedData, 0, true)
+
+	packed := func(alg int64, authData []byte) []byte {
+		clientDataHash := sha256.Sum256(validClientData)
+		sig := signWithAlgorithm(t, a.signer, COSEAlgES256, append(append([]byte{}, authData...), clientDataHash[:]...))
+		return attestationObject("packed", cborMap(cborText("alg"), cborInt(alg), cborText("sig"), cborBytes(sig)), authData)
+	}
+	wrongRPIDHash := append([]byte{}, validAuthData...)
+	wrongRPIDHash[0] ^= 0xff
+	noUserPresent := a.authData(WebAuthnFlagUserVerified|WebAuthnFlagAttestedData, 0, true)
+	noUserVerified := a.authData(WebAuthnFlagUserPresent|WebAuthnFlagAttestedData, 0, true)
+	tamperedPacked := packed(COSEAlgES256, validAuthData)
+	tamperedPacked[len(tamperedPacked)-1] ^= 0xff
+
+	crossOrigin, _ := json.Marshal(map[string]interface{}{
+		"type": WebAuthnTypeCreate, "challenge": testChallenge, "origin": testOrigin, "crossOrigin": true,
+	})
+
+	tests := []struct {
+		name           string
+		clientDataJSON []byte
+		attObj         []byte
+		requireUV      bool
+	}{
+		{"wrong challenge", testClientData(WebAuthnTypeCreate, "b3RoZXI", testOrigin), attestationObject("none", cborMap(), validAuthData), false},
+		{"wrong type", testClientData(WebAuthnTypeGet, testChallenge, testOrigin), attestationObject("none", cborMap(), validAuthData), false},
+		{"wrong origin", testClientData(WebAuthnTypeCreate, testChallenge, "https://evil.example.com"), attestationObject("none", cborMap(), validAuthData), false},
+		{"cross origin", crossOrigin, attestationObject("none", cborMap(), validAuthData), false},
+		{"client data not json", []byte("{"), attestationObject("none", cborMap(), validAuthData), false},
+		{"wrong RP ID hash", validClientData, attestationObject("none", cborMap(), wrongRPIDHash), false},
+		{"user not present", validClientData, attestationObject("none", cborMap(), noUserPresent), false},
+		{"user verification required", validClientData, attestationObject("none", cborMap(), noUserVerified), true},
+		{"no attested data", validClientData, attestationObject("none", cborMap(), a.authData(WebAuthnFlagUserPresent, 0, false)), false},
+		{"none with statement", validClientData, attestationObject("none", cborMap(cborText("alg"), cborInt(-7)), validAuthData), false},
+		{"packed bad signature", validClientData, tamperedPacked, false},
+		{"packed algorithm mismatch", validClientData, packed(COSEAlgRS256, validAuthData), false},
+		{"packed missing signature", validClientData, attestationObject("packed", cborMap(cborText("alg"), cborInt(-7)), validAuthData), false},
+		{"attestation not a map", validClientData, cborArray(cborText("none")), false},
+		{"auth data missing", validClientData, cborMap(cborText("fmt"), cborText("none"), cborText("attStmt"), cborMap()), false},
+		{"auth data wrong type", validClientData, cborMap(cborText("fmt"), cborText("none"), cborText("attStmt"), cborMap(), cborText("authData"), cborText("x")), false},
+		{"auth data length oversized", validClientData, append(cborMap(cborText("fmt"), cborText("none"), cborText("attStmt"), cborMap(), cborText("authData")), 0x5a, 0xff, 0xff, 0xff, 0xff), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testRP.VerifyRegistration(tt.clientDataJSON, tt.attObj, testChallenge, tt.requireUV); err == nil {
+				t.Fatal("VerifyRegistration() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationTruncated(t *testing.T) {
+	a := newTestAuthenticator(t, COSEAlgES256)
+	clientDataJSON, attObj := a.register(t, "packed")
+	for i := 0; i < len(attObj); i++ {
+		if _, err := testRP.VerifyRegistration(clientDataJSON, attObj[:i], testChallenge, false); err == nil {
+			t.Fatalf("VerifyRegistration() accepted attestation object truncated to %d of %d bytes", i, len(attObj))
+		}
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	a := newTestAuthenticator(t, COSEAlgES256)
+	other := newTestAuthenticator(t, COSEAlgES256)
+	clientDataJSON, authData, sig := a.assert(t, WebAuthnFlagUserPresent, 1)
+
+	tamperedSig := append([]byte{}, sig...)
+	tamperedSig[len(tamperedSig)-1] ^= 0xff
+	tamperedAuthData := append([]byte{}, authData...)
+	tamperedAuthData[36]++ // 修改签名计数
+	_, noUPAuthData, noUPSig := a.assert(t, 0, 1)
+
+	tests := []struct {
+		name           string
+		clientDataJSON []byte
+		authData       []byte
+		sig            []byte
+		publicKey      []byte
+		challenge      string
+		requireUV      bool
+	}{
+		{"tampered signature", clientDataJSON, authData, tamperedSig, a.cose, testChallenge, false},
+		{"tampered authenticator data", clientDataJSON, tamperedAuthData, sig, a.cose, testChallenge, false},
+		{"other credential key", clientDataJSON, authData, sig, other.cose, testChallenge, false},
+		{"wrong challenge", clientDataJSON, authData, sig, a.cose, "b3RoZXI", false},
+		{"registration client data", testClientData(WebAuthnTypeCreate, testChallenge, testOrigin), authData, sig, a.cose, testChallenge, false},
+		{"user verification required", clientDataJSON, authData, sig, a.cose, testChallenge, true},
+		{"user not present", clientDataJSON, noUPAuthData, noUPSig, a.cose, testChallenge, false},
+		{"empty signature", clientDataJSON, authData, nil, a.cose, testChallenge, false},
+		{"invalid public key", clientDataJSON, authData, sig, []byte{0xa0}, testChallenge, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testRP.VerifyAssertion(tt.clientDataJSON, tt.authData, tt.sig, tt.publicKey, tt.challenge, tt.requireUV); err == nil {
+				t.Fatal("VerifyAssertion() succeeded, want error")
+			}
+		})
+	}
+
+	for i := 0; i < len(authData); i++ {
+		if _, err := testRP.VerifyAssertion(clientDataJSON, authData[:i], sig, a.cose, testChallenge, false); err == nil {
+			t.Fatalf("VerifyAssertion() accepted authenticator data truncated to %d bytes", i)
+		}
+	}
+}
+
+func TestParseWebAuthnAuthenticatorDataRejects(t *testing.T) {
+	a := newTestAuthenticator(t, COSEAlgES256)
+	valid := a.authData(WebAuthnFlagUserPresent|WebAuthnFlagAttestedData, 0, true)
+	header := a.authData(WebAuthnFlagUserPresent|WebAuthnFlagAttestedData, 0, false)
+
+	withCredentialID := func(idLength int, id []byte, rest []byte) []byte {
+		data := append(append([]byte{}, header...), a.aaguid...)
+		data = binary.BigEndian.AppendUint16(data, uint16(idLength))
+		data = append(data, id...)
+		return append(data, rest...)
+	}
+	extensionFlag := func(data []byte) []byte {
+		data = append([]byte{}, data...)
+		data[32] |= WebAuthnFlagExtensionData
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", valid[:36]},
+		{"attested data too short", append(append([]byte{}, header...), make([]byte, 17)...)},
+		{"credential ID longer than data", withCredentialID(64, make([]byte, 32), nil)},
+		{"credential ID too long", withCredentialID(1024, make([]byte, 1024), a.cose)},
+		{"public key missing", withCredentialID(32, a.credID, nil)},
+		{"public key truncated", withCredentialID(32, a.credID, a.cose[:len(a.cose)-1])},
+		{"public key oversized length", withCredentialID(32, a.credID, []byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})},
+		{"public key nested too deep", withCredentialID(32, a.credID, append(bytes.Repeat([]byte{0x81}, cborMaxDepth+1), 0x00))},
+		{"trailing data", append(append([]byte{}, valid...), 0x00)},
+		{"extension flag without extensions", extensionFlag(valid)},
+		{"extensions nested too deep", append(extensionFlag(valid), append(bytes.Repeat([]byte{0xa1, 0x00}, cborMaxDepth+1), 0x00)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseWebAuthnAuthenticatorData(tt.data); err == nil {
+				t.Fatal("ParseWebAuthnAuthenticatorData() succeeded, want error")
+			}
+		})
+	}
+
+	// 带扩展数据的认证器数据可以正常解析
+	withExtensions := append(extensionFlag(valid), cborMap(cborText("credProtect"), cborInt(2))...)
+	if _, err := ParseWebAuthnAuthenticatorData(withExtensions); err != nil {
+		t.Fatalf("ParseWebAuthnAuthenticatorData() with extensions error = %v", err)
+	}
+}
+
+func TestParseCOSEKeyRejects(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := key.X.FillBytes(make([]byte, 32))
+	y := key.Y.FillBytes(make([]byte, 32))
+	offCurve := append([]byte{}, y...)
+	offCurve[31] ^= 0x01
+
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"empty", nil},
+		{"not a map", cborArray(cborInt(1))},
+		{"trailing data", append(coseES256Key(&key.PublicKey), 0x00)},
+		{"unsupported algorithm", cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(-35))},
+		{"ES256 wrong key type", cborMap(cborInt(1), cborInt(1), cborInt(3), cborInt(COSEAlgES256),
+			cborInt(-1), cborInt(1), cborInt(-2), cborBytes(x), cborInt(-3), cborBytes(y))},
+		{"ES256 wrong curve", cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(COSEAlgES256),
+			cborInt(-1), cborInt(2), cborInt(-2), cborBytes(x), cborInt(-3), cborBytes(y))},
+		{"ES256 short coordinate", cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(COSEAlgES256),
+			cborInt(-1), cborInt(1), cborInt(-2), cborBytes(x[:31]), cborInt(-3), cborBytes(y))},
+		{"ES256 point not on curve", cborMap(cborInt(1), cborInt(2), cborInt(3), cborInt(COSEAlgES256),
+			cborInt(-1), cborInt(1), cborInt(-2), cborBytes(x), cborInt(-3), cborBytes(offCurve))},
+		{"EdDSA wrong curve", cborMap(cborInt(1), cborInt(1), cborInt(3), cborInt(COSEAlgEdDSA),
+			cborInt(-1), cborInt(5), cborInt(-2), cborBytes(make([]byte, 32)))},
+		{"RS256 short modulus", cborMap(cborInt(1), cborInt(3), cborInt(3), cborInt(COSEAlgRS256),
+			cborInt(-1), cborBytes(make([]byte, 128)), cborInt(-2), cborBytes([]byte{1, 0, 1}))},
+		{"RS256 oversized exponent", cborMap(cborInt(1), cborInt(3), cborInt(3), cborInt(COSEAlgRS256),
+			cborInt(-1), cborBytes(make([]byte, 256)), cborInt(-2), cborBytes(make([]byte, 8)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseCOSEKey(tt.raw); err == nil {
+				t.Fatal("ParseCOSEKey() succeeded, want error")
+			}
+		})
+	}
+}